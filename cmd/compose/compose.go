@@ -236,6 +236,30 @@ func (o *ProjectOptions) addProjectFlags(f *pflag.FlagSet) {
 	_ = f.MarkHidden("workdir")
 }
 
+// profilesValue is a --profile flag adding its profiles to the ones already enabled
+type profilesValue struct {
+	profiles *[]string
+}
+
+func (v profilesValue) String() string {
+	return "[" + strings.Join(*v.profiles, ",") + "]"
+}
+
+func (v profilesValue) Set(profile string) error {
+	*v.profiles = append(*v.profiles, profile)
+	return nil
+}
+
+func (v profilesValue) Type() string {
+	return "stringArray"
+}
+
+// addProfileFlag adds --profile to a subcommand, enabling profiles in addition to the ones set with
+// --profile before the subcommand name. COMPOSE_PROFILES only applies when neither is set.
+func (o *ProjectOptions) addProfileFlag(f *pflag.FlagSet) {
+	f.Var(profilesValue{profiles: &o.Profiles}, "profile", "Specify a profile to enable (adds to the ones set before the command, overrides COMPOSE_PROFILES)")
+}
+
 // get default value for a command line flag that is set by a coma-separated value in environment variable
 func defaultStringArrayVar(env string) []string {
 	return strings.FieldsFunc(os.Getenv(env), func(c rune) bool {
@@ -361,6 +385,29 @@ func (o *ProjectOptions) ToProject(ctx context.Context, dockerCli command.Cli, b
 	return project, metrics, nil
 }
 
+// SelectServices implements the service selection shared by the monitor, perf, test, sync and
+// scale commands, returning the services to load the project with: the services given as
+// arguments, or nil for all the services when none are given. all selects all the services,
+// ignoring the arguments.
+func (o *ProjectOptions) SelectServices(args []string, all bool) []string {
+	if all {
+		if len(args) > 0 {
+			logrus.Warnf("--all selects all the services, ignoring %s", strings.Join(args, ", "))
+		}
+		return nil
+	}
+	return args
+}
+
+// ResolveServices returns the names of the services selected by SelectServices once the project
+// is loaded, all the services of the project for an empty selection
+func (o *ProjectOptions) ResolveServices(project *types.Project, selection []string) []string {
+	if len(selection) > 0 {
+		return selection
+	}
+	return project.ServiceNames()
+}
+
 func (o *ProjectOptions) remoteLoaders(dockerCli command.Cli) []loader.ResourceLoader {
 	if o.Offline {
 		return nil
@@ -640,9 +687,11 @@ func RootCommand(dockerCli command.Cli, backendOptions *BackendOptions) *cobra.C
 		syncCommand(&opts, dockerCli, backendOptions),
 		perfCommand(&opts, dockerCli, backendOptions),
 		shareCommand(&opts, dockerCli, backendOptions),
+		statusCommand(&opts, dockerCli, backendOptions),
 		alphaCommand(&opts, dockerCli, backendOptions),
 		bridgeCommand(&opts, dockerCli),
 		volumesCommand(&opts, dockerCli, backendOptions),
+		doctorCommand(dockerCli),
 	)
 
 	c.Flags().SetInterspersed(false)
@@ -17,10 +17,15 @@
 package compose
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
-	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/spf13/cobra"
 	"gotest.tools/v3/assert"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/pkg/compose"
 )
 
 func TestFilterServices(t *testing.T) {
@@ -53,3 +58,86 @@ func TestFilterServices(t *testing.T) {
 	_, err = p.GetService("zot")
 	assert.NilError(t, err)
 }
+
+func TestSelectServices(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services{
+			"web": {Name: "web"},
+			"db":  {Name: "db"},
+		},
+	}
+	opts := &ProjectOptions{}
+	testCases := []struct {
+		name     string
+		args     []string
+		all      bool
+		selected []string
+		resolved []string
+	}{
+		{name: "no arguments selects all services", resolved: []string{"db", "web"}},
+		{name: "arguments select those services", args: []string{"web"}, selected: []string{"web"}, resolved: []string{"web"}},
+		{name: "all selects all services", all: true, resolved: []string{"db", "web"}},
+		{name: "all ignores arguments", args: []string{"web"}, all: true, resolved: []string{"db", "web"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			selection := opts.SelectServices(tc.args, tc.all)
+			assert.DeepEqual(t, selection, tc.selected)
+			assert.DeepEqual(t, opts.ResolveServices(project, selection), tc.resolved)
+		})
+	}
+}
+
+func TestSubcommandProfiles(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte(`services:
+  web:
+    image: nginx
+  debug:
+    image: busybox
+    profiles: [debug]
+  worker:
+    image: busybox
+    profiles: [jobs]
+`), 0o644))
+
+	backend, err := compose.NewComposeService(nil)
+	assert.NilError(t, err)
+	commands := map[string]func(p *ProjectOptions) *cobra.Command{
+		"deploy":   func(p *ProjectOptions) *cobra.Command { return deployCommand(p, nil, &BackendOptions{}) },
+		"rollback": func(p *ProjectOptions) *cobra.Command { return rollbackCommand(p, nil, &BackendOptions{}) },
+		"quick":    func(p *ProjectOptions) *cobra.Command { return quickCommand(p, nil, &BackendOptions{}) },
+	}
+	tests := []struct {
+		name     string
+		env      string
+		root     []string
+		args     []string
+		services []string
+		expected []string
+	}{
+		{name: "no profile", expected: []string{"web"}},
+		{name: "COMPOSE_PROFILES", env: "jobs", expected: []string{"web", "worker"}},
+		{name: "command flag", args: []string{"--profile", "debug"}, expected: []string{"debug", "web"}},
+		{name: "flag overrides COMPOSE_PROFILES", env: "jobs", args: []string{"--profile", "debug"}, expected: []string{"debug", "web"}},
+		{name: "root and command flags add up", root: []string{"--profile", "jobs"}, args: []string{"--profile", "debug"}, expected: []string{"debug", "web", "worker"}},
+		{name: "named service", services: []string{"worker"}, expected: []string{"worker"}},
+	}
+	for command, newCommand := range commands {
+		for _, tt := range tests {
+			t.Run(command+"/"+tt.name, func(t *testing.T) {
+				t.Setenv("COMPOSE_PROFILES", tt.env)
+				p := &ProjectOptions{}
+				root := &cobra.Command{}
+				p.addProjectFlags(root.Flags())
+				assert.NilError(t, root.ParseFlags(append([]string{"--project-directory", dir}, tt.root...)))
+				p.Offline = true
+				assert.NilError(t, newCommand(p).ParseFlags(tt.args))
+
+				project, _, err := p.ToProject(t.Context(), nil, backend, tt.services)
+				assert.NilError(t, err)
+				assert.DeepEqual(t, project.ServiceNames(), tt.expected)
+			})
+		}
+	}
+}
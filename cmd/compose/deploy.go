@@ -17,18 +17,44 @@
 package compose
 
 import (
+	"bytes"
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
+	"os/user"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/containerd/errdefs"
+	"github.com/distribution/reference"
 	"github.com/docker/cli/cli/command"
+	"github.com/docker/docker/api/types/container"
+	registrytypes "github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
+	"github.com/compose-spec/compose-go/v2/cli"
 	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/cmd/prompt"
+	"github.com/docker/compose/v5/internal/bundle"
+	"github.com/docker/compose/v5/internal/registry"
 	"github.com/docker/compose/v5/pkg/api"
 	"github.com/docker/compose/v5/pkg/compose"
+	"github.com/docker/compose/v5/pkg/extensions"
 )
 
 type deployOptions struct {
@@ -41,8 +67,40 @@ type deployOptions struct {
 	ci         bool
 	rollback   bool
 	rollbackTo string
+	registry   string
+
+	requireApproval bool
+	approvalToken   string
+
+	notify   string
+	notifyOn string
+
+	failOnDrift bool
+	force       bool
+
+	preDeploy             string
+	postDeploy            string
+	hookIn                string
+	rollbackOnHookFailure bool
+	rollbackOnFailure     bool
+
+	maxParallel  int
+	smokeTimeout time.Duration
+
+	manifestDir  string
+	showManifest string
+
+	fromArchive string
+
+	maintenanceService string
 }
 
+// errDeployDegraded reports a deployment which rolled out but whose post-deploy hook failed
+var errDeployDegraded = errors.New("deployment degraded")
+
+// deployApprovalTokenEnv holds the token accepted by --approval-token
+const deployApprovalTokenEnv = "COMPOSE_DEPLOY_APPROVAL_TOKEN"
+
 func deployCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *BackendOptions) *cobra.Command {
 	opts := deployOptions{
 		ProjectOptions: p,
@@ -50,6 +108,8 @@ func deployCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *Bac
 		build:          true,
 		push:           false,
 		strategy:       "rolling",
+		notifyOn:       "always",
+		maxParallel:    1,
 	}
 
 	cmd := &cobra.Command{
@@ -63,6 +123,83 @@ This command supports:
 3. Deployment strategies (rolling/blue-green)
 4. CI/CD integration
 5. Rollback to previous versions
+
+With --require-approval, the deployment plan is displayed and the deployment only
+proceeds once the project name is typed to confirm, or with an --approval-token
+matching the COMPOSE_DEPLOY_APPROVAL_TOKEN environment variable. Non-interactive
+sessions must use the token.
+
+With --notify, a JSON summary of the deployment (project, environment, strategy,
+status, service states, duration and version) is posted to the given webhook URL
+once the deployment succeeds or fails. Notifications are best-effort and never
+fail the deployment.
+
+With --fail-on-drift, the running containers are compared with the latest recorded
+deployment and the deployment is aborted if a service was changed out-of-band
+(different image or configuration), unless --force is set.
+
+Hooks run around the rollout, from --pre-deploy and --post-deploy or from x-deploy.hooks
+(pre, post). They run on the host from the project directory, or in a one-off container
+of the service given with --hook-in. A failing pre-deploy hook aborts the deployment, a
+failing post-deploy hook marks it degraded, and rolls back to the previous version with
+--rollback-on-hook-failure.
+
+The rolling strategy updates services following depends_on: the containers of a service are
+recreated with the current image and configuration as soon as its dependencies are running
+(or healthy) again, up to --max-parallel services at a time (also accepted as --parallelism or
+--max-unavailable: the containers of a service are replaced while it is updated, so this is as
+well the number of services unavailable at the same time).
+
+With --rollback-on-failure, a failed rollout is recorded in the history and the services
+are rolled back to the latest deployed version.
+
+Once rolled out, the smoke checks declared by services in x-deploy.smoke are probed through
+their published port, e.g.:
+
+  x-deploy:
+    smoke:
+      - path: /health
+        status: 200
+      - path: /api/orders
+        port: 8080
+
+A check passes when the response has the expected status (200 by default) before
+--smoke-timeout. A failing check fails the deployment, and rolls it back with
+--rollback-on-failure.
+
+Each recorded deployment is described by a manifest, deploy-<timestamp>.json, kept along with
+the version history and also written to --manifest-dir if set: the version, environment,
+strategy, git commit of the project directory, the image and its digest per service, and the
+published endpoints. --show-manifest prints a past manifest, by ID or by version.
+
+--from-archive deploys an archive written by "share --method archive" or "env --export":
+it is extracted to a temporary directory, removed afterwards, and its files are verified
+against the checksums of its manifest before anything is deployed. The project is named
+after the archived project or environment unless --project-name is set. When the archive
+holds a compose.lock.json lockfile, the services are deployed with the image digests it
+pins. "share --method archive" and "env --export" write it with the repository digests of
+the local images of the services, unless the project already has one. Its format is the
+"services" section of a deployment manifest, so a manifest written with --manifest-dir can
+be shipped as the lockfile:
+
+  {"services": {"web": {"image": "shop/web:1.2", "digest": "shop/web@sha256:..."}}}
+
+With --maintenance-service, the blue-green cutover is covered by a maintenance service: it is
+started before the services are stopped, and removed once they are running (or healthy) again,
+whether the deployment succeeded or not. It is a service of the project, typically kept out of
+"up" with a profile, or, when no such service is declared, an nginx container answering every
+request with a 503 maintenance page, attached to the networks of the project. The proxy in front
+of the services is expected to fall back to it, e.g. with nginx:
+
+  upstream web {
+    server web:80;
+    server maintenance:80 backup;
+  }
+
+Services of a profile are only deployed when the profile is enabled, with --profile before or
+after the command name (both add up) or, when no --profile is given, with COMPOSE_PROFILES
+from the environment or the .env file. Services named as arguments are enabled whatever their
+profile.
 `,
 		RunE: Adapt(func(ctx context.Context, args []string) error {
 			opts.services = args
@@ -70,6 +207,7 @@ This command supports:
 		}),
 	}
 
+	opts.addProfileFlag(cmd.Flags())
 	cmd.Flags().StringVar(&opts.env, "env", "dev", "Environment to deploy to (dev/test/prod)")
 	cmd.Flags().BoolVar(&opts.build, "no-build", false, "Skip build step")
 	cmd.Flags().BoolVar(&opts.push, "push", false, "Push images to registry")
@@ -77,17 +215,67 @@ This command supports:
 	cmd.Flags().BoolVar(&opts.ci, "ci", false, "CI mode for integration with CI/CD pipelines")
 	cmd.Flags().BoolVar(&opts.rollback, "rollback", false, "Rollback to previous version")
 	cmd.Flags().StringVar(&opts.rollbackTo, "rollback-to", "", "Rollback to specific version")
+	cmd.Flags().StringVar(&opts.registry, "registry", "", "Registry to push images to (overrides x-deploy.registry)")
+	cmd.Flags().BoolVar(&opts.requireApproval, "require-approval", false, "Require an explicit approval of the deployment plan before deploying")
+	cmd.Flags().StringVar(&opts.approvalToken, "approval-token", "", "Token approving the deployment, required in non-interactive sessions")
+	cmd.Flags().StringVar(&opts.notify, "notify", "", "Webhook URL to POST a deployment summary to")
+	cmd.Flags().StringVar(&opts.notifyOn, "notify-on", "always", "When to send the notification (always, success, failure)")
+	cmd.Flags().BoolVar(&opts.failOnDrift, "fail-on-drift", false, "Abort if running services differ from the latest recorded deployment")
+	cmd.Flags().BoolVar(&opts.force, "force", false, "Deploy even if drift is detected")
+	cmd.Flags().StringVar(&opts.preDeploy, "pre-deploy", "", "Command to run before rolling out the services (overrides x-deploy.hooks.pre)")
+	cmd.Flags().StringVar(&opts.postDeploy, "post-deploy", "", "Command to run once the services are rolled out (overrides x-deploy.hooks.post)")
+	cmd.Flags().StringVar(&opts.hookIn, "hook-in", "", "Run the hooks in a one-off container of this service instead of on the host")
+	cmd.Flags().BoolVar(&opts.rollbackOnHookFailure, "rollback-on-hook-failure", false, "Roll back to the previous version when the post-deploy hook fails")
+	cmd.Flags().BoolVar(&opts.rollbackOnFailure, "rollback-on-failure", false, "Roll back to the latest deployed version when the deployment strategy fails")
+	cmd.Flags().IntVar(&opts.maxParallel, "max-parallel", 1, "Maximum number of services updated in parallel by the rolling strategy")
+	cmd.Flags().StringVar(&opts.manifestDir, "manifest-dir", "", "Directory to also write the deployment manifest to")
+	cmd.Flags().StringVar(&opts.fromArchive, "from-archive", "", "Deploy the project of a share or env archive, pinned to the digests of its lockfile")
+	cmd.Flags().StringVar(&opts.showManifest, "show-manifest", "", "Print the manifest of a past deployment, by ID (deploy-<timestamp>) or version")
+	cmd.Flags().StringVar(&opts.maintenanceService, "maintenance-service", "", "Service serving a maintenance page during the blue-green cutover")
+	cmd.Flags().DurationVar(&opts.smokeTimeout, "smoke-timeout", 30*time.Second, "How long the x-deploy.smoke checks are retried until they get the expected status")
+	cmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "parallelism" || name == "max-unavailable" {
+			name = "max-parallel"
+		}
+		return pflag.NormalizedName(name)
+	})
 	return cmd
 }
 
 func runDeploy(ctx context.Context, dockerCli command.Cli, backendOptions *BackendOptions, opts *deployOptions) error {
+	switch opts.notifyOn {
+	case "always", "success", "failure":
+	default:
+		return fmt.Errorf("invalid --notify-on value %q, must be one of always, success or failure", opts.notifyOn)
+	}
+	if opts.maxParallel < 1 {
+		return fmt.Errorf("--max-parallel must be at least 1, got %d", opts.maxParallel)
+	}
+
 	backend, err := compose.NewComposeService(dockerCli, backendOptions.Options...)
 	if err != nil {
 		return err
 	}
 
+	if opts.fromArchive != "" {
+		dir, err := os.MkdirTemp("", "compose-deploy-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir) //nolint:errcheck
+		manifest, err := extractDeployArchive(opts.fromArchive, dir, opts.ProjectOptions)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Deploying %s %q from %s (%d files verified)\n", manifest.Kind, manifest.Name, opts.fromArchive, len(manifest.Files))
+	}
+
 	// Load environment-specific compose file if exists
 	envConfigPath := getEnvConfigPath(opts.ConfigPaths, opts.env)
+	// an archive is deployed with its own files only
+	if opts.fromArchive != "" && filepath.Dir(envConfigPath) != opts.ProjectDir {
+		envConfigPath = ""
+	}
 	if envConfigPath != "" {
 		opts.ConfigPaths = []string{envConfigPath}
 		fmt.Printf("Using environment-specific config: %s\n", envConfigPath)
@@ -97,55 +285,175 @@ func runDeploy(ctx context.Context, dockerCli command.Cli, backendOptions *Backe
 	if err != nil {
 		return err
 	}
+	if opts.fromArchive != "" {
+		pinned, err := applyDeployLock(project, project.WorkingDir)
+		if err != nil {
+			return err
+		}
+		for _, service := range pinned {
+			fmt.Printf("Pinned %s to %s\n", service, project.Services[service].Image)
+		}
+	}
+
+	if opts.showManifest != "" {
+		return showDeployManifest(os.Stdout, project.Name, opts.showManifest)
+	}
 
 	// Handle rollback
 	if opts.rollback {
 		return runRollback(ctx, dockerCli, backend, project, project.Name, opts.rollbackTo)
 	}
 
+	if opts.hookIn != "" {
+		if _, err := project.GetService(opts.hookIn); err != nil {
+			return fmt.Errorf("invalid --hook-in: %w", err)
+		}
+	}
+
+	start := time.Now()
+	outcome, err := deployProject(ctx, dockerCli, backend, project, opts)
+	if opts.notify != "" && shouldNotifyDeploy(opts.notifyOn, err) {
+		notification := newDeployNotification(ctx, backend, project, opts, outcome, time.Since(start), err)
+		if notifyErr := sendDeployNotification(ctx, opts.notify, notification); notifyErr != nil {
+			_, _ = fmt.Fprintf(dockerCli.Err(), "Warning: failed to send deployment notification: %v\n", notifyErr)
+		}
+	}
+	return err
+}
+
+// deployOutcome is what a deployment produced, reported by --notify
+type deployOutcome struct {
+	Version string
+	Hooks   []deployHookResult
+	Smoke   []deploySmokeResult
+}
+
+// deployProject runs the build, push and deploy steps, along with the deployment hooks
+func deployProject(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, opts *deployOptions) (deployOutcome, error) {
+	var (
+		outcome deployOutcome
+		err     error
+	)
+
+	if opts.maintenanceService != "" && opts.strategy != "blue-green" {
+		return outcome, fmt.Errorf("--maintenance-service requires --strategy blue-green")
+	}
+
 	// CI mode setup
 	if opts.ci {
 		fmt.Println("Running in CI mode...")
 		// CI-specific setup here
 	}
 
+	// Resolve the target registry and check it before spending time building
+	targetRegistry := opts.registry
+	if targetRegistry == "" {
+		targetRegistry = getDeployExtensionString(project, "registry")
+	}
+	if opts.push && targetRegistry != "" {
+		if err := checkRegistryAccess(ctx, dockerCli, targetRegistry); err != nil {
+			return outcome, err
+		}
+	}
+
+	if opts.failOnDrift {
+		if err := checkDeployDrift(ctx, backend, project, opts.force); err != nil {
+			return outcome, err
+		}
+	}
+
+	approvedBy := ""
+	if opts.requireApproval {
+		printDeployPlan(project, opts, targetRegistry)
+		if approvedBy, err = approveDeploy(dockerCli, project.Name, opts.approvalToken); err != nil {
+			return outcome, err
+		}
+		fmt.Printf("Deployment approved by %s\n", approvedBy)
+	}
+
 	// Step 1: Build images if needed
 	if opts.build {
 		fmt.Println("Building services...")
 		if err := backend.Build(ctx, project, api.BuildOptions{}); err != nil {
-			return err
+			return outcome, err
 		}
 	}
 
 	// Step 2: Push images if needed
 	if opts.push {
+		var pushed []string
+		if targetRegistry != "" {
+			fmt.Printf("Tagging images for registry %s...\n", targetRegistry)
+			if pushed, err = retagForRegistry(ctx, dockerCli, project, targetRegistry); err != nil {
+				return outcome, err
+			}
+		}
 		fmt.Println("Pushing images to registry...")
 		if err := backend.Push(ctx, project, api.PushOptions{}); err != nil {
-			return err
+			return outcome, err
+		}
+		for _, ref := range pushed {
+			fmt.Printf("Pushed %s\n", ref)
+		}
+	}
+
+	pre, post := deployHooks(project, opts)
+	if pre != "" {
+		result := runDeployHook(ctx, dockerCli, backend, project, opts, "pre-deploy", pre)
+		outcome.Hooks = append(outcome.Hooks, result)
+		if result.Error != "" {
+			return outcome, fmt.Errorf("pre-deploy hook failed, deployment aborted: %s", result.Error)
 		}
 	}
 
 	// Step 3: Deploy services based on strategy
 	fmt.Printf("Deploying to %s environment with %s strategy...\n", opts.env, opts.strategy)
 
+	var strategyErr error
 	switch opts.strategy {
 	case "rolling":
-		if err := runRollingDeploy(ctx, backend, project); err != nil {
-			return err
-		}
+		strategyErr = extensions.RollingDeploy(ctx, backend, project, extensions.RollingDeployOptions{
+			MaxParallel: opts.maxParallel,
+			Out:         os.Stdout,
+		})
 	case "blue-green":
-		if err := runBlueGreenDeploy(ctx, backend, project, project.Name); err != nil {
-			return err
-		}
+		strategyErr = runBlueGreenDeploy(ctx, backend, project, opts.maintenanceService)
 	default:
-		return fmt.Errorf("unsupported deployment strategy: %s", opts.strategy)
+		return outcome, fmt.Errorf("unsupported deployment strategy: %s", opts.strategy)
+	}
+	if strategyErr == nil {
+		strategyErr = runDeploySmokeChecks(ctx, project, opts, &outcome)
+	}
+	if strategyErr != nil {
+		if !opts.rollbackOnFailure {
+			return outcome, strategyErr
+		}
+		return outcome, rollbackFailedDeploy(ctx, backend, project, opts, approvedBy, strategyErr, &outcome)
+	}
+
+	hookFailure := ""
+	if post != "" {
+		result := runDeployHook(ctx, dockerCli, backend, project, opts, "post-deploy", post)
+		outcome.Hooks = append(outcome.Hooks, result)
+		hookFailure = result.Error
+	}
+	if hookFailure != "" && opts.rollbackOnHookFailure {
+		fmt.Printf("Post-deploy hook failed: %s\n", hookFailure)
+		version, err := rollbackToLatestVersion(ctx, backend, project, "after post-deploy hook failure")
+		if err != nil {
+			return outcome, fmt.Errorf("post-deploy hook failed (%s) and rollback failed: %w", hookFailure, err)
+		}
+		return outcome, fmt.Errorf("post-deploy hook failed, rolled back to version %s: %s", version, hookFailure)
+	}
+	if hookFailure != "" {
+		fmt.Printf("Warning: post-deploy hook failed, deployment is degraded: %s\n", hookFailure)
 	}
 
 	// Step 4: Show deployment status
 	fmt.Println("\nDeployment status:")
 	containers, err := backend.Ps(ctx, project.Name, api.PsOptions{})
 	if err != nil {
-		return err
+		return outcome, err
 	}
 
 	for _, container := range containers {
@@ -163,8 +471,270 @@ func runDeploy(ctx context.Context, dockerCli command.Cli, backendOptions *Backe
 		}
 	}
 
+	description := fmt.Sprintf("Deployed to %s", opts.env)
+	if hookFailure != "" {
+		description += " (degraded)"
+	}
+	version, err := extensions.DefaultHistoryStore().Record(project, description, approvedBy, containers)
+	if err != nil {
+		fmt.Printf("Warning: Failed to record version history: %v\n", err)
+	} else {
+		fmt.Printf("\nRecorded version: %s\n", version.Version)
+		outcome.Version = version.Version
+		manifest := newDeployManifest(ctx, dockerCli, project, opts, version, containers)
+		if files, err := writeDeployManifest(manifest, opts.manifestDir); err != nil {
+			fmt.Printf("Warning: Failed to write deployment manifest: %v\n", err)
+		} else {
+			fmt.Printf("Deployment manifest: %s\n", strings.Join(files, ", "))
+		}
+	}
+
+	if hookFailure != "" {
+		return outcome, fmt.Errorf("%w: post-deploy hook failed: %s", errDeployDegraded, hookFailure)
+	}
 	fmt.Printf("\nDeployment to %s environment completed successfully!\n", opts.env)
-	return nil
+	return outcome, nil
+}
+
+// deployManifest records exactly what a deployment rolled out
+type deployManifest struct {
+	ID          string                           `json:"id"`
+	Project     string                           `json:"project"`
+	Version     string                           `json:"version"`
+	Description string                           `json:"description"`
+	Timestamp   time.Time                        `json:"timestamp"`
+	Env         string                           `json:"env"`
+	Strategy    string                           `json:"strategy"`
+	GitSHA      string                           `json:"git_sha,omitempty"`
+	ApprovedBy  string                           `json:"approved_by,omitempty"`
+	Services    map[string]deployManifestService `json:"services"`
+	Endpoints   []deployManifestEndpoint         `json:"endpoints,omitempty"`
+}
+
+type deployManifestService struct {
+	Image string `json:"image"`
+	// Digest is the repository digest of the image, its ID for an image never pushed nor pulled
+	Digest string `json:"digest,omitempty"`
+}
+
+type deployManifestEndpoint struct {
+	Service   string `json:"service"`
+	HostIP    string `json:"host_ip,omitempty"`
+	Published string `json:"published"`
+	Target    uint32 `json:"target"`
+	Protocol  string `json:"protocol"`
+}
+
+// deployManifestTimeLayout names the manifests after their deployment time, in UTC, precise
+// enough for deployments in the same second not to collide
+const deployManifestTimeLayout = "20060102T150405.000000000Z"
+
+// deployManifestDir is where the manifests of a project are kept, along with the version history
+func deployManifestDir(projectName string) string {
+	return filepath.Join(extensions.DefaultHistoryStore().Dir, "manifests", projectName)
+}
+
+// newDeployManifest describes the recorded version, resolving the digests of the images run by the containers
+func newDeployManifest(ctx context.Context, dockerCli command.Cli, project *types.Project, opts *deployOptions, version *extensions.VersionInfo, containers []api.ContainerSummary) deployManifest {
+	now := time.Now().UTC()
+	manifest := deployManifest{
+		ID:          "deploy-" + now.Format(deployManifestTimeLayout),
+		Project:     project.Name,
+		Version:     version.Version,
+		Description: version.Description,
+		Timestamp:   now,
+		Env:         opts.env,
+		Strategy:    opts.strategy,
+		GitSHA:      deployGitSHA(ctx, project.WorkingDir),
+		ApprovedBy:  version.ApprovedBy,
+		Services:    map[string]deployManifestService{},
+	}
+	digests := map[string]string{}
+	for _, c := range containers {
+		if _, ok := project.Services[c.Service]; !ok {
+			continue
+		}
+		if _, ok := digests[c.Image]; !ok {
+			digests[c.Image] = resolveImageDigest(ctx, dockerCli.Client(), c.Image)
+		}
+		manifest.Services[c.Service] = deployManifestService{Image: c.Image, Digest: digests[c.Image]}
+	}
+	for _, name := range project.ServiceNames() {
+		if _, ok := manifest.Services[name]; !ok {
+			manifest.Services[name] = deployManifestService{Image: api.GetImageNameOrDefault(project.Services[name], project.Name)}
+		}
+		for _, port := range project.Services[name].Ports {
+			manifest.Endpoints = append(manifest.Endpoints, deployManifestEndpoint{
+				Service:   name,
+				HostIP:    port.HostIP,
+				Published: port.Published,
+				Target:    port.Target,
+				Protocol:  port.Protocol,
+			})
+		}
+	}
+	return manifest
+}
+
+// resolveImageDigest returns the repository digest of a local image, its ID for an image never
+// pushed nor pulled, empty when there is no such image
+func resolveImageDigest(ctx context.Context, apiClient client.APIClient, image string) string {
+	inspect, err := apiClient.ImageInspect(ctx, image)
+	if err != nil {
+		return ""
+	}
+	if len(inspect.RepoDigests) > 0 {
+		return inspect.RepoDigests[0]
+	}
+	return inspect.ID
+}
+
+// deployGitSHA returns the commit checked out in the project directory, empty outside of a git repository
+func deployGitSHA(ctx context.Context, dir string) string {
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// writeDeployManifest stores the manifest with the version history and in extraDir, if set
+func writeDeployManifest(manifest deployManifest, extraDir string) ([]string, error) {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	dirs := []string{deployManifestDir(manifest.Project)}
+	if extraDir != "" {
+		dirs = append(dirs, extraDir)
+	}
+	var files []string
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return files, fmt.Errorf("failed to create manifest directory: %v", err)
+		}
+		file := filepath.Join(dir, manifest.ID+".json")
+		if err := os.WriteFile(file, append(content, '\n'), 0o644); err != nil {
+			return files, fmt.Errorf("failed to write manifest: %v", err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// showDeployManifest prints the stored manifest with the given ID, or of the given version
+func showDeployManifest(w io.Writer, projectName, id string) error {
+	dir := deployManifestDir(projectName)
+	content, err := os.ReadFile(filepath.Join(dir, strings.TrimSuffix(id, ".json")+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		content, err = findDeployManifest(dir, id)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+// findDeployManifest returns the manifest of a version
+func findDeployManifest(dir, version string) ([]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read manifests: %v", err)
+	}
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var manifest deployManifest
+		if json.Unmarshal(content, &manifest) == nil && manifest.Version == version {
+			return content, nil
+		}
+	}
+	return nil, fmt.Errorf("no deployment manifest %s", version)
+}
+
+// deployLockFile is the lockfile of an archive, pinning the image digests of its services
+const deployLockFile = "compose.lock.json"
+
+// deployLock returns the content of the lockfile pinning the services of the project to the
+// repository digest of their local image, nil when none of them has one
+func deployLock(ctx context.Context, apiClient client.APIClient, project *types.Project) ([]byte, error) {
+	services := map[string]deployManifestService{}
+	for _, name := range project.ServiceNames() {
+		image := api.GetImageNameOrDefault(project.Services[name], project.Name)
+		if digest := resolveImageDigest(ctx, apiClient, image); strings.Contains(digest, "@sha256:") {
+			services[name] = deployManifestService{Image: image, Digest: digest}
+		}
+	}
+	if len(services) == 0 {
+		return nil, nil
+	}
+	content, err := json.MarshalIndent(map[string]any{"services": services}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
+
+// extractDeployArchive extracts and verifies an archive into dir, and points the project
+// options at its compose file
+func extractDeployArchive(archive, dir string, opts *ProjectOptions) (*bundle.Manifest, error) {
+	manifest, err := bundle.ReadFile(archive, dir)
+	if errors.Is(err, bundle.ErrNoManifest) {
+		return nil, fmt.Errorf("%s has no manifest, its content can't be verified", archive)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %s: %v", archive, err)
+	}
+	configFile := ""
+	for _, name := range cli.DefaultFileNames {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			configFile = filepath.Join(dir, name)
+			break
+		}
+	}
+	if configFile == "" {
+		return nil, fmt.Errorf("%s has no compose file", archive)
+	}
+	opts.ConfigPaths = []string{configFile}
+	opts.ProjectDir = dir
+	if opts.ProjectName == "" {
+		opts.ProjectName = manifest.Name
+	}
+	return manifest, nil
+}
+
+// applyDeployLock pins the services to the image digests of the lockfile in dir, if any. Digests
+// which are local image IDs can't be pulled and are ignored. It returns the pinned services.
+func applyDeployLock(project *types.Project, dir string) ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(dir, deployLockFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", deployLockFile, err)
+	}
+	var lock struct {
+		Services map[string]deployManifestService `json:"services"`
+	}
+	if err := json.Unmarshal(content, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", deployLockFile, err)
+	}
+	var pinned []string
+	for _, name := range project.ServiceNames() {
+		locked, ok := lock.Services[name]
+		if !ok || !strings.Contains(locked.Digest, "@sha256:") {
+			continue
+		}
+		service := project.Services[name]
+		service.Image = locked.Digest
+		service.Build = nil
+		project.Services[name] = service
+		pinned = append(pinned, name)
+	}
+	return pinned, nil
 }
 
 func getEnvConfigPath(configPaths []string, env string) string {
@@ -196,49 +766,726 @@ func getEnvConfigPath(configPaths []string, env string) string {
 	return ""
 }
 
-func runRollingDeploy(ctx context.Context, backend api.Compose, project *types.Project) error {
-	// Rolling deployment: stop and start services one by one
-	for _, service := range project.Services {
-		fmt.Printf("Deploying service: %s\n", service.Name)
+// printDeployPlan previews what the deployment is about to do
+func printDeployPlan(project *types.Project, opts *deployOptions, targetRegistry string) {
+	fmt.Println("Deployment plan:")
+	fmt.Printf("  Project:     %s\n", project.Name)
+	fmt.Printf("  Environment: %s\n", opts.env)
+	fmt.Printf("  Strategy:    %s\n", opts.strategy)
+	fmt.Printf("  Build:       %t\n", opts.build)
+	if opts.push {
+		target := "default registry"
+		if targetRegistry != "" {
+			target = targetRegistry
+		}
+		fmt.Printf("  Push:        %s\n", target)
+	}
+	fmt.Println("  Services:")
+	for _, name := range project.ServiceNames() {
+		fmt.Printf("    %s: %s\n", name, api.GetImageNameOrDefault(project.Services[name], project.Name))
+	}
+}
 
-		// Stop the service
-		if err := backend.Stop(ctx, project.Name, api.StopOptions{
-			Services: []string{service.Name},
-		}); err != nil {
-			fmt.Printf("Warning: Stop failed: %v\n", err)
-			// Continue even if stop fails
+// approveDeploy asks for the project name to be typed, or checks the approval token,
+// and returns a description of the approver to be recorded in the version history
+func approveDeploy(dockerCli command.Cli, projectName, token string) (string, error) {
+	if token != "" {
+		expected := os.Getenv(deployApprovalTokenEnv)
+		if expected == "" {
+			return "", fmt.Errorf("--approval-token requires %s to be set", deployApprovalTokenEnv)
 		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			return "", fmt.Errorf("deployment not approved: invalid approval token")
+		}
+		return "approval token", nil
+	}
 
-		// Start the service
-		if err := backend.Start(ctx, project.Name, api.StartOptions{
-			Services: []string{service.Name},
-		}); err != nil {
-			return err
+	if !dockerCli.In().IsTerminal() {
+		return "", fmt.Errorf("deployment requires approval: use --approval-token in non-interactive sessions")
+	}
+	answer, err := prompt.NewPrompt(dockerCli.In(), dockerCli.Out()).Input(fmt.Sprintf("Type the project name (%s) to approve the deployment:", projectName), "")
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(answer) != projectName {
+		return "", fmt.Errorf("deployment not approved: project name does not match")
+	}
+	approver := "interactive confirmation"
+	if u, err := user.Current(); err == nil {
+		approver = fmt.Sprintf("%s (interactive confirmation)", u.Username)
+	}
+	return approver, nil
+}
+
+// deployHookResult is the outcome of a deployment hook, with the tail of its output
+type deployHookResult struct {
+	Phase   string `json:"phase"`
+	Command string `json:"command"`
+	Service string `json:"service,omitempty"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// deployHookOutputLimit is the amount of hook output kept for the report
+const deployHookOutputLimit = 4096
+
+// deployHooks returns the pre and post deployment commands, flags taking precedence over x-deploy.hooks
+func deployHooks(project *types.Project, opts *deployOptions) (string, string) {
+	pre, post := opts.preDeploy, opts.postDeploy
+	xdeploy, _ := project.Extensions["x-deploy"].(map[string]any)
+	if hooks, ok := xdeploy["hooks"].(map[string]any); ok {
+		if v, ok := hooks["pre"].(string); ok && pre == "" {
+			pre = v
+		}
+		if v, ok := hooks["post"].(string); ok && post == "" {
+			post = v
+		}
+	}
+	return pre, post
+}
+
+// runDeployHook runs a hook command on the host, from the project directory, or in a one-off
+// container of the --hook-in service. The hook output is streamed and captured for the report.
+func runDeployHook(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, opts *deployOptions, phase, hook string) deployHookResult {
+	result := deployHookResult{Phase: phase, Command: hook, Service: opts.hookIn}
+	fmt.Printf("Running %s hook: %s\n", phase, hook)
+
+	if opts.hookIn != "" {
+		name := fmt.Sprintf("%s%s%s%shook%s%d", project.Name, api.Separator, opts.hookIn, api.Separator, api.Separator, time.Now().UnixNano())
+		exitCode, err := backend.RunOneOffContainer(ctx, project, api.RunOptions{
+			Project:     project,
+			Service:     opts.hookIn,
+			Name:        name,
+			Command:     []string{"/bin/sh", "-c", hook},
+			Environment: []string{"DEPLOY_ENV=" + opts.env},
+		})
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+		case exitCode != 0:
+			result.Error = fmt.Sprintf("exited with code %d", exitCode)
+		}
+		result.Output = tailString(deployHookContainerOutput(ctx, dockerCli, name), deployHookOutputLimit)
+		return result
+	}
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", hook)
+	cmd.Dir = project.WorkingDir
+	cmd.Env = append(os.Environ(), "COMPOSE_PROJECT_NAME="+project.Name, "DEPLOY_ENV="+opts.env)
+	cmd.Stdout = io.MultiWriter(dockerCli.Out(), &output)
+	cmd.Stderr = io.MultiWriter(dockerCli.Err(), &output)
+	if err := cmd.Run(); err != nil {
+		result.Error = err.Error()
+	}
+	result.Output = tailString(output.String(), deployHookOutputLimit)
+	return result
+}
+
+// deployHookContainerOutput reads the output of the one-off container a hook ran in, then removes
+// the container, even once the deployment was interrupted
+func deployHookContainerOutput(ctx context.Context, dockerCli command.Cli, name string) string {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	apiClient := dockerCli.Client()
+	defer func() {
+		if err := apiClient.ContainerRemove(ctx, name, container.RemoveOptions{Force: true}); err != nil && !errdefs.IsNotFound(err) {
+			fmt.Printf("Warning: Failed to remove hook container %s: %v\n", name, err)
 		}
+	}()
+
+	logs, err := apiClient.ContainerLogs(ctx, name, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return ""
 	}
+	defer func() { _ = logs.Close() }()
+	var output bytes.Buffer
+	_, _ = stdcopy.StdCopy(&output, &output, logs)
+	return output.String()
+}
 
+// deploySmokeCheck is an HTTP request expected to get a status from a service once deployed
+type deploySmokeCheck struct {
+	Service string
+	Path    string
+	// Port is the container port the check is sent to, 0 for the first published one
+	Port   uint32
+	Status int
+}
+
+// deploySmokeResult is the outcome of a smoke check
+type deploySmokeResult struct {
+	Service  string `json:"service"`
+	URL      string `json:"url"`
+	Expected int    `json:"expected"`
+	Status   int    `json:"status,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// deploySmokeChecks reads the x-deploy.smoke checks of the services. An entry is either a path,
+// expected to answer 200, or a mapping with path, status and port attributes.
+func deploySmokeChecks(project *types.Project) ([]deploySmokeCheck, error) {
+	var checks []deploySmokeCheck
+	for _, name := range project.ServiceNames() {
+		service := project.Services[name]
+		xdeploy, _ := service.Extensions["x-deploy"].(map[string]any)
+		entries, ok := xdeploy["smoke"].([]any)
+		if !ok {
+			continue
+		}
+		for _, entry := range entries {
+			check := deploySmokeCheck{Service: name, Status: http.StatusOK}
+			switch entry := entry.(type) {
+			case string:
+				check.Path = entry
+			case map[string]any:
+				check.Path, _ = entry["path"].(string)
+				if status, ok := entry["status"]; ok {
+					value, err := strconv.Atoi(fmt.Sprint(status))
+					if err != nil {
+						return nil, fmt.Errorf("invalid x-deploy.smoke status %v for service %s", status, name)
+					}
+					check.Status = value
+				}
+				if port, ok := entry["port"]; ok {
+					value, err := strconv.ParseUint(fmt.Sprint(port), 10, 32)
+					if err != nil {
+						return nil, fmt.Errorf("invalid x-deploy.smoke port %v for service %s", port, name)
+					}
+					check.Port = uint32(value)
+				}
+			default:
+				return nil, fmt.Errorf("invalid x-deploy.smoke entry for service %s: expected a path or a mapping", name)
+			}
+			if !strings.HasPrefix(check.Path, "/") {
+				return nil, fmt.Errorf("invalid x-deploy.smoke path %q for service %s: must start with /", check.Path, name)
+			}
+			checks = append(checks, check)
+		}
+	}
+	return checks, nil
+}
+
+// deploySmokeURL resolves the URL of a check from the published ports of the service
+func deploySmokeURL(service types.ServiceConfig, check deploySmokeCheck) (string, error) {
+	for _, port := range service.Ports {
+		if port.Published == "" || (check.Port != 0 && port.Target != check.Port) {
+			continue
+		}
+		host := port.HostIP
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "localhost"
+		}
+		return fmt.Sprintf("http://%s%s", net.JoinHostPort(host, port.Published), check.Path), nil
+	}
+	if check.Port != 0 {
+		return "", fmt.Errorf("port %d of service %s is not published", check.Port, service.Name)
+	}
+	return "", fmt.Errorf("service %s has no published port", service.Name)
+}
+
+// deploySmokePollInterval is the delay between two attempts of a failing smoke check
+const deploySmokePollInterval = time.Second
+
+// probeDeploySmokeCheck requests the URL until it answers the expected status or the timeout expires
+func probeDeploySmokeCheck(ctx context.Context, url string, expected int, timeout time.Duration) deploySmokeResult {
+	result := deploySmokeResult{URL: url, Expected: expected}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+			result.Status = resp.StatusCode
+			result.Error = ""
+			if resp.StatusCode == expected {
+				return result
+			}
+		} else if ctx.Err() == nil {
+			result.Error = err.Error()
+		}
+		select {
+		case <-ctx.Done():
+			if result.Status == 0 && result.Error == "" {
+				result.Error = ctx.Err().Error()
+			}
+			return result
+		case <-time.After(deploySmokePollInterval):
+		}
+	}
+}
+
+// runDeploySmokeChecks probes the x-deploy.smoke checks of the deployed services, reports them
+// as a matrix and fails if any check didn't get its expected status
+func runDeploySmokeChecks(ctx context.Context, project *types.Project, opts *deployOptions, outcome *deployOutcome) error {
+	checks, err := deploySmokeChecks(project)
+	if err != nil || len(checks) == 0 {
+		return err
+	}
+	fmt.Println("\nRunning smoke checks...")
+	failed := 0
+	for _, check := range checks {
+		result := deploySmokeResult{Service: check.Service, Expected: check.Status}
+		url, err := deploySmokeURL(project.Services[check.Service], check)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result = probeDeploySmokeCheck(ctx, url, check.Status, opts.smokeTimeout)
+			result.Service = check.Service
+		}
+		if result.Error != "" || result.Status != result.Expected {
+			failed++
+		}
+		outcome.Smoke = append(outcome.Smoke, result)
+	}
+	if err := printDeploySmokeResults(os.Stdout, outcome.Smoke); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d smoke check(s) failed", failed, len(checks))
+	}
 	return nil
 }
 
-func runBlueGreenDeploy(ctx context.Context, backend api.Compose, project *types.Project, projectName string) error {
+// printDeploySmokeResults renders the service × check results
+func printDeploySmokeResults(w io.Writer, results []deploySmokeResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SERVICE\tCHECK\tEXPECTED\tGOT\tRESULT")
+	for _, result := range results {
+		check := result.URL
+		if check == "" {
+			check = "-"
+		}
+		got := "-"
+		if result.Status != 0 {
+			got = strconv.Itoa(result.Status)
+		}
+		outcome := "ok"
+		switch {
+		case result.Error != "":
+			outcome = "FAIL: " + result.Error
+		case result.Status != result.Expected:
+			outcome = "FAIL"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", result.Service, check, result.Expected, got, outcome)
+	}
+	return tw.Flush()
+}
+
+func tailString(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[len(s)-limit:]
+}
+
+// rollbackToLatestVersion switches the services back to the images of the latest deployed version,
+// and records the rollback in the history
+func rollbackToLatestVersion(ctx context.Context, backend api.Compose, project *types.Project, reason string) (string, error) {
+	history, err := extensions.DefaultHistoryStore().Load(project.Name)
+	if err != nil {
+		return "", err
+	}
+	target := extensions.LatestDeployedVersion(history)
+	if target == nil {
+		return "", fmt.Errorf("no recorded version to roll back to")
+	}
+	containers, err := backend.Ps(ctx, project.Name, api.PsOptions{All: true})
+	if err != nil {
+		return "", err
+	}
+	plan, err := planServiceRollback(project, nil, target, containers)
+	if err != nil {
+		return "", err
+	}
+	if err := runRollingRollback(ctx, backend, project, plan, true); err != nil {
+		return "", err
+	}
+
+	containers, err = backend.Ps(ctx, project.Name, api.PsOptions{})
+	if err == nil {
+		_, err = extensions.DefaultHistoryStore().RecordRollback(project.Name, target, fmt.Sprintf("Rolled back to %s %s", target.Version, reason), containers)
+	}
+	if err != nil {
+		fmt.Printf("Warning: Failed to record the rollback in version history: %v\n", err)
+	}
+	return target.Version, nil
+}
+
+// rollbackFailedDeploy records a deployment whose strategy failed and rolls the services back to
+// the latest deployed version, returning an error describing both
+func rollbackFailedDeploy(ctx context.Context, backend api.Compose, project *types.Project, opts *deployOptions, approvedBy string, deployErr error, outcome *deployOutcome) error {
+	fmt.Printf("Deployment failed: %v\n", deployErr)
+	reason := "after failed deploy"
+	containers, err := backend.Ps(ctx, project.Name, api.PsOptions{All: true})
+	if err == nil {
+		var failed *extensions.VersionInfo
+		failed, err = extensions.DefaultHistoryStore().RecordFailure(project, fmt.Sprintf("Failed deploy to %s", opts.env), approvedBy, containers)
+		if err == nil {
+			fmt.Printf("Recorded failed version: %s\n", failed.Version)
+			outcome.Version = failed.Version
+			reason += " " + failed.Version
+		}
+	}
+	if err != nil {
+		fmt.Printf("Warning: Failed to record the failed deployment in version history: %v\n", err)
+	}
+
+	fmt.Println("Rolling back to the latest deployed version...")
+	version, err := rollbackToLatestVersion(ctx, backend, project, reason)
+	if err != nil {
+		return fmt.Errorf("deployment failed (%v) and rollback failed: %w", deployErr, err)
+	}
+	return fmt.Errorf("deployment failed, rolled back to version %s: %w", version, deployErr)
+}
+
+// serviceDrift describes how a running service differs from the latest recorded deployment
+type serviceDrift struct {
+	Service string
+	Reason  string
+}
+
+// checkDeployDrift compares the running containers with the latest recorded deployment and
+// fails when a service was changed out-of-band, unless force is set
+func checkDeployDrift(ctx context.Context, backend api.Compose, project *types.Project, force bool) error {
+	history, err := extensions.DefaultHistoryStore().Load(project.Name)
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 {
+		fmt.Println("No recorded deployment, skipping drift detection")
+		return nil
+	}
+	latest := extensions.LatestDeployedVersion(history)
+	if latest == nil {
+		fmt.Println("No successful deployment recorded, skipping drift detection")
+		return nil
+	}
+	containers, err := backend.Ps(ctx, project.Name, api.PsOptions{})
+	if err != nil {
+		return err
+	}
+	drifts := detectDeployDrift(latest, containers)
+	if len(drifts) == 0 {
+		fmt.Printf("No drift detected since version %s\n", latest.Version)
+		return nil
+	}
+	fmt.Printf("Drift detected since version %s:\n", latest.Version)
+	for _, drift := range drifts {
+		fmt.Printf("  %s: %s\n", drift.Service, drift.Reason)
+	}
+	if !force {
+		return fmt.Errorf("%d service(s) changed since version %s was deployed, use --force to deploy anyway", len(drifts), latest.Version)
+	}
+	fmt.Println("Deploying anyway (--force)")
+	return nil
+}
+
+// detectDeployDrift lists the services whose running containers use another image or
+// configuration than the one recorded for the version
+func detectDeployDrift(version *extensions.VersionInfo, containers []api.ContainerSummary) []serviceDrift {
+	reasons := map[string]string{}
+	for _, c := range containers {
+		image, ok := version.Services[c.Service]
+		if !ok || reasons[c.Service] != "" {
+			continue
+		}
+		if recordedID := version.ImageIDs[c.Service]; recordedID != "" && c.Labels[api.ImageDigestLabel] != "" {
+			if c.Labels[api.ImageDigestLabel] != recordedID {
+				reasons[c.Service] = fmt.Sprintf("running image %s (%s), recorded %s (%s)", c.Image, c.Labels[api.ImageDigestLabel], image, recordedID)
+				continue
+			}
+		} else if c.Image != image {
+			reasons[c.Service] = fmt.Sprintf("running image %s, recorded %s", c.Image, image)
+			continue
+		}
+		recorded := version.ConfigHashes[c.Service]
+		if recorded != "" && c.Labels[api.ConfigHashLabel] != recorded {
+			reasons[c.Service] = "configuration (environment, command, volumes...) differs from the recorded deployment"
+		}
+	}
+	var drifts []serviceDrift
+	for _, service := range slices.Sorted(maps.Keys(reasons)) {
+		drifts = append(drifts, serviceDrift{Service: service, Reason: reasons[service]})
+	}
+	return drifts
+}
+
+// deployNotification is the payload posted to the --notify webhook
+type deployNotification struct {
+	Project     string              `json:"project"`
+	Environment string              `json:"environment"`
+	Strategy    string              `json:"strategy"`
+	Status      string              `json:"status"`
+	Error       string              `json:"error,omitempty"`
+	Services    map[string]string   `json:"services"`
+	Duration    float64             `json:"duration_seconds"`
+	Version     string              `json:"version,omitempty"`
+	Hooks       []deployHookResult  `json:"hooks,omitempty"`
+	Smoke       []deploySmokeResult `json:"smoke,omitempty"`
+}
+
+func shouldNotifyDeploy(notifyOn string, deployErr error) bool {
+	switch notifyOn {
+	case "success":
+		return deployErr == nil
+	case "failure":
+		return deployErr != nil
+	default:
+		return true
+	}
+}
+
+// newDeployNotification describes the outcome of a deployment. ctx may already be cancelled, when
+// the deployment was interrupted or timed out.
+func newDeployNotification(ctx context.Context, backend api.Compose, project *types.Project, opts *deployOptions, outcome deployOutcome, duration time.Duration, deployErr error) deployNotification {
+	notification := deployNotification{
+		Project:     project.Name,
+		Environment: opts.env,
+		Strategy:    opts.strategy,
+		Status:      "success",
+		Services:    map[string]string{},
+		Duration:    duration.Seconds(),
+		Version:     outcome.Version,
+		Hooks:       outcome.Hooks,
+		Smoke:       outcome.Smoke,
+	}
+	if deployErr != nil {
+		notification.Status = "failure"
+		if errors.Is(deployErr, errDeployDegraded) {
+			notification.Status = "degraded"
+		}
+		notification.Error = deployErr.Error()
+	}
+	for _, name := range project.ServiceNames() {
+		notification.Services[name] = "missing"
+	}
+	// service states are best-effort, a failed deployment may leave the engine unreachable
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if containers, err := backend.Ps(ctx, project.Name, api.PsOptions{All: true}); err == nil {
+		for _, c := range containers {
+			if state, ok := notification.Services[c.Service]; ok && state != "running" {
+				notification.Services[c.Service] = c.State
+			}
+		}
+	}
+	return notification
+}
+
+// sendDeployNotification posts the notification to the webhook, even once ctx is cancelled: the
+// failure of an interrupted or timed out deployment is the one that matters most
+func sendDeployNotification(ctx context.Context, url string, notification deployNotification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// getDeployExtensionString reads a string attribute of the project x-deploy extension
+func getDeployExtensionString(project *types.Project, key string) string {
+	xdeploy, ok := project.Extensions["x-deploy"].(map[string]any)
+	if !ok {
+		return ""
+	}
+	value, _ := xdeploy[key].(string)
+	return value
+}
+
+// checkRegistryAccess verifies the registry is reachable with the credentials stored by `docker login`
+func checkRegistryAccess(ctx context.Context, dockerCli command.Cli, registryHost string) error {
+	authConfig, err := dockerCli.ConfigFile().GetAuthConfig(registry.GetAuthConfigKey(registryHost))
+	if err != nil {
+		return err
+	}
+	if authConfig.Username == "" && authConfig.IdentityToken == "" && authConfig.RegistryToken == "" {
+		return fmt.Errorf("not logged in to registry %s, run 'docker login %s' first", registryHost, registryHost)
+	}
+	if authConfig.ServerAddress == "" {
+		authConfig.ServerAddress = registryHost
+	}
+	if _, err := dockerCli.Client().RegistryLogin(ctx, registrytypes.AuthConfig(authConfig)); err != nil {
+		return fmt.Errorf("registry %s is not reachable or rejected the stored credentials: %w", registryHost, err)
+	}
+	return nil
+}
+
+// registryReference moves an image reference under another registry, keeping its path and tag.
+// Docker Hub official images keep their familiar name, without the implicit library/ namespace.
+func registryReference(image, registryHost string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	tagged, ok := reference.TagNameOnly(named).(reference.Tagged)
+	if !ok {
+		return "", fmt.Errorf("invalid image reference: %s", image)
+	}
+	path := reference.Path(named)
+	if reference.Domain(named) == "docker.io" {
+		path = reference.FamiliarName(named)
+	}
+	return fmt.Sprintf("%s/%s:%s", strings.TrimSuffix(registryHost, "/"), path, tagged.Tag()), nil
+}
+
+// retagForRegistry tags the built images of the project under the target registry
+// and updates the services so the push step sends them there
+func retagForRegistry(ctx context.Context, dockerCli command.Cli, project *types.Project, registryHost string) ([]string, error) {
+	var pushed []string
+	for _, name := range project.ServiceNames() {
+		service := project.Services[name]
+		if service.Build == nil {
+			continue
+		}
+		source := api.GetImageNameOrDefault(service, project.Name)
+		target, err := registryReference(source, registryHost)
+		if err != nil {
+			return nil, err
+		}
+		if err := dockerCli.Client().ImageTag(ctx, source, target); err != nil {
+			return nil, fmt.Errorf("failed to tag %s as %s: %w", source, target, err)
+		}
+		service.Image = target
+
+		tags := make([]string, 0, len(service.Build.Tags))
+		for _, tag := range service.Build.Tags {
+			retagged, err := registryReference(tag, registryHost)
+			if err != nil {
+				return nil, err
+			}
+			if err := dockerCli.Client().ImageTag(ctx, tag, retagged); err != nil {
+				return nil, fmt.Errorf("failed to tag %s as %s: %w", tag, retagged, err)
+			}
+			tags = append(tags, retagged)
+		}
+		service.Build.Tags = tags
+
+		project.Services[name] = service
+		pushed = append(pushed, target)
+		pushed = append(pushed, tags...)
+	}
+	return pushed, nil
+}
+
+func runBlueGreenDeploy(ctx context.Context, backend api.Compose, project *types.Project, maintenance string) error {
 	// Blue-green deployment: create new instances alongside existing ones
 	// For simplicity, we'll just restart all services
 	fmt.Println("Performing blue-green deployment...")
 
+	var stopOptions api.StopOptions
+	var startOptions api.StartOptions
+	if maintenance != "" {
+		maintenanceProject, err := deployMaintenanceProject(project, maintenance)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Starting maintenance service %s...\n", maintenance)
+		if err := backend.Up(ctx, maintenanceProject, api.UpOptions{
+			Create: api.CreateOptions{Services: []string{maintenance}, RecreateDependencies: api.RecreateNever},
+			Start:  api.StartOptions{Project: maintenanceProject, Services: []string{maintenance}},
+		}); err != nil {
+			return fmt.Errorf("failed to start maintenance service %s: %v", maintenance, err)
+		}
+		defer func() {
+			// also removed when the deployment fails or is interrupted
+			fmt.Printf("Removing maintenance service %s...\n", maintenance)
+			if err := backend.Remove(context.WithoutCancel(ctx), project.Name, api.RemoveOptions{
+				Project:  maintenanceProject,
+				Services: []string{maintenance},
+				Stop:     true,
+				Force:    true,
+			}); err != nil {
+				fmt.Printf("Warning: Failed to remove maintenance service %s: %v\n", maintenance, err)
+			}
+		}()
+
+		// the maintenance service keeps running until the services are back
+		services := slices.DeleteFunc(project.ServiceNames(), func(name string) bool { return name == maintenance })
+		stopOptions = api.StopOptions{Project: project, Services: services}
+		startOptions = api.StartOptions{Project: project, Services: services, Wait: true}
+	}
+
 	// Stop all services
-	if err := backend.Stop(ctx, projectName, api.StopOptions{}); err != nil {
+	if err := backend.Stop(ctx, project.Name, stopOptions); err != nil {
 		fmt.Printf("Warning: Stop failed: %v\n", err)
 		// Continue even if stop fails
 	}
 
 	// Start all services
-	if err := backend.Start(ctx, projectName, api.StartOptions{}); err != nil {
+	if err := backend.Start(ctx, project.Name, startOptions); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// deployMaintenanceImage serves the maintenance page when no maintenance service is declared
+const deployMaintenanceImage = "nginx:alpine"
+
+// deployMaintenanceScript configures nginx to answer every request with a 503 maintenance page
+const deployMaintenanceScript = `cat > /etc/nginx/conf.d/default.conf <<'EOF'
+server {
+    listen 80;
+    root /usr/share/nginx/html;
+    error_page 503 /maintenance.html;
+    location = /maintenance.html {
+        internal;
+    }
+    location / {
+        add_header Retry-After 30 always;
+        return 503;
+    }
+}
+EOF
+echo '<!doctype html><title>Maintenance</title><h1>Down for maintenance</h1><p>We will be back in a moment.</p>' > /usr/share/nginx/html/maintenance.html
+exec nginx -g 'daemon off;'`
+
+// deployMaintenanceProject returns the project to start the maintenance service with: the service
+// is enabled if disabled by a profile, or added as an nginx service serving a maintenance page
+// on the networks of the project when not declared
+func deployMaintenanceProject(project *types.Project, name string) (*types.Project, error) {
+	if _, ok := project.Services[name]; ok {
+		return project, nil
+	}
+	if _, ok := project.DisabledServices[name]; ok {
+		return project.WithServicesEnabled(name)
+	}
+	service := types.ServiceConfig{
+		Name:     name,
+		Image:    deployMaintenanceImage,
+		Command:  types.ShellCommand{"/bin/sh", "-c", deployMaintenanceScript},
+		Networks: map[string]*types.ServiceNetworkConfig{},
+	}
+	for network := range project.Networks {
+		service.Networks[network] = nil
+	}
+	withMaintenance := *project
+	withMaintenance.Services = maps.Clone(project.Services)
+	withMaintenance.Services[name] = service
+	return &withMaintenance, nil
+}
+
 func runRollback(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, projectName string, rollbackTo string) error {
 	fmt.Println("Performing rollback...")
 
@@ -0,0 +1,459 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/cli/cli/streams"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/extensions"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestRegistryReference(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "myapp-web", want: "registry.example.com/myapp-web:latest"},
+		{image: "docker.io/library/nginx:1.27", want: "registry.example.com/nginx:1.27"},
+		{image: "acme/web:1.2", want: "registry.example.com/acme/web:1.2"},
+		{image: "dev.registry:5000/acme/web:1.2", want: "registry.example.com/acme/web:1.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got, err := registryReference(tt.image, "registry.example.com/")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestApproveDeploy(t *testing.T) {
+	t.Setenv(deployApprovalTokenEnv, "s3cr3t")
+
+	approver, err := approveDeploy(nil, "shop", "s3cr3t")
+	require.NoError(t, err)
+	assert.Equal(t, "approval token", approver)
+
+	_, err = approveDeploy(nil, "shop", "wrong")
+	assert.ErrorContains(t, err, "invalid approval token")
+
+	ctrl := gomock.NewController(t)
+	cli := mocks.NewMockCli(ctrl)
+	cli.EXPECT().In().Return(streams.NewIn(io.NopCloser(strings.NewReader("shop\n")))).AnyTimes()
+	_, err = approveDeploy(cli, "shop", "")
+	assert.ErrorContains(t, err, "use --approval-token in non-interactive sessions")
+}
+
+func TestDeployNotification(t *testing.T) {
+	assert.True(t, shouldNotifyDeploy("always", nil))
+	assert.False(t, shouldNotifyDeploy("failure", nil))
+	assert.True(t, shouldNotifyDeploy("failure", errors.New("boom")))
+	assert.False(t, shouldNotifyDeploy("success", errors.New("boom")))
+
+	// --notify-on is validated before --show-manifest, --rollback or anything else runs
+	err := runDeploy(context.Background(), nil, nil, &deployOptions{notifyOn: "sometimes", showManifest: "v1", maxParallel: 1})
+	assert.EqualError(t, err, `invalid --notify-on value "sometimes", must be one of always, success or failure`)
+
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{All: true}).DoAndReturn(
+		func(ctx context.Context, _ string, _ api.PsOptions) ([]api.ContainerSummary, error) {
+			return []api.ContainerSummary{
+				{Service: "web", State: "exited"},
+				{Service: "web", State: "running"},
+			}, ctx.Err()
+		})
+	project := &types.Project{Name: "shop", Services: types.Services{"web": {Name: "web"}, "db": {Name: "db"}}}
+	opts := &deployOptions{env: "prod", strategy: "rolling"}
+	// an interrupted deployment is still notified
+	interrupted, cancel := context.WithCancel(context.Background())
+	cancel()
+	notification := newDeployNotification(interrupted, backend, project, opts, deployOutcome{}, 3*time.Second, errors.New("boom"))
+
+	var received deployNotification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+	require.NoError(t, sendDeployNotification(interrupted, server.URL, notification))
+	assert.Equal(t, deployNotification{
+		Project:     "shop",
+		Environment: "prod",
+		Strategy:    "rolling",
+		Status:      "failure",
+		Error:       "boom",
+		Services:    map[string]string{"web": "running", "db": "missing"},
+		Duration:    3,
+	}, received)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	assert.ErrorContains(t, sendDeployNotification(context.Background(), failing.URL, notification), "502")
+}
+
+func TestDetectDeployDrift(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"web": {Name: "web", Image: "web:1"},
+		"db":  {Name: "db", Image: "postgres:16"},
+	}}
+	deployed := []api.ContainerSummary{
+		{Service: "web", Image: "web:1", Labels: map[string]string{api.ConfigHashLabel: "aaa"}},
+		{Service: "db", Image: "postgres:16", Labels: map[string]string{api.ConfigHashLabel: "bbb"}},
+	}
+	version, err := extensions.DefaultHistoryStore().Record(project, "deployed", "", deployed)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"web": "aaa", "db": "bbb"}, version.ConfigHashes)
+
+	assert.Empty(t, detectDeployDrift(version, deployed))
+
+	running := []api.ContainerSummary{
+		{Service: "web", Image: "web:1-hotfix", Labels: map[string]string{api.ConfigHashLabel: "ccc"}},
+		{Service: "db", Image: "postgres:16", Labels: map[string]string{api.ConfigHashLabel: "ddd"}},
+		{Service: "debug", Image: "busybox"},
+	}
+	drifts := detectDeployDrift(version, running)
+	require.Len(t, drifts, 2)
+	assert.Equal(t, serviceDrift{Service: "db", Reason: "configuration (environment, command, volumes...) differs from the recorded deployment"}, drifts[0])
+	assert.Equal(t, serviceDrift{Service: "web", Reason: "running image web:1-hotfix, recorded web:1"}, drifts[1])
+}
+
+func TestDeployHooks(t *testing.T) {
+	project := &types.Project{Name: "shop", WorkingDir: t.TempDir(), Extensions: types.Extensions{
+		"x-deploy": map[string]any{"hooks": map[string]any{"pre": "echo warm", "post": "echo migrate"}},
+	}}
+	pre, post := deployHooks(project, &deployOptions{postDeploy: "./migrate.sh"})
+	assert.Equal(t, "echo warm", pre)
+	assert.Equal(t, "./migrate.sh", post)
+
+	pre, post = deployHooks(&types.Project{}, &deployOptions{})
+	assert.Empty(t, pre)
+	assert.Empty(t, post)
+
+	ctrl := gomock.NewController(t)
+	cli := mocks.NewMockCli(ctrl)
+	cli.EXPECT().Out().Return(streams.NewOut(io.Discard)).AnyTimes()
+	cli.EXPECT().Err().Return(streams.NewOut(io.Discard)).AnyTimes()
+
+	opts := &deployOptions{env: "prod"}
+	result := runDeployHook(context.Background(), cli, nil, project, opts, "post-deploy", `echo "$COMPOSE_PROJECT_NAME $DEPLOY_ENV"; echo failed >&2; exit 3`)
+	assert.Equal(t, "post-deploy", result.Phase)
+	assert.Contains(t, result.Output, "shop prod\n")
+	assert.Contains(t, result.Output, "failed\n")
+	assert.Equal(t, "exit status 3", result.Error)
+
+	result = runDeployHook(context.Background(), cli, nil, project, opts, "pre-deploy", "true")
+	assert.Empty(t, result.Error)
+}
+
+func TestDeployHookInContainer(t *testing.T) {
+	project := &types.Project{Name: "shop", Services: types.Services{"web": {Name: "web"}}}
+	ctrl := gomock.NewController(t)
+	cli := mocks.NewMockCli(ctrl)
+	apiClient := mocks.NewMockAPIClient(ctrl)
+	backend := mocks.NewMockCompose(ctrl)
+	cli.EXPECT().Client().Return(apiClient).AnyTimes()
+
+	var hookContainer string
+	backend.EXPECT().RunOneOffContainer(gomock.Any(), project, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *types.Project, opts api.RunOptions) (int, error) {
+			assert.Equal(t, "web", opts.Service)
+			assert.Equal(t, []string{"/bin/sh", "-c", "./migrate.sh"}, opts.Command)
+			assert.False(t, opts.AutoRemove, "the container is kept to read its output")
+			hookContainer = opts.Name
+			return 2, nil
+		})
+	apiClient.EXPECT().ContainerLogs(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, name string, _ container.LogsOptions) (io.ReadCloser, error) {
+			assert.Equal(t, hookContainer, name)
+			var logs bytes.Buffer
+			_, _ = stdcopy.NewStdWriter(&logs, stdcopy.Stdout).Write([]byte("migrating\n"))
+			_, _ = stdcopy.NewStdWriter(&logs, stdcopy.Stderr).Write([]byte("migration failed\n"))
+			return io.NopCloser(&logs), nil
+		})
+	apiClient.EXPECT().ContainerRemove(gomock.Any(), gomock.Any(), container.RemoveOptions{Force: true}).DoAndReturn(
+		func(_ context.Context, name string, _ container.RemoveOptions) error {
+			assert.Equal(t, hookContainer, name)
+			return nil
+		})
+
+	result := runDeployHook(context.Background(), cli, backend, project, &deployOptions{hookIn: "web"}, "post-deploy", "./migrate.sh")
+	assert.Equal(t, "web", result.Service)
+	assert.Equal(t, "exited with code 2", result.Error)
+	assert.Equal(t, "migrating\nmigration failed\n", result.Output)
+}
+
+func TestRollbackFailedDeploy(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	project := &types.Project{Name: "shop", Services: types.Services{"web": {Name: "web", Image: "web:1"}}}
+	_, err := extensions.DefaultHistoryStore().Record(project, "Deployed to prod", "", nil)
+	require.NoError(t, err)
+
+	project.Services["web"] = types.ServiceConfig{Name: "web", Image: "web:2"}
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	backend.EXPECT().Ps(gomock.Any(), "shop", gomock.Any()).Return([]api.ContainerSummary{
+		{Service: "web", Image: "web:2", State: "running"},
+	}, nil).Times(3)
+	backend.EXPECT().Up(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+
+	outcome := deployOutcome{}
+	err = rollbackFailedDeploy(context.Background(), backend, project, &deployOptions{env: "prod"}, "", errors.New("web is unhealthy"), &outcome)
+	assert.EqualError(t, err, "deployment failed, rolled back to version v1: web is unhealthy")
+	assert.Equal(t, "v2", outcome.Version)
+
+	history, err := extensions.DefaultHistoryStore().Load("shop")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, "failed", history[1].Status)
+	assert.Equal(t, "Failed deploy to prod", history[1].Description)
+	assert.Equal(t, "Rolled back to v1 after failed deploy v2", history[2].Description)
+	assert.Equal(t, map[string]string{"web": "web:1"}, history[2].Services)
+}
+
+func TestDeploySmokeChecks(t *testing.T) {
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"web": {Name: "web", Ports: []types.ServicePortConfig{{Target: 80, Published: "8080"}, {Target: 9090, Published: "9090", HostIP: "127.0.0.1"}},
+			Extensions: types.Extensions{"x-deploy": map[string]any{"smoke": []any{
+				"/health",
+				map[string]any{"path": "/metrics", "status": 204, "port": 9090},
+			}}}},
+		"db": {Name: "db"},
+	}}
+	checks, err := deploySmokeChecks(project)
+	require.NoError(t, err)
+	assert.Equal(t, []deploySmokeCheck{
+		{Service: "web", Path: "/health", Status: 200},
+		{Service: "web", Path: "/metrics", Port: 9090, Status: 204},
+	}, checks)
+
+	url, err := deploySmokeURL(project.Services["web"], checks[0])
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/health", url)
+	url, err = deploySmokeURL(project.Services["web"], checks[1])
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:9090/metrics", url)
+	_, err = deploySmokeURL(project.Services["db"], deploySmokeCheck{Service: "db", Path: "/"})
+	assert.ErrorContains(t, err, "service db has no published port")
+
+	project.Services["db"] = types.ServiceConfig{Name: "db", Extensions: types.Extensions{"x-deploy": map[string]any{"smoke": []any{"health"}}}}
+	_, err = deploySmokeChecks(project)
+	assert.ErrorContains(t, err, `invalid x-deploy.smoke path "health" for service db`)
+}
+
+func TestRunDeploySmokeChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"web": {Name: "web", Ports: []types.ServicePortConfig{{Target: 80, Published: port, HostIP: "127.0.0.1"}},
+			Extensions: types.Extensions{"x-deploy": map[string]any{"smoke": []any{"/health", "/broken"}}}},
+	}}
+	outcome := deployOutcome{}
+	err = runDeploySmokeChecks(context.Background(), project, &deployOptions{smokeTimeout: 100 * time.Millisecond}, &outcome)
+	assert.EqualError(t, err, "1 of 2 smoke check(s) failed")
+	require.Len(t, outcome.Smoke, 2)
+	assert.Equal(t, 200, outcome.Smoke[0].Status)
+	assert.Equal(t, 500, outcome.Smoke[1].Status)
+
+	var report strings.Builder
+	require.NoError(t, printDeploySmokeResults(&report, []deploySmokeResult{
+		{Service: "web", URL: "http://localhost:8080/health", Expected: 200, Status: 200},
+		{Service: "api", Expected: 200, Error: "service api has no published port"},
+	}))
+	assert.Equal(t, `SERVICE   CHECK                          EXPECTED   GOT   RESULT
+web       http://localhost:8080/health   200        200   ok
+api       -                              200        -     FAIL: service api has no published port
+`, report.String())
+}
+
+func TestDeployManifest(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	project := &types.Project{Name: "shop", WorkingDir: t.TempDir(), Services: types.Services{
+		"web": {Name: "web", Image: "web:2", Ports: []types.ServicePortConfig{{HostIP: "127.0.0.1", Published: "8080", Target: 80, Protocol: "tcp"}}},
+		"db":  {Name: "db", Image: "postgres:16"},
+	}}
+	containers := []api.ContainerSummary{
+		{Service: "web", Image: "web:2"},
+		{Service: "web", Image: "web:2"},
+	}
+
+	ctrl := gomock.NewController(t)
+	cli := mocks.NewMockCli(ctrl)
+	apiClient := mocks.NewMockAPIClient(ctrl)
+	cli.EXPECT().Client().Return(apiClient).AnyTimes()
+	apiClient.EXPECT().ImageInspect(gomock.Any(), "web:2").Return(image.InspectResponse{
+		ID:          "sha256:abc",
+		RepoDigests: []string{"registry.example.com/web@sha256:def"},
+	}, nil).Times(1)
+
+	version := &extensions.VersionInfo{Version: "v3", Description: "Deployed to prod", ApprovedBy: "alice"}
+	manifest := newDeployManifest(context.Background(), cli, project, &deployOptions{env: "prod", strategy: "rolling"}, version, containers)
+	assert.Regexp(t, `^deploy-\d{8}T\d{6}\.\d{9}Z$`, manifest.ID)
+	assert.NotEqual(t, manifest.ID, newDeployManifest(context.Background(), cli, project, &deployOptions{}, version, nil).ID)
+	assert.Equal(t, "v3", manifest.Version)
+	assert.Empty(t, manifest.GitSHA)
+	assert.Equal(t, map[string]deployManifestService{
+		"web": {Image: "web:2", Digest: "registry.example.com/web@sha256:def"},
+		"db":  {Image: "postgres:16"},
+	}, manifest.Services)
+	assert.Equal(t, []deployManifestEndpoint{{Service: "web", HostIP: "127.0.0.1", Published: "8080", Target: 80, Protocol: "tcp"}}, manifest.Endpoints)
+
+	extra := t.TempDir()
+	files, err := writeDeployManifest(manifest, extra)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.FileExists(t, filepath.Join(extra, manifest.ID+".json"))
+
+	var byID, byVersion strings.Builder
+	require.NoError(t, showDeployManifest(&byID, "shop", manifest.ID))
+	require.NoError(t, showDeployManifest(&byVersion, "shop", "v3"))
+	assert.Equal(t, byID.String(), byVersion.String())
+	var shown deployManifest
+	require.NoError(t, json.Unmarshal([]byte(byID.String()), &shown))
+	assert.Equal(t, "prod", shown.Env)
+	assert.ErrorContains(t, showDeployManifest(io.Discard, "shop", "v9"), "no deployment manifest v9")
+}
+
+func TestDeployFromArchive(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "compose.yaml"), []byte("services:\n  web:\n    build: .\n  db:\n    image: postgres\n"), 0o644))
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"web": {Name: "web", Build: &types.BuildConfig{Context: "."}},
+		"db":  {Name: "db", Image: "postgres"},
+	}}
+
+	// only the images with a repository digest can be pinned
+	ctrl := gomock.NewController(t)
+	apiClient := mocks.NewMockAPIClient(ctrl)
+	apiClient.EXPECT().ImageInspect(gomock.Any(), "shop-web").Return(image.InspectResponse{
+		ID:          "sha256:abc",
+		RepoDigests: []string{"registry.example.com/shop/web@sha256:0123"},
+	}, nil)
+	apiClient.EXPECT().ImageInspect(gomock.Any(), "postgres").Return(image.InspectResponse{ID: "sha256:local-image-id"}, nil)
+	lock, err := deployLock(context.Background(), apiClient, project)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"services": {"web": {"image": "shop-web", "digest": "registry.example.com/shop/web@sha256:0123"}}}`, string(lock))
+
+	archive := filepath.Join(t.TempDir(), "shop.tar.gz")
+	f, err := os.Create(archive)
+	require.NoError(t, err)
+	require.NoError(t, writeShareArchive(f, src, []string{"compose.yaml"}, lock, shareManifest{ID: "abc", Project: "shop"}))
+	require.NoError(t, f.Close())
+
+	dir := t.TempDir()
+	opts := &ProjectOptions{}
+	manifest, err := extractDeployArchive(archive, dir, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "shop", manifest.Name)
+	assert.Equal(t, "shop", opts.ProjectName)
+	assert.Equal(t, []string{filepath.Join(dir, "compose.yaml")}, opts.ConfigPaths)
+
+	pinned, err := applyDeployLock(project, dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"web"}, pinned)
+	assert.Equal(t, "registry.example.com/shop/web@sha256:0123", project.Services["web"].Image)
+	assert.Nil(t, project.Services["web"].Build)
+	assert.Equal(t, "postgres", project.Services["db"].Image)
+
+	// a plain compose file can't be verified
+	_, err = extractDeployArchive(filepath.Join(src, "compose.yaml"), t.TempDir(), &ProjectOptions{})
+	assert.ErrorContains(t, err, "not a bundle")
+}
+
+func TestDeployMaintenanceProject(t *testing.T) {
+	project := &types.Project{
+		Name:             "shop",
+		Services:         types.Services{"web": {Name: "web"}, "offline": {Name: "offline", Image: "shop/offline"}},
+		DisabledServices: types.Services{"maintenance": {Name: "maintenance", Image: "shop/maintenance", Profiles: []string{"maintenance"}}},
+		Networks:         types.Networks{"default": {Name: "shop_default"}, "front": {Name: "shop_front"}},
+	}
+
+	declared, err := deployMaintenanceProject(project, "offline")
+	require.NoError(t, err)
+	assert.Same(t, project, declared)
+
+	enabled, err := deployMaintenanceProject(project, "maintenance")
+	require.NoError(t, err)
+	assert.Equal(t, "shop/maintenance", enabled.Services["maintenance"].Image)
+	assert.NotContains(t, project.Services, "maintenance")
+
+	added, err := deployMaintenanceProject(project, "down")
+	require.NoError(t, err)
+	assert.Equal(t, deployMaintenanceImage, added.Services["down"].Image)
+	assert.Equal(t, map[string]*types.ServiceNetworkConfig{"default": nil, "front": nil}, added.Services["down"].Networks)
+	assert.NotContains(t, project.Services, "down")
+}
+
+func TestBlueGreenDeployMaintenance(t *testing.T) {
+	project := &types.Project{Name: "shop", Services: types.Services{"web": {Name: "web"}, "api": {Name: "api"}}}
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	isMaintenance := gomock.Cond(func(p *types.Project) bool { return p.Services["down"].Image == deployMaintenanceImage })
+
+	// the maintenance service runs until the services are back, and is removed even when they fail to start
+	gomock.InOrder(
+		backend.EXPECT().Up(gomock.Any(), isMaintenance, gomock.Cond(func(o api.UpOptions) bool {
+			return o.Create.Services[0] == "down" && o.Start.Services[0] == "down"
+		})).Return(nil),
+		backend.EXPECT().Stop(gomock.Any(), "shop", api.StopOptions{Project: project, Services: []string{"api", "web"}}).Return(nil),
+		backend.EXPECT().Start(gomock.Any(), "shop", api.StartOptions{Project: project, Services: []string{"api", "web"}, Wait: true}).
+			Return(errors.New("web is unhealthy")),
+		backend.EXPECT().Remove(gomock.Any(), "shop", gomock.Cond(func(o api.RemoveOptions) bool {
+			return len(o.Services) == 1 && o.Services[0] == "down" && o.Stop && o.Force
+		})).Return(nil),
+	)
+	assert.EqualError(t, runBlueGreenDeploy(context.Background(), backend, project, "down"), "web is unhealthy")
+
+	// without a maintenance service, all the services are restarted
+	backend.EXPECT().Stop(gomock.Any(), "shop", api.StopOptions{}).Return(nil)
+	backend.EXPECT().Start(gomock.Any(), "shop", api.StartOptions{}).Return(nil)
+	require.NoError(t, runBlueGreenDeploy(context.Background(), backend, project, ""))
+}
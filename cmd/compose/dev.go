@@ -17,18 +17,29 @@
 package compose
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/cli/cli/command"
 	"github.com/spf13/cobra"
 
 	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/cmd/formatter"
 	"github.com/docker/compose/v5/pkg/api"
 	"github.com/docker/compose/v5/pkg/compose"
+	"github.com/docker/compose/v5/pkg/extensions"
 )
 
 type devOptions struct {
@@ -43,6 +54,13 @@ type devOptions struct {
 	ignorePaths   []string
 	pollInterval  int
 	restartPolicy string
+	forwards      []string
+	attachLogs    bool
+	onStart       string
+	onStartFiles  []string
+
+	rebuildOnDockerfileChange bool
+	syncStats                 bool
 }
 
 func devCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *BackendOptions) *cobra.Command {
@@ -69,6 +87,33 @@ This command supports:
 4. IDE integration: Integration with VS Code, IntelliJ, and other IDEs
 5. Custom watch paths: Specify which paths to watch for changes
 6. Ignore patterns: Exclude specific paths from watching
+
+An on-start command, declared as x-develop.on-start on a service or given with --on-start,
+runs once in the service container after it first starts and before watching begins, e.g. to
+install dependencies or run migrations. It is not run again while the container is kept,
+unless one of the files listed in x-develop.on-start-files or with --on-start-file changed.
+
+With hot reload, the --watch paths, or the build context of each service, are polled for
+changes. A source change restarts the service following --restart-policy. A change of the
+Dockerfile, .dockerignore or a dependency manifest (package.json, go.mod, requirements.txt...)
+at the root of the build context leaves the image stale: with --rebuild-on-dockerfile-change
+the service image is rebuilt and its container recreated instead. Each reload reports which
+path was taken.
+
+The dependency manifests of a service can be declared as x-develop.rebuild, a list of patterns
+replacing the default ones, matched against the paths relative to the build context and, for
+patterns without a slash, against the file names:
+
+    x-develop:
+      rebuild: ["package.json", "packages/*/package.json", "*.csproj"]
+
+A service declaring x-develop.rebuild is rebuilt and recreated on a change of its Dockerfile or
+of a matching file, even without --rebuild-on-dockerfile-change.
+
+--sync-stats prints one line per reload with how long it took to detect the change (from the
+last modification of the changed files, including the scan of the watched files), to reload
+the service, in total, and the average total over the last 10 reloads of the service. Use it
+to tune --poll-interval, --watch and --ignore.
 `,
 		RunE: Adapt(func(ctx context.Context, args []string) error {
 			opts.services = args
@@ -85,6 +130,12 @@ This command supports:
 	cmd.Flags().StringArrayVar(&opts.ignorePaths, "ignore", []string{}, "Paths to ignore for changes")
 	cmd.Flags().IntVar(&opts.pollInterval, "poll-interval", 2, "Polling interval for file changes (seconds)")
 	cmd.Flags().StringVar(&opts.restartPolicy, "restart-policy", "always", "Restart policy on code changes (always, on-failure, never)")
+	cmd.Flags().BoolVar(&opts.attachLogs, "attach-logs", false, "Stream the logs of the watched services, marking each reload")
+	cmd.Flags().StringArrayVar(&opts.forwards, "forward", []string{}, "Publish a container port to the host while developing (format: [SERVICE:]HOST_PORT:CONTAINER_PORT)")
+	cmd.Flags().StringVar(&opts.onStart, "on-start", "", "Command run once in the containers of the watched services after they start (overrides x-develop.on-start)")
+	cmd.Flags().BoolVar(&opts.rebuildOnDockerfileChange, "rebuild-on-dockerfile-change", false, "Rebuild and recreate a service when its Dockerfile or dependency manifests change, instead of restarting it")
+	cmd.Flags().BoolVar(&opts.syncStats, "sync-stats", false, "Print the detection and reload durations of each reload, with a rolling average")
+	cmd.Flags().StringArrayVar(&opts.onStartFiles, "on-start-file", []string{}, "File the on-start command depends on, it runs again when the file changes (overrides x-develop.on-start-files)")
 	return cmd
 }
 
@@ -122,6 +173,18 @@ func runDev(ctx context.Context, dockerCli command.Cli, backendOptions *BackendO
 		fmt.Printf("Ignoring paths: %v\n", opts.ignorePaths)
 	}
 
+	forwards, err := devPortForwards(project, opts)
+	if err != nil {
+		return err
+	}
+	// Published ports are only added to the in-memory model: services are recreated with them
+	// for the dev session, and stopDevEnvironment removes those containers when it ends.
+	for _, forward := range forwards {
+		if applyPortForward(project, forward) {
+			fmt.Printf("Forwarding localhost:%s -> %s:%d\n", forward.Published, forward.Service, forward.Target)
+		}
+	}
+
 	// Start services
 	fmt.Println("\nStarting services...")
 	uOptions := api.UpOptions{}
@@ -129,6 +192,11 @@ func runDev(ctx context.Context, dockerCli command.Cli, backendOptions *BackendO
 		return err
 	}
 
+	// Run the on-start commands before watching
+	if err := runDevOnStart(ctx, backend, project, opts); err != nil {
+		fmt.Printf("Warning: Failed to run on-start command: %v\n", err)
+	}
+
 	// Set up hot reload if enabled
 	if opts.hotReload {
 		fmt.Println("\nSetting up hot reload...")
@@ -164,26 +232,594 @@ func runDev(ctx context.Context, dockerCli command.Cli, backendOptions *BackendO
 	fmt.Println("\nDevelopment environment started successfully!")
 	fmt.Println("Press Ctrl+C to stop...")
 
+	if opts.attachLogs {
+		go streamDevLogs(ctx, dockerCli, backend, project, watchedDevServices(project, opts))
+	}
+
 	// Wait for interrupt
 	<-ctx.Done()
 
+	stopDevEnvironment(ctx, backend, project)
+	return nil
+}
+
+// stopDevEnvironment removes the containers of the dev session, reverting the forwarded ports.
+// ctx is done by then, so the removal runs without its cancellation.
+func stopDevEnvironment(ctx context.Context, backend api.Compose, project *types.Project) {
 	fmt.Println("\nStopping development environment...")
-	// Stop services
-	if err := backend.Down(ctx, project.Name, api.DownOptions{}); err != nil {
+	if err := backend.Down(context.WithoutCancel(ctx), project.Name, api.DownOptions{}); err != nil {
 		fmt.Printf("Warning: Failed to stop services: %v\n", err)
 	}
+}
+
+// watchedDevServices returns the services selected for development, all of them when none were given
+func watchedDevServices(project *types.Project, opts *devOptions) []string {
+	if len(opts.services) > 0 {
+		return opts.services
+	}
+	return project.ServiceNames()
+}
+
+// streamDevLogs follows the logs of the given services until ctx is done, printing a marker
+// each time one of their containers (re)starts
+func streamDevLogs(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, services []string) {
+	consumer := formatter.NewLogConsumer(ctx, dockerCli.Out(), dockerCli.Err(), true, true, false)
+	go func() {
+		err := backend.Events(ctx, project.Name, api.EventsOptions{
+			Services: services,
+			Consumer: func(event api.Event) error {
+				if event.Status == "start" {
+					_, _ = fmt.Fprintf(dockerCli.Out(), "--- reloaded %s ---\n", event.Service)
+				}
+				return nil
+			},
+		})
+		if err != nil && ctx.Err() == nil {
+			fmt.Printf("Warning: Failed to watch reloads: %v\n", err)
+		}
+	}()
+	err := backend.Logs(ctx, project.Name, consumer, api.LogOptions{
+		Project:  project,
+		Services: services,
+		Follow:   true,
+		Tail:     "0",
+	})
+	if err != nil && ctx.Err() == nil {
+		fmt.Printf("Warning: Failed to stream logs: %v\n", err)
+	}
+}
+
+// devOnStartCommand returns the on-start command of a service: the command line flag when set,
+// otherwise the x-develop extension of the service
+func devOnStartCommand(service types.ServiceConfig, flag string) []string {
+	if flag != "" {
+		return []string{"/bin/sh", "-c", flag}
+	}
+	xdevelop, _ := service.Extensions["x-develop"].(map[string]any)
+	return parseTestCommand(xdevelop["on-start"])
+}
+
+// devOnStartFiles returns the files the on-start command of a service depends on
+func devOnStartFiles(service types.ServiceConfig, flag []string) []string {
+	if len(flag) > 0 {
+		return flag
+	}
+	xdevelop, _ := service.Extensions["x-develop"].(map[string]any)
+	list, _ := xdevelop["on-start-files"].([]any)
+	files := make([]string, 0, len(list))
+	for _, file := range list {
+		files = append(files, fmt.Sprint(file))
+	}
+	return files
+}
+
+// devOnStartFingerprint identifies a run of the on-start command: the container it ran in, the
+// command and the content of the files it depends on
+func devOnStartFingerprint(workingDir, containerID string, command, files []string) (string, error) {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\x00%s\x00", containerID, strings.Join(command, "\x00"))
+	for _, file := range files {
+		path := file
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workingDir, path)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to read on-start file %s: %v", file, err)
+		}
+		_, _ = fmt.Fprintf(hash, "%s\x00%d\x00", file, len(content))
+		_, _ = hash.Write(content)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// devOnStartMarker returns the file recording the last successful run of the on-start command of a service
+func devOnStartMarker(projectName, service string) string {
+	return filepath.Join(extensions.StateDir("dev"), projectName, service+".on-start")
+}
 
+// runDevOnStart runs the on-start command of the watched services, skipping those which already
+// ran it in the same container with unchanged dependency files
+func runDevOnStart(ctx context.Context, backend api.Compose, project *types.Project, opts *devOptions) error {
+	for _, name := range watchedDevServices(project, opts) {
+		service, err := project.GetService(name)
+		if err != nil {
+			return err
+		}
+		command := devOnStartCommand(service, opts.onStart)
+		if len(command) == 0 {
+			continue
+		}
+
+		containers, err := backend.Ps(ctx, project.Name, api.PsOptions{Services: []string{name}})
+		if err != nil {
+			return err
+		}
+		var target *api.ContainerSummary
+		for i := range containers {
+			if containers[i].State == "running" {
+				target = &containers[i]
+				break
+			}
+		}
+		if target == nil {
+			return fmt.Errorf("no running container for service %s", name)
+		}
+
+		fingerprint, err := devOnStartFingerprint(project.WorkingDir, target.ID, command, devOnStartFiles(service, opts.onStartFiles))
+		if err != nil {
+			return err
+		}
+		marker := devOnStartMarker(project.Name, name)
+		if previous, err := os.ReadFile(marker); err == nil && string(previous) == fingerprint {
+			fmt.Printf("On-start command of %s already ran, skipping\n", name)
+			continue
+		}
+
+		fmt.Printf("\nRunning on-start command of %s: %s\n", name, strings.Join(command, " "))
+		index, _ := strconv.Atoi(target.Labels[api.ContainerNumberLabel])
+		exitCode, err := backend.Exec(ctx, project.Name, api.RunOptions{
+			Service: name,
+			Command: command,
+			Index:   index,
+		})
+		if err != nil {
+			return fmt.Errorf("on-start command of %s failed: %v", name, err)
+		}
+		if exitCode != 0 {
+			return fmt.Errorf("on-start command of %s failed with exit code %d", name, exitCode)
+		}
+		if err := os.MkdirAll(filepath.Dir(marker), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(marker, []byte(fingerprint), 0o644); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func setupHotReload(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, opts *devOptions) error {
-	// Simplified implementation - in real code, this would use file watchers
-	fmt.Println("Hot reload is enabled. Services will restart on code changes.")
+// portForward publishes a container port of a service on the host
+type portForward struct {
+	Service   string
+	Published string
+	Target    uint32
+}
 
-	// For demo purposes, just return success
+// devPortForwards resolves the --forward flags, plus the debug port when debugging is enabled.
+// Forwards without an explicit service apply to the single service being developed.
+func devPortForwards(project *types.Project, opts *devOptions) ([]portForward, error) {
+	defaultService := ""
+	switch {
+	case len(opts.services) == 1:
+		defaultService = opts.services[0]
+	case len(opts.services) == 0 && len(project.Services) == 1:
+		defaultService = project.ServiceNames()[0]
+	}
+
+	var forwards []portForward
+	for _, spec := range opts.forwards {
+		forward, err := parsePortForward(spec, defaultService)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := project.Services[forward.Service]; !ok {
+			return nil, fmt.Errorf("invalid forward %q: no such service: %s", spec, forward.Service)
+		}
+		forwards = append(forwards, forward)
+	}
+
+	if opts.debug {
+		if defaultService == "" {
+			fmt.Println("Warning: debug port is not forwarded, select a single service to debug")
+		} else {
+			port := strconv.Itoa(opts.debugPort)
+			forwards = append(forwards, portForward{Service: defaultService, Published: port, Target: uint32(opts.debugPort)})
+		}
+	}
+	return forwards, nil
+}
+
+func parsePortForward(spec string, defaultService string) (portForward, error) {
+	parts := strings.Split(spec, ":")
+	var service, published, target string
+	switch len(parts) {
+	case 2:
+		service, published, target = defaultService, parts[0], parts[1]
+	case 3:
+		service, published, target = parts[0], parts[1], parts[2]
+	default:
+		return portForward{}, fmt.Errorf("invalid forward %q: expected [SERVICE:]HOST_PORT:CONTAINER_PORT", spec)
+	}
+	if service == "" {
+		return portForward{}, fmt.Errorf("invalid forward %q: a service is required when developing multiple services", spec)
+	}
+	if _, err := strconv.ParseUint(published, 10, 16); err != nil {
+		return portForward{}, fmt.Errorf("invalid forward %q: invalid host port %q", spec, published)
+	}
+	targetPort, err := strconv.ParseUint(target, 10, 16)
+	if err != nil {
+		return portForward{}, fmt.Errorf("invalid forward %q: invalid container port %q", spec, target)
+	}
+	return portForward{Service: service, Published: published, Target: uint32(targetPort)}, nil
+}
+
+// applyPortForward adds the published port to the service unless it is already published,
+// and reports whether the service was changed
+func applyPortForward(project *types.Project, forward portForward) bool {
+	service := project.Services[forward.Service]
+	for _, port := range service.Ports {
+		if port.Target == forward.Target && port.Published != "" {
+			return false
+		}
+	}
+	service.Ports = append(service.Ports, types.ServicePortConfig{
+		Mode:      "ingress",
+		Target:    forward.Target,
+		Published: forward.Published,
+		Protocol:  "tcp",
+	})
+	project.Services[forward.Service] = service
+	return true
+}
+
+// devDependencyManifests are the files of a build context declaring the dependencies installed
+// in the image, a change requires a rebuild like a Dockerfile change
+var devDependencyManifests = []string{
+	"package.json", "package-lock.json", "yarn.lock", "pnpm-lock.yaml",
+	"go.mod", "go.sum",
+	"requirements.txt", "Pipfile.lock", "poetry.lock",
+	"Gemfile", "Gemfile.lock",
+	"pom.xml", "build.gradle",
+	"Cargo.toml", "Cargo.lock",
+	"composer.json", "composer.lock",
+}
+
+// devFileStamp identifies the version of a watched file
+type devFileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// devWatch is the state of the files watched for a service
+type devWatch struct {
+	service string
+	roots   []string
+	// triggers are the files requiring a rebuild of the image when they change
+	triggers map[string]bool
+	// rebuild holds the x-develop.rebuild patterns of the service, matched relative to context
+	rebuild  []string
+	context  string
+	declared bool // x-develop.rebuild is set, the service is rebuilt without the flag
+	files    map[string]devFileStamp
+	stats    devSyncStats
+}
+
+// devSyncStatsWindow is the number of reloads the --sync-stats rolling average is computed over
+const devSyncStatsWindow = 10
+
+// devSyncEvent is the timing of a reload, from the change of the files to the service reloaded
+type devSyncEvent struct {
+	// Detect is the time from the last modification of the changed files to their detection,
+	// Scan being the part spent snapshotting the watched files
+	Detect time.Duration
+	Scan   time.Duration
+	Reload time.Duration
+}
+
+func (e devSyncEvent) total() time.Duration {
+	return e.Detect + e.Reload
+}
+
+// devSyncStats keeps the total durations of the last reloads of a service
+type devSyncStats struct {
+	totals []time.Duration
+}
+
+// add records a reload and returns the average total duration of the last reloads
+func (s *devSyncStats) add(event devSyncEvent) time.Duration {
+	s.totals = append(s.totals, event.total())
+	if len(s.totals) > devSyncStatsWindow {
+		s.totals = s.totals[len(s.totals)-devSyncStatsWindow:]
+	}
+	var sum time.Duration
+	for _, total := range s.totals {
+		sum += total
+	}
+	return sum / time.Duration(len(s.totals))
+}
+
+// devChangeDetectDelay returns the time between the last modification of the changed files and
+// detectedAt, zero when only removed files changed
+func devChangeDetectDelay(files map[string]devFileStamp, changed []string, detectedAt time.Time) time.Duration {
+	var last time.Time
+	for _, path := range changed {
+		if stamp, ok := files[path]; ok && stamp.modTime.After(last) {
+			last = stamp.modTime
+		}
+	}
+	if last.IsZero() || last.After(detectedAt) {
+		return 0
+	}
+	return detectedAt.Sub(last)
+}
+
+// formatDevSyncEvent formats a --sync-stats line, compact to not drown the dev logs
+func formatDevSyncEvent(service string, event devSyncEvent, average time.Duration, count int) string {
+	return fmt.Sprintf("[sync-stats] %s: detect %s (scan %s), reload %s, total %s, avg %s over %d",
+		service, event.Detect.Round(time.Millisecond), event.Scan.Round(time.Millisecond),
+		event.Reload.Round(time.Millisecond), event.total().Round(time.Millisecond), average.Round(time.Millisecond), count)
+}
+
+// devWatchRoots returns the paths watched for a service: the --watch paths, otherwise its build context
+func devWatchRoots(project *types.Project, service types.ServiceConfig, opts *devOptions) []string {
+	var roots []string
+	for _, path := range opts.watchPaths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(project.WorkingDir, path)
+		}
+		roots = append(roots, path)
+	}
+	if len(roots) == 0 && service.Build != nil && service.Build.Context != "" {
+		roots = append(roots, service.Build.Context)
+	}
+	return roots
+}
+
+// devRebuildPatterns returns the x-develop.rebuild patterns of a service, and whether they are declared
+func devRebuildPatterns(service types.ServiceConfig) ([]string, bool) {
+	xdevelop, _ := service.Extensions["x-develop"].(map[string]any)
+	list, declared := xdevelop["rebuild"].([]any)
+	patterns := make([]string, 0, len(list))
+	for _, pattern := range list {
+		patterns = append(patterns, fmt.Sprint(pattern))
+	}
+	return patterns, declared
+}
+
+// devRebuildTriggers returns the files of a service whose change requires rebuilding its image: the
+// Dockerfile, the .dockerignore and, unless x-develop.rebuild replaces them, the dependency manifests
+// at the root of the build context
+func devRebuildTriggers(service types.ServiceConfig) map[string]bool {
+	triggers := map[string]bool{}
+	if service.Build == nil || service.Build.Context == "" {
+		return triggers
+	}
+	context := service.Build.Context
+	if service.Build.DockerfileInline == "" {
+		dockerfile := cmp.Or(service.Build.Dockerfile, "Dockerfile")
+		if !filepath.IsAbs(dockerfile) {
+			dockerfile = filepath.Join(context, dockerfile)
+		}
+		triggers[dockerfile] = true
+		triggers[dockerfile+".dockerignore"] = true
+	}
+	triggers[filepath.Join(context, ".dockerignore")] = true
+	if _, declared := devRebuildPatterns(service); declared {
+		return triggers
+	}
+	for _, manifest := range devDependencyManifests {
+		triggers[filepath.Join(context, manifest)] = true
+	}
+	return triggers
+}
+
+// devPathMatches tells if a path below root matches one of the patterns, an --ignore or x-develop.rebuild
+// one, matched against the path relative to root, as a parent directory, and against the file name
+func devPathMatches(root, path string, patterns []string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(filepath.FromSlash(pattern), string(filepath.Separator))
+		if ok, _ := filepath.Match(pattern, rel); ok || rel == pattern || strings.HasPrefix(rel, pattern+string(filepath.Separator)) {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotDevFiles stamps the files under roots, skipping .git directories and ignored paths.
+// Triggers are stamped even outside of the roots, e.g. a Dockerfile out of the build context.
+func snapshotDevFiles(roots []string, triggers map[string]bool, ignore []string) map[string]devFileStamp {
+	files := map[string]devFileStamp{}
+	for _, root := range roots {
+		_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if path != root && (entry.Name() == ".git" || devPathMatches(root, path, ignore)) {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			if info, err := entry.Info(); err == nil {
+				files[path] = devFileStamp{size: info.Size(), modTime: info.ModTime()}
+			}
+			return nil
+		})
+	}
+	for trigger := range triggers {
+		if info, err := os.Stat(trigger); err == nil && !info.IsDir() {
+			files[trigger] = devFileStamp{size: info.Size(), modTime: info.ModTime()}
+		}
+	}
+	return files
+}
+
+// diffDevSnapshots returns the files added, removed or modified between two snapshots, sorted
+func diffDevSnapshots(before, after map[string]devFileStamp) []string {
+	var changed []string
+	for path, stamp := range after {
+		if previous, ok := before[path]; !ok || previous != stamp {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// classifyChanges splits changed files between those requiring a rebuild and source files
+func (w *devWatch) classifyChanges(changed []string) (rebuild, source []string) {
+	for _, path := range changed {
+		if w.triggers[path] || (w.context != "" && devPathMatches(w.context, path, w.rebuild)) {
+			rebuild = append(rebuild, path)
+		} else {
+			source = append(source, path)
+		}
+	}
+	return rebuild, source
+}
+
+// setupHotReload polls the watched files of every service with a build context or --watch paths,
+// and reloads a service when they change: a rebuild and recreate for Dockerfile and dependency
+// changes with --rebuild-on-dockerfile-change or x-develop.rebuild, a restart following
+// --restart-policy otherwise
+func setupHotReload(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, opts *devOptions) error {
+	if opts.pollInterval < 1 {
+		return fmt.Errorf("--poll-interval must be at least 1 second, got %d", opts.pollInterval)
+	}
+	var watches []*devWatch
+	for _, name := range watchedDevServices(project, opts) {
+		service, err := project.GetService(name)
+		if err != nil {
+			return err
+		}
+		roots := devWatchRoots(project, service, opts)
+		if len(roots) == 0 {
+			fmt.Printf("Service %s has no build context, use --watch to reload it on changes\n", name)
+			continue
+		}
+		triggers := devRebuildTriggers(service)
+		watch := &devWatch{
+			service:  name,
+			roots:    roots,
+			triggers: triggers,
+			files:    snapshotDevFiles(roots, triggers, opts.ignorePaths),
+		}
+		if service.Build != nil {
+			watch.context = service.Build.Context
+			watch.rebuild, watch.declared = devRebuildPatterns(service)
+		}
+		watches = append(watches, watch)
+		fmt.Printf("Watching %s for service %s\n", strings.Join(roots, ", "), name)
+	}
+	if len(watches) == 0 {
+		return nil
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(opts.pollInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, watch := range watches {
+				scanStart := time.Now()
+				files := snapshotDevFiles(watch.roots, watch.triggers, opts.ignorePaths)
+				detectedAt := time.Now()
+				changed := diffDevSnapshots(watch.files, files)
+				watch.files = files
+				if len(changed) == 0 {
+					continue
+				}
+				err := reloadDevService(ctx, backend, project, watch, changed, opts)
+				if err != nil && ctx.Err() == nil {
+					fmt.Printf("Warning: Failed to reload service %s: %v\n", watch.service, err)
+				}
+				if opts.syncStats && err == nil {
+					event := devSyncEvent{
+						Detect: devChangeDetectDelay(files, changed, detectedAt),
+						Scan:   detectedAt.Sub(scanStart),
+						Reload: time.Since(detectedAt),
+					}
+					average := watch.stats.add(event)
+					fmt.Println(formatDevSyncEvent(watch.service, event, average, len(watch.stats.totals)))
+				}
+			}
+		}
+	}()
 	return nil
 }
 
+// reloadDevService applies the reload matching the changed files of a service, reporting which one
+func reloadDevService(ctx context.Context, backend api.Compose, project *types.Project, watch *devWatch, changed []string, opts *devOptions) error {
+	rebuild, _ := watch.classifyChanges(changed)
+	if len(rebuild) > 0 {
+		names := make([]string, 0, len(rebuild))
+		for _, path := range rebuild {
+			names = append(names, filepath.Base(path))
+		}
+		if opts.rebuildOnDockerfileChange || watch.declared {
+			fmt.Printf("%s: %s changed, rebuilding and recreating\n", watch.service, strings.Join(names, ", "))
+			if err := backend.Build(ctx, project, api.BuildOptions{Services: []string{watch.service}}); err != nil {
+				return err
+			}
+			return backend.Up(ctx, project, api.UpOptions{
+				Create: api.CreateOptions{
+					Services:             []string{watch.service},
+					Recreate:             api.RecreateForce,
+					RecreateDependencies: api.RecreateNever,
+				},
+				Start: api.StartOptions{Project: project, Services: []string{watch.service}},
+			})
+		}
+		fmt.Printf("Warning: %s: %s changed, the image is stale until rebuilt, use --rebuild-on-dockerfile-change\n", watch.service, strings.Join(names, ", "))
+	}
+
+	switch opts.restartPolicy {
+	case "never":
+		fmt.Printf("%s: %d file(s) changed, not restarting (--restart-policy never)\n", watch.service, len(changed))
+		return nil
+	case "on-failure":
+		containers, err := backend.Ps(ctx, project.Name, api.PsOptions{All: true, Services: []string{watch.service}})
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(containers, func(c api.ContainerSummary) bool { return c.State != "running" }) {
+			fmt.Printf("%s: %d file(s) changed, running fine, not restarting (--restart-policy on-failure)\n", watch.service, len(changed))
+			return nil
+		}
+	}
+	fmt.Printf("%s: %d file(s) changed, restarting\n", watch.service, len(changed))
+	return backend.Restart(ctx, project.Name, api.RestartOptions{Project: project, Services: []string{watch.service}})
+}
+
 func setupCodeSync(ctx context.Context, dockerCli command.Cli, project *types.Project, opts *devOptions) error {
 	// Parse sync specification
 	parts := strings.Split(opts.sync, ":")
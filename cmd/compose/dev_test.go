@@ -0,0 +1,262 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestParsePortForward(t *testing.T) {
+	forward, err := parsePortForward("8080:80", "web")
+	require.NoError(t, err)
+	assert.Equal(t, portForward{Service: "web", Published: "8080", Target: 80}, forward)
+
+	forward, err = parsePortForward("api:9000:9001", "web")
+	require.NoError(t, err)
+	assert.Equal(t, portForward{Service: "api", Published: "9000", Target: 9001}, forward)
+
+	_, err = parsePortForward("8080:80", "")
+	assert.ErrorContains(t, err, "a service is required")
+
+	_, err = parsePortForward("8080", "web")
+	assert.ErrorContains(t, err, "expected [SERVICE:]HOST_PORT:CONTAINER_PORT")
+
+	_, err = parsePortForward("8080:http", "web")
+	assert.ErrorContains(t, err, "invalid container port")
+}
+
+func TestApplyPortForward(t *testing.T) {
+	project := &types.Project{Services: types.Services{
+		"web": {Name: "web", Ports: []types.ServicePortConfig{{Target: 80, Published: "8000"}}},
+	}}
+
+	assert.False(t, applyPortForward(project, portForward{Service: "web", Published: "8080", Target: 80}))
+	assert.True(t, applyPortForward(project, portForward{Service: "web", Published: "5678", Target: 5678}))
+	assert.Len(t, project.Services["web"].Ports, 2)
+	assert.Equal(t, "5678", project.Services["web"].Ports[1].Published)
+}
+
+func TestWatchedDevServices(t *testing.T) {
+	project := &types.Project{Services: types.Services{
+		"web": {Name: "web"},
+		"db":  {Name: "db"},
+	}}
+	assert.Equal(t, []string{"db", "web"}, watchedDevServices(project, &devOptions{}))
+	assert.Equal(t, []string{"web"}, watchedDevServices(project, &devOptions{services: []string{"web"}}))
+}
+
+func TestDevOnStartCommand(t *testing.T) {
+	service := types.ServiceConfig{Name: "web", Extensions: types.Extensions{
+		"x-develop": map[string]any{"on-start": "npm install", "on-start-files": []any{"package.json"}},
+	}}
+	assert.Equal(t, []string{"/bin/sh", "-c", "npm install"}, devOnStartCommand(service, ""))
+	assert.Equal(t, []string{"/bin/sh", "-c", "make migrate"}, devOnStartCommand(service, "make migrate"))
+	assert.Nil(t, devOnStartCommand(types.ServiceConfig{Name: "db"}, ""))
+	assert.Equal(t, []string{"package.json"}, devOnStartFiles(service, nil))
+	assert.Equal(t, []string{"go.sum"}, devOnStartFiles(service, []string{"go.sum"}))
+}
+
+func TestRunDevOnStart(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{}`), 0o644))
+	project := &types.Project{Name: "app", WorkingDir: dir, Services: types.Services{
+		"web": {Name: "web", Extensions: types.Extensions{
+			"x-develop": map[string]any{"on-start": "npm install", "on-start-files": []any{"package.json"}},
+		}},
+		"db": {Name: "db"},
+	}}
+	opts := &devOptions{services: []string{"web", "db"}}
+
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	backend.EXPECT().Ps(gomock.Any(), "app", api.PsOptions{Services: []string{"web"}}).Return([]api.ContainerSummary{
+		{ID: "c1", Service: "web", State: "running", Labels: map[string]string{api.ContainerNumberLabel: "1"}},
+	}, nil).Times(3)
+	backend.EXPECT().Exec(gomock.Any(), "app", api.RunOptions{
+		Service: "web",
+		Command: []string{"/bin/sh", "-c", "npm install"},
+		Index:   1,
+	}).Return(0, nil).Times(2)
+
+	require.NoError(t, runDevOnStart(context.Background(), backend, project, opts))
+	// same container and dependencies, the command is not run again
+	require.NoError(t, runDevOnStart(context.Background(), backend, project, opts))
+	// a changed dependency runs it again
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"name":"app"}`), 0o644))
+	require.NoError(t, runDevOnStart(context.Background(), backend, project, opts))
+}
+
+func TestStopDevEnvironment(t *testing.T) {
+	project := &types.Project{Name: "app", Services: types.Services{"web": {Name: "web"}}}
+	require.True(t, applyPortForward(project, portForward{Service: "web", Published: "8080", Target: 80}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	// the session ends on an interrupt, the containers with forwarded ports are still removed
+	backend.EXPECT().Down(gomock.Any(), "app", api.DownOptions{}).DoAndReturn(
+		func(ctx context.Context, _ string, _ api.DownOptions) error {
+			assert.NoError(t, ctx.Err())
+			return ctx.Err()
+		})
+	stopDevEnvironment(ctx, backend, project)
+}
+
+func TestClassifyDevChanges(t *testing.T) {
+	dir := t.TempDir()
+	service := types.ServiceConfig{Name: "web", Build: &types.BuildConfig{Context: dir, Dockerfile: "docker/Dockerfile.dev"}}
+	triggers := devRebuildTriggers(service)
+	assert.True(t, triggers[filepath.Join(dir, "docker", "Dockerfile.dev")])
+	assert.True(t, triggers[filepath.Join(dir, ".dockerignore")])
+	assert.True(t, triggers[filepath.Join(dir, "package.json")])
+	assert.False(t, triggers[filepath.Join(dir, "src", "package.json")])
+
+	watch := &devWatch{service: "web", triggers: triggers}
+	rebuild, source := watch.classifyChanges([]string{
+		filepath.Join(dir, "docker", "Dockerfile.dev"),
+		filepath.Join(dir, "src", "main.js"),
+		filepath.Join(dir, "package.json"),
+	})
+	assert.Equal(t, []string{filepath.Join(dir, "docker", "Dockerfile.dev"), filepath.Join(dir, "package.json")}, rebuild)
+	assert.Equal(t, []string{filepath.Join(dir, "src", "main.js")}, source)
+
+	assert.Empty(t, devRebuildTriggers(types.ServiceConfig{Name: "db", Image: "postgres"}))
+
+	// x-develop.rebuild replaces the default dependency manifests
+	service.Extensions = types.Extensions{"x-develop": map[string]any{"rebuild": []any{"packages/*/package.json", "*.csproj"}}}
+	patterns, declared := devRebuildPatterns(service)
+	assert.True(t, declared)
+	assert.Equal(t, []string{"packages/*/package.json", "*.csproj"}, patterns)
+	triggers = devRebuildTriggers(service)
+	assert.True(t, triggers[filepath.Join(dir, "docker", "Dockerfile.dev")])
+	assert.False(t, triggers[filepath.Join(dir, "package.json")])
+
+	watch = &devWatch{service: "web", triggers: triggers, context: dir, rebuild: patterns, declared: declared}
+	rebuild, source = watch.classifyChanges([]string{
+		filepath.Join(dir, "api", "Api.csproj"),
+		filepath.Join(dir, "package.json"),
+		filepath.Join(dir, "packages", "ui", "package.json"),
+		filepath.Join(dir, "packages", "ui", "src", "package.json"),
+		filepath.Join(filepath.Dir(dir), "Other.csproj"),
+	})
+	assert.Equal(t, []string{filepath.Join(dir, "api", "Api.csproj"), filepath.Join(dir, "packages", "ui", "package.json")}, rebuild)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "package.json"),
+		filepath.Join(dir, "packages", "ui", "src", "package.json"),
+		filepath.Join(filepath.Dir(dir), "Other.csproj"),
+	}, source)
+
+	_, declared = devRebuildPatterns(types.ServiceConfig{Name: "db", Image: "postgres"})
+	assert.False(t, declared)
+}
+
+func TestSnapshotDevFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "src"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "node_modules", "lib"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "main.js"), []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "node_modules", "lib", "index.js"), []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "debug.log"), []byte("a"), 0o644))
+
+	before := snapshotDevFiles([]string{dir}, nil, []string{"node_modules/", "*.log"})
+	assert.Len(t, before, 1)
+	assert.Contains(t, before, filepath.Join(dir, "src", "main.js"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "main.js"), []byte("ab"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "util.js"), []byte("a"), 0o644))
+	after := snapshotDevFiles([]string{dir}, nil, []string{"node_modules/", "*.log"})
+	assert.Equal(t, []string{filepath.Join(dir, "src", "main.js"), filepath.Join(dir, "src", "util.js")}, diffDevSnapshots(before, after))
+	assert.Equal(t, []string{filepath.Join(dir, "src", "main.js"), filepath.Join(dir, "src", "util.js")}, diffDevSnapshots(after, before))
+	assert.Empty(t, diffDevSnapshots(after, after))
+}
+
+func TestReloadDevService(t *testing.T) {
+	dir := t.TempDir()
+	project := &types.Project{Name: "app", WorkingDir: dir, Services: types.Services{
+		"web": {Name: "web", Build: &types.BuildConfig{Context: dir}},
+	}}
+	service := project.Services["web"]
+	watch := &devWatch{service: "web", roots: []string{dir}, triggers: devRebuildTriggers(service)}
+	dockerfile := []string{filepath.Join(dir, "Dockerfile")}
+	source := []string{filepath.Join(dir, "main.go")}
+
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	backend.EXPECT().Build(gomock.Any(), project, api.BuildOptions{Services: []string{"web"}}).Return(nil)
+	backend.EXPECT().Up(gomock.Any(), project, gomock.Cond(func(o api.UpOptions) bool {
+		return o.Create.Recreate == api.RecreateForce && slices.Equal(o.Create.Services, []string{"web"})
+	})).Return(nil)
+	require.NoError(t, reloadDevService(context.Background(), backend, project, watch, dockerfile, &devOptions{rebuildOnDockerfileChange: true, restartPolicy: "always"}))
+
+	restart := api.RestartOptions{Project: project, Services: []string{"web"}}
+	backend.EXPECT().Restart(gomock.Any(), "app", restart).Return(nil).Times(2)
+	require.NoError(t, reloadDevService(context.Background(), backend, project, watch, source, &devOptions{rebuildOnDockerfileChange: true, restartPolicy: "always"}))
+	// without the flag, a Dockerfile change falls back to a restart
+	require.NoError(t, reloadDevService(context.Background(), backend, project, watch, dockerfile, &devOptions{restartPolicy: "always"}))
+
+	require.NoError(t, reloadDevService(context.Background(), backend, project, watch, source, &devOptions{restartPolicy: "never"}))
+
+	backend.EXPECT().Ps(gomock.Any(), "app", api.PsOptions{All: true, Services: []string{"web"}}).Return([]api.ContainerSummary{
+		{ID: "c1", Service: "web", State: "running"},
+	}, nil)
+	require.NoError(t, reloadDevService(context.Background(), backend, project, watch, source, &devOptions{restartPolicy: "on-failure"}))
+
+	// declaring x-develop.rebuild rebuilds a dependency change without the flag
+	watch = &devWatch{service: "web", roots: []string{dir}, triggers: devRebuildTriggers(service), context: dir, rebuild: []string{"go.mod"}, declared: true}
+	backend.EXPECT().Build(gomock.Any(), project, api.BuildOptions{Services: []string{"web"}}).Return(nil)
+	backend.EXPECT().Up(gomock.Any(), project, gomock.Any()).Return(nil)
+	require.NoError(t, reloadDevService(context.Background(), backend, project, watch, []string{filepath.Join(dir, "go.mod")}, &devOptions{restartPolicy: "always"}))
+}
+
+func TestDevSyncStats(t *testing.T) {
+	now := time.Now()
+	files := map[string]devFileStamp{
+		"/src/a.go": {modTime: now.Add(-3 * time.Second)},
+		"/src/b.go": {modTime: now.Add(-1500 * time.Millisecond)},
+	}
+	assert.Equal(t, 1500*time.Millisecond, devChangeDetectDelay(files, []string{"/src/a.go", "/src/b.go"}, now))
+	assert.Zero(t, devChangeDetectDelay(files, []string{"/src/removed.go"}, now))
+
+	var stats devSyncStats
+	event := devSyncEvent{Detect: 1500 * time.Millisecond, Scan: 3 * time.Millisecond, Reload: 500 * time.Millisecond}
+	assert.Equal(t, 2*time.Second, stats.add(event))
+	assert.Equal(t, 1500*time.Millisecond, stats.add(devSyncEvent{Reload: time.Second}))
+	assert.Equal(t, "[sync-stats] web: detect 1.5s (scan 3ms), reload 500ms, total 2s, avg 1.5s over 2",
+		formatDevSyncEvent("web", event, 1500*time.Millisecond, len(stats.totals)))
+
+	// the average only covers the last reloads
+	for range devSyncStatsWindow {
+		stats.add(devSyncEvent{Reload: 100 * time.Millisecond})
+	}
+	assert.Len(t, stats.totals, devSyncStatsWindow)
+	assert.Equal(t, 100*time.Millisecond, stats.add(devSyncEvent{Reload: 100 * time.Millisecond}))
+}
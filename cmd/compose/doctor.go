@@ -0,0 +1,222 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/cli/cli/command"
+	"github.com/spf13/cobra"
+
+	"github.com/docker/compose/v5/pkg/extensions"
+)
+
+type doctorOptions struct {
+	fix bool
+}
+
+func doctorCommand(dockerCli command.Cli) *cobra.Command {
+	opts := doctorOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "doctor [OPTIONS]",
+		Short: "Check the state stored by the extension commands",
+		Long: `EXPERIMENTAL - Check the state stored by the extension commands.
+
+This command inspects the directories used by env, secret and rollback
+(~/.docker/compose/{environments,secrets,history}) and reports:
+- Dangling active environment pointer
+- Environments missing their compose file
+- Unreadable secret store, or malformed secrets
+- Malformed version history
+`,
+		RunE: Adapt(func(ctx context.Context, args []string) error {
+			return runDoctor(ctx, dockerCli, opts)
+		}),
+	}
+
+	cmd.Flags().BoolVar(&opts.fix, "fix", false, "Repair the problems that can be fixed automatically")
+	return cmd
+}
+
+// doctorProblem is an inconsistency found in the extension state
+type doctorProblem struct {
+	Description string
+	// Fix repairs the problem, nil when it requires manual intervention
+	Fix func() error
+}
+
+func runDoctor(ctx context.Context, dockerCli command.Cli, opts doctorOptions) error {
+	var problems []doctorProblem
+	problems = append(problems, checkEnvironmentsState(getEnvironmentsDir())...)
+	problems = append(problems, checkSecretsState(extensions.StateDir("secrets"))...)
+	problems = append(problems, checkHistoryState(extensions.DefaultHistoryStore().Dir)...)
+
+	out := dockerCli.Out()
+	if len(problems) == 0 {
+		_, _ = fmt.Fprintln(out, "No problems found.")
+		return nil
+	}
+
+	unresolved := 0
+	for _, problem := range problems {
+		switch {
+		case opts.fix && problem.Fix != nil:
+			if err := problem.Fix(); err != nil {
+				_, _ = fmt.Fprintf(out, "[FAILED] %s: %v\n", problem.Description, err)
+				unresolved++
+				continue
+			}
+			_, _ = fmt.Fprintf(out, "[FIXED]  %s\n", problem.Description)
+		case problem.Fix != nil:
+			_, _ = fmt.Fprintf(out, "[FIXABLE] %s\n", problem.Description)
+			unresolved++
+		default:
+			_, _ = fmt.Fprintf(out, "[MANUAL] %s\n", problem.Description)
+			unresolved++
+		}
+	}
+
+	if unresolved > 0 {
+		if !opts.fix {
+			_, _ = fmt.Fprintln(out, "\nRun 'docker compose doctor --fix' to repair fixable problems.")
+		}
+		return fmt.Errorf("%d problem(s) found", unresolved)
+	}
+	return nil
+}
+
+func checkEnvironmentsState(envsDir string) []doctorProblem {
+	entries, err := os.ReadDir(envsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return []doctorProblem{{Description: fmt.Sprintf("environments directory %s is unreadable: %v", envsDir, err)}}
+	}
+
+	var problems []doctorProblem
+	currentEnv, err := getCurrentEnvironment(envsDir)
+	if err == nil {
+		if info, err := os.Stat(filepath.Join(envsDir, currentEnv)); currentEnv == "" || err != nil || !info.IsDir() {
+			problems = append(problems, doctorProblem{
+				Description: fmt.Sprintf("active environment %q does not exist", currentEnv),
+				Fix: func() error {
+					return os.Remove(filepath.Join(envsDir, "current"))
+				},
+			})
+		}
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		composeFile := filepath.Join(envsDir, entry.Name(), "compose.yaml")
+		if _, err := os.Stat(composeFile); err != nil {
+			problems = append(problems, doctorProblem{
+				Description: fmt.Sprintf("environment %q has no compose.yaml", entry.Name()),
+			})
+		}
+	}
+	return problems
+}
+
+func checkSecretsState(secretsDir string) []doctorProblem {
+	store := extensions.NewSecretStore(secretsDir)
+	var problems []doctorProblem
+	err := filepath.WalkDir(secretsDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && path == secretsDir {
+				return filepath.SkipDir
+			}
+			problems = append(problems, doctorProblem{
+				Description: fmt.Sprintf("secret store entry %s is unreadable: %v", path, err),
+			})
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		// secrets are read as the secret store does, so a corrupt one is reported
+		if rel, err := filepath.Rel(store.Dir, path); err == nil && filepath.Ext(path) == ".json" && !strings.HasPrefix(path, store.FilesDir()+string(filepath.Separator)) {
+			if _, err := store.Get(filepath.ToSlash(strings.TrimSuffix(rel, ".json"))); err != nil {
+				problems = append(problems, doctorProblem{
+					Description: fmt.Sprintf("secret store entry %s is malformed: %v", path, err),
+					Fix: func() error {
+						// keep the broken file aside for inspection rather than deleting it
+						return os.Rename(path, path+".corrupt")
+					},
+				})
+			}
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			problems = append(problems, doctorProblem{
+				Description: fmt.Sprintf("secret store entry %s is unreadable: %v", path, err),
+			})
+			return nil
+		}
+		return f.Close()
+	})
+	if err != nil {
+		problems = append(problems, doctorProblem{
+			Description: fmt.Sprintf("secret store %s is unreadable: %v", secretsDir, err),
+		})
+	}
+	return problems
+}
+
+func checkHistoryState(historyDir string) []doctorProblem {
+	entries, err := os.ReadDir(historyDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return []doctorProblem{{Description: fmt.Sprintf("history directory %s is unreadable: %v", historyDir, err)}}
+	}
+
+	var problems []doctorProblem
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(historyDir, entry.Name())
+		content, err := os.ReadFile(path)
+		if err == nil {
+			var history []extensions.VersionInfo
+			err = json.Unmarshal(content, &history)
+		}
+		if err != nil {
+			problems = append(problems, doctorProblem{
+				Description: fmt.Sprintf("version history %s is malformed: %v", path, err),
+				Fix: func() error {
+					// keep the broken file aside for inspection rather than deleting it
+					return os.Rename(path, path+".corrupt")
+				},
+			})
+		}
+	}
+	return problems
+}
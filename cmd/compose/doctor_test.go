@@ -0,0 +1,71 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckEnvironmentsStateDanglingCurrent(t *testing.T) {
+	envsDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(envsDir, "current"), []byte("gone"), 0o644))
+
+	problems := checkEnvironmentsState(envsDir)
+	require.Len(t, problems, 1)
+	assert.Equal(t, `active environment "gone" does not exist`, problems[0].Description)
+	require.NotNil(t, problems[0].Fix)
+
+	require.NoError(t, problems[0].Fix())
+	assert.NoFileExists(t, filepath.Join(envsDir, "current"))
+	assert.Empty(t, checkEnvironmentsState(envsDir))
+}
+
+func TestCheckHistoryStateMalformed(t *testing.T) {
+	historyDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(historyDir, "good.json"), []byte(`[{"version":"v1"}]`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(historyDir, "bad.json"), []byte(`{not json`), 0o644))
+
+	problems := checkHistoryState(historyDir)
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0].Description, "bad.json is malformed")
+
+	require.NoError(t, problems[0].Fix())
+	assert.FileExists(t, filepath.Join(historyDir, "bad.json.corrupt"))
+	assert.Empty(t, checkHistoryState(historyDir))
+}
+
+func TestCheckSecretsStateMalformed(t *testing.T) {
+	secretsDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(secretsDir, "prod"), 0o700))
+	require.NoError(t, os.MkdirAll(filepath.Join(secretsDir, "files"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(secretsDir, "prod", "good.json"), []byte(`{"name":"prod/good","value":"s3cr3t"}`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(secretsDir, "prod", "bad.json"), []byte(`{not json`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(secretsDir, "files", "published.json"), []byte(`not a secret`), 0o600))
+
+	problems := checkSecretsState(secretsDir)
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0].Description, "bad.json is malformed: failed to parse secret 'prod/bad'")
+
+	require.NoError(t, problems[0].Fix())
+	assert.FileExists(t, filepath.Join(secretsDir, "prod", "bad.json.corrupt"))
+	assert.Empty(t, checkSecretsState(secretsDir))
+}
@@ -17,14 +17,45 @@
 package compose
 
 import (
+	"bytes"
 	"context"
+	"embed"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"text/template"
+	"time"
 
+	"github.com/compose-spec/compose-go/v2/dotenv"
+	"github.com/compose-spec/compose-go/v2/loader"
 	"github.com/docker/cli/cli/command"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v4"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/cmd/prompt"
+	"github.com/docker/compose/v5/internal/bundle"
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/extensions"
 )
 
 type envOptions struct {
@@ -35,11 +66,34 @@ type envOptions struct {
 	deactivate  bool
 	create      bool
 	remove      bool
+	force       bool
+	syncFrom    string
 	importFile  string
+	insecure    bool
 	exportFile  string
 	description string
+	format      string
+	template    string
+	templateURL string
+	parent      string
+	show        bool
+	resolved    bool
+	clone       string
+	withData    bool
+
+	postActivate string
+	output       string
+
+	set   []string
+	unset []string
+	get   string
 }
 
+// envTemplates holds the built-in environment templates, one compose file per template
+//
+//go:embed envtemplates/*.yaml
+var envTemplates embed.FS
+
 func envCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *BackendOptions) *cobra.Command {
 	opts := envOptions{
 		ProjectOptions: p,
@@ -52,6 +106,36 @@ func envCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *Backen
 
 This command helps you create and manage different environment configurations
 (development, testing, production) and easily switch between them.
+
+An environment created with --parent inherits the .env and compose.yaml of its
+parent, its own values being layered on top.
+
+Removing the active environment requires --force, or an interactive confirmation.
+
+Activating an environment whose compose.yaml is older than the project compose file
+prints a warning, as the environment likely missed recent changes. Refresh it with
+--sync-from, or use --force to silence the warning.
+
+Activation first checks that the compose files of the environment load and its .env files
+are readable, then atomically switches the active environment. The --post-activate command,
+or the post-activate.sh script of the environment, then runs with COMPOSE_ENVIRONMENT and
+COMPOSE_PREVIOUS_ENVIRONMENT set. If it fails, the previously active environment is restored.
+
+An environment created with --clone SOURCE is a copy of the files of SOURCE. With
+--with-data, the clone gets its own project name (COMPOSE_PROJECT_NAME in its .env), the
+named volumes of the SOURCE project are copied into volumes of the clone project, and the
+secrets of the SOURCE namespace ("SOURCE/...") are copied to the clone namespace. Copying
+more than 1GB of volume data requires a confirmation, or --force.
+
+--set KEY=VALUE and --unset KEY edit the .env of an environment (the active one by default)
+in place: an existing assignment is replaced where it is, new variables are appended, and
+comments and other lines are kept. --get KEY prints the value of a variable, including the
+values inherited from parent environments with --resolved.
+
+--export writes the files of the environment as the same checksummed archive as
+"share --method archive", so exported environments can be imported with "share --import"
+and shared projects with --import, which still accepts a plain compose file. Archives
+without a manifest can't be verified, they are only imported with --insecure.
 `,
 		RunE: Adapt(func(ctx context.Context, args []string) error {
 			if len(args) > 0 {
@@ -66,9 +150,25 @@ This command helps you create and manage different environment configurations
 	cmd.Flags().BoolVar(&opts.deactivate, "deactivate", false, "Deactivate current environment")
 	cmd.Flags().BoolVar(&opts.create, "create", false, "Create new environment")
 	cmd.Flags().BoolVar(&opts.remove, "remove", false, "Remove environment")
-	cmd.Flags().StringVar(&opts.importFile, "import", "", "Import environment from file")
-	cmd.Flags().StringVar(&opts.exportFile, "export", "", "Export environment to file")
+	cmd.Flags().BoolVar(&opts.force, "force", false, "With --remove, remove the environment even if it is active. With --activate, don't warn about a stale compose file")
+	cmd.Flags().StringVar(&opts.syncFrom, "sync-from", "", "Refresh the environment compose.yaml from a compose file")
+	cmd.Flags().StringVar(&opts.importFile, "import", "", "Import environment from an archive or a compose file")
+	cmd.Flags().BoolVar(&opts.insecure, "insecure", false, "Import archives without a manifest, whose content can't be verified, with --import")
+	cmd.Flags().StringVar(&opts.exportFile, "export", "", "Export environment to an archive")
 	cmd.Flags().StringVar(&opts.description, "description", "", "Environment description")
+	cmd.Flags().StringVar(&opts.format, "format", "text", "Output format of --list, --show and the current environment (text, json)")
+	addOutputFlag(cmd.Flags(), &opts.output, "the output of --list, --show and the current environment")
+	cmd.Flags().StringVar(&opts.template, "template", "", fmt.Sprintf("Create the environment from a built-in template (%s)", strings.Join(builtinEnvTemplates(), ", ")))
+	cmd.Flags().StringVar(&opts.templateURL, "template-url", "", "Create the environment from a template fetched from a URL")
+	cmd.Flags().StringVar(&opts.parent, "parent", "", "Environment the created environment inherits from")
+	cmd.Flags().BoolVar(&opts.show, "show", false, "Show an environment (the active one by default)")
+	cmd.Flags().StringVar(&opts.postActivate, "post-activate", "", "With --activate, command to run once activated, the previous environment being restored if it fails (overrides post-activate.sh)")
+	cmd.Flags().BoolVar(&opts.resolved, "resolved", false, "With --show and --get, merge the values inherited from parent environments")
+	cmd.Flags().StringVar(&opts.clone, "clone", "", "Create the environment as a copy of an existing one")
+	cmd.Flags().StringArrayVar(&opts.set, "set", nil, "Set a variable in the .env of the environment (KEY=VALUE)")
+	cmd.Flags().StringArrayVar(&opts.unset, "unset", nil, "Remove a variable from the .env of the environment")
+	cmd.Flags().StringVar(&opts.get, "get", "", "Print the value of a variable of the environment")
+	cmd.Flags().BoolVar(&opts.withData, "with-data", false, "With --clone, also copy the volumes and secrets of the environment")
 	return cmd
 }
 
@@ -81,7 +181,9 @@ func runEnv(ctx context.Context, dockerCli command.Cli, backendOptions *BackendO
 
 	// List environments
 	if opts.list {
-		return listEnvironments(envsDir)
+		return writeOutput(opts.output, 0o644, os.Stdout, func(w io.Writer) error {
+			return listEnvironments(w, envsDir, opts.format)
+		})
 	}
 
 	// Create environment
@@ -89,7 +191,76 @@ func runEnv(ctx context.Context, dockerCli command.Cli, backendOptions *BackendO
 		if opts.name == "" {
 			return fmt.Errorf("environment name is required")
 		}
-		return createEnvironment(envsDir, opts.name, opts.description)
+		composeContent := ""
+		if opts.template != "" || opts.templateURL != "" {
+			content, err := loadEnvironmentTemplate(ctx, opts.template, opts.templateURL)
+			if err != nil {
+				return err
+			}
+			if composeContent, err = renderEnvironmentTemplate(content, opts.name); err != nil {
+				return err
+			}
+		}
+		if opts.parent != "" {
+			return createChildEnvironment(envsDir, opts.name, opts.description, composeContent, opts.parent)
+		}
+		return createEnvironment(envsDir, opts.name, opts.description, composeContent)
+	}
+
+	// Clone environment
+	if opts.clone != "" {
+		if opts.name == "" {
+			return fmt.Errorf("environment name is required")
+		}
+		if err := cloneEnvironment(envsDir, opts.clone, opts.name, opts.description); err != nil {
+			return err
+		}
+		if opts.withData {
+			return cloneEnvironmentData(ctx, dockerCli, envsDir, opts)
+		}
+		return nil
+	}
+	if opts.withData {
+		return fmt.Errorf("--with-data requires --clone")
+	}
+
+	// Show environment
+	if opts.show {
+		name := opts.name
+		if name == "" {
+			current, err := getCurrentEnvironment(envsDir)
+			if err != nil || current == "" {
+				return fmt.Errorf("no active environment, specify the environment to show")
+			}
+			name = current
+		}
+		return writeOutput(opts.output, 0o644, os.Stdout, func(w io.Writer) error {
+			return showEnvironment(w, envsDir, name, opts.resolved, opts.format)
+		})
+	}
+
+	// Edit environment variables
+	if len(opts.set) > 0 || len(opts.unset) > 0 || opts.get != "" {
+		if opts.get != "" && (len(opts.set) > 0 || len(opts.unset) > 0) {
+			return fmt.Errorf("--get cannot be combined with --set or --unset")
+		}
+		name := opts.name
+		if name == "" {
+			current, err := getCurrentEnvironment(envsDir)
+			if err != nil || current == "" {
+				return fmt.Errorf("no active environment, specify the environment to edit")
+			}
+			name = current
+		}
+		if opts.get != "" {
+			value, err := getEnvironmentVariable(envsDir, name, opts.get, opts.resolved)
+			if err != nil {
+				return err
+			}
+			fmt.Println(value)
+			return nil
+		}
+		return editEnvironmentVariables(envsDir, name, opts.set, opts.unset)
 	}
 
 	// Remove environment
@@ -97,7 +268,16 @@ func runEnv(ctx context.Context, dockerCli command.Cli, backendOptions *BackendO
 		if opts.name == "" {
 			return fmt.Errorf("environment name is required")
 		}
-		return removeEnvironment(envsDir, opts.name)
+		force := opts.force
+		if current, _ := getCurrentEnvironment(envsDir); !force && current == opts.name && dockerCli.In().IsTerminal() {
+			msg := fmt.Sprintf("Environment %q is active, deactivate and remove it? [y/N]: ", opts.name)
+			confirmed, err := prompt.NewPrompt(dockerCli.In(), dockerCli.Out()).Confirm(msg, false)
+			if err != nil {
+				return err
+			}
+			force = confirmed
+		}
+		return removeEnvironment(envsDir, opts.name, force)
 	}
 
 	// Activate environment
@@ -105,7 +285,14 @@ func runEnv(ctx context.Context, dockerCli command.Cli, backendOptions *BackendO
 		if opts.name == "" {
 			return fmt.Errorf("environment name is required")
 		}
-		return activateEnvironment(envsDir, opts.name)
+		projectFile := ""
+		if !opts.force {
+			projectFile = mainComposeFile(opts.ProjectOptions)
+		}
+		return activateEnvironment(ctx, envsDir, opts.name, projectFile, opts.postActivate)
+	}
+	if opts.postActivate != "" {
+		return fmt.Errorf("--post-activate requires --activate")
 	}
 
 	// Deactivate environment
@@ -113,12 +300,23 @@ func runEnv(ctx context.Context, dockerCli command.Cli, backendOptions *BackendO
 		return deactivateEnvironment(envsDir)
 	}
 
+	// Refresh environment
+	if opts.syncFrom != "" {
+		if opts.name == "" {
+			return fmt.Errorf("environment name is required")
+		}
+		return syncEnvironment(envsDir, opts.name, opts.syncFrom)
+	}
+
 	// Import environment
 	if opts.importFile != "" {
 		if opts.name == "" {
 			return fmt.Errorf("environment name is required")
 		}
-		return importEnvironment(envsDir, opts.name, opts.importFile)
+		return importEnvironment(envsDir, opts.name, opts.importFile, opts.insecure)
+	}
+	if opts.insecure {
+		return fmt.Errorf("--insecure requires --import")
 	}
 
 	// Export environment
@@ -126,72 +324,76 @@ func runEnv(ctx context.Context, dockerCli command.Cli, backendOptions *BackendO
 		if opts.name == "" {
 			return fmt.Errorf("environment name is required")
 		}
-		return exportEnvironment(envsDir, opts.name, opts.exportFile)
+		return exportEnvironment(ctx, dockerCli, envsDir, opts.name, opts.exportFile)
 	}
 
 	// Show current environment
-	return showCurrentEnvironment(envsDir)
+	return writeOutput(opts.output, 0o644, os.Stdout, func(w io.Writer) error {
+		switch opts.format {
+		case "text":
+			return showCurrentEnvironment(w, envsDir)
+		case "json":
+			return showCurrentEnvironmentJSON(w, envsDir)
+		default:
+			return fmt.Errorf("unsupported format: %s", opts.format)
+		}
+	})
 }
 
 func getEnvironmentsDir() string {
-	// Get user config directory based on platform
-	var configDir string
-	switch {
-	case os.Getenv("HOME") != "":
-		// Unix-like systems
-		configDir = filepath.Join(os.Getenv("HOME"), ".docker", "compose", "environments")
-	case os.Getenv("USERPROFILE") != "":
-		// Windows
-		configDir = filepath.Join(os.Getenv("USERPROFILE"), ".docker", "compose", "environments")
-	default:
-		// Fallback
-		configDir = ".docker-compose-environments"
-	}
-	return configDir
+	return extensions.StateDir("environments")
 }
 
-func listEnvironments(envsDir string) error {
+// listEnvironments prints the environments with their description, as text or as JSON
+func listEnvironments(w io.Writer, envsDir, format string) error {
 	files, err := os.ReadDir(envsDir)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("Available environments:")
-	fmt.Println("=====================")
-
 	// Get current environment
 	currentEnv, _ := getCurrentEnvironment(envsDir)
 
+	environments := []currentEnvironmentInfo{}
 	for _, file := range files {
 		if file.IsDir() {
-			status := ""
-			if file.Name() == currentEnv {
-				status = " [ACTIVE]"
-			}
+			environments = append(environments, environmentInfo(envsDir, file.Name(), file.Name() == currentEnv))
+		}
+	}
 
-			// Read description
-			descFile := filepath.Join(envsDir, file.Name(), "description.txt")
-			desc, err := os.ReadFile(descFile)
-			description := ""
-			if err == nil {
-				description = strings.TrimSpace(string(desc))
-			}
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(environments)
+	case "text":
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
 
-			fmt.Printf("%s%s\n", file.Name(), status)
-			if description != "" {
-				fmt.Printf("  Description: %s\n", description)
-			}
+	_, _ = fmt.Fprintln(w, "Available environments:")
+	_, _ = fmt.Fprintln(w, "=====================")
+	for _, env := range environments {
+		status := ""
+		if env.Active {
+			status = " [ACTIVE]"
+		}
+		_, _ = fmt.Fprintf(w, "%s%s\n", env.Name, status)
+		if env.Description != "" {
+			_, _ = fmt.Fprintf(w, "  Description: %s\n", env.Description)
 		}
 	}
 
 	if len(files) == 0 {
-		fmt.Println("No environments found. Use 'docker compose env --create' to create one.")
+		_, _ = fmt.Fprintln(w, "No environments found. Use 'docker compose env --create' to create one.")
 	}
 
 	return nil
 }
 
-func createEnvironment(envsDir, name, description string) error {
+// createEnvironment creates the environment directory. An empty composeContent writes
+// a placeholder compose.yaml.
+func createEnvironment(envsDir, name, description, composeContent string) error {
 	envDir := filepath.Join(envsDir, name)
 	if _, err := os.Stat(envDir); err == nil {
 		return fmt.Errorf("environment %q already exists", name)
@@ -210,15 +412,17 @@ func createEnvironment(envsDir, name, description string) error {
 		}
 	}
 
-	// Create default compose.yaml template
+	// Create compose.yaml, from the template if any
 	composeFile := filepath.Join(envDir, "compose.yaml")
-	defaultCompose := `# Environment: ` + name + `
+	if composeContent == "" {
+		composeContent = `# Environment: ` + name + `
 # Generated by docker compose env
 
-services:
-  # Add your services here
+# Add your services here
+services: {}
 `
-	if err := os.WriteFile(composeFile, []byte(defaultCompose), 0o644); err != nil {
+	}
+	if err := os.WriteFile(composeFile, []byte(composeContent), 0o644); err != nil {
 		return fmt.Errorf("failed to create compose.yaml: %v", err)
 	}
 
@@ -236,7 +440,66 @@ services:
 	return nil
 }
 
-func removeEnvironment(envsDir, name string) error {
+// builtinEnvTemplates returns the names of the embedded environment templates
+func builtinEnvTemplates() []string {
+	entries, err := envTemplates.ReadDir("envtemplates")
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".yaml"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadEnvironmentTemplate returns the raw content of a built-in template or of a template fetched from url
+func loadEnvironmentTemplate(ctx context.Context, name, url string) (string, error) {
+	if name != "" && url != "" {
+		return "", fmt.Errorf("--template and --template-url cannot be combined")
+	}
+	if name != "" {
+		content, err := envTemplates.ReadFile("envtemplates/" + name + ".yaml")
+		if err != nil {
+			return "", fmt.Errorf("unknown template %q, available templates: %s", name, strings.Join(builtinEnvTemplates(), ", "))
+		}
+		return string(content), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid template URL: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch template: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch template: %s", resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read template: %v", err)
+	}
+	return string(content), nil
+}
+
+// renderEnvironmentTemplate substitutes the environment name, available as {{ .Name }}, in a template
+func renderEnvironmentTemplate(content, name string) (string, error) {
+	tmpl, err := template.New("environment").Option("missingkey=error").Parse(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, struct{ Name string }{Name: name}); err != nil {
+		return "", fmt.Errorf("failed to render template: %v", err)
+	}
+	return buf.String(), nil
+}
+
+func removeEnvironment(envsDir, name string, force bool) error {
 	envDir := filepath.Join(envsDir, name)
 	if _, err := os.Stat(envDir); os.IsNotExist(err) {
 		return fmt.Errorf("environment %q does not exist", name)
@@ -245,6 +508,9 @@ func removeEnvironment(envsDir, name string) error {
 	// Check if it's the current active environment
 	currentEnv, _ := getCurrentEnvironment(envsDir)
 	if currentEnv == name {
+		if !force {
+			return fmt.Errorf("environment %q is active, deactivate it first with --deactivate or use --force", name)
+		}
 		// Deactivate first
 		if err := deactivateEnvironment(envsDir); err != nil {
 			return err
@@ -260,20 +526,182 @@ func removeEnvironment(envsDir, name string) error {
 	return nil
 }
 
-func activateEnvironment(envsDir, name string) error {
+// envPostActivateScript is the script of an environment run once it is activated, unless
+// --post-activate is set
+const envPostActivateScript = "post-activate.sh"
+
+// activateEnvironment makes the environment the current one, warning when its compose.yaml is
+// older than projectFile. An empty projectFile skips the check. The environment is validated
+// before being activated, and the previous one is restored when the post-activation hook fails.
+func activateEnvironment(ctx context.Context, envsDir, name, projectFile, postActivate string) error {
 	envDir := filepath.Join(envsDir, name)
 	if _, err := os.Stat(envDir); os.IsNotExist(err) {
 		return fmt.Errorf("environment %q does not exist", name)
 	}
+	resolved, err := resolveEnvironment(envsDir, name)
+	if err != nil {
+		return err
+	}
+	if err := validateEnvironment(ctx, resolved); err != nil {
+		return fmt.Errorf("environment %q is not usable, not activated: %v", name, err)
+	}
+	if projectFile != "" && isEnvironmentStale(filepath.Join(envDir, "compose.yaml"), projectFile) {
+		fmt.Printf("Warning: compose.yaml of environment %q is older than %s and may miss recent changes.\n", name, projectFile)
+		fmt.Printf("Refresh it with --sync-from %s, or use --force to silence this warning.\n", projectFile)
+	}
 
-	// Write current environment
-	currentEnvFile := filepath.Join(envsDir, "current")
-	if err := os.WriteFile(currentEnvFile, []byte(name), 0o644); err != nil {
+	previous, err := getCurrentEnvironment(envsDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read the active environment: %v", err)
+	}
+	if err := setCurrentEnvironment(envsDir, name); err != nil {
 		return fmt.Errorf("failed to activate environment: %v", err)
 	}
 
+	if err := runPostActivateHook(ctx, envDir, name, previous, postActivate); err != nil {
+		if previous == "" {
+			err = errors.Join(err, os.Remove(filepath.Join(envsDir, "current")))
+			return fmt.Errorf("post-activate hook failed, environment %q deactivated: %w", name, err)
+		}
+		err = errors.Join(err, setCurrentEnvironment(envsDir, previous))
+		return fmt.Errorf("post-activate hook failed, environment %q restored: %w", previous, err)
+	}
+
 	fmt.Printf("Environment %q activated successfully!\n", name)
-	fmt.Printf("To use this environment, run: docker compose --env-file %s/.env up\n", envDir)
+	fmt.Printf("To use this environment, run: %s\n", resolved.composeCommand())
+	return nil
+}
+
+// validateEnvironment checks the compose files of a resolved environment load with its variables,
+// the .env files having been read while resolving it
+func validateEnvironment(ctx context.Context, env *resolvedEnvironment) error {
+	_, err := loadEnvironmentProject(ctx, env)
+	return err
+}
+
+// loadEnvironmentProject loads the compose files of the environment, nil when it has none
+func loadEnvironmentProject(ctx context.Context, env *resolvedEnvironment) (*types.Project, error) {
+	if len(env.ComposeFiles) == 0 {
+		return nil, nil
+	}
+	details := types.ConfigDetails{
+		WorkingDir:  filepath.Dir(env.ComposeFiles[len(env.ComposeFiles)-1]),
+		Environment: env.Variables,
+	}
+	for _, file := range env.ComposeFiles {
+		configFile, err := environmentConfigFile(file)
+		if err != nil {
+			return nil, err
+		}
+		details.ConfigFiles = append(details.ConfigFiles, configFile)
+	}
+	return loader.LoadWithContext(ctx, details, func(options *loader.Options) {
+		options.SetProjectName(loader.NormalizeProjectName(env.Name), false)
+		options.SkipConsistencyCheck = true
+		options.SkipResolveEnvironment = true
+	})
+}
+
+// environmentConfigFile reads a compose file of an environment for validation. Environments created
+// by former versions declare no service as a null services, which compose rejects, so it is read
+// as an empty one.
+func environmentConfigFile(file string) (types.ConfigFile, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return types.ConfigFile{}, err
+	}
+	var config map[string]any
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return types.ConfigFile{}, fmt.Errorf("failed to parse %s: %v", file, err)
+	}
+	if services, ok := config["services"]; ok && services == nil {
+		config["services"] = map[string]any{}
+		if content, err = yaml.Marshal(config); err != nil {
+			return types.ConfigFile{}, err
+		}
+	}
+	return types.ConfigFile{Filename: file, Content: content}, nil
+}
+
+// setCurrentEnvironment atomically replaces the active environment
+func setCurrentEnvironment(envsDir, name string) error {
+	tmp, err := os.CreateTemp(envsDir, ".current-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	if _, err := tmp.WriteString(name); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(envsDir, "current"))
+}
+
+// runPostActivateHook runs the post-activation command, or the post-activate.sh script of the
+// environment when no command is set
+func runPostActivateHook(ctx context.Context, envDir, name, previous, command string) error {
+	var cmd *exec.Cmd
+	switch script := filepath.Join(envDir, envPostActivateScript); {
+	case command != "":
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	case fileExists(script):
+		cmd = exec.CommandContext(ctx, "/bin/sh", script)
+	default:
+		return nil
+	}
+	cmd.Env = append(os.Environ(), "COMPOSE_ENVIRONMENT="+name, "COMPOSE_PREVIOUS_ENVIRONMENT="+previous)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// mainComposeFile returns the main compose file of the project, or an empty string when it can't
+// be resolved or isn't a local file
+func mainComposeFile(opts *ProjectOptions) string {
+	options, err := opts.toProjectOptions()
+	if err != nil || len(options.ConfigPaths) == 0 {
+		return ""
+	}
+	if _, err := os.Stat(options.ConfigPaths[0]); err != nil {
+		return ""
+	}
+	return options.ConfigPaths[0]
+}
+
+// isEnvironmentStale reports whether the environment compose file was last modified before the
+// project compose file
+func isEnvironmentStale(envComposeFile, projectFile string) bool {
+	envInfo, err := os.Stat(envComposeFile)
+	if err != nil {
+		return false
+	}
+	projectInfo, err := os.Stat(projectFile)
+	if err != nil {
+		return false
+	}
+	return envInfo.ModTime().Before(projectInfo.ModTime())
+}
+
+// syncEnvironment replaces the compose.yaml of an existing environment with the content of a compose file
+func syncEnvironment(envsDir, name, composeFile string) error {
+	envDir := filepath.Join(envsDir, name)
+	if _, err := os.Stat(envDir); os.IsNotExist(err) {
+		return fmt.Errorf("environment %q does not exist", name)
+	}
+	content, err := os.ReadFile(composeFile)
+	if err != nil {
+		return fmt.Errorf("failed to read compose file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(envDir, "compose.yaml"), content, 0o644); err != nil {
+		return fmt.Errorf("failed to write compose.yaml: %v", err)
+	}
+	fmt.Printf("Environment %q refreshed from %q\n", name, composeFile)
 	return nil
 }
 
@@ -291,14 +719,27 @@ func deactivateEnvironment(envsDir string) error {
 	return nil
 }
 
-func importEnvironment(envsDir, name, importFile string) error {
+// importEnvironment creates the environment from a bundle written by env --export or share,
+// or from a plain compose file. Bundles without a manifest are only imported when insecure.
+func importEnvironment(envsDir, name, importFile string, insecure bool) error {
 	// Check if import file exists
 	if _, err := os.Stat(importFile); os.IsNotExist(err) {
 		return fmt.Errorf("import file %q does not exist", importFile)
 	}
+	isBundle, err := bundle.IsGzip(importFile)
+	if err != nil {
+		return fmt.Errorf("failed to read import file: %v", err)
+	}
+	if isBundle {
+		if err := importEnvironmentBundle(envsDir, name, importFile, insecure); err != nil {
+			return err
+		}
+		fmt.Printf("Environment %q imported successfully from %q!\n", name, importFile)
+		return nil
+	}
 
 	// Create environment
-	if err := createEnvironment(envsDir, name, "Imported environment"); err != nil {
+	if err := createEnvironment(envsDir, name, "Imported environment", ""); err != nil {
 		return err
 	}
 
@@ -318,21 +759,103 @@ func importEnvironment(envsDir, name, importFile string) error {
 	return nil
 }
 
-func exportEnvironment(envsDir, name, exportFile string) error {
+// importEnvironmentBundle extracts the bundle as the environment, which must provide a compose file
+func importEnvironmentBundle(envsDir, name, importFile string, insecure bool) error {
+	envDir := filepath.Join(envsDir, name)
+	if _, err := os.Stat(envDir); err == nil {
+		return fmt.Errorf("environment %q already exists", name)
+	}
+	if err := os.MkdirAll(envsDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create environments directory: %v", err)
+	}
+	tmpDir, err := os.MkdirTemp(envsDir, ".import-")
+	if err != nil {
+		return fmt.Errorf("failed to create environment directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir) //nolint:errcheck
+
+	manifest, err := bundle.ReadFile(importFile, tmpDir)
+	if err := checkBundleManifest(importFile, err, insecure); err != nil {
+		return err
+	}
+	// a shared project may use any of the default compose file names
+	composeFile := filepath.Join(tmpDir, "compose.yaml")
+	if _, err := os.Stat(composeFile); os.IsNotExist(err) {
+		found := false
+		for _, candidate := range []string{"compose.yml", "docker-compose.yaml", "docker-compose.yml"} {
+			if err := os.Rename(filepath.Join(tmpDir, candidate), composeFile); err == nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%q has no compose file", importFile)
+		}
+	}
+	descFile := filepath.Join(tmpDir, "description.txt")
+	if _, err := os.Stat(descFile); os.IsNotExist(err) {
+		description := "Imported environment"
+		if manifest != nil && manifest.Kind == bundle.KindShare {
+			description = fmt.Sprintf("Imported from the share of project %s", manifest.Name)
+		}
+		if err := os.WriteFile(descFile, []byte(description), 0o644); err != nil {
+			return fmt.Errorf("failed to write description: %v", err)
+		}
+	}
+	if err := os.Rename(tmpDir, envDir); err != nil {
+		return fmt.Errorf("failed to create environment directory: %v", err)
+	}
+	return nil
+}
+
+// exportEnvironment writes the files of the environment as a bundle, which share --import and
+// env --import both accept. Unless the environment has its own, a lockfile pinning the image
+// digests of its services is added for deploy --from-archive.
+func exportEnvironment(ctx context.Context, dockerCli command.Cli, envsDir, name, exportFile string) error {
 	envDir := filepath.Join(envsDir, name)
 	if _, err := os.Stat(envDir); os.IsNotExist(err) {
 		return fmt.Errorf("environment %q does not exist", name)
 	}
 
-	// Read compose.yaml
-	composeFile := filepath.Join(envDir, "compose.yaml")
-	content, err := os.ReadFile(composeFile)
+	var files []string
+	err := filepath.WalkDir(envDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(envDir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to read compose.yaml: %v", err)
+		return fmt.Errorf("failed to read environment %q: %v", name, err)
 	}
 
-	// Write to export file
-	if err := os.WriteFile(exportFile, content, 0o644); err != nil {
+	var generated map[string][]byte
+	if !slices.Contains(files, deployLockFile) {
+		lock, err := environmentDeployLock(ctx, dockerCli, envsDir, name)
+		if err != nil {
+			fmt.Fprintf(dockerCli.Err(), "Warning: the image digests of environment %q are not pinned: %v\n", name, err)
+		} else if lock != nil {
+			generated = map[string][]byte{deployLockFile: lock}
+		}
+	}
+
+	f, err := os.Create(exportFile)
+	if err != nil {
+		return fmt.Errorf("failed to write export file: %v", err)
+	}
+	err = bundle.WriteGenerated(f, envDir, files, generated, bundle.Manifest{
+		Kind:      bundle.KindEnvironment,
+		Name:      name,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
 		return fmt.Errorf("failed to write export file: %v", err)
 	}
 
@@ -340,11 +863,25 @@ func exportEnvironment(envsDir, name, exportFile string) error {
 	return nil
 }
 
-func showCurrentEnvironment(envsDir string) error {
+// environmentDeployLock returns the lockfile pinning the services of the environment to the
+// repository digest of their local image, nil when there is none to pin
+func environmentDeployLock(ctx context.Context, dockerCli command.Cli, envsDir, name string) ([]byte, error) {
+	env, err := resolveEnvironment(envsDir, name)
+	if err != nil {
+		return nil, err
+	}
+	project, err := loadEnvironmentProject(ctx, env)
+	if err != nil || project == nil {
+		return nil, err
+	}
+	return deployLock(ctx, dockerCli.Client(), project)
+}
+
+func showCurrentEnvironment(w io.Writer, envsDir string) error {
 	currentEnv, err := getCurrentEnvironment(envsDir)
 	if err != nil {
-		fmt.Println("No active environment")
-		fmt.Println("Use 'docker compose env --activate' to activate an environment")
+		_, _ = fmt.Fprintln(w, "No active environment")
+		_, _ = fmt.Fprintln(w, "Use 'docker compose env --activate' to activate an environment")
 		return nil
 	}
 
@@ -358,19 +895,215 @@ func showCurrentEnvironment(envsDir string) error {
 		description = strings.TrimSpace(string(desc))
 	}
 
-	fmt.Println("Current environment:")
-	fmt.Println("==================")
-	fmt.Printf("Name: %s\n", currentEnv)
+	_, _ = fmt.Fprintln(w, "Current environment:")
+	_, _ = fmt.Fprintln(w, "==================")
+	_, _ = fmt.Fprintf(w, "Name: %s\n", currentEnv)
 	if description != "" {
-		fmt.Printf("Description: %s\n", description)
+		_, _ = fmt.Fprintf(w, "Description: %s\n", description)
 	}
-	fmt.Printf("Location: %s\n", envDir)
-	fmt.Printf("\nTo use this environment:\n")
-	fmt.Printf("  docker compose --env-file %s/.env up\n", envDir)
+	_, _ = fmt.Fprintf(w, "Location: %s\n", envDir)
+	_, _ = fmt.Fprintf(w, "\nTo use this environment:\n")
+	_, _ = fmt.Fprintf(w, "  docker compose --env-file %s/.env up\n", envDir)
+
+	return nil
+}
+
+// currentEnvironmentInfo is the machine-readable view of the active environment
+type currentEnvironmentInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Location    string `json:"location"`
+	EnvFile     string `json:"envFile"`
+	ComposeFile string `json:"composeFile"`
+	Active      bool   `json:"active"`
+}
+
+func getCurrentEnvironmentInfo(envsDir string) currentEnvironmentInfo {
+	currentEnv, err := getCurrentEnvironment(envsDir)
+	if err != nil || currentEnv == "" {
+		return currentEnvironmentInfo{}
+	}
+	return environmentInfo(envsDir, currentEnv, true)
+}
+
+// environmentInfo returns the machine-readable view of an environment
+func environmentInfo(envsDir, name string, active bool) currentEnvironmentInfo {
+	envDir := filepath.Join(envsDir, name)
+	info := currentEnvironmentInfo{
+		Name:        name,
+		Location:    envDir,
+		EnvFile:     filepath.Join(envDir, ".env"),
+		ComposeFile: filepath.Join(envDir, "compose.yaml"),
+		Active:      active,
+	}
+	if desc, err := os.ReadFile(filepath.Join(envDir, "description.txt")); err == nil {
+		info.Description = strings.TrimSpace(string(desc))
+	}
+	return info
+}
+
+func showCurrentEnvironmentJSON(w io.Writer, envsDir string) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(getCurrentEnvironmentInfo(envsDir))
+}
 
+// createChildEnvironment creates an environment inheriting from parent. The environment is only
+// created once parent is known to exist, and removed if it can't inherit from it.
+func createChildEnvironment(envsDir, name, description, composeContent, parent string) error {
+	if _, err := os.Stat(filepath.Join(envsDir, parent)); os.IsNotExist(err) {
+		return fmt.Errorf("parent environment %q does not exist", parent)
+	}
+	if err := createEnvironment(envsDir, name, description, composeContent); err != nil {
+		return err
+	}
+	if err := setEnvironmentParent(envsDir, name, parent); err != nil {
+		_ = os.RemoveAll(filepath.Join(envsDir, name))
+		return err
+	}
 	return nil
 }
 
+// setEnvironmentParent records the environment name inherits from, refusing to create a cycle
+func setEnvironmentParent(envsDir, name, parent string) error {
+	parentFile := filepath.Join(envsDir, name, "parent.txt")
+	if err := os.WriteFile(parentFile, []byte(parent), 0o644); err != nil {
+		return fmt.Errorf("failed to write parent: %v", err)
+	}
+	if _, err := resolveEnvironment(envsDir, name); err != nil {
+		_ = os.Remove(parentFile)
+		return err
+	}
+	fmt.Printf("Environment %q inherits from %q\n", name, parent)
+	return nil
+}
+
+func getEnvironmentParent(envsDir, name string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(envsDir, name, "parent.txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read parent of environment %q: %v", name, err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// resolvedEnvironment is an environment merged with the environments it inherits from
+type resolvedEnvironment struct {
+	Name string `json:"name"`
+	// Chain lists the environments from the root ancestor to this one
+	Chain []string `json:"chain"`
+	// ComposeFiles and EnvFiles are ordered so later files override earlier ones
+	ComposeFiles []string          `json:"composeFiles"`
+	EnvFiles     []string          `json:"envFiles"`
+	Variables    map[string]string `json:"variables"`
+}
+
+// resolveEnvironment walks the parent chain of an environment and merges the .env and compose.yaml
+// files of its ancestors, the closest environment taking precedence
+func resolveEnvironment(envsDir, name string) (*resolvedEnvironment, error) {
+	var chain []string
+	seen := map[string]bool{}
+	for current := name; current != ""; {
+		if seen[current] {
+			return nil, fmt.Errorf("environment %q has an inheritance cycle: %s -> %s", name, strings.Join(chain, " -> "), current)
+		}
+		if _, err := os.Stat(filepath.Join(envsDir, current)); os.IsNotExist(err) {
+			return nil, fmt.Errorf("environment %q does not exist", current)
+		}
+		seen[current] = true
+		chain = append(chain, current)
+		parent, err := getEnvironmentParent(envsDir, current)
+		if err != nil {
+			return nil, err
+		}
+		current = parent
+	}
+	slices.Reverse(chain)
+	return mergeEnvironments(envsDir, name, chain)
+}
+
+func mergeEnvironments(envsDir, name string, chain []string) (*resolvedEnvironment, error) {
+	resolved := &resolvedEnvironment{Name: name, Chain: chain}
+	for _, env := range chain {
+		envDir := filepath.Join(envsDir, env)
+		if composeFile := filepath.Join(envDir, "compose.yaml"); fileExists(composeFile) {
+			resolved.ComposeFiles = append(resolved.ComposeFiles, composeFile)
+		}
+		if envFile := filepath.Join(envDir, ".env"); fileExists(envFile) {
+			resolved.EnvFiles = append(resolved.EnvFiles, envFile)
+		}
+	}
+	resolved.Variables = map[string]string{}
+	if len(resolved.EnvFiles) > 0 {
+		variables, err := dotenv.Read(resolved.EnvFiles...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read environment variables: %v", err)
+		}
+		resolved.Variables = variables
+	}
+	return resolved, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// composeCommand returns the docker compose invocation using the merged files
+func (r *resolvedEnvironment) composeCommand() string {
+	args := []string{"docker", "compose"}
+	for _, file := range r.ComposeFiles {
+		args = append(args, "-f", file)
+	}
+	for _, file := range r.EnvFiles {
+		args = append(args, "--env-file", file)
+	}
+	return strings.Join(append(args, "up"), " ")
+}
+
+func showEnvironment(w io.Writer, envsDir, name string, resolve bool, format string) error {
+	var (
+		env *resolvedEnvironment
+		err error
+	)
+	if resolve {
+		env, err = resolveEnvironment(envsDir, name)
+	} else {
+		if _, statErr := os.Stat(filepath.Join(envsDir, name)); os.IsNotExist(statErr) {
+			return fmt.Errorf("environment %q does not exist", name)
+		}
+		env, err = mergeEnvironments(envsDir, name, []string{name})
+	}
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(env)
+	case "text":
+		_, _ = fmt.Fprintf(w, "Environment: %s\n", env.Name)
+		if len(env.Chain) > 1 {
+			_, _ = fmt.Fprintf(w, "Inherits: %s\n", strings.Join(env.Chain, " -> "))
+		}
+		_, _ = fmt.Fprintln(w, "Compose files:")
+		for _, file := range env.ComposeFiles {
+			_, _ = fmt.Fprintf(w, "  %s\n", file)
+		}
+		_, _ = fmt.Fprintln(w, "Variables:")
+		for _, key := range slices.Sorted(maps.Keys(env.Variables)) {
+			_, _ = fmt.Fprintf(w, "  %s=%s\n", key, env.Variables[key])
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
 func getCurrentEnvironment(envsDir string) (string, error) {
 	currentEnvFile := filepath.Join(envsDir, "current")
 	content, err := os.ReadFile(currentEnvFile)
@@ -379,3 +1112,377 @@ func getCurrentEnvironment(envsDir string) (string, error) {
 	}
 	return strings.TrimSpace(string(content)), nil
 }
+
+// cloneEnvironment creates the environment name as a copy of the files of the environment source
+func cloneEnvironment(envsDir, source, name, description string) error {
+	sourceDir := filepath.Join(envsDir, source)
+	entries, err := os.ReadDir(sourceDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("environment %q does not exist", source)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read environment %q: %v", source, err)
+	}
+	envDir := filepath.Join(envsDir, name)
+	if _, err := os.Stat(envDir); err == nil {
+		return fmt.Errorf("environment %q already exists", name)
+	}
+	if err := os.MkdirAll(envDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create environment directory: %v", err)
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(sourceDir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", entry.Name(), err)
+		}
+		if err := os.WriteFile(filepath.Join(envDir, entry.Name()), content, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", entry.Name(), err)
+		}
+	}
+	if description == "" {
+		description = fmt.Sprintf("Clone of %s", source)
+	}
+	if err := os.WriteFile(filepath.Join(envDir, "description.txt"), []byte(description), 0o644); err != nil {
+		return fmt.Errorf("failed to write description: %v", err)
+	}
+	fmt.Printf("Environment %q cloned from %q\n", name, source)
+	return nil
+}
+
+// envCloneConfirmSize is the volume data size above which cloning requires a confirmation
+const envCloneConfirmSize = 1 << 30
+
+// envCloneImage is the image of the helper container copying volume data
+const envCloneImage = "alpine:latest"
+
+// envCloneVolume is a volume of the source environment project, and the volume it is copied to
+type envCloneVolume struct {
+	Source string
+	Target string
+	// Size is the size of the volume data, -1 when the daemon doesn't report it
+	Size int64
+	// Labels are the labels of the target volume, those of the source one adapted to the clone project
+	Labels map[string]string
+}
+
+// cloneEnvironmentData gives the cloned environment its own project name, then copies the named
+// volumes of the source project and the secrets of the source namespace
+func cloneEnvironmentData(ctx context.Context, dockerCli command.Cli, envsDir string, opts *envOptions) error {
+	source, err := resolveEnvironment(envsDir, opts.clone)
+	if err != nil {
+		return err
+	}
+	sourceProject := source.Variables[ComposeProjectName]
+	if sourceProject == "" {
+		if sourceProject, err = opts.toProjectName(ctx, dockerCli); err != nil {
+			return err
+		}
+	}
+	cloneProject := loader.NormalizeProjectName(sourceProject + "-" + opts.name)
+	if err := setEnvFileVariable(filepath.Join(envsDir, opts.name, ".env"), ComposeProjectName, cloneProject); err != nil {
+		return err
+	}
+	fmt.Printf("Environment %q uses project name %q\n", opts.name, cloneProject)
+
+	apiClient := dockerCli.Client()
+	volumes, err := listEnvironmentVolumes(ctx, apiClient, sourceProject, cloneProject)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, v := range volumes {
+		total += max(v.Size, 0)
+		fmt.Printf("Volume %s (%s) -> %s\n", v.Source, formatVolumeSize(v.Size), v.Target)
+	}
+	if total > envCloneConfirmSize && !opts.force {
+		if !dockerCli.In().IsTerminal() {
+			return fmt.Errorf("copying %s of volume data requires --force", units.HumanSize(float64(total)))
+		}
+		msg := fmt.Sprintf("Copy %s of volume data? [y/N]: ", units.HumanSize(float64(total)))
+		confirmed, err := prompt.NewPrompt(dockerCli.In(), dockerCli.Out()).Confirm(msg, false)
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			return fmt.Errorf("volume copy cancelled, the environment %q was cloned without data", opts.name)
+		}
+	}
+	for _, v := range volumes {
+		if err := copyEnvironmentVolume(ctx, apiClient, v); err != nil {
+			return err
+		}
+		fmt.Printf("Volume %s copied\n", v.Target)
+	}
+
+	copied, err := cloneEnvironmentSecrets(secretStore(), opts.clone, opts.name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Environment %q cloned with %d volume(s) (%s) and %d secret(s)\n", opts.name, len(volumes), units.HumanSize(float64(total)), copied)
+	return nil
+}
+
+// setEnvFileVariable sets a variable in an env file, replacing any previous assignment
+func setEnvFileVariable(envFile, key, value string) error {
+	return updateEnvFile(envFile, []envAssignment{{key: key, value: value}}, nil)
+}
+
+// envAssignment is a variable set by updateEnvFile
+type envAssignment struct {
+	key   string
+	value string
+}
+
+// envKeyPattern is the format of the variable names accepted by --set, --unset and --get
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// editEnvironmentVariables applies --set and --unset to the .env of an environment
+func editEnvironmentVariables(envsDir, name string, set, unset []string) error {
+	envDir := filepath.Join(envsDir, name)
+	if _, err := os.Stat(envDir); os.IsNotExist(err) {
+		return fmt.Errorf("environment %q does not exist", name)
+	}
+	assignments, err := parseEnvAssignments(set)
+	if err != nil {
+		return err
+	}
+	for _, key := range unset {
+		if !envKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid variable name %q", key)
+		}
+	}
+	if err := updateEnvFile(filepath.Join(envDir, ".env"), assignments, unset); err != nil {
+		return err
+	}
+	fmt.Printf("Environment %q updated: %d variable(s) set, %d unset\n", name, len(assignments), len(unset))
+	return nil
+}
+
+// parseEnvAssignments parses KEY=VALUE arguments, the value possibly empty
+func parseEnvAssignments(args []string) ([]envAssignment, error) {
+	assignments := make([]envAssignment, 0, len(args))
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid assignment %q, expected KEY=VALUE", arg)
+		}
+		if !envKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid variable name %q", key)
+		}
+		assignments = append(assignments, envAssignment{key: key, value: value})
+	}
+	return assignments, nil
+}
+
+// getEnvironmentVariable returns the value of a variable in the .env of an environment, or with
+// resolve in the .env files it inherits
+func getEnvironmentVariable(envsDir, name, key string, resolve bool) (string, error) {
+	if !envKeyPattern.MatchString(key) {
+		return "", fmt.Errorf("invalid variable name %q", key)
+	}
+	var (
+		env *resolvedEnvironment
+		err error
+	)
+	if resolve {
+		env, err = resolveEnvironment(envsDir, name)
+	} else {
+		if _, statErr := os.Stat(filepath.Join(envsDir, name)); os.IsNotExist(statErr) {
+			return "", fmt.Errorf("environment %q does not exist", name)
+		}
+		env, err = mergeEnvironments(envsDir, name, []string{name})
+	}
+	if err != nil {
+		return "", err
+	}
+	value, ok := env.Variables[key]
+	if !ok {
+		return "", fmt.Errorf("variable %s is not set in environment %q", key, name)
+	}
+	return value, nil
+}
+
+// updateEnvFile sets and removes variables of an env file: a variable set replaces its first
+// assignment in place, or is appended when missing, further assignments being dropped. Comments,
+// blank lines and the order of the other lines are kept. The file is replaced atomically.
+func updateEnvFile(envFile string, set []envAssignment, unset []string) error {
+	content, err := os.ReadFile(envFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %v", envFile, err)
+	}
+	values := map[string]string{}
+	for _, assignment := range set {
+		values[assignment.key] = assignment.value
+	}
+	written := map[string]bool{}
+	var lines []string
+	if text := strings.TrimRight(string(content), "\n"); text != "" {
+		for _, line := range strings.Split(text, "\n") {
+			name, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(line), "export "), "=")
+			name = strings.TrimSpace(name)
+			if slices.Contains(unset, name) {
+				continue
+			}
+			if value, ok := values[name]; ok {
+				if !written[name] {
+					lines = append(lines, name+"="+extensions.QuoteEnvValue(value))
+					written[name] = true
+				}
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}
+	for _, assignment := range set {
+		if !written[assignment.key] {
+			lines = append(lines, assignment.key+"="+extensions.QuoteEnvValue(values[assignment.key]))
+			written[assignment.key] = true
+		}
+	}
+	text := ""
+	if len(lines) > 0 {
+		text = strings.Join(lines, "\n") + "\n"
+	}
+	perm := os.FileMode(0o644)
+	if info, err := os.Stat(envFile); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return writeOutput(envFile, perm, nil, func(w io.Writer) error {
+		_, err := io.WriteString(w, text)
+		return err
+	})
+}
+
+// listEnvironmentVolumes lists the named volumes of the source project, with the name of the volume
+// compose uses for the same volume in the clone project
+func listEnvironmentVolumes(ctx context.Context, apiClient client.APIClient, sourceProject, cloneProject string) ([]envCloneVolume, error) {
+	list, err := apiClient.VolumeList(ctx, volume.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", api.ProjectLabel, sourceProject))),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes of project %q: %v", sourceProject, err)
+	}
+	sizes := map[string]int64{}
+	if usage, err := apiClient.DiskUsage(ctx, dockertypes.DiskUsageOptions{Types: []dockertypes.DiskUsageObject{dockertypes.VolumeObject}}); err == nil {
+		for _, v := range usage.Volumes {
+			if v.UsageData != nil {
+				sizes[v.Name] = v.UsageData.Size
+			}
+		}
+	}
+	var volumes []envCloneVolume
+	for _, v := range list.Volumes {
+		size, ok := sizes[v.Name]
+		if !ok {
+			size = -1
+		}
+		target, ok := cloneVolumeName(v.Name, v.Labels, sourceProject, cloneProject)
+		if !ok {
+			fmt.Printf("Warning: volume %s has a custom name, skipped\n", v.Name)
+			continue
+		}
+		labels := maps.Clone(v.Labels)
+		labels[api.ProjectLabel] = cloneProject
+		// the config hash covers the volume name, compose would otherwise offer to recreate it
+		delete(labels, api.ConfigHashLabel)
+		volumes = append(volumes, envCloneVolume{Source: v.Name, Target: target, Size: size, Labels: labels})
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Source < volumes[j].Source })
+	return volumes, nil
+}
+
+// cloneVolumeName returns the name compose gives to a volume of the source project in the clone
+// project. Volumes declared with a custom name can't be mapped and are reported as not ok.
+func cloneVolumeName(name string, labels map[string]string, sourceProject, cloneProject string) (string, bool) {
+	key := labels[api.VolumeLabel]
+	if key == "" || name != sourceProject+"_"+key {
+		return "", false
+	}
+	return cloneProject + "_" + key, true
+}
+
+func formatVolumeSize(size int64) string {
+	if size < 0 {
+		return "size unknown"
+	}
+	return units.HumanSize(float64(size))
+}
+
+// copyEnvironmentVolume creates the target volume, labeled for the clone project so compose adopts
+// it, and copies the source volume data into it from a helper container
+func copyEnvironmentVolume(ctx context.Context, apiClient client.APIClient, v envCloneVolume) error {
+	if _, err := apiClient.VolumeInspect(ctx, v.Target); err == nil {
+		return fmt.Errorf("volume %s already exists", v.Target)
+	}
+	if _, err := apiClient.VolumeCreate(ctx, volume.CreateOptions{Name: v.Target, Labels: v.Labels}); err != nil {
+		return fmt.Errorf("failed to create volume %s: %v", v.Target, err)
+	}
+
+	if _, err := apiClient.ImageInspect(ctx, envCloneImage); err != nil {
+		stream, err := apiClient.ImagePull(ctx, envCloneImage, image.PullOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to pull %s: %v", envCloneImage, err)
+		}
+		_, _ = io.Copy(io.Discard, stream)
+		_ = stream.Close()
+	}
+	created, err := apiClient.ContainerCreate(ctx, &container.Config{
+		Image: envCloneImage,
+		Cmd:   []string{"cp", "-a", "/from/.", "/to/"},
+	}, &container.HostConfig{
+		Mounts: []mount.Mount{
+			{Type: mount.TypeVolume, Source: v.Source, Target: "/from", ReadOnly: true},
+			{Type: mount.TypeVolume, Source: v.Target, Target: "/to"},
+		},
+	}, nil, nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to create the copy container for volume %s: %v", v.Source, err)
+	}
+	defer func() {
+		_ = apiClient.ContainerRemove(context.WithoutCancel(ctx), created.ID, container.RemoveOptions{Force: true})
+	}()
+	if err := apiClient.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to copy volume %s: %v", v.Source, err)
+	}
+	waitCh, errCh := apiClient.ContainerWait(ctx, created.ID, container.WaitConditionNotRunning)
+	select {
+	case result := <-waitCh:
+		if result.StatusCode != 0 {
+			return fmt.Errorf("failed to copy volume %s: exit code %d", v.Source, result.StatusCode)
+		}
+	case err := <-errCh:
+		return fmt.Errorf("failed to copy volume %s: %v", v.Source, err)
+	}
+	return nil
+}
+
+// cloneEnvironmentSecrets copies the secrets of the source namespace ("source/...") to the clone
+// namespace, returning the number of secrets copied
+func cloneEnvironmentSecrets(store *extensions.SecretStore, source, name string) (int, error) {
+	secrets, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+	copied := 0
+	now := time.Now().Format(extensions.SecretTimeLayout)
+	for _, secret := range extensions.FilterSecretsByPrefix(secrets, source+"/") {
+		clone := secret
+		clone.Name = name + "/" + strings.TrimPrefix(secret.Name, source+"/")
+		if _, err := store.Get(clone.Name); err == nil {
+			return copied, fmt.Errorf("secret '%s' already exists", clone.Name)
+		}
+		clone.Fields = maps.Clone(secret.Fields)
+		clone.CreatedAt = now
+		clone.UpdatedAt = now
+		err := store.Write(clone)
+		_ = store.Audit("create", clone.Name, os.Getenv("USER"), err)
+		if err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	return copied, nil
+}
@@ -0,0 +1,355 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/extensions"
+)
+
+func TestCurrentEnvironmentInfo(t *testing.T) {
+	envsDir := t.TempDir()
+
+	info := getCurrentEnvironmentInfo(envsDir)
+	assert.False(t, info.Active)
+	assert.Empty(t, info.Name)
+
+	envDir := filepath.Join(envsDir, "staging")
+	require.NoError(t, os.MkdirAll(envDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(envDir, "description.txt"), []byte("Staging\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(envsDir, "current"), []byte("staging"), 0o644))
+
+	info = getCurrentEnvironmentInfo(envsDir)
+	assert.Equal(t, currentEnvironmentInfo{
+		Name:        "staging",
+		Description: "Staging",
+		Location:    envDir,
+		EnvFile:     filepath.Join(envDir, ".env"),
+		ComposeFile: filepath.Join(envDir, "compose.yaml"),
+		Active:      true,
+	}, info)
+}
+
+func TestEnvironmentTemplates(t *testing.T) {
+	assert.Equal(t, []string{"node-postgres", "python-redis"}, builtinEnvTemplates())
+
+	content, err := loadEnvironmentTemplate(context.Background(), "node-postgres", "")
+	require.NoError(t, err)
+	rendered, err := renderEnvironmentTemplate(content, "staging")
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "POSTGRES_DB: staging")
+	assert.NotContains(t, rendered, "{{")
+
+	_, err = loadEnvironmentTemplate(context.Background(), "unknown", "")
+	assert.ErrorContains(t, err, `unknown template "unknown"`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("# {{ .Name }}\nservices: {}\n"))
+	}))
+	defer server.Close()
+	content, err = loadEnvironmentTemplate(context.Background(), "", server.URL)
+	require.NoError(t, err)
+	rendered, err = renderEnvironmentTemplate(content, "qa")
+	require.NoError(t, err)
+	assert.Equal(t, "# qa\nservices: {}\n", rendered)
+}
+
+func TestResolveEnvironment(t *testing.T) {
+	envsDir := t.TempDir()
+	for name, env := range map[string]string{
+		"base":    "DB_HOST=db\nLOG_LEVEL=info\n",
+		"staging": "LOG_LEVEL=debug\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(envsDir, name), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(envsDir, name, ".env"), []byte(env), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(envsDir, name, "compose.yaml"), []byte("services: {}\n"), 0o644))
+	}
+	require.NoError(t, setEnvironmentParent(envsDir, "staging", "base"))
+
+	resolved, err := resolveEnvironment(envsDir, "staging")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"base", "staging"}, resolved.Chain)
+	assert.Equal(t, map[string]string{"DB_HOST": "db", "LOG_LEVEL": "debug"}, resolved.Variables)
+	assert.Equal(t, []string{
+		filepath.Join(envsDir, "base", "compose.yaml"),
+		filepath.Join(envsDir, "staging", "compose.yaml"),
+	}, resolved.ComposeFiles)
+
+	err = setEnvironmentParent(envsDir, "base", "staging")
+	assert.ErrorContains(t, err, "inheritance cycle")
+	parent, err := getEnvironmentParent(envsDir, "base")
+	require.NoError(t, err)
+	assert.Empty(t, parent)
+}
+
+func TestCreateChildEnvironment(t *testing.T) {
+	envsDir := t.TempDir()
+	err := createChildEnvironment(envsDir, "staging", "Staging", "", "missing")
+	assert.EqualError(t, err, `parent environment "missing" does not exist`)
+	assert.NoDirExists(t, filepath.Join(envsDir, "staging"))
+
+	require.NoError(t, createEnvironment(envsDir, "base", "", ""))
+	require.NoError(t, createChildEnvironment(envsDir, "staging", "Staging", "", "base"))
+	parent, err := getEnvironmentParent(envsDir, "staging")
+	require.NoError(t, err)
+	assert.Equal(t, "base", parent)
+
+	// an environment which can't inherit from its parent is removed
+	require.NoError(t, os.WriteFile(filepath.Join(envsDir, "base", ".env"), []byte("not a variable\n"), 0o644))
+	err = createChildEnvironment(envsDir, "qa", "", "", "base")
+	assert.Error(t, err)
+	assert.NoDirExists(t, filepath.Join(envsDir, "qa"))
+}
+
+func TestRemoveActiveEnvironment(t *testing.T) {
+	envsDir := t.TempDir()
+	for _, name := range []string{"staging", "qa"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(envsDir, name), 0o755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(envsDir, "current"), []byte("staging"), 0o644))
+
+	err := removeEnvironment(envsDir, "staging", false)
+	assert.ErrorContains(t, err, `environment "staging" is active, deactivate it first`)
+	assert.DirExists(t, filepath.Join(envsDir, "staging"))
+
+	// non-active environments are removed without --force
+	require.NoError(t, removeEnvironment(envsDir, "qa", false))
+	assert.NoDirExists(t, filepath.Join(envsDir, "qa"))
+
+	require.NoError(t, removeEnvironment(envsDir, "staging", true))
+	assert.NoDirExists(t, filepath.Join(envsDir, "staging"))
+	assert.NoFileExists(t, filepath.Join(envsDir, "current"))
+}
+
+func TestStaleEnvironment(t *testing.T) {
+	envsDir := t.TempDir()
+	require.NoError(t, createEnvironment(envsDir, "staging", "", ""))
+	envCompose := filepath.Join(envsDir, "staging", "compose.yaml")
+	projectFile := filepath.Join(t.TempDir(), "compose.yaml")
+	require.NoError(t, os.WriteFile(projectFile, []byte("services:\n  web:\n    image: nginx\n"), 0o644))
+
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(envCompose, past, past))
+	assert.True(t, isEnvironmentStale(envCompose, projectFile))
+	assert.False(t, isEnvironmentStale(envCompose, filepath.Join(envsDir, "missing.yaml")))
+	require.NoError(t, activateEnvironment(context.Background(), envsDir, "staging", projectFile, ""))
+
+	require.NoError(t, syncEnvironment(envsDir, "staging", projectFile))
+	assert.False(t, isEnvironmentStale(envCompose, projectFile))
+	content, err := os.ReadFile(envCompose)
+	require.NoError(t, err)
+	assert.Equal(t, "services:\n  web:\n    image: nginx\n", string(content))
+
+	assert.ErrorContains(t, syncEnvironment(envsDir, "qa", projectFile), `environment "qa" does not exist`)
+}
+
+func TestActivateEnvironment(t *testing.T) {
+	envsDir := t.TempDir()
+	ctx := context.Background()
+	for _, name := range []string{"staging", "qa", "broken"} {
+		require.NoError(t, createEnvironment(envsDir, name, "", ""))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(envsDir, "broken", "compose.yaml"), []byte("services:\n  web: [\n"), 0o644))
+
+	err := activateEnvironment(ctx, envsDir, "broken", "", "")
+	assert.ErrorContains(t, err, `environment "broken" is not usable, not activated`)
+	assert.NoFileExists(t, filepath.Join(envsDir, "current"))
+
+	// a failing hook without a previous environment leaves none active
+	err = activateEnvironment(ctx, envsDir, "staging", "", "exit 1")
+	assert.ErrorContains(t, err, `post-activate hook failed, environment "staging" deactivated`)
+	assert.NoFileExists(t, filepath.Join(envsDir, "current"))
+
+	hookLog := filepath.Join(t.TempDir(), "hook.log")
+	require.NoError(t, activateEnvironment(ctx, envsDir, "staging", "", "echo $COMPOSE_ENVIRONMENT >> "+hookLog))
+	current, err := getCurrentEnvironment(envsDir)
+	require.NoError(t, err)
+	assert.Equal(t, "staging", current)
+
+	// the post-activate.sh script of the environment fails, staging is restored
+	script := "echo $COMPOSE_PREVIOUS_ENVIRONMENT >> " + hookLog + "\nexit 3\n"
+	require.NoError(t, os.WriteFile(filepath.Join(envsDir, "qa", envPostActivateScript), []byte(script), 0o644))
+	err = activateEnvironment(ctx, envsDir, "qa", "", "")
+	assert.ErrorContains(t, err, `post-activate hook failed, environment "staging" restored: exit status 3`)
+	current, err = getCurrentEnvironment(envsDir)
+	require.NoError(t, err)
+	assert.Equal(t, "staging", current)
+
+	content, err := os.ReadFile(hookLog)
+	require.NoError(t, err)
+	assert.Equal(t, "staging\nstaging\n", string(content))
+	entries, err := os.ReadDir(envsDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 4, "no temporary file should be left")
+}
+
+func TestActivateEnvironmentWithoutServices(t *testing.T) {
+	envsDir := t.TempDir()
+	require.NoError(t, createEnvironment(envsDir, "legacy", "", ""))
+	// the compose.yaml written by former versions, with a null services
+	legacy := "# Environment: legacy\n# Generated by docker compose env\n\nservices:\n  # Add your services here\n"
+	require.NoError(t, os.WriteFile(filepath.Join(envsDir, "legacy", "compose.yaml"), []byte(legacy), 0o644))
+
+	require.NoError(t, activateEnvironment(context.Background(), envsDir, "legacy", "", ""))
+	current, err := getCurrentEnvironment(envsDir)
+	require.NoError(t, err)
+	assert.Equal(t, "legacy", current)
+	content, err := os.ReadFile(filepath.Join(envsDir, "legacy", "compose.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, legacy, string(content), "the environment is left untouched")
+}
+
+func TestListEnvironments(t *testing.T) {
+	envsDir := t.TempDir()
+	require.NoError(t, createEnvironment(envsDir, "qa", "QA", ""))
+	require.NoError(t, createEnvironment(envsDir, "staging", "", ""))
+	require.NoError(t, os.WriteFile(filepath.Join(envsDir, "current"), []byte("staging"), 0o644))
+
+	var buf bytes.Buffer
+	require.NoError(t, listEnvironments(&buf, envsDir, "text"))
+	assert.Equal(t, "Available environments:\n=====================\nqa\n  Description: QA\nstaging [ACTIVE]\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, listEnvironments(&buf, envsDir, "json"))
+	var environments []currentEnvironmentInfo
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &environments))
+	require.Len(t, environments, 2)
+	assert.Equal(t, currentEnvironmentInfo{
+		Name:        "qa",
+		Description: "QA",
+		Location:    filepath.Join(envsDir, "qa"),
+		EnvFile:     filepath.Join(envsDir, "qa", ".env"),
+		ComposeFile: filepath.Join(envsDir, "qa", "compose.yaml"),
+	}, environments[0])
+	assert.True(t, environments[1].Active)
+
+	assert.EqualError(t, listEnvironments(&buf, envsDir, "yaml"), "unsupported format: yaml")
+}
+
+func TestCloneEnvironment(t *testing.T) {
+	envsDir := t.TempDir()
+	require.NoError(t, createEnvironment(envsDir, "production", "Production", "services: {}\n"))
+	require.NoError(t, os.WriteFile(filepath.Join(envsDir, "production", ".env"), []byte("DEBUG=0\nCOMPOSE_PROJECT_NAME=shop\n"), 0o644))
+
+	require.NoError(t, cloneEnvironment(envsDir, "production", "staging-debug", ""))
+	content, err := os.ReadFile(filepath.Join(envsDir, "staging-debug", "compose.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "services: {}\n", string(content))
+	description, err := os.ReadFile(filepath.Join(envsDir, "staging-debug", "description.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Clone of production", string(description))
+
+	assert.ErrorContains(t, cloneEnvironment(envsDir, "production", "staging-debug", ""), `environment "staging-debug" already exists`)
+	assert.ErrorContains(t, cloneEnvironment(envsDir, "missing", "other", ""), `environment "missing" does not exist`)
+
+	envFile := filepath.Join(envsDir, "staging-debug", ".env")
+	require.NoError(t, setEnvFileVariable(envFile, "COMPOSE_PROJECT_NAME", "shop-staging-debug"))
+	content, err = os.ReadFile(envFile)
+	require.NoError(t, err)
+	assert.Equal(t, "DEBUG=0\nCOMPOSE_PROJECT_NAME=shop-staging-debug\n", string(content))
+
+	missing := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, setEnvFileVariable(missing, "COMPOSE_PROJECT_NAME", "shop"))
+	content, err = os.ReadFile(missing)
+	require.NoError(t, err)
+	assert.Equal(t, "COMPOSE_PROJECT_NAME=shop\n", string(content))
+}
+
+func TestCloneVolumeName(t *testing.T) {
+	name, ok := cloneVolumeName("shop_db-data", map[string]string{api.VolumeLabel: "db-data"}, "shop", "shop-debug")
+	assert.True(t, ok)
+	assert.Equal(t, "shop-debug_db-data", name)
+
+	_, ok = cloneVolumeName("legacy-data", map[string]string{api.VolumeLabel: "data"}, "shop", "shop-debug")
+	assert.False(t, ok)
+}
+
+func TestCloneEnvironmentSecrets(t *testing.T) {
+	store := extensions.NewSecretStore(t.TempDir())
+	require.NoError(t, store.Save("production/db_password", "s3cret", nil))
+	require.NoError(t, store.Save("production/api", "", map[string]string{"KEY": "k"}))
+	require.NoError(t, store.Save("staging/db_password", "other", nil))
+
+	copied, err := cloneEnvironmentSecrets(store, "production", "debug")
+	require.NoError(t, err)
+	assert.Equal(t, 2, copied)
+	secret, err := store.Get("debug/db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", secret.Value)
+	secret, err = store.Get("debug/api")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"KEY": "k"}, secret.Fields)
+	_, err = store.Get("debug/staging/db_password")
+	assert.Error(t, err)
+
+	_, err = cloneEnvironmentSecrets(store, "production", "debug")
+	assert.ErrorContains(t, err, "already exists")
+}
+
+func TestEditEnvironmentVariables(t *testing.T) {
+	envsDir := t.TempDir()
+	require.NoError(t, createEnvironment(envsDir, "staging", "Staging", ""))
+	envFile := filepath.Join(envsDir, "staging", ".env")
+	require.NoError(t, os.WriteFile(envFile, []byte("# database\nDB_HOST=db\nexport DB_PORT=5432\n\n# features\nDEBUG=1\nDB_HOST=stale\n"), 0o644))
+
+	require.NoError(t, editEnvironmentVariables(envsDir, "staging", []string{
+		"DB_HOST=db.internal",
+		"GREETING=hello world",
+		"PASSWORD=it's $secret",
+		"TOKEN=$literal",
+		"EMPTY=",
+	}, []string{"DEBUG"}))
+	content, err := os.ReadFile(envFile)
+	require.NoError(t, err)
+	assert.Equal(t, "# database\nDB_HOST=db.internal\nexport DB_PORT=5432\n\n# features\n"+
+		"GREETING='hello world'\nPASSWORD=\"it's \\$secret\"\nTOKEN='$literal'\nEMPTY=\n", string(content))
+
+	for key, expected := range map[string]string{"DB_HOST": "db.internal", "DB_PORT": "5432", "GREETING": "hello world", "PASSWORD": "it's $secret", "TOKEN": "$literal", "EMPTY": ""} {
+		value, err := getEnvironmentVariable(envsDir, "staging", key, false)
+		require.NoError(t, err, key)
+		assert.Equal(t, expected, value, key)
+	}
+	_, err = getEnvironmentVariable(envsDir, "staging", "DEBUG", false)
+	assert.EqualError(t, err, `variable DEBUG is not set in environment "staging"`)
+
+	// values inherited from the parent are only found with resolve
+	require.NoError(t, createEnvironment(envsDir, "review", "", ""))
+	require.NoError(t, setEnvironmentParent(envsDir, "review", "staging"))
+	_, err = getEnvironmentVariable(envsDir, "review", "DB_HOST", false)
+	assert.Error(t, err)
+	value, err := getEnvironmentVariable(envsDir, "review", "DB_HOST", true)
+	require.NoError(t, err)
+	assert.Equal(t, "db.internal", value)
+
+	assert.EqualError(t, editEnvironmentVariables(envsDir, "staging", []string{"1KEY=x"}, nil), `invalid variable name "1KEY"`)
+	assert.EqualError(t, editEnvironmentVariables(envsDir, "staging", []string{"KEY"}, nil), `invalid assignment "KEY", expected KEY=VALUE`)
+	assert.EqualError(t, editEnvironmentVariables(envsDir, "staging", nil, []string{"BAD-KEY"}), `invalid variable name "BAD-KEY"`)
+	assert.EqualError(t, editEnvironmentVariables(envsDir, "missing", []string{"KEY=x"}, nil), `environment "missing" does not exist`)
+}
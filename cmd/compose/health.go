@@ -18,10 +18,24 @@ package compose
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/cli/cli"
 	"github.com/docker/cli/cli/command"
+	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
 
 	"github.com/docker/compose/v5/pkg/api"
@@ -42,8 +56,37 @@ type healthOptions struct {
 	startPeriod time.Duration
 	test        []string
 	disable     bool
+	httpProbes  []string
+	tcpProbes   []string
+	wait        bool
+	waitTimeout time.Duration
+
+	exportCompose bool
+	exportFile    string
+	format        string
+
+	logFile    string
+	logMaxSize string
 }
 
+// Health states reported by --status, a running container without a
+// healthcheck is counted as healthy
+const (
+	healthStateHealthy   = "healthy"
+	healthStateStarting  = "starting"
+	healthStateUnhealthy = "unhealthy"
+)
+
+// Exit codes of health --status --wait: services which never left the
+// starting state before --wait-timeout are told apart from broken ones
+const (
+	healthExitUnhealthy = 1
+	healthExitStarting  = 2
+)
+
+// healthWaitPollInterval is how often --wait polls container health
+const healthWaitPollInterval = 2 * time.Second
+
 func healthCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *BackendOptions) *cobra.Command {
 	opts := healthOptions{
 		ProjectOptions: p,
@@ -51,6 +94,8 @@ func healthCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *Bac
 		timeout:        30 * time.Second,
 		retries:        3,
 		startPeriod:    0,
+		format:         "text",
+		logMaxSize:     "10MB",
 	}
 
 	cmd := &cobra.Command{
@@ -59,6 +104,29 @@ func healthCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *Bac
 		Long: `EXPERIMENTAL - Manage service health checks for Compose projects.
 
 This command helps you monitor, configure, and manage health checks for your services.
+
+With --check, --http and --tcp probe endpoints from the host, for services whose
+readiness is only observable through their published ports. The command fails if
+any probe fails.
+
+With --status --wait, the command polls until every service is healthy. Services
+still starting are waited for, a service reported unhealthy for more than
+--retries consecutive polls fails the command with exit code 1, and services
+still starting when --wait-timeout expires exit with code 2.
+
+With --export-compose, a healthcheck is suggested for the services which don't declare
+one, from the ports their containers expose: an HTTP check of /health on web ports, a TCP
+check otherwise. The suggestions are written as a compose override file to review, they
+are guesses: the images must provide curl or nc, and the application the checked path.
+
+With --watch, the health of the services is polled until interrupted. For each service, the
+share of time spent healthy since the watch started is displayed as its uptime, along with
+when its state last changed. With --format json, a JSON object is written per poll instead.
+
+--log-file appends every state transition observed by --watch to a file, as one JSON object
+per line with the service, the previous and new states, when it changed and the output of
+the last healthcheck probe, to replay the timeline of an incident once the watch is gone.
+The file is rotated to <file>.1 when it would grow past --log-max-size.
 `,
 		RunE: Adapt(func(ctx context.Context, args []string) error {
 			opts.service = ""
@@ -80,10 +148,43 @@ This command helps you monitor, configure, and manage health checks for your ser
 	cmd.Flags().DurationVar(&opts.startPeriod, "start-period", 0, "Health check start period")
 	cmd.Flags().StringArrayVar(&opts.test, "test", []string{}, "Health check test command")
 	cmd.Flags().BoolVar(&opts.disable, "disable", false, "Disable health check")
+	cmd.Flags().StringArrayVar(&opts.httpProbes, "http", []string{}, "With --check, probe an HTTP endpoint (e.g. http://localhost:8080/health)")
+	cmd.Flags().StringArrayVar(&opts.tcpProbes, "tcp", []string{}, "With --check, probe a TCP address (e.g. localhost:5432)")
+	cmd.Flags().BoolVar(&opts.wait, "wait", false, "With --status, wait until all services are healthy")
+	cmd.Flags().BoolVar(&opts.exportCompose, "export-compose", false, "Suggest healthchecks for the services without one and write them to a compose override file")
+	cmd.Flags().StringVar(&opts.exportFile, "export-file", "compose.healthcheck.yaml", "File written by --export-compose, relative to the project directory (\"-\" for stdout)")
+	cmd.Flags().StringVar(&opts.format, "format", "text", "Format of the --watch output (text, json)")
+	cmd.Flags().StringVar(&opts.logFile, "log-file", "", "With --watch, append the state transitions to this file as NDJSON")
+	cmd.Flags().StringVar(&opts.logMaxSize, "log-max-size", "10MB", "Size past which --log-file is rotated (0 to never rotate)")
+	cmd.Flags().DurationVar(&opts.waitTimeout, "wait-timeout", 0, "With --wait, maximum duration to wait for services still starting (0 waits forever)")
 	return cmd
 }
 
 func runHealth(ctx context.Context, dockerCli command.Cli, backendOptions *BackendOptions, opts *healthOptions) error {
+	if len(opts.httpProbes) > 0 || len(opts.tcpProbes) > 0 {
+		if !opts.check {
+			return fmt.Errorf("--http and --tcp require --check")
+		}
+		return runHealthProbes(ctx, opts)
+	}
+	if opts.wait && !opts.status {
+		return fmt.Errorf("--wait requires --status")
+	}
+	if opts.format != "text" && opts.format != "json" {
+		return fmt.Errorf("unsupported format %q, must be one of text, json", opts.format)
+	}
+	var timeline *healthTimelineLog
+	if opts.logFile != "" {
+		if !opts.watch {
+			return fmt.Errorf("--log-file requires --watch")
+		}
+		maxSize, err := units.RAMInBytes(opts.logMaxSize)
+		if err != nil {
+			return fmt.Errorf("invalid --log-max-size %q: %v", opts.logMaxSize, err)
+		}
+		timeline = &healthTimelineLog{path: opts.logFile, maxSize: maxSize}
+	}
+
 	backend, err := compose.NewComposeService(dockerCli, backendOptions.Options...)
 	if err != nil {
 		return err
@@ -94,6 +195,16 @@ func runHealth(ctx context.Context, dockerCli command.Cli, backendOptions *Backe
 		return err
 	}
 
+	if opts.wait {
+		return waitForHealth(ctx, backend, project.Name, opts)
+	}
+	if opts.watch {
+		return watchHealth(ctx, dockerCli, backend, project.Name, opts, timeline)
+	}
+	if opts.exportCompose {
+		return runHealthExportCompose(ctx, dockerCli, backend, project, opts)
+	}
+
 	// Get containers status
 	containers, err := backend.Ps(ctx, project.Name, api.PsOptions{})
 	if err != nil {
@@ -110,8 +221,581 @@ func runHealth(ctx context.Context, dockerCli command.Cli, backendOptions *Backe
 		fmt.Printf("Image: %s\n", container.Image)
 		fmt.Println()
 	}
+	if opts.status {
+		fmt.Println(formatHealthTally(tallyHealthStates(serviceHealthStates(containers, opts.service))))
+	}
 
 	return nil
 }
 
-// Health check functionality is integrated into the main runHealth function
+// waitForHealth polls the project until every service is healthy, a service
+// stays unhealthy for more than opts.retries polls, or the wait times out
+func waitForHealth(ctx context.Context, backend api.Compose, projectName string, opts *healthOptions) error {
+	if opts.waitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.waitTimeout)
+		defer cancel()
+	}
+
+	unhealthyPolls := map[string]int{}
+	for {
+		containers, err := backend.Ps(ctx, projectName, api.PsOptions{All: true})
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return cli.StatusError{StatusCode: healthExitStarting, Status: "timed out waiting for services to become healthy"}
+			}
+			return err
+		}
+		states := serviceHealthStates(containers, opts.service)
+		if len(states) == 0 {
+			return fmt.Errorf("no containers found for project %s", projectName)
+		}
+		tally := tallyHealthStates(states)
+		fmt.Println(formatHealthTally(tally))
+
+		if failed := failedHealthServices(states, unhealthyPolls, opts.retries); len(failed) > 0 {
+			return cli.StatusError{
+				StatusCode: healthExitUnhealthy,
+				Status:     fmt.Sprintf("service(s) unhealthy: %s", strings.Join(failed, ", ")),
+			}
+		}
+		if tally[healthStateHealthy] == len(states) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return cli.StatusError{
+					StatusCode: healthExitStarting,
+					Status:     fmt.Sprintf("timed out after %s with service(s) not yet healthy: %s", opts.waitTimeout, strings.Join(pendingHealthServices(states), ", ")),
+				}
+			}
+			return ctx.Err()
+		case <-time.After(healthWaitPollInterval):
+		}
+	}
+}
+
+// healthUptime is the health of a service observed since the watch started
+type healthUptime struct {
+	Service string `json:"service"`
+	State   string `json:"state"`
+	// Watched is how long the service has been observed, Healthy how long of it was spent healthy
+	Watched        time.Duration `json:"-"`
+	Healthy        time.Duration `json:"-"`
+	UptimePercent  float64       `json:"uptime_percent"`
+	WatchedSeconds float64       `json:"watched_seconds"`
+	// LastTransition is when the state last changed, nil if it never did
+	LastTransition *time.Time `json:"last_transition,omitempty"`
+	Transitions    int        `json:"transitions"`
+
+	observed time.Time
+}
+
+// healthUptimeTracker accumulates the time each service spends in each health state between polls
+type healthUptimeTracker struct {
+	services map[string]*healthUptime
+}
+
+func newHealthUptimeTracker() *healthUptimeTracker {
+	return &healthUptimeTracker{services: map[string]*healthUptime{}}
+}
+
+// observe records the states polled at now and returns the transitions, sorted by service. The time
+// since the previous poll is accounted to the previous state of each service. A service seen before
+// but without containers anymore is unhealthy.
+func (t *healthUptimeTracker) observe(states map[string]string, now time.Time) []healthTransition {
+	var transitions []healthTransition
+	for service := range t.services {
+		if _, ok := states[service]; !ok {
+			states[service] = healthStateUnhealthy
+		}
+	}
+	for service, state := range states {
+		uptime, ok := t.services[service]
+		if !ok {
+			t.services[service] = &healthUptime{Service: service, State: state, observed: now}
+			continue
+		}
+		elapsed := now.Sub(uptime.observed)
+		uptime.Watched += elapsed
+		if uptime.State == healthStateHealthy {
+			uptime.Healthy += elapsed
+		}
+		if state != uptime.State {
+			transitions = append(transitions, healthTransition{Service: service, From: uptime.State, To: state, Timestamp: now})
+			transition := now
+			uptime.LastTransition = &transition
+			uptime.Transitions++
+			uptime.State = state
+		}
+		uptime.observed = now
+	}
+	sort.Slice(transitions, func(i, j int) bool { return transitions[i].Service < transitions[j].Service })
+	return transitions
+}
+
+// snapshot returns the uptime of every service, sorted by name
+func (t *healthUptimeTracker) snapshot() []healthUptime {
+	uptimes := make([]healthUptime, 0, len(t.services))
+	for _, uptime := range t.services {
+		u := *uptime
+		switch {
+		case u.Watched > 0:
+			u.UptimePercent = float64(u.Healthy) / float64(u.Watched) * 100
+		case u.State == healthStateHealthy:
+			u.UptimePercent = 100
+		}
+		u.WatchedSeconds = u.Watched.Seconds()
+		uptimes = append(uptimes, u)
+	}
+	sort.Slice(uptimes, func(i, j int) bool { return uptimes[i].Service < uptimes[j].Service })
+	return uptimes
+}
+
+// watchHealth polls the health of the project services until the context is done, displaying their
+// uptime and appending their transitions to timeline when set
+func watchHealth(ctx context.Context, dockerCli command.Cli, backend api.Compose, projectName string, opts *healthOptions, timeline *healthTimelineLog) error {
+	tracker := newHealthUptimeTracker()
+	for {
+		containers, err := backend.Ps(ctx, projectName, api.PsOptions{All: true})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		now := time.Now()
+		transitions := tracker.observe(serviceHealthStates(containers, opts.service), now)
+		if timeline != nil && len(transitions) > 0 {
+			for i, transition := range transitions {
+				transitions[i].Output = healthProbeOutput(ctx, dockerCli, containers, transition.Service, transition.To)
+			}
+			if err := timeline.append(transitions); err != nil {
+				return err
+			}
+		}
+		if err := printHealthUptimes(os.Stdout, tracker.snapshot(), now, opts.format); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(healthWaitPollInterval):
+		}
+	}
+}
+
+// printHealthUptimes renders the uptime of the services, redrawing the screen in text format
+func printHealthUptimes(w io.Writer, uptimes []healthUptime, now time.Time, format string) error {
+	if format == "json" {
+		return json.NewEncoder(w).Encode(map[string]any{
+			"timestamp": now.Format(time.RFC3339),
+			"services":  uptimes,
+		})
+	}
+	_, _ = fmt.Fprint(w, "\033[2J\033[H")
+	_, _ = fmt.Fprintf(w, "Health uptime at %s\n\n", now.Format(time.TimeOnly))
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SERVICE\tSTATE\tUPTIME\tLAST TRANSITION")
+	for _, u := range uptimes {
+		last := "never"
+		if u.LastTransition != nil {
+			last = fmt.Sprintf("%s ago", now.Sub(*u.LastTransition).Round(time.Second))
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%.1f%% of %s\t%s\n", u.Service, u.State, u.UptimePercent, u.Watched.Round(time.Second), last)
+	}
+	return tw.Flush()
+}
+
+// healthTransition is a change of the health state of a service, as written to --log-file
+type healthTransition struct {
+	Service   string    `json:"service"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Timestamp time.Time `json:"timestamp"`
+	// Output is the output of the last healthcheck probe, or the status of the container without healthcheck
+	Output string `json:"output,omitempty"`
+}
+
+// healthTimelineLog appends the health transitions to an NDJSON file, rotated to path.1 once it
+// would grow past maxSize bytes
+type healthTimelineLog struct {
+	path    string
+	maxSize int64
+}
+
+func (l *healthTimelineLog) append(transitions []healthTransition) error {
+	for _, transition := range transitions {
+		line, err := json.Marshal(transition)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+		if info, err := os.Stat(l.path); err == nil && l.maxSize > 0 && info.Size() > 0 && info.Size()+int64(len(line)) > l.maxSize {
+			if err := os.Rename(l.path, l.path+".1"); err != nil {
+				return fmt.Errorf("failed to rotate %s: %v", l.path, err)
+			}
+		}
+		f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", l.path, err)
+		}
+		_, err = f.Write(line)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %v", l.path, err)
+		}
+	}
+	return nil
+}
+
+// healthProbeOutput returns the output of the last healthcheck probe of the worst replica of a
+// service, or its status when it has no healthcheck
+func healthProbeOutput(ctx context.Context, dockerCli command.Cli, containers []api.ContainerSummary, service, state string) string {
+	for _, container := range containers {
+		if container.Service != service || containerHealthState(container) != state {
+			continue
+		}
+		inspect, err := dockerCli.Client().ContainerInspect(ctx, container.ID)
+		if err == nil && inspect.State != nil && inspect.State.Health != nil && len(inspect.State.Health.Log) > 0 {
+			return strings.TrimSpace(inspect.State.Health.Log[len(inspect.State.Health.Log)-1].Output)
+		}
+		return container.Status
+	}
+	return ""
+}
+
+// containerHealthState classifies a container as healthy, starting or unhealthy
+func containerHealthState(container api.ContainerSummary) string {
+	switch container.State {
+	case "running":
+	case "created", "restarting":
+		return healthStateStarting
+	default:
+		return healthStateUnhealthy
+	}
+	switch container.Health {
+	case "starting":
+		return healthStateStarting
+	case "unhealthy":
+		return healthStateUnhealthy
+	default:
+		return healthStateHealthy
+	}
+}
+
+// serviceHealthStates reduces containers to one state per service, a service
+// is only as healthy as its worst replica
+func serviceHealthStates(containers []api.ContainerSummary, service string) map[string]string {
+	rank := map[string]int{healthStateHealthy: 0, healthStateStarting: 1, healthStateUnhealthy: 2}
+	states := map[string]string{}
+	for _, container := range containers {
+		if service != "" && container.Service != service {
+			continue
+		}
+		state := containerHealthState(container)
+		if current, ok := states[container.Service]; !ok || rank[state] > rank[current] {
+			states[container.Service] = state
+		}
+	}
+	return states
+}
+
+// tallyHealthStates counts services per health state
+func tallyHealthStates(states map[string]string) map[string]int {
+	tally := map[string]int{healthStateHealthy: 0, healthStateStarting: 0, healthStateUnhealthy: 0}
+	for _, state := range states {
+		tally[state]++
+	}
+	return tally
+}
+
+// formatHealthTally renders the per-state tally on a single line
+func formatHealthTally(tally map[string]int) string {
+	return fmt.Sprintf("%s: %d, %s: %d, %s: %d",
+		healthStateHealthy, tally[healthStateHealthy],
+		healthStateStarting, tally[healthStateStarting],
+		healthStateUnhealthy, tally[healthStateUnhealthy])
+}
+
+// failedHealthServices updates the consecutive unhealthy poll count of each
+// service and returns those which have been unhealthy for more than retries polls
+func failedHealthServices(states map[string]string, unhealthyPolls map[string]int, retries int) []string {
+	var failed []string
+	for service, state := range states {
+		if state != healthStateUnhealthy {
+			delete(unhealthyPolls, service)
+			continue
+		}
+		unhealthyPolls[service]++
+		if unhealthyPolls[service] > retries {
+			failed = append(failed, service)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// pendingHealthServices lists services which are not healthy yet
+func pendingHealthServices(states map[string]string) []string {
+	var pending []string
+	for service, state := range states {
+		if state != healthStateHealthy {
+			pending = append(pending, service)
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+// healthProbeResult is the outcome of an HTTP or TCP probe
+type healthProbeResult struct {
+	Target  string
+	Detail  string
+	Latency time.Duration
+	Err     error
+}
+
+// runHealthProbes runs every --http and --tcp probe and fails if any of them failed
+func runHealthProbes(ctx context.Context, opts *healthOptions) error {
+	var results []healthProbeResult
+	for _, url := range opts.httpProbes {
+		results = append(results, probeHTTP(ctx, url, opts.timeout))
+	}
+	for _, address := range opts.tcpProbes {
+		results = append(results, probeTCP(ctx, address, opts.timeout))
+	}
+
+	fmt.Println("Probe Results:")
+	fmt.Println("=============")
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Printf("FAIL %s: %v\n", result.Target, result.Err)
+			continue
+		}
+		fmt.Printf("OK   %s: %s (%s)\n", result.Target, result.Detail, result.Latency.Round(time.Millisecond))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d probe(s) failed", failed, len(results))
+	}
+	return nil
+}
+
+// probeHTTP requests the URL, any status below 400 is healthy
+func probeHTTP(ctx context.Context, url string, timeout time.Duration) healthProbeResult {
+	result := healthProbeResult{Target: url}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	_ = resp.Body.Close()
+	result.Detail = resp.Status
+	if resp.StatusCode >= http.StatusBadRequest {
+		result.Err = errors.New(resp.Status)
+	}
+	return result
+}
+
+// probeTCP checks a connection to the address can be established
+func probeTCP(ctx context.Context, address string, timeout time.Duration) healthProbeResult {
+	result := healthProbeResult{Target: "tcp://" + address}
+	dialer := net.Dialer{Timeout: timeout}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	_ = conn.Close()
+	result.Detail = "connected"
+	return result
+}
+
+// healthSuggestion is a healthcheck guessed for a service from one of its ports
+type healthSuggestion struct {
+	Port string
+	Test []string
+}
+
+// healthHTTPPorts are the ports assumed to serve HTTP, other ports get a TCP check
+var healthHTTPPorts = map[int]bool{80: true, 3000: true, 4000: true, 5000: true, 8000: true, 8080: true, 8081: true, 8888: true, 9000: true}
+
+// suggestHealthcheck guesses a healthcheck from the ports of a service ("80/tcp", "5432"), preferring
+// an HTTP port, then the lowest TCP port
+func suggestHealthcheck(ports []string) (healthSuggestion, bool) {
+	var candidates []int
+	for _, port := range ports {
+		number, protocol, _ := strings.Cut(port, "/")
+		if protocol != "" && protocol != "tcp" {
+			continue
+		}
+		if n, err := strconv.Atoi(number); err == nil && n > 0 {
+			candidates = append(candidates, n)
+		}
+	}
+	if len(candidates) == 0 {
+		return healthSuggestion{}, false
+	}
+	sort.Ints(candidates)
+	for _, port := range candidates {
+		if healthHTTPPorts[port] {
+			return healthSuggestion{
+				Port: strconv.Itoa(port),
+				Test: []string{"CMD-SHELL", fmt.Sprintf("curl -f http://localhost:%d/health || exit 1", port)},
+			}, true
+		}
+	}
+	return healthSuggestion{
+		Port: strconv.Itoa(candidates[0]),
+		Test: []string{"CMD-SHELL", fmt.Sprintf("nc -z localhost %d || exit 1", candidates[0])},
+	}, true
+}
+
+// serviceHealthPorts lists the ports declared by a service and exposed by its container
+func serviceHealthPorts(service types.ServiceConfig, exposed []string) []string {
+	ports := append([]string{}, exposed...)
+	for _, port := range service.Ports {
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		ports = append(ports, fmt.Sprintf("%d/%s", port.Target, protocol))
+	}
+	ports = append(ports, service.Expose...)
+	return ports
+}
+
+// containerHealthPorts inspects the first container of a service for the ports its image exposes, and
+// whether the image already declares a healthcheck
+func containerHealthPorts(ctx context.Context, dockerCli command.Cli, containers []api.ContainerSummary, service string) ([]string, bool, error) {
+	for _, c := range containers {
+		if c.Service != service {
+			continue
+		}
+		inspect, err := dockerCli.Client().ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return nil, false, err
+		}
+		if inspect.Config == nil {
+			return nil, false, nil
+		}
+		if hc := inspect.Config.Healthcheck; hc != nil && len(hc.Test) > 0 && hc.Test[0] != "NONE" {
+			return nil, true, nil
+		}
+		var ports []string
+		for port := range inspect.Config.ExposedPorts {
+			ports = append(ports, string(port))
+		}
+		return ports, false, nil
+	}
+	return nil, false, nil
+}
+
+// runHealthExportCompose suggests a healthcheck for the services of the project which don't have
+// one, and writes them to a compose override file
+func runHealthExportCompose(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, opts *healthOptions) error {
+	containers, err := backend.Ps(ctx, project.Name, api.PsOptions{})
+	if err != nil {
+		return err
+	}
+	suggestions := map[string]healthSuggestion{}
+	for _, name := range project.ServiceNames() {
+		service := project.Services[name]
+		if service.HealthCheck != nil {
+			continue
+		}
+		exposed, declared, err := containerHealthPorts(ctx, dockerCli, containers, name)
+		if err != nil {
+			return err
+		}
+		if declared {
+			_, _ = fmt.Fprintf(dockerCli.Err(), "%s: the image declares a healthcheck, skipped\n", name)
+			continue
+		}
+		suggestion, ok := suggestHealthcheck(serviceHealthPorts(service, exposed))
+		if !ok {
+			_, _ = fmt.Fprintf(dockerCli.Err(), "%s: no TCP port exposed, no healthcheck suggested\n", name)
+			continue
+		}
+		suggestions[name] = suggestion
+	}
+	if len(suggestions) == 0 {
+		_, _ = fmt.Fprintln(dockerCli.Err(), "No healthcheck to suggest")
+		return nil
+	}
+
+	if opts.exportFile == "-" {
+		return writeHealthcheckOverride(dockerCli.Out(), suggestions, opts)
+	}
+	file := opts.exportFile
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(project.WorkingDir, file)
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%s already exists, remove it or choose another file with --export-file", file)
+		}
+		return fmt.Errorf("failed to create %s: %v", file, err)
+	}
+	defer f.Close() //nolint:errcheck
+	if err := writeHealthcheckOverride(f, suggestions, opts); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(dockerCli.Out(), "Suggested healthchecks for %d service(s) written to %s\n", len(suggestions), file)
+	_, _ = fmt.Fprintf(dockerCli.Out(), "Review them, then add the file to the project with: -f %s\n", file)
+	return nil
+}
+
+// writeHealthcheckOverride renders the suggested healthchecks as a compose override file, flagged as
+// guesses to review
+func writeHealthcheckOverride(w io.Writer, suggestions map[string]healthSuggestion, opts *healthOptions) error {
+	names := make([]string, 0, len(suggestions))
+	for name := range suggestions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("# Healthchecks suggested by `docker compose health --export-compose`.\n")
+	b.WriteString("# These are GUESSES based on the exposed ports, review them before use: the images\n")
+	b.WriteString("# must provide curl (HTTP checks) or nc (TCP checks), and the checked path must exist.\n")
+	b.WriteString("services:\n")
+	for _, name := range names {
+		suggestion := suggestions[name]
+		test := make([]string, 0, len(suggestion.Test))
+		for _, arg := range suggestion.Test {
+			test = append(test, strconv.Quote(arg))
+		}
+		fmt.Fprintf(&b, "  %s:\n", name)
+		b.WriteString("    healthcheck:\n")
+		fmt.Fprintf(&b, "      # guessed from port %s, review before use\n", suggestion.Port)
+		fmt.Fprintf(&b, "      test: [%s]\n", strings.Join(test, ", "))
+		fmt.Fprintf(&b, "      interval: %s\n", opts.interval)
+		fmt.Fprintf(&b, "      timeout: %s\n", opts.timeout)
+		fmt.Fprintf(&b, "      retries: %d\n", opts.retries)
+		if opts.startPeriod > 0 {
+			fmt.Fprintf(&b, "      start_period: %s\n", opts.startPeriod)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
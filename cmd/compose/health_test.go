@@ -0,0 +1,265 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/cli/cli"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.yaml.in/yaml/v4"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestProbeHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	result := probeHTTP(context.Background(), server.URL+"/health", time.Second)
+	require.NoError(t, result.Err)
+	assert.Equal(t, "200 OK", result.Detail)
+
+	result = probeHTTP(context.Background(), server.URL+"/other", time.Second)
+	assert.EqualError(t, result.Err, "503 Service Unavailable")
+}
+
+func TestProbeTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+
+	result := probeTCP(context.Background(), address, time.Second)
+	require.NoError(t, result.Err)
+	assert.Equal(t, "connected", result.Detail)
+
+	require.NoError(t, listener.Close())
+	result = probeTCP(context.Background(), address, time.Second)
+	assert.Error(t, result.Err)
+}
+
+func TestServiceHealthStates(t *testing.T) {
+	containers := []api.ContainerSummary{
+		{Service: "web", State: "running", Health: "healthy"},
+		{Service: "web", State: "running", Health: "starting"},
+		{Service: "db", State: "running", Health: "unhealthy"},
+		{Service: "cache", State: "running"},
+		{Service: "worker", State: "restarting"},
+		{Service: "job", State: "exited"},
+	}
+	states := serviceHealthStates(containers, "")
+	assert.Equal(t, map[string]string{
+		"web":    healthStateStarting,
+		"db":     healthStateUnhealthy,
+		"cache":  healthStateHealthy,
+		"worker": healthStateStarting,
+		"job":    healthStateUnhealthy,
+	}, states)
+	assert.Equal(t, "healthy: 1, starting: 2, unhealthy: 2", formatHealthTally(tallyHealthStates(states)))
+	assert.Equal(t, []string{"job", "web", "worker"}, pendingHealthServices(map[string]string{
+		"web": healthStateStarting, "worker": healthStateStarting, "job": healthStateUnhealthy, "cache": healthStateHealthy,
+	}))
+
+	assert.Equal(t, map[string]string{"cache": healthStateHealthy}, serviceHealthStates(containers, "cache"))
+}
+
+func TestFailedHealthServices(t *testing.T) {
+	polls := map[string]int{}
+	states := map[string]string{"db": healthStateUnhealthy, "web": healthStateStarting}
+	assert.Empty(t, failedHealthServices(states, polls, 1))
+	assert.Equal(t, []string{"db"}, failedHealthServices(states, polls, 1))
+
+	// recovering resets the count
+	polls = map[string]int{}
+	assert.Empty(t, failedHealthServices(states, polls, 1))
+	assert.Empty(t, failedHealthServices(map[string]string{"db": healthStateHealthy}, polls, 1))
+	assert.Empty(t, failedHealthServices(states, polls, 1))
+}
+
+func TestWaitForHealth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{All: true}).Return([]api.ContainerSummary{
+		{Service: "web", State: "running", Health: "healthy"},
+		{Service: "db", State: "running"},
+	}, nil)
+	require.NoError(t, waitForHealth(context.Background(), backend, "shop", &healthOptions{}))
+
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{All: true}).Return([]api.ContainerSummary{
+		{Service: "web", State: "running", Health: "starting"},
+		{Service: "db", State: "running", Health: "unhealthy"},
+	}, nil)
+	err := waitForHealth(context.Background(), backend, "shop", &healthOptions{})
+	var statusErr cli.StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, healthExitUnhealthy, statusErr.StatusCode)
+	assert.Contains(t, statusErr.Status, "db")
+
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{All: true}).Return([]api.ContainerSummary{
+		{Service: "web", State: "running", Health: "starting"},
+	}, nil).AnyTimes()
+	err = waitForHealth(context.Background(), backend, "shop", &healthOptions{waitTimeout: 10 * time.Millisecond})
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, healthExitStarting, statusErr.StatusCode)
+	assert.Contains(t, statusErr.Status, "web")
+}
+
+func TestSuggestHealthcheck(t *testing.T) {
+	_, ok := suggestHealthcheck(nil)
+	assert.False(t, ok)
+	_, ok = suggestHealthcheck([]string{"53/udp"})
+	assert.False(t, ok)
+
+	suggestion, ok := suggestHealthcheck([]string{"5432/tcp", "8080/tcp", "80"})
+	require.True(t, ok)
+	assert.Equal(t, "80", suggestion.Port)
+	assert.Equal(t, []string{"CMD-SHELL", "curl -f http://localhost:80/health || exit 1"}, suggestion.Test)
+
+	suggestion, ok = suggestHealthcheck([]string{"6379/tcp", "5432"})
+	require.True(t, ok)
+	assert.Equal(t, "5432", suggestion.Port)
+	assert.Equal(t, []string{"CMD-SHELL", "nc -z localhost 5432 || exit 1"}, suggestion.Test)
+}
+
+func TestServiceHealthPorts(t *testing.T) {
+	service := types.ServiceConfig{
+		Ports:  []types.ServicePortConfig{{Target: 3000}, {Target: 53, Protocol: "udp"}},
+		Expose: types.StringOrNumberList{"9000"},
+	}
+	assert.Equal(t, []string{"80/tcp", "3000/tcp", "53/udp", "9000"}, serviceHealthPorts(service, []string{"80/tcp"}))
+}
+
+func TestWriteHealthcheckOverride(t *testing.T) {
+	var b strings.Builder
+	err := writeHealthcheckOverride(&b, map[string]healthSuggestion{
+		"web": {Port: "8080", Test: []string{"CMD-SHELL", "curl -f http://localhost:8080/health || exit 1"}},
+		"db":  {Port: "5432", Test: []string{"CMD-SHELL", "nc -z localhost 5432 || exit 1"}},
+	}, &healthOptions{interval: 30 * time.Second, timeout: 5 * time.Second, retries: 3})
+	require.NoError(t, err)
+	out := b.String()
+	assert.Contains(t, out, "GUESSES")
+	assert.Less(t, strings.Index(out, "  db:"), strings.Index(out, "  web:"))
+	assert.Contains(t, out, "      # guessed from port 8080, review before use\n")
+	assert.Contains(t, out, `      test: ["CMD-SHELL", "curl -f http://localhost:8080/health || exit 1"]`)
+	assert.Contains(t, out, "      interval: 30s\n")
+	assert.NotContains(t, out, "start_period")
+
+	var override struct {
+		Services map[string]any `yaml:"services"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte(out), &override))
+	assert.Len(t, override.Services, 2)
+}
+
+func TestHealthUptimeTracker(t *testing.T) {
+	start := time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC)
+	tracker := newHealthUptimeTracker()
+	tracker.observe(map[string]string{"api": healthStateHealthy, "db": healthStateStarting}, start)
+	tracker.observe(map[string]string{"api": healthStateHealthy, "db": healthStateHealthy}, start.Add(8*time.Minute))
+	tracker.observe(map[string]string{"api": healthStateUnhealthy, "db": healthStateHealthy}, start.Add(9*time.Minute))
+	// api has no container anymore
+	tracker.observe(map[string]string{"db": healthStateHealthy}, start.Add(10*time.Minute))
+
+	uptimes := tracker.snapshot()
+	require.Len(t, uptimes, 2)
+	api, db := uptimes[0], uptimes[1]
+	assert.Equal(t, "api", api.Service)
+	assert.Equal(t, healthStateUnhealthy, api.State)
+	assert.Equal(t, 10*time.Minute, api.Watched)
+	assert.InDelta(t, 90, api.UptimePercent, 0.001)
+	assert.Equal(t, start.Add(9*time.Minute), *api.LastTransition)
+	assert.Equal(t, 1, api.Transitions)
+	assert.InDelta(t, 20, db.UptimePercent, 0.001)
+	assert.Equal(t, start.Add(8*time.Minute), *db.LastTransition)
+
+	var buf strings.Builder
+	require.NoError(t, printHealthUptimes(&buf, uptimes, start.Add(11*time.Minute), "text"))
+	assert.Contains(t, buf.String(), "api       unhealthy   90.0% of 10m0s   2m0s ago\n")
+	assert.Contains(t, buf.String(), "db        healthy     20.0% of 10m0s   3m0s ago\n")
+
+	buf.Reset()
+	require.NoError(t, printHealthUptimes(&buf, uptimes, start.Add(11*time.Minute), "json"))
+	assert.Contains(t, buf.String(), `{"service":"api","state":"unhealthy","uptime_percent":90,"watched_seconds":600,"last_transition":"2026-05-04T10:09:00Z","transitions":1}`)
+
+	fresh := newHealthUptimeTracker()
+	fresh.observe(map[string]string{"web": healthStateHealthy}, start)
+	assert.InDelta(t, 100, fresh.snapshot()[0].UptimePercent, 0.001)
+	assert.Nil(t, fresh.snapshot()[0].LastTransition)
+}
+
+func TestHealthTimelineLog(t *testing.T) {
+	start := time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC)
+	tracker := newHealthUptimeTracker()
+	assert.Empty(t, tracker.observe(map[string]string{"api": healthStateHealthy, "db": healthStateStarting}, start))
+	transitions := tracker.observe(map[string]string{"api": healthStateUnhealthy, "db": healthStateHealthy}, start.Add(time.Minute))
+	assert.Equal(t, []healthTransition{
+		{Service: "api", From: healthStateHealthy, To: healthStateUnhealthy, Timestamp: start.Add(time.Minute)},
+		{Service: "db", From: healthStateStarting, To: healthStateHealthy, Timestamp: start.Add(time.Minute)},
+	}, transitions)
+
+	ctrl := gomock.NewController(t)
+	cli := mocks.NewMockCli(ctrl)
+	apiClient := mocks.NewMockAPIClient(ctrl)
+	cli.EXPECT().Client().Return(apiClient).AnyTimes()
+	apiClient.EXPECT().ContainerInspect(gomock.Any(), "api-1").Return(container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{State: &container.State{Health: &container.Health{Log: []*container.HealthcheckResult{
+			{Output: "ok\n"},
+			{Output: "curl: (7) Failed to connect\n"},
+		}}}},
+	}, nil)
+	containers := []api.ContainerSummary{
+		{ID: "api-1", Service: "api", State: "running", Health: "unhealthy"},
+		{ID: "db-1", Service: "db", State: "running", Status: "Up 1 minute"},
+	}
+	assert.Equal(t, "curl: (7) Failed to connect", healthProbeOutput(t.Context(), cli, containers, "api", healthStateUnhealthy))
+	assert.Empty(t, healthProbeOutput(t.Context(), cli, containers, "web", healthStateUnhealthy))
+
+	file := filepath.Join(t.TempDir(), "health.ndjson")
+	timeline := &healthTimelineLog{path: file, maxSize: 256}
+	transitions[0].Output = "curl: (7) Failed to connect"
+	require.NoError(t, timeline.append(transitions))
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, `{"service":"api","from":"healthy","to":"unhealthy","timestamp":"2026-05-04T10:01:00Z","output":"curl: (7) Failed to connect"}`+"\n"+
+		`{"service":"db","from":"starting","to":"healthy","timestamp":"2026-05-04T10:01:00Z"}`+"\n", string(content))
+
+	// the next record would grow the file past its max size
+	require.NoError(t, timeline.append(transitions[1:]))
+	rotated, err := os.ReadFile(file + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, string(content), string(rotated))
+	content, err = os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, `{"service":"db","from":"starting","to":"healthy","timestamp":"2026-05-04T10:01:00Z"}`+"\n", string(content))
+}
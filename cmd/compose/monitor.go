@@ -17,36 +17,85 @@
 package compose
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/containerd/errdefs"
+	"github.com/docker/cli/cli"
 	"github.com/docker/cli/cli/command"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
 
+	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/docker/compose/v5/pkg/api"
 	"github.com/docker/compose/v5/pkg/compose"
 )
 
 type monitorOptions struct {
 	*ProjectOptions
-	interval   time.Duration
-	format     string
-	watch      bool
-	outputFile string
+	services       []string
+	all            bool
+	interval       time.Duration
+	format         string
+	watch          bool
+	outputFile     string
+	events         bool
+	groupByService bool
+	expand         bool
+	maxFailures    int
+	compact        bool
+
+	pushgateway        string
+	pushgatewayJob     string
+	pushgatewayCleanup bool
+
+	cpuAlert      float64
+	memAlert      float64
+	thresholdExit bool
+
+	projects    []string
+	allProjects bool
+
+	record string
+	replay string
+	speed  float64
 }
 
+// Exit codes of monitor --threshold-exit: a breach is told apart from a failure to sample
+const (
+	monitorExitBreach   = 1
+	monitorExitNoSample = 2
+)
+
 func monitorCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *BackendOptions) *cobra.Command {
 	opts := monitorOptions{
 		ProjectOptions: p,
 		interval:       5 * time.Second,
 		format:         "table",
 		watch:          true,
+		groupByService: true,
+		maxFailures:    5,
+		pushgatewayJob: "compose_monitor",
+		speed:          1,
 	}
 
 	cmd := &cobra.Command{
-		Use:   "monitor [OPTIONS]",
+		Use:   "monitor [OPTIONS] [SERVICE...]",
 		Short: "Monitor services status and resources",
 		Long: `EXPERIMENTAL - Monitor services status and resources usage.
 
@@ -54,30 +103,111 @@ This command provides real-time monitoring of:
 - Service status (running, stopped, etc.)
 - Container health
 - Resource usage (CPU, memory, network, disk)
-- Port mappings and endpoints
+- Port mappings and endpoints, flagging the published ports nothing answers on and
+  the host ports claimed by several services
+
+With --pushgateway, every refresh pushes the service status and resource gauges to a
+Prometheus Pushgateway, grouped by job and project and labeled by service.
+
+With --compact, the status is rendered as one line per service (name, state, health,
+CPU and memory) without header nor endpoints, and refreshed in place on a terminal.
+
+--cpu-alert and --mem-alert set the CPU usage (percent of one CPU) and memory usage
+(percent of the container memory limit) above which a container is reported, on every
+refresh, as breaching.
+
+--threshold-exit takes a single sample instead of watching, prints the snapshot, and
+checks it against --cpu-alert and --mem-alert, at least one of which is required. It is
+meant as a CI gate and exits with:
+  0 when every container is within bounds
+  1 when a container breached a threshold, the breaches being listed on stderr
+  2 when the sample could not be taken, e.g. stats of a running container were missing
+
+All services are monitored when none are given.
+
+--projects a,b,c, or --all-projects, monitors several compose projects at once, found from the
+labels of their containers rather than from compose files, and renders them grouped by
+project. Every project is refreshed independently, a slow one being shown with its last
+refresh and marked stale rather than holding the others back.
+
+--record FILE appends every refresh to FILE as a JSON frame per line: the project, the time of
+the refresh, the services with their replicas, and the endpoints. --replay FILE renders the
+recorded frames, with the --format, --compact, --group-by-service, --expand and alert options
+of the replay, at the pace they were recorded, --speed times faster. A replay never contacts
+Docker, so a session can be shared and replayed without access to the stack.
 `,
 		RunE: Adapt(func(ctx context.Context, args []string) error {
+			opts.services = args
 			return runMonitor(ctx, dockerCli, backendOptions, &opts)
 		}),
 	}
 
+	cmd.Flags().BoolVar(&opts.all, "all", false, "Monitor all services")
 	cmd.Flags().DurationVar(&opts.interval, "interval", 5*time.Second, "Refresh interval")
 	cmd.Flags().StringVar(&opts.format, "format", "table", "Output format (table, json)")
 	cmd.Flags().BoolVar(&opts.watch, "watch", true, "Continuously monitor services")
 	cmd.Flags().StringVar(&opts.outputFile, "output", "", "Write output to file instead of stdout")
+	cmd.Flags().BoolVar(&opts.events, "events", false, "Stream container lifecycle events for the project")
+	cmd.Flags().BoolVar(&opts.groupByService, "group-by-service", true, "Aggregate replicas into one row per service")
+	cmd.Flags().BoolVar(&opts.expand, "expand", false, "Show individual containers below each service")
+	cmd.Flags().IntVar(&opts.maxFailures, "max-failures", 5, "Consecutive failed refreshes tolerated before giving up while watching")
+	cmd.Flags().BoolVar(&opts.compact, "compact", false, "Print one line per service, refreshed in place")
+	cmd.Flags().StringVar(&opts.pushgateway, "pushgateway", "", "Prometheus Pushgateway URL to push metrics to on each refresh")
+	cmd.Flags().StringVar(&opts.pushgatewayJob, "job", "compose_monitor", "Job name used for metrics pushed to the Pushgateway")
+	cmd.Flags().BoolVar(&opts.pushgatewayCleanup, "pushgateway-cleanup", false, "Delete the pushed metrics from the Pushgateway on exit")
+	cmd.Flags().Float64Var(&opts.cpuAlert, "cpu-alert", 0, "CPU usage percent above which a container is reported as breaching (0 disables)")
+	cmd.Flags().Float64Var(&opts.memAlert, "mem-alert", 0, "Memory usage percent of the limit above which a container is reported as breaching (0 disables)")
+	cmd.Flags().StringSliceVar(&opts.projects, "projects", nil, "Comma-separated list of the running projects to monitor together")
+	cmd.Flags().BoolVar(&opts.allProjects, "all-projects", false, "Monitor every running compose project")
+	cmd.Flags().StringVar(&opts.record, "record", "", "Record every refresh to a file, as NDJSON frames")
+	cmd.Flags().StringVar(&opts.replay, "replay", "", "Replay the frames recorded with --record instead of monitoring the services")
+	cmd.Flags().Float64Var(&opts.speed, "speed", 1, "With --replay, how many times faster than recorded the frames are replayed")
+	cmd.Flags().BoolVar(&opts.thresholdExit, "threshold-exit", false, "Take a single sample and exit non-zero if a container breaches --cpu-alert or --mem-alert")
 	return cmd
 }
 
 func runMonitor(ctx context.Context, dockerCli command.Cli, backendOptions *BackendOptions, opts *monitorOptions) error {
+	if opts.compact && opts.format != "table" {
+		return fmt.Errorf("--compact only supports the table format")
+	}
+	if opts.cpuAlert < 0 || opts.memAlert < 0 {
+		return fmt.Errorf("--cpu-alert and --mem-alert must not be negative")
+	}
+	if opts.thresholdExit {
+		if opts.cpuAlert == 0 && opts.memAlert == 0 {
+			return fmt.Errorf("--threshold-exit requires --cpu-alert or --mem-alert")
+		}
+		if opts.events {
+			return fmt.Errorf("--threshold-exit can't be used with --events")
+		}
+		opts.watch = false
+	}
+	if opts.replay != "" {
+		if opts.record != "" || opts.events || opts.thresholdExit || opts.pushgateway != "" || len(opts.projects) > 0 || opts.allProjects {
+			return fmt.Errorf("--replay can't be used with --record, --events, --threshold-exit, --pushgateway, --projects or --all-projects")
+		}
+		if opts.speed <= 0 {
+			return fmt.Errorf("--speed must be positive, got %v", opts.speed)
+		}
+		return runMonitorReplay(ctx, dockerCli, opts)
+	}
+	if opts.record != "" && (opts.events || len(opts.projects) > 0 || opts.allProjects) {
+		return fmt.Errorf("--record can't be used with --events, --projects or --all-projects")
+	}
 	backend, err := compose.NewComposeService(dockerCli, backendOptions.Options...)
 	if err != nil {
 		return err
 	}
+	if len(opts.projects) > 0 || opts.allProjects {
+		return runMonitorProjects(ctx, dockerCli, backend, opts)
+	}
 
-	project, _, err := opts.ToProject(ctx, dockerCli, backend, nil)
+	selection := opts.SelectServices(opts.services, opts.all)
+	project, _, err := opts.ToProject(ctx, dockerCli, backend, selection)
 	if err != nil {
 		return err
 	}
+	opts.services = opts.ResolveServices(project, selection)
 
 	// Determine output destination
 	output := os.Stdout
@@ -90,93 +220,1022 @@ func runMonitor(ctx context.Context, dockerCli command.Cli, backendOptions *Back
 		output = outputFile
 	}
 
+	if opts.events {
+		return runMonitorEvents(ctx, backend, project.Name, selection, output, opts.format)
+	}
+
+	var recording *os.File
+	if opts.record != "" {
+		recording, err = os.OpenFile(opts.record, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", opts.record, err)
+		}
+		defer recording.Close() //nolint:errcheck
+	}
+
+	if opts.pushgateway != "" && opts.pushgatewayCleanup {
+		defer func() {
+			// the command context is likely cancelled already when exiting on Ctrl+C
+			cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+			defer cancel()
+			if err := deletePushgatewayMetrics(cleanupCtx, opts.pushgateway, opts.pushgatewayJob, project.Name); err != nil {
+				fmt.Fprintf(dockerCli.Err(), "Warning: failed to delete metrics from pushgateway: %v\n", err)
+			}
+		}()
+	}
+
+	// Compact output is redrawn in place on a terminal, and truncated to its width
+	inPlace := opts.compact && opts.watch && opts.outputFile == "" && dockerCli.Out().IsTerminal()
+
 	// Monitor loop
+	failures := 0
 	for {
-		// Clear screen if watching
-		if opts.watch && opts.outputFile == "" {
-			fmt.Fprint(output, "\033[2J\033[H")
+		// Get services status. While watching, failures are tolerated so a daemon restart
+		// doesn't end a long-running monitor: missing stats are rendered as "-".
+		containers, err := backend.Ps(ctx, project.Name, api.PsOptions{Services: selection})
+		if err != nil && opts.thresholdExit {
+			return cli.StatusError{StatusCode: monitorExitNoSample, Status: fmt.Sprintf("failed to sample services: %v", err)}
+		}
+		if err != nil && !opts.watch {
+			return err
+		}
+		var stats map[string]container.StatsResponse
+		if err == nil {
+			stats, err = collectMonitorStats(ctx, dockerCli, containers)
+		}
+		if err != nil {
+			failures++
+			if opts.watch && failures >= opts.maxFailures {
+				return fmt.Errorf("failed to refresh status %d consecutive times: %w", failures, err)
+			}
+			fmt.Fprintf(dockerCli.Err(), "Warning: failed to refresh status (%d/%d): %v\n", failures, opts.maxFailures, err)
+		} else {
+			failures = 0
+			if opts.pushgateway != "" {
+				metrics := formatPushgatewayMetrics(groupMonitorReplicas(containers, stats))
+				if err := pushPushgatewayMetrics(ctx, opts.pushgateway, opts.pushgatewayJob, project.Name, metrics); err != nil {
+					fmt.Fprintf(dockerCli.Err(), "Warning: failed to push metrics to pushgateway: %v\n", err)
+				}
+			}
 		}
 
-		// Show header
-		fmt.Fprintf(output, "=== Docker Compose Monitor ===\n")
-		fmt.Fprintf(output, "Project: %s\n", project.Name)
-		fmt.Fprintf(output, "Time: %s\n\n", time.Now().Format(time.RFC3339))
+		frame := monitorFrame{
+			Project:     project.Name,
+			Time:        time.Now(),
+			Unavailable: containers == nil && failures > 0,
+			Services:    groupMonitorReplicas(containers, stats),
+		}
+		// endpoints aren't rendered in compact output, but recorded for replays
+		if !opts.compact || recording != nil {
+			frame.Endpoints = checkMonitorEndpoints(ctx, monitorEndpoints(project, opts.services))
+		}
+		if err := renderMonitorFrame(dockerCli, output, opts, frame, inPlace); err != nil {
+			return err
+		}
+		if recording != nil {
+			if err := recordMonitorFrame(recording, frame); err != nil {
+				return err
+			}
+		}
+
+		breaches := checkMonitorThresholds(monitorReplicas(containers, stats), opts.cpuAlert, opts.memAlert)
+		for _, breach := range breaches {
+			fmt.Fprintf(dockerCli.Err(), "ALERT %s\n", breach)
+		}
+		if opts.thresholdExit {
+			return monitorThresholdExit(containers, stats, breaches, failures)
+		}
+
+		// Check if we should exit
+		if !opts.watch {
+			break
+		}
+
+		// Sleep until next refresh
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.interval):
+		}
+	}
+
+	return nil
+}
+
+// monitorFrame is the status of the monitored services at a refresh, as rendered and recorded
+type monitorFrame struct {
+	Project string    `json:"project"`
+	Time    time.Time `json:"time"`
+	// Unavailable is set when the refresh failed, the frame then has no services
+	Unavailable bool                  `json:"unavailable,omitempty"`
+	Services    []monitorServiceGroup `json:"services"`
+	Endpoints   []monitorEndpoint     `json:"endpoints"`
+}
 
-		// Get services status
-		containers, err := backend.Ps(ctx, project.Name, api.PsOptions{})
+// replicas returns the replicas of every service of the frame
+func (f monitorFrame) replicas() []monitorReplica {
+	replicas := []monitorReplica{}
+	for _, group := range f.Services {
+		replicas = append(replicas, group.Replicas...)
+	}
+	return replicas
+}
+
+// renderMonitorFrame renders a frame as the compact view or the full report
+func renderMonitorFrame(dockerCli command.Cli, output io.Writer, opts *monitorOptions, frame monitorFrame, inPlace bool) error {
+	if !opts.compact {
+		return printMonitorReport(output, opts, frame)
+	}
+	lines := []string{"status unavailable, retrying on next refresh"}
+	if !frame.Unavailable {
+		width := 0
+		if inPlace {
+			_, w := dockerCli.Out().GetTtySize()
+			width = int(w)
+		}
+		lines = formatCompactMonitor(frame.Services, width)
+	}
+	printCompactMonitor(output, lines, inPlace)
+	return nil
+}
+
+// recordMonitorFrame appends a frame to a recording as a line of JSON
+func recordMonitorFrame(w io.Writer, frame monitorFrame) error {
+	line, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to record frame: %v", err)
+	}
+	return nil
+}
+
+// runMonitorReplay renders the frames of a recording at their recorded pace, divided by --speed,
+// without contacting Docker
+func runMonitorReplay(ctx context.Context, dockerCli command.Cli, opts *monitorOptions) error {
+	f, err := os.Open(opts.replay)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+
+	output := io.Writer(os.Stdout)
+	if opts.outputFile != "" {
+		outputFile, err := os.Create(opts.outputFile)
 		if err != nil {
 			return err
 		}
+		defer outputFile.Close() //nolint:errcheck
+		output = outputFile
+	}
+	inPlace := opts.compact && opts.watch && opts.outputFile == "" && dockerCli.Out().IsTerminal()
 
-		// Display services status
-		fmt.Fprintln(output, "Services Status:")
-		fmt.Fprintln(output, "================")
+	return replayMonitorFrames(ctx, f, opts.speed, func(frame monitorFrame) error {
+		if err := renderMonitorFrame(dockerCli, output, opts, frame, inPlace); err != nil {
+			return err
+		}
+		for _, breach := range checkMonitorThresholds(frame.replicas(), opts.cpuAlert, opts.memAlert) {
+			fmt.Fprintf(dockerCli.Err(), "ALERT %s\n", breach)
+		}
+		return nil
+	})
+}
 
-		if opts.format == "table" {
-			// Table format
-			fmt.Fprintf(output, "%-20s %-12s %-10s\n", "Service", "Status", "Health")
-			fmt.Fprintln(output, "------------------------------")
+// replayMonitorFrames decodes the frames of a recording and passes them to render, waiting between
+// two frames the time elapsed between them when recorded, divided by speed. It stops early, without
+// error, when the context is done.
+func replayMonitorFrames(ctx context.Context, recording io.Reader, speed float64, render func(monitorFrame) error) error {
+	decoder := json.NewDecoder(recording)
+	var previous time.Time
+	for frames := 1; ; frames++ {
+		var frame monitorFrame
+		if err := decoder.Decode(&frame); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read frame %d: %v", frames, err)
+		}
+		if !previous.IsZero() && frame.Time.After(previous) {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Duration(float64(frame.Time.Sub(previous)) / speed)):
+			}
+		}
+		previous = frame.Time
+		if err := render(frame); err != nil {
+			return err
+		}
+	}
+}
 
-			for _, container := range containers {
-				health := container.Health
-				if health == "" {
-					health = "-"
-				}
+// printMonitorReport renders the full monitor view: header, services status and endpoints
+func printMonitorReport(output io.Writer, opts *monitorOptions, frame monitorFrame) error {
+	// Clear screen if watching
+	if opts.watch && opts.outputFile == "" {
+		fmt.Fprint(output, "\033[2J\033[H")
+	}
+
+	// Show header
+	fmt.Fprintf(output, "=== Docker Compose Monitor ===\n")
+	fmt.Fprintf(output, "Project: %s\n", frame.Project)
+	fmt.Fprintf(output, "Time: %s\n\n", frame.Time.Format(time.RFC3339))
+
+	// Display services status
+	fmt.Fprintln(output, "Services Status:")
+	fmt.Fprintln(output, "================")
+
+	if frame.Unavailable {
+		fmt.Fprintln(output, "Status unavailable, retrying on next refresh")
+	} else if opts.format == "table" {
+		if opts.groupByService {
+			printMonitorGroups(output, frame.Services, opts.expand)
+		} else {
+			printMonitorReplicas(output, frame.replicas())
+		}
+	} else if opts.format == "json" {
+		view := map[string]any{
+			"project": frame.Project,
+			"time":    frame.Time.Format(time.RFC3339),
+		}
+		if opts.groupByService {
+			view["services"] = frame.Services
+		} else {
+			view["services"] = frame.replicas()
+		}
+		view["endpoints"] = frame.Endpoints
+		marshal, err := json.MarshalIndent(view, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(output, string(marshal))
+	}
+
+	// Show endpoints
+	fmt.Fprintln(output, "\nEndpoints:")
+	fmt.Fprintln(output, "==========")
+	printMonitorEndpoints(output, frame.Endpoints)
+
+	return nil
+}
+
+// monitorEndpointDialTimeout bounds the check a published port is reachable
+const monitorEndpointDialTimeout = 500 * time.Millisecond
+
+// monitorEndpoint is a port published by a service on the host
+type monitorEndpoint struct {
+	Service   string   `json:"service"`
+	HostIP    string   `json:"host_ip"`
+	Published string   `json:"published"`
+	Protocol  string   `json:"protocol"`
+	Checked   bool     `json:"checked"`
+	Reachable bool     `json:"reachable"`
+	Error     string   `json:"error,omitempty"`
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// URL returns the address of the endpoint as displayed
+func (e monitorEndpoint) URL() string {
+	if e.Protocol != "tcp" {
+		return fmt.Sprintf("%s://%s", e.Protocol, net.JoinHostPort(e.HostIP, e.Published))
+	}
+	return fmt.Sprintf("http://%s", net.JoinHostPort(e.HostIP, e.Published))
+}
+
+// monitorEndpoints lists the ports published by the given services, sorted by service, and flags
+// the host ports also claimed by another service of the project
+func monitorEndpoints(project *types.Project, services []string) []monitorEndpoint {
+	var endpoints []monitorEndpoint
+	for _, name := range project.ServiceNames() {
+		for _, port := range project.Services[name].Ports {
+			if port.Published == "" {
+				continue
+			}
+			endpoint := monitorEndpoint{
+				Service:   name,
+				HostIP:    port.HostIP,
+				Published: port.Published,
+				Protocol:  port.Protocol,
+			}
+			if endpoint.HostIP == "" {
+				endpoint.HostIP = "0.0.0.0"
+			}
+			if endpoint.Protocol == "" {
+				endpoint.Protocol = "tcp"
+			}
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	for i := range endpoints {
+		for j := range endpoints {
+			if endpoints[i].Service != endpoints[j].Service && endpointsOverlap(endpoints[i], endpoints[j]) &&
+				!slices.Contains(endpoints[i].Conflicts, endpoints[j].Service) {
+				endpoints[i].Conflicts = append(endpoints[i].Conflicts, endpoints[j].Service)
+			}
+		}
+	}
+	return slices.DeleteFunc(endpoints, func(e monitorEndpoint) bool {
+		return !slices.Contains(services, e.Service)
+	})
+}
+
+// endpointsOverlap tells if two endpoints claim the same host port, a wildcard address binding all
+// the host addresses
+func endpointsOverlap(a, b monitorEndpoint) bool {
+	if a.Protocol != b.Protocol || a.Published != b.Published {
+		return false
+	}
+	return a.HostIP == b.HostIP || isWildcardHostIP(a.HostIP) || isWildcardHostIP(b.HostIP)
+}
+
+func isWildcardHostIP(ip string) bool {
+	return ip == "0.0.0.0" || ip == "::"
+}
+
+// checkMonitorEndpoints dials the TCP endpoints to check something answers on the host. UDP
+// endpoints and port ranges can't be checked this way and are left unchecked.
+func checkMonitorEndpoints(ctx context.Context, endpoints []monitorEndpoint) []monitorEndpoint {
+	var wg sync.WaitGroup
+	for i := range endpoints {
+		endpoint := &endpoints[i]
+		if endpoint.Protocol != "tcp" || strings.Contains(endpoint.Published, "-") {
+			continue
+		}
+		host := endpoint.HostIP
+		if isWildcardHostIP(host) {
+			host = "localhost"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := probeTCP(ctx, net.JoinHostPort(host, endpoint.Published), monitorEndpointDialTimeout)
+			endpoint.Checked = true
+			endpoint.Reachable = result.Err == nil
+			if result.Err != nil {
+				endpoint.Error = result.Err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	return endpoints
+}
+
+// printMonitorEndpoints renders the endpoints grouped by service, with a ✗ beside the ones nothing
+// answers on and a warning for host ports claimed by several services
+func printMonitorEndpoints(output io.Writer, endpoints []monitorEndpoint) {
+	service := ""
+	for _, endpoint := range endpoints {
+		if endpoint.Service != service {
+			service = endpoint.Service
+			fmt.Fprintf(output, "%s:\n", service)
+		}
+		mark := " "
+		if endpoint.Checked {
+			mark = "✓"
+			if !endpoint.Reachable {
+				mark = "✗"
+			}
+		}
+		line := fmt.Sprintf("  %s %s", mark, endpoint.URL())
+		if endpoint.Checked && !endpoint.Reachable {
+			line += " (unreachable)"
+		}
+		if len(endpoint.Conflicts) > 0 {
+			line += fmt.Sprintf(" (port conflict with %s)", strings.Join(endpoint.Conflicts, ", "))
+		}
+		fmt.Fprintln(output, line)
+	}
+}
+
+// formatCompactMonitor renders one line per service with columns sized to their widest value,
+// lines are truncated to width when set
+func formatCompactMonitor(groups []monitorServiceGroup, width int) []string {
+	rows := make([][]string, 0, len(groups))
+	for _, group := range groups {
+		cpu, memory := formatMonitorStats(group.HasStats, group.CPUPercent, group.MemoryUsage)
+		if cpu != "-" {
+			cpu += "%"
+		}
+		rows = append(rows, []string{group.Service, compactServiceState(group), compactServiceHealth(group), cpu, memory})
+	}
+
+	widths := make([]int, 5)
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			if i > 0 {
+				line.WriteString("  ")
+			}
+			// numeric columns are right aligned
+			if i >= 3 {
+				fmt.Fprintf(&line, "%*s", widths[i], cell)
+			} else {
+				fmt.Fprintf(&line, "%-*s", widths[i], cell)
+			}
+		}
+		text := strings.TrimRight(line.String(), " ")
+		if width > 0 && len(text) > width {
+			text = text[:width]
+		}
+		lines = append(lines, text)
+	}
+	return lines
+}
+
+// compactServiceState summarizes the replicas state: running, stopped, or the running count when partial
+func compactServiceState(group monitorServiceGroup) string {
+	switch group.Running {
+	case group.Total:
+		return "running"
+	case 0:
+		return "stopped"
+	default:
+		return fmt.Sprintf("%d/%d running", group.Running, group.Total)
+	}
+}
+
+// compactServiceHealth summarizes the replicas health, "-" for services without healthcheck
+func compactServiceHealth(group monitorServiceGroup) string {
+	if !group.HealthCheck {
+		return "-"
+	}
+	if group.Healthy == group.Total {
+		return "healthy"
+	}
+	for _, replica := range group.Replicas {
+		if replica.Health == "unhealthy" {
+			return "unhealthy"
+		}
+	}
+	return "starting"
+}
+
+// printCompactMonitor prints the compact lines. In place, the cursor is moved back to the top and
+// every line cleared as it is rewritten, so the pane doesn't flicker between refreshes.
+func printCompactMonitor(output io.Writer, lines []string, inPlace bool) {
+	if !inPlace {
+		for _, line := range lines {
+			fmt.Fprintln(output, line)
+		}
+		return
+	}
+	var frame strings.Builder
+	frame.WriteString("\033[H")
+	for _, line := range lines {
+		frame.WriteString(line)
+		frame.WriteString("\033[K\n")
+	}
+	frame.WriteString("\033[J")
+	fmt.Fprint(output, frame.String())
+}
+
+// formatPushgatewayMetrics renders the service groups as gauges in the Prometheus text format
+func formatPushgatewayMetrics(groups []monitorServiceGroup) []byte {
+	gauges := []struct {
+		name  string
+		help  string
+		value func(g monitorServiceGroup) float64
+	}{
+		{"compose_service_replicas", "Number of containers of the service", func(g monitorServiceGroup) float64 { return float64(g.Total) }},
+		{"compose_service_running_replicas", "Number of running containers of the service", func(g monitorServiceGroup) float64 { return float64(g.Running) }},
+		{"compose_service_healthy_replicas", "Number of healthy containers of the service", func(g monitorServiceGroup) float64 { return float64(g.Healthy) }},
+		{"compose_service_cpu_percent", "CPU usage of the service containers, in percent", func(g monitorServiceGroup) float64 { return g.CPUPercent }},
+		{"compose_service_memory_bytes", "Memory usage of the service containers, in bytes", func(g monitorServiceGroup) float64 { return float64(g.MemoryUsage) }},
+	}
+	var buf bytes.Buffer
+	for _, gauge := range gauges {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n", gauge.name, gauge.help, gauge.name)
+		for _, g := range groups {
+			if !g.HasStats && (gauge.name == "compose_service_cpu_percent" || gauge.name == "compose_service_memory_bytes") {
+				continue
+			}
+			fmt.Fprintf(&buf, "%s{service=%q} %s\n", gauge.name, g.Service, strconv.FormatFloat(gauge.value(g), 'g', -1, 64))
+		}
+	}
+	return buf.Bytes()
+}
 
-				fmt.Fprintf(output, "%-20s %-12s %-10s\n",
-					container.Service,
-					container.State,
-					health,
-				)
-			}
-		} else if opts.format == "json" {
-			// JSON format
-			fmt.Fprintln(output, "{")
-			fmt.Fprintf(output, "  \"project\": \"%s\",\n", project.Name)
-			fmt.Fprintf(output, "  \"time\": \"%s\",\n", time.Now().Format(time.RFC3339))
-			fmt.Fprintln(output, "  \"services\": [")
-
-			for i, container := range containers {
-				if i > 0 {
-					fmt.Fprintln(output, ",")
+func pushgatewayURL(gateway, job, projectName string) string {
+	return fmt.Sprintf("%s/metrics/job/%s/project/%s", strings.TrimSuffix(gateway, "/"), url.PathEscape(job), url.PathEscape(projectName))
+}
+
+// pushPushgatewayMetrics replaces the metrics of the project group with the given ones
+func pushPushgatewayMetrics(ctx context.Context, gateway, job, projectName string, metrics []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, pushgatewayURL(gateway, job, projectName), bytes.NewReader(metrics))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	return doPushgatewayRequest(req)
+}
+
+// deletePushgatewayMetrics removes the metrics of the project group so they don't linger once monitoring stops
+func deletePushgatewayMetrics(ctx context.Context, gateway, job, projectName string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, pushgatewayURL(gateway, job, projectName), nil)
+	if err != nil {
+		return err
+	}
+	return doPushgatewayRequest(req)
+}
+
+func doPushgatewayRequest(req *http.Request) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway responded with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// monitoredEventActions lists the container actions reported by monitor --events
+var monitoredEventActions = []string{"start", "stop", "die", "health_status"}
+
+func isMonitoredEvent(action string) bool {
+	for _, a := range monitoredEventActions {
+		// health_status actions carry the new status, e.g. "health_status: healthy"
+		if action == a || strings.HasPrefix(action, a+":") {
+			return true
+		}
+	}
+	return false
+}
+
+func runMonitorEvents(ctx context.Context, backend api.Compose, projectName string, services []string, output io.Writer, format string) error {
+	if format == "table" {
+		fmt.Fprintf(output, "Streaming events for project %s (press Ctrl+C to stop)\n", projectName)
+	}
+	return backend.Events(ctx, projectName, api.EventsOptions{
+		Services: services,
+		Consumer: func(event api.Event) error {
+			if !isMonitoredEvent(event.Status) {
+				return nil
+			}
+			if format == "json" {
+				marshal, err := json.Marshal(map[string]any{
+					"time":    event.Timestamp,
+					"project": projectName,
+					"service": event.Service,
+					"id":      event.Container,
+					"action":  event.Status,
+				})
+				if err != nil {
+					return err
 				}
+				_, err = fmt.Fprintln(output, string(marshal))
+				return err
+			}
+			_, err := fmt.Fprintf(output, "%s %-20s %-12s %s\n",
+				event.Timestamp.Format(time.RFC3339), event.Service, event.Container[:min(12, len(event.Container))], event.Status)
+			return err
+		},
+	})
+}
 
-				fmt.Fprintf(output, "    {\n")
-				fmt.Fprintf(output, "      \"service\": \"%s\",\n", container.Service)
-				fmt.Fprintf(output, "      \"status\": \"%s\",\n", container.State)
-				fmt.Fprintf(output, "      \"health\": \"%s\",\n", container.Health)
-				fmt.Fprintf(output, "      \"image\": \"%s\"\n", container.Image)
-				fmt.Fprintf(output, "    }")
-			}
-
-			fmt.Fprintln(output, "\n  ]")
-			fmt.Fprintln(output, "}")
-		}
-
-		// Show endpoints
-		fmt.Fprintln(output, "\nEndpoints:")
-		fmt.Fprintln(output, "==========")
-		for _, service := range project.Services {
-			if len(service.Ports) > 0 {
-				fmt.Fprintf(output, "%s:\n", service.Name)
-				for _, port := range service.Ports {
-					hostIP := port.HostIP
-					if hostIP == "" {
-						hostIP = "0.0.0.0"
-					}
-					fmt.Fprintf(output, "  http://%s:%s\n", hostIP, port.Published)
+// monitorReplica is the status of a single service container
+type monitorReplica struct {
+	Service     string  `json:"service"`
+	Name        string  `json:"name"`
+	Status      string  `json:"status"`
+	Health      string  `json:"health"`
+	Image       string  `json:"image"`
+	CPUPercent  float64 `json:"cpuPercent"`
+	MemoryUsage uint64  `json:"memoryUsage"`
+	MemoryLimit uint64  `json:"memoryLimit"`
+	// HasStats is false when no stats sample could be read for the container
+	HasStats bool `json:"hasStats"`
+}
+
+// monitorServiceGroup aggregates the replicas of a service
+type monitorServiceGroup struct {
+	Service     string           `json:"service"`
+	Running     int              `json:"running"`
+	Healthy     int              `json:"healthy"`
+	Total       int              `json:"total"`
+	HealthCheck bool             `json:"healthcheck"`
+	CPUPercent  float64          `json:"cpuPercent"`
+	MemoryUsage uint64           `json:"memoryUsage"`
+	HasStats    bool             `json:"hasStats"`
+	Replicas    []monitorReplica `json:"replicas"`
+}
+
+// Summary renders the replica availability, e.g. "3/5 healthy"
+func (g monitorServiceGroup) Summary() string {
+	if g.HealthCheck {
+		return fmt.Sprintf("%d/%d healthy", g.Healthy, g.Total)
+	}
+	return fmt.Sprintf("%d/%d running", g.Running, g.Total)
+}
+
+// monitorProjectSnapshot is the latest refresh of a project monitored with --projects
+type monitorProjectSnapshot struct {
+	Project string `json:"project"`
+	// UpdatedAt is zero until the first refresh of the project completed
+	UpdatedAt time.Time             `json:"updatedAt"`
+	Error     string                `json:"error,omitempty"`
+	Services  []monitorServiceGroup `json:"services"`
+}
+
+// monitorProjects holds the latest snapshot of every monitored project
+type monitorProjects struct {
+	mu        sync.Mutex
+	snapshots map[string]monitorProjectSnapshot
+}
+
+func (m *monitorProjects) set(snapshot monitorProjectSnapshot) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshots[snapshot.Project] = snapshot
+}
+
+// list returns the snapshots of the projects, in their order
+func (m *monitorProjects) list(names []string) []monitorProjectSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshots := make([]monitorProjectSnapshot, 0, len(names))
+	for _, name := range names {
+		snapshot, ok := m.snapshots[name]
+		if !ok {
+			snapshot = monitorProjectSnapshot{Project: name}
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots
+}
+
+func runMonitorProjects(ctx context.Context, dockerCli command.Cli, backend api.Compose, opts *monitorOptions) error {
+	switch {
+	case len(opts.projects) > 0 && opts.allProjects:
+		return fmt.Errorf("--projects and --all-projects are mutually exclusive")
+	case len(opts.services) > 0 || opts.all:
+		return fmt.Errorf("services can't be selected when monitoring several projects")
+	case opts.events || opts.compact || opts.thresholdExit || opts.pushgateway != "":
+		return fmt.Errorf("--events, --compact, --threshold-exit and --pushgateway monitor a single project")
+	}
+	names, err := monitorProjectNames(ctx, backend, opts.projects)
+	if err != nil {
+		return err
+	}
+
+	output := io.Writer(os.Stdout)
+	if opts.outputFile != "" {
+		outputFile, err := os.Create(opts.outputFile)
+		if err != nil {
+			return err
+		}
+		defer outputFile.Close() //nolint:errcheck
+		output = outputFile
+	}
+
+	store := &monitorProjects{snapshots: map[string]monitorProjectSnapshot{}}
+	var firstRefresh sync.WaitGroup
+	for _, name := range names {
+		firstRefresh.Add(1)
+		go func() {
+			first := true
+			for {
+				store.set(refreshMonitorProject(ctx, dockerCli, backend, name))
+				if first {
+					firstRefresh.Done()
+					first = false
+				}
+				if !opts.watch {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(opts.interval):
 				}
 			}
+		}()
+	}
+
+	if !opts.watch {
+		firstRefresh.Wait()
+		return printMonitorProjects(output, store.list(names), opts, time.Now())
+	}
+
+	// render once every project refreshed, or after an interval if one is slow
+	refreshed := make(chan struct{})
+	go func() {
+		firstRefresh.Wait()
+		close(refreshed)
+	}()
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-refreshed:
+	case <-time.After(opts.interval):
+	}
+	for {
+		if err := printMonitorProjects(output, store.list(names), opts, time.Now()); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.interval):
 		}
+	}
+}
 
-		// Check if we should exit
-		if !opts.watch {
-			break
+// monitorProjectNames resolves the projects to monitor against the compose projects discovered
+// from the container labels, all of them when none are given
+func monitorProjectNames(ctx context.Context, backend api.Compose, projects []string) ([]string, error) {
+	stacks, err := backend.List(ctx, api.ListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	known := make([]string, 0, len(stacks))
+	for _, stack := range stacks {
+		known = append(known, stack.Name)
+	}
+	sort.Strings(known)
+	if len(projects) == 0 {
+		if len(known) == 0 {
+			return nil, fmt.Errorf("no compose project found")
 		}
+		return known, nil
+	}
+	var names []string
+	for _, name := range projects {
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("project %q not found, known projects: %s", name, strings.Join(known, ", "))
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
 
-		// Sleep until next refresh
-		time.Sleep(opts.interval)
+// refreshMonitorProject takes a snapshot of the containers of a project and their resource usage
+func refreshMonitorProject(ctx context.Context, dockerCli command.Cli, backend api.Compose, name string) monitorProjectSnapshot {
+	snapshot := monitorProjectSnapshot{Project: name, Services: []monitorServiceGroup{}}
+	containers, err := backend.Ps(ctx, name, api.PsOptions{All: true})
+	if err == nil {
+		var stats map[string]container.StatsResponse
+		stats, err = collectMonitorStats(ctx, dockerCli, containers)
+		snapshot.Services = groupMonitorReplicas(containers, stats)
+	}
+	if err != nil {
+		snapshot.Error = err.Error()
+	}
+	snapshot.UpdatedAt = time.Now()
+	return snapshot
+}
+
+// printMonitorProjects renders the snapshots grouped by project. Projects whose last refresh is
+// older than two intervals are marked stale.
+func printMonitorProjects(output io.Writer, snapshots []monitorProjectSnapshot, opts *monitorOptions, now time.Time) error {
+	if opts.format == "json" {
+		marshal, err := json.MarshalIndent(map[string]any{
+			"time":     now.Format(time.RFC3339),
+			"projects": snapshots,
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(output, string(marshal))
+		return err
 	}
 
+	if opts.watch && opts.outputFile == "" {
+		fmt.Fprint(output, "\033[2J\033[H")
+	}
+	fmt.Fprintf(output, "=== Docker Compose Monitor ===\n")
+	fmt.Fprintf(output, "Projects: %d\n", len(snapshots))
+	fmt.Fprintf(output, "Time: %s\n", now.Format(time.RFC3339))
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(output, "\nProject: %s", snapshot.Project)
+		if snapshot.UpdatedAt.IsZero() {
+			fmt.Fprintln(output, " (waiting for the first refresh)")
+			continue
+		}
+		if age := now.Sub(snapshot.UpdatedAt); opts.watch && age > 2*opts.interval {
+			fmt.Fprintf(output, " (stale, refreshed %s ago)", age.Round(time.Second))
+		}
+		fmt.Fprintln(output)
+		if snapshot.Error != "" {
+			fmt.Fprintf(output, "Warning: %s\n", snapshot.Error)
+		}
+		if opts.groupByService {
+			printMonitorGroups(output, snapshot.Services, opts.expand)
+			continue
+		}
+		var replicas []monitorReplica
+		for _, group := range snapshot.Services {
+			replicas = append(replicas, group.Replicas...)
+		}
+		printMonitorReplicas(output, replicas)
+	}
+	return nil
+}
+
+// monitorBreach is a container using more of a resource than its alert threshold
+type monitorBreach struct {
+	Service   string
+	Container string
+	// Resource is "cpu" or "memory"
+	Resource  string
+	Percent   float64
+	Threshold float64
+}
+
+func (b monitorBreach) String() string {
+	return fmt.Sprintf("%s (%s): %s %.1f%% above %.1f%%", b.Service, b.Container, b.Resource, b.Percent, b.Threshold)
+}
+
+// checkMonitorThresholds lists the containers breaching the CPU or memory thresholds, zero
+// disabling a threshold. Memory is relative to the container limit, when known.
+func checkMonitorThresholds(replicas []monitorReplica, cpuAlert, memAlert float64) []monitorBreach {
+	var breaches []monitorBreach
+	for _, replica := range replicas {
+		if !replica.HasStats {
+			continue
+		}
+		if cpuAlert > 0 && replica.CPUPercent > cpuAlert {
+			breaches = append(breaches, monitorBreach{Service: replica.Service, Container: replica.Name, Resource: "cpu", Percent: replica.CPUPercent, Threshold: cpuAlert})
+		}
+		if memAlert > 0 && replica.MemoryLimit > 0 {
+			percent := float64(replica.MemoryUsage) / float64(replica.MemoryLimit) * 100
+			if percent > memAlert {
+				breaches = append(breaches, monitorBreach{Service: replica.Service, Container: replica.Name, Resource: "memory", Percent: percent, Threshold: memAlert})
+			}
+		}
+	}
+	return breaches
+}
+
+// monitorThresholdExit turns the single sample of --threshold-exit into the command status
+func monitorThresholdExit(containers []api.ContainerSummary, stats map[string]container.StatsResponse, breaches []monitorBreach, failures int) error {
+	if failures > 0 {
+		return cli.StatusError{StatusCode: monitorExitNoSample, Status: "failed to sample the stats of every running container"}
+	}
+	for _, c := range containers {
+		if _, ok := stats[c.ID]; c.State == "running" && !ok {
+			return cli.StatusError{StatusCode: monitorExitNoSample, Status: fmt.Sprintf("no stats sample for container %s", c.Name)}
+		}
+	}
+	if len(breaches) > 0 {
+		services := map[string]bool{}
+		for _, breach := range breaches {
+			services[breach.Service] = true
+		}
+		return cli.StatusError{StatusCode: monitorExitBreach, Status: fmt.Sprintf("%d service(s) breached the resource thresholds", len(services))}
+	}
 	return nil
 }
+
+// collectMonitorStats reads a stats sample of every running container. Containers which disappeared
+// in the meantime are skipped, other failures are reported along with the samples that could be read.
+func collectMonitorStats(ctx context.Context, dockerCli command.Cli, containers []api.ContainerSummary) (map[string]container.StatsResponse, error) {
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		errs  []error
+		stats = map[string]container.StatsResponse{}
+	)
+	for _, c := range containers {
+		if c.State != "running" {
+			continue
+		}
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			sample, err := readContainerStatsSample(ctx, dockerCli, id)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if !errdefs.IsNotFound(err) {
+					errs = append(errs, fmt.Errorf("failed to read stats of container %s: %w", id[:min(12, len(id))], err))
+				}
+				return
+			}
+			stats[id] = sample
+		}(c.ID)
+	}
+	wg.Wait()
+	return stats, errors.Join(errs...)
+}
+
+// readContainerStatsSample reads stats including the previous CPU reading, so CPU usage can be computed from a single call
+func readContainerStatsSample(ctx context.Context, dockerCli command.Cli, containerID string) (container.StatsResponse, error) {
+	var stats container.StatsResponse
+	response, err := dockerCli.Client().ContainerStats(ctx, containerID, false)
+	if err != nil {
+		return stats, err
+	}
+	defer response.Body.Close() //nolint:errcheck
+	err = json.NewDecoder(response.Body).Decode(&stats)
+	return stats, err
+}
+
+func monitorReplicas(containers []api.ContainerSummary, stats map[string]container.StatsResponse) []monitorReplica {
+	replicas := make([]monitorReplica, 0, len(containers))
+	for _, c := range containers {
+		replica := monitorReplica{
+			Service: c.Service,
+			Name:    c.Name,
+			Status:  c.State,
+			Health:  c.Health,
+			Image:   c.Image,
+		}
+		if sample, ok := stats[c.ID]; ok {
+			replica.CPUPercent = sampleCPUPercent(sample)
+			replica.MemoryUsage = sample.MemoryStats.Usage
+			replica.MemoryLimit = sample.MemoryStats.Limit
+			replica.HasStats = true
+		}
+		replicas = append(replicas, replica)
+	}
+	return replicas
+}
+
+func groupMonitorReplicas(containers []api.ContainerSummary, stats map[string]container.StatsResponse) []monitorServiceGroup {
+	groups := map[string]*monitorServiceGroup{}
+	for _, replica := range monitorReplicas(containers, stats) {
+		group, ok := groups[replica.Service]
+		if !ok {
+			group = &monitorServiceGroup{Service: replica.Service}
+			groups[replica.Service] = group
+		}
+		group.Total++
+		if replica.Status == "running" {
+			group.Running++
+		}
+		if replica.Health != "" {
+			group.HealthCheck = true
+		}
+		if replica.Health == "healthy" {
+			group.Healthy++
+		}
+		group.CPUPercent += replica.CPUPercent
+		group.MemoryUsage += replica.MemoryUsage
+		group.HasStats = group.HasStats || replica.HasStats
+		group.Replicas = append(group.Replicas, replica)
+	}
+
+	result := make([]monitorServiceGroup, 0, len(groups))
+	for _, group := range groups {
+		sort.Slice(group.Replicas, func(i, j int) bool {
+			return group.Replicas[i].Name < group.Replicas[j].Name
+		})
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Service < result[j].Service
+	})
+	return result
+}
+
+func printMonitorGroups(output io.Writer, groups []monitorServiceGroup, expand bool) {
+	fmt.Fprintf(output, "%-20s %-14s %-8s %-10s\n", "Service", "Replicas", "CPU %", "Memory")
+	fmt.Fprintln(output, "------------------------------------------------------")
+	for _, group := range groups {
+		cpu, memory := formatMonitorStats(group.HasStats, group.CPUPercent, group.MemoryUsage)
+		fmt.Fprintf(output, "%-20s %-14s %-8s %-10s\n", group.Service, group.Summary(), cpu, memory)
+		if !expand {
+			continue
+		}
+		for _, replica := range group.Replicas {
+			health := replica.Health
+			if health == "" {
+				health = "-"
+			}
+			cpu, memory := formatMonitorStats(replica.HasStats, replica.CPUPercent, replica.MemoryUsage)
+			fmt.Fprintf(output, "  %-18s %-14s %-8s %-10s %s\n", replica.Name, replica.Status, cpu, memory, health)
+		}
+	}
+}
+
+func printMonitorReplicas(output io.Writer, replicas []monitorReplica) {
+	fmt.Fprintf(output, "%-20s %-12s %-10s %-8s %-10s\n", "Service", "Status", "Health", "CPU %", "Memory")
+	fmt.Fprintln(output, "------------------------------------------------------------")
+	for _, replica := range replicas {
+		health := replica.Health
+		if health == "" {
+			health = "-"
+		}
+		cpu, memory := formatMonitorStats(replica.HasStats, replica.CPUPercent, replica.MemoryUsage)
+		fmt.Fprintf(output, "%-20s %-12s %-10s %-8s %-10s\n", replica.Service, replica.Status, health, cpu, memory)
+	}
+}
+
+// formatMonitorStats renders CPU and memory columns, as "-" when stats are unavailable
+func formatMonitorStats(hasStats bool, cpuPercent float64, memoryUsage uint64) (string, string) {
+	if !hasStats {
+		return "-", "-"
+	}
+	return fmt.Sprintf("%.1f", cpuPercent), units.BytesSize(float64(memoryUsage))
+}
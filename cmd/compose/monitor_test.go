@@ -0,0 +1,352 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/cli/cli"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestGroupMonitorReplicas(t *testing.T) {
+	containers := []api.ContainerSummary{
+		{ID: "1", Name: "demo-web-1", Service: "web", State: "running", Health: "healthy"},
+		{ID: "2", Name: "demo-web-2", Service: "web", State: "running", Health: "starting"},
+		{ID: "3", Name: "demo-web-3", Service: "web", State: "exited", Health: "unhealthy"},
+		{ID: "4", Name: "demo-db-1", Service: "db", State: "running"},
+	}
+	stats := map[string]container.StatsResponse{
+		"1": {MemoryStats: container.MemoryStats{Usage: 100}},
+		"2": {MemoryStats: container.MemoryStats{Usage: 50}},
+	}
+
+	groups := groupMonitorReplicas(containers, stats)
+	require.Len(t, groups, 2)
+
+	assert.Equal(t, "db", groups[0].Service)
+	assert.Equal(t, "1/1 running", groups[0].Summary())
+	assert.False(t, groups[0].HasStats)
+
+	assert.Equal(t, "web", groups[1].Service)
+	assert.Equal(t, "1/3 healthy", groups[1].Summary())
+	assert.Equal(t, uint64(150), groups[1].MemoryUsage)
+	assert.Len(t, groups[1].Replicas, 3)
+	assert.True(t, groups[1].HasStats)
+	assert.False(t, groups[1].Replicas[2].HasStats)
+}
+
+func TestFormatMonitorStats(t *testing.T) {
+	cpu, memory := formatMonitorStats(false, 0, 0)
+	assert.Equal(t, "-", cpu)
+	assert.Equal(t, "-", memory)
+
+	cpu, memory = formatMonitorStats(true, 12.34, 2048)
+	assert.Equal(t, "12.3", cpu)
+	assert.Equal(t, "2KiB", memory)
+}
+
+func TestPushgatewayMetrics(t *testing.T) {
+	metrics := formatPushgatewayMetrics([]monitorServiceGroup{
+		{Service: "web", Total: 2, Running: 2, Healthy: 1, CPUPercent: 12.5, MemoryUsage: 1024, HasStats: true},
+		{Service: "db", Total: 1},
+	})
+	assert.Contains(t, string(metrics), "# TYPE compose_service_replicas gauge\n"+
+		"compose_service_replicas{service=\"web\"} 2\n"+
+		"compose_service_replicas{service=\"db\"} 1\n")
+	assert.Contains(t, string(metrics), "compose_service_cpu_percent{service=\"web\"} 12.5\n")
+	assert.NotContains(t, string(metrics), "compose_service_memory_bytes{service=\"db\"}")
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+string(body))
+	}))
+	defer server.Close()
+
+	require.NoError(t, pushPushgatewayMetrics(context.Background(), server.URL+"/", "compose_monitor", "shop", []byte("m 1\n")))
+	require.NoError(t, deletePushgatewayMetrics(context.Background(), server.URL, "compose_monitor", "shop"))
+	assert.Equal(t, []string{
+		"PUT /metrics/job/compose_monitor/project/shop m 1\n",
+		"DELETE /metrics/job/compose_monitor/project/shop ",
+	}, requests)
+}
+
+func TestFormatCompactMonitor(t *testing.T) {
+	groups := []monitorServiceGroup{
+		{Service: "api", Total: 2, Running: 2, Healthy: 1, HealthCheck: true, CPUPercent: 3.25, MemoryUsage: 2048, HasStats: true,
+			Replicas: []monitorReplica{{Health: "healthy"}, {Health: "unhealthy"}}},
+		{Service: "database", Total: 1},
+		{Service: "web", Total: 3, Running: 1, HasStats: true, CPUPercent: 12, MemoryUsage: 1024},
+	}
+	assert.Equal(t, []string{
+		"api       running      unhealthy   3.2%  2KiB",
+		"database  stopped      -              -     -",
+		"web       1/3 running  -          12.0%  1KiB",
+	}, formatCompactMonitor(groups, 0))
+	assert.Equal(t, []string{"api       running", "database  stopped", "web       1/3 run"}, formatCompactMonitor(groups, 17))
+
+	var out bytes.Buffer
+	printCompactMonitor(&out, []string{"a", "b"}, true)
+	assert.Equal(t, "\033[Ha\033[K\nb\033[K\n\033[J", out.String())
+	out.Reset()
+	printCompactMonitor(&out, []string{"a", "b"}, false)
+	assert.Equal(t, "a\nb\n", out.String())
+}
+
+func TestMonitorEndpoints(t *testing.T) {
+	project := &types.Project{Services: types.Services{
+		"web":   {Name: "web", Ports: []types.ServicePortConfig{{Target: 80, Published: "8080"}, {Target: 81}}},
+		"db":    {Name: "db", Ports: []types.ServicePortConfig{{Target: 5432, Published: "5432", HostIP: "127.0.0.1"}}},
+		"db2":   {Name: "db2", Ports: []types.ServicePortConfig{{Target: 5432, Published: "5432"}}},
+		"dns":   {Name: "dns", Ports: []types.ServicePortConfig{{Target: 53, Published: "8080", Protocol: "udp"}}},
+		"other": {Name: "other", Ports: []types.ServicePortConfig{{Target: 5432, Published: "5432", HostIP: "10.0.0.1"}}},
+	}}
+	endpoints := monitorEndpoints(project, project.ServiceNames())
+	require.Len(t, endpoints, 5)
+	conflicts := map[string][]string{}
+	for _, e := range endpoints {
+		conflicts[e.Service] = e.Conflicts
+	}
+	assert.Equal(t, []string{"db2"}, conflicts["db"])
+	assert.Equal(t, []string{"db", "other"}, conflicts["db2"])
+	assert.Equal(t, []string{"db2"}, conflicts["other"])
+	assert.Empty(t, conflicts["web"])
+	assert.Empty(t, conflicts["dns"])
+
+	// conflicts with services which are not monitored are still reported
+	endpoints = monitorEndpoints(project, []string{"db"})
+	require.Len(t, endpoints, 1)
+	assert.Equal(t, []string{"db2"}, endpoints[0].Conflicts)
+}
+
+func TestCheckMonitorEndpoints(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close() //nolint:errcheck
+	_, open, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, dead, err := net.SplitHostPort(closed.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, closed.Close())
+
+	endpoints := checkMonitorEndpoints(context.Background(), []monitorEndpoint{
+		{Service: "web", HostIP: "127.0.0.1", Published: open, Protocol: "tcp"},
+		{Service: "web", HostIP: "127.0.0.1", Published: dead, Protocol: "tcp", Conflicts: []string{"api"}},
+		{Service: "dns", HostIP: "0.0.0.0", Published: "53", Protocol: "udp"},
+	})
+	assert.True(t, endpoints[0].Checked)
+	assert.True(t, endpoints[0].Reachable)
+	assert.True(t, endpoints[1].Checked)
+	assert.False(t, endpoints[1].Reachable)
+	assert.False(t, endpoints[2].Checked)
+
+	var buf bytes.Buffer
+	printMonitorEndpoints(&buf, endpoints)
+	assert.Equal(t, "web:\n"+
+		"  ✓ http://127.0.0.1:"+open+"\n"+
+		"  ✗ http://127.0.0.1:"+dead+" (unreachable) (port conflict with api)\n"+
+		"dns:\n"+
+		"    udp://0.0.0.0:53\n", buf.String())
+}
+
+func TestMonitorThresholds(t *testing.T) {
+	containers := []api.ContainerSummary{
+		{ID: "1", Name: "demo-web-1", Service: "web", State: "running"},
+		{ID: "2", Name: "demo-db-1", Service: "db", State: "running"},
+		{ID: "3", Name: "demo-worker-1", Service: "worker", State: "exited"},
+	}
+	stats := map[string]container.StatsResponse{
+		"1": {MemoryStats: container.MemoryStats{Usage: 90, Limit: 100}},
+		"2": {MemoryStats: container.MemoryStats{Usage: 10, Limit: 100}},
+	}
+	replicas := monitorReplicas(containers, stats)
+
+	breaches := checkMonitorThresholds(replicas, 0, 80)
+	require.Len(t, breaches, 1)
+	assert.Equal(t, "web (demo-web-1): memory 90.0% above 80.0%", breaches[0].String())
+	assert.Empty(t, checkMonitorThresholds(replicas, 50, 95))
+
+	var status cli.StatusError
+	err := monitorThresholdExit(containers, stats, breaches, 0)
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, monitorExitBreach, status.StatusCode)
+	assert.Equal(t, "1 service(s) breached the resource thresholds", status.Status)
+
+	require.NoError(t, monitorThresholdExit(containers, stats, nil, 0))
+
+	// a running container without sample can't be judged
+	delete(stats, "2")
+	err = monitorThresholdExit(containers, stats, nil, 0)
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, monitorExitNoSample, status.StatusCode)
+	err = monitorThresholdExit(nil, nil, nil, 1)
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, monitorExitNoSample, status.StatusCode)
+}
+
+func TestMonitorProjects(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	backend.EXPECT().List(gomock.Any(), api.ListOptions{All: true}).Return([]api.Stack{{Name: "shop"}, {Name: "blog"}}, nil).Times(3)
+
+	names, err := monitorProjectNames(context.Background(), backend, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"blog", "shop"}, names)
+	names, err = monitorProjectNames(context.Background(), backend, []string{"shop", "shop"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shop"}, names)
+	_, err = monitorProjectNames(context.Background(), backend, []string{"wiki"})
+	assert.EqualError(t, err, `project "wiki" not found, known projects: blog, shop`)
+
+	backend.EXPECT().Ps(gomock.Any(), "shop", gomock.Any()).Return([]api.ContainerSummary{
+		{ID: "1", Name: "shop-web-1", Service: "web", State: "exited"},
+	}, nil)
+	snapshot := refreshMonitorProject(context.Background(), nil, backend, "shop")
+	assert.Empty(t, snapshot.Error)
+	require.Len(t, snapshot.Services, 1)
+	assert.Equal(t, "0/1 running", snapshot.Services[0].Summary())
+
+	store := &monitorProjects{snapshots: map[string]monitorProjectSnapshot{}}
+	now := time.Now()
+	snapshot.UpdatedAt = now.Add(-time.Minute)
+	store.set(snapshot)
+	var buf bytes.Buffer
+	opts := &monitorOptions{format: "table", watch: true, outputFile: "out", interval: 5 * time.Second, groupByService: true}
+	require.NoError(t, printMonitorProjects(&buf, store.list([]string{"blog", "shop"}), opts, now))
+	assert.Contains(t, buf.String(), "Project: blog (waiting for the first refresh)\n")
+	assert.Contains(t, buf.String(), "Project: shop (stale, refreshed 1m0s ago)\n")
+	assert.Contains(t, buf.String(), "0/1 running")
+}
+
+func TestMonitorRecordReplay(t *testing.T) {
+	start := time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC)
+	containers := []api.ContainerSummary{{ID: "1", Name: "shop-api-1", Service: "api", State: "running", Health: "healthy"}}
+	stats := map[string]container.StatsResponse{"1": {MemoryStats: container.MemoryStats{Usage: 2048, Limit: 4096}}}
+	frames := []monitorFrame{
+		{Project: "shop", Time: start, Services: groupMonitorReplicas(containers, stats), Endpoints: []monitorEndpoint{}},
+		{Project: "shop", Time: start.Add(2 * time.Second), Unavailable: true, Services: []monitorServiceGroup{}},
+		{Project: "shop", Time: start.Add(4 * time.Second), Services: groupMonitorReplicas(containers, nil)},
+	}
+	var recording bytes.Buffer
+	for _, frame := range frames {
+		require.NoError(t, recordMonitorFrame(&recording, frame))
+	}
+	assert.Equal(t, 3, bytes.Count(recording.Bytes(), []byte("\n")))
+
+	var replayed []monitorFrame
+	started := time.Now()
+	require.NoError(t, replayMonitorFrames(context.Background(), bytes.NewReader(recording.Bytes()), 100, func(frame monitorFrame) error {
+		replayed = append(replayed, frame)
+		return nil
+	}))
+	// 4s recorded at 100 times the speed
+	assert.GreaterOrEqual(t, time.Since(started), 40*time.Millisecond)
+	require.Len(t, replayed, 3)
+	assert.Equal(t, frames[0].Services, replayed[0].Services)
+	assert.True(t, replayed[1].Unavailable)
+	assert.True(t, replayed[2].Time.Equal(start.Add(4*time.Second)))
+
+	var out bytes.Buffer
+	require.NoError(t, printMonitorReport(&out, &monitorOptions{format: "table", groupByService: false}, replayed[0]))
+	assert.Contains(t, out.String(), "Time: 2026-05-04T10:00:00Z\n")
+	assert.Contains(t, out.String(), "api                  running      healthy    0.0      2KiB")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rendered := 0
+	require.NoError(t, replayMonitorFrames(ctx, bytes.NewReader(recording.Bytes()), 1, func(monitorFrame) error {
+		rendered++
+		return nil
+	}))
+	assert.Equal(t, 1, rendered)
+
+	err := replayMonitorFrames(context.Background(), bytes.NewReader([]byte("{\"project\":")), 1, func(monitorFrame) error { return nil })
+	assert.ErrorContains(t, err, "failed to read frame 1")
+}
+
+func TestIsMonitoredEvent(t *testing.T) {
+	testCases := []struct {
+		action    string
+		monitored bool
+	}{
+		{action: "start", monitored: true},
+		{action: "stop", monitored: true},
+		{action: "die", monitored: true},
+		{action: "health_status", monitored: true},
+		{action: "health_status: healthy", monitored: true},
+		{action: "health_status: unhealthy", monitored: true},
+		{action: "exec_start: sh", monitored: false},
+		{action: "create", monitored: false},
+		{action: "starting", monitored: false},
+		{action: "", monitored: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.action, func(t *testing.T) {
+			assert.Equal(t, tc.monitored, isMonitoredEvent(tc.action))
+		})
+	}
+}
+
+func TestRunMonitorEvents(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	events := []api.Event{
+		{Timestamp: now, Service: "web", Container: "0123456789abcdef", Status: "start"},
+		{Timestamp: now, Service: "web", Container: "0123456789abcdef", Status: "exec_start: sh"},
+		{Timestamp: now.Add(time.Second), Service: "db", Container: "fedcba", Status: "health_status: unhealthy"},
+	}
+	run := func(format string) string {
+		ctrl := gomock.NewController(t)
+		backend := mocks.NewMockCompose(ctrl)
+		backend.EXPECT().Events(gomock.Any(), "shop", gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ string, options api.EventsOptions) error {
+				assert.Equal(t, []string{"web", "db"}, options.Services)
+				for _, event := range events {
+					if err := options.Consumer(event); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		var buf bytes.Buffer
+		require.NoError(t, runMonitorEvents(context.Background(), backend, "shop", []string{"web", "db"}, &buf, format))
+		return buf.String()
+	}
+
+	assert.Equal(t, "Streaming events for project shop (press Ctrl+C to stop)\n"+
+		"2024-05-01T12:00:00Z web                  0123456789ab start\n"+
+		"2024-05-01T12:00:01Z db                   fedcba       health_status: unhealthy\n", run("table"))
+
+	assert.Equal(t, `{"action":"start","id":"0123456789abcdef","project":"shop","service":"web","time":"2024-05-01T12:00:00Z"}`+"\n"+
+		`{"action":"health_status: unhealthy","id":"fedcba","project":"shop","service":"db","time":"2024-05-01T12:00:01Z"}`+"\n", run("json"))
+}
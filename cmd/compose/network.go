@@ -18,11 +18,27 @@ package compose
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
 
+	"github.com/containerd/errdefs"
 	"github.com/docker/cli/cli/command"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
 	"github.com/spf13/cobra"
 
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/cmd/prompt"
+	"github.com/docker/compose/v5/pkg/api"
 	"github.com/docker/compose/v5/pkg/compose"
 )
 
@@ -41,12 +57,17 @@ type networkOptions struct {
 	service    string
 	ipamDriver string
 	ipamConfig string
+	prune      bool
+	assumeYes  bool
+	diff       bool
+	format     string
 }
 
 func networkCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *BackendOptions) *cobra.Command {
 	opts := networkOptions{
 		ProjectOptions: p,
 		driver:         "bridge",
+		format:         "table",
 	}
 
 	cmd := &cobra.Command{
@@ -55,6 +76,18 @@ func networkCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *Ba
 		Long: `EXPERIMENTAL - Manage networks for Compose projects.
 
 This command helps you create, configure, and manage networks for your Compose projects.
+
+With --prune, networks created for the project which no longer have any attached
+container, running or stopped (typically left over by failed runs), are removed after
+confirmation.
+
+With --diff, the networks declared in the compose file are compared with the networks of the
+project existing in the engine:
+- missing: declared, but not created (yet), along with the services attached to it
+- extra: created for the project, but no longer declared
+- drift: created with a driver or subnets other than declared, the network has to be
+  recreated for the declaration to apply
+External networks are only checked for existence.
 `,
 		RunE: Adapt(func(ctx context.Context, args []string) error {
 			if len(args) > 0 {
@@ -76,10 +109,22 @@ This command helps you create, configure, and manage networks for your Compose p
 	cmd.Flags().StringVar(&opts.service, "service", "", "Service name for connect/disconnect")
 	cmd.Flags().StringVar(&opts.ipamDriver, "ipam-driver", "default", "IPAM driver")
 	cmd.Flags().StringVar(&opts.ipamConfig, "ipam-config", "", "IPAM configuration (e.g., \"subnet=192.168.1.0/24\")")
+	cmd.Flags().BoolVar(&opts.prune, "prune", false, "Remove project networks without attached containers")
+	cmd.Flags().BoolVarP(&opts.assumeYes, "yes", "y", false, `Assume "yes" as answer to all prompts`)
+	cmd.Flags().BoolVar(&opts.diff, "diff", false, "Compare the networks declared in the compose file with the existing ones")
+	cmd.Flags().StringVar(&opts.format, "format", "table", "Format of the --diff output (table, json)")
 	return cmd
 }
 
 func runNetwork(ctx context.Context, dockerCli command.Cli, backendOptions *BackendOptions, opts *networkOptions) error {
+	if opts.prune {
+		projectName, err := opts.toProjectName(ctx, dockerCli)
+		if err != nil {
+			return err
+		}
+		return pruneProjectNetworks(ctx, dockerCli, projectName, opts.assumeYes)
+	}
+
 	backend, err := compose.NewComposeService(dockerCli, backendOptions.Options...)
 	if err != nil {
 		return err
@@ -90,6 +135,10 @@ func runNetwork(ctx context.Context, dockerCli command.Cli, backendOptions *Back
 		return err
 	}
 
+	if opts.diff {
+		return runNetworkDiff(ctx, dockerCli, project, opts.format)
+	}
+
 	// For now, we'll just list the services and their networks
 	fmt.Println("Network Information:")
 	fmt.Println("====================")
@@ -111,3 +160,232 @@ func runNetwork(ctx context.Context, dockerCli command.Cli, backendOptions *Back
 }
 
 // Network management functions are integrated into the main runNetwork function
+
+// pruneProjectNetworks removes the networks labeled for the project which have no attached container
+func pruneProjectNetworks(ctx context.Context, dockerCli command.Cli, projectName string, assumeYes bool) error {
+	unused, err := unusedProjectNetworks(ctx, dockerCli.Client(), projectName)
+	if err != nil {
+		return err
+	}
+	if len(unused) == 0 {
+		_, _ = fmt.Fprintf(dockerCli.Out(), "No unused networks for project %s\n", projectName)
+		return nil
+	}
+
+	_, _ = fmt.Fprintf(dockerCli.Out(), "The following networks of project %s have no attached containers:\n", projectName)
+	for _, n := range unused {
+		_, _ = fmt.Fprintf(dockerCli.Out(), "  - %s\n", n.Name)
+	}
+	if !assumeYes {
+		confirmed, err := prompt.NewPrompt(dockerCli.In(), dockerCli.Out()).Confirm("Remove these networks? [y/N]: ", false)
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			return fmt.Errorf("operation cancelled by user")
+		}
+	}
+
+	var errs []error
+	for _, n := range unused {
+		if err := dockerCli.Client().NetworkRemove(ctx, n.ID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove network %s: %w", n.Name, err))
+			continue
+		}
+		_, _ = fmt.Fprintf(dockerCli.Out(), "Removed network %s\n", n.Name)
+	}
+	return errors.Join(errs...)
+}
+
+// unusedProjectNetworks lists the networks labeled for the project without any container, running
+// or stopped, attached
+func unusedProjectNetworks(ctx context.Context, apiClient client.APIClient, projectName string) ([]network.Inspect, error) {
+	networks, err := apiClient.NetworkList(ctx, network.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", api.ProjectLabel, projectName))),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var unused []network.Inspect
+	for _, n := range networks {
+		// containers are only reported when inspecting a network
+		inspect, err := apiClient.NetworkInspect(ctx, n.ID, network.InspectOptions{})
+		if errdefs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(inspect.Containers) > 0 {
+			continue
+		}
+		// stopped containers are not reported by the inspection, but still use the network
+		stopped, err := apiClient.ContainerList(ctx, container.ListOptions{
+			All:     true,
+			Filters: filters.NewArgs(filters.Arg("network", inspect.ID)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(stopped) == 0 {
+			unused = append(unused, inspect)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		return unused[i].Name < unused[j].Name
+	})
+	return unused, nil
+}
+
+// networkDiff is the difference between the networks declared by a project and those existing in the engine
+type networkDiff struct {
+	Missing []networkMissing `json:"missing"`
+	Extra   []string         `json:"extra"`
+	Drift   []networkDrift   `json:"drift"`
+}
+
+// networkMissing is a declared network which doesn't exist
+type networkMissing struct {
+	Network  string   `json:"network"`
+	Name     string   `json:"name"`
+	External bool     `json:"external,omitempty"`
+	Services []string `json:"services"`
+}
+
+// networkDrift is a setting of an existing network differing from its declaration
+type networkDrift struct {
+	Network  string `json:"network"`
+	Name     string `json:"name"`
+	Field    string `json:"field"` // driver or subnet
+	Declared string `json:"declared"`
+	Actual   string `json:"actual"`
+}
+
+func (d networkDiff) empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Drift) == 0
+}
+
+func runNetworkDiff(ctx context.Context, dockerCli command.Cli, project *types.Project, format string) error {
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	apiClient := dockerCli.Client()
+	existing, err := apiClient.NetworkList(ctx, network.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", api.ProjectLabel, project.Name))),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list networks: %v", err)
+	}
+	// external networks are not labeled for the project
+	for _, config := range project.Networks {
+		if !config.External {
+			continue
+		}
+		inspect, err := apiClient.NetworkInspect(ctx, config.Name, network.InspectOptions{})
+		if errdefs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to inspect network %s: %v", config.Name, err)
+		}
+		existing = append(existing, inspect)
+	}
+	return printNetworkDiff(dockerCli.Out(), project.Name, diffProjectNetworks(project, existing), format)
+}
+
+// diffProjectNetworks compares the networks declared by a project with the existing ones: networks
+// of the project, matched by their network label or name, and external networks, matched by name
+func diffProjectNetworks(project *types.Project, existing []network.Inspect) networkDiff {
+	diff := networkDiff{Missing: []networkMissing{}, Extra: []string{}, Drift: []networkDrift{}}
+	matched := map[string]bool{}
+	for _, key := range slices.Sorted(maps.Keys(project.Networks)) {
+		config := project.Networks[key]
+		index := slices.IndexFunc(existing, func(n network.Inspect) bool {
+			if config.External {
+				return n.Name == config.Name
+			}
+			return n.Labels[api.NetworkLabel] == key || n.Name == config.Name
+		})
+		if index < 0 {
+			diff.Missing = append(diff.Missing, networkMissing{
+				Network:  key,
+				Name:     config.Name,
+				External: bool(config.External),
+				Services: networkServices(project, key),
+			})
+			continue
+		}
+		actual := existing[index]
+		matched[actual.ID] = true
+		if config.External {
+			continue
+		}
+		if config.Driver != "" && config.Driver != actual.Driver {
+			diff.Drift = append(diff.Drift, networkDrift{Network: key, Name: actual.Name, Field: "driver", Declared: config.Driver, Actual: actual.Driver})
+		}
+		var declared, subnets []string
+		for _, pool := range config.Ipam.Config {
+			if pool.Subnet != "" {
+				declared = append(declared, pool.Subnet)
+			}
+		}
+		for _, pool := range actual.IPAM.Config {
+			subnets = append(subnets, pool.Subnet)
+		}
+		slices.Sort(declared)
+		slices.Sort(subnets)
+		if len(declared) > 0 && !slices.Equal(declared, subnets) {
+			diff.Drift = append(diff.Drift, networkDrift{Network: key, Name: actual.Name, Field: "subnet", Declared: strings.Join(declared, ","), Actual: strings.Join(subnets, ",")})
+		}
+	}
+	for _, n := range existing {
+		if !matched[n.ID] {
+			diff.Extra = append(diff.Extra, n.Name)
+		}
+	}
+	sort.Strings(diff.Extra)
+	return diff
+}
+
+// networkServices returns the services of a project attached to a network, sorted
+func networkServices(project *types.Project, key string) []string {
+	services := []string{}
+	for _, service := range project.Services {
+		if _, ok := service.Networks[key]; ok {
+			services = append(services, service.Name)
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+func printNetworkDiff(w io.Writer, projectName string, diff networkDiff, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	}
+	if diff.empty() {
+		_, _ = fmt.Fprintf(w, "Networks of project %s match the compose file\n", projectName)
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NETWORK\tSTATUS\tDETAILS")
+	for _, m := range diff.Missing {
+		details := "not created"
+		if m.External {
+			details = "external network not found"
+		}
+		if len(m.Services) > 0 {
+			details += ", used by " + strings.Join(m.Services, ", ")
+		}
+		_, _ = fmt.Fprintf(tw, "%s\tmissing\t%s\n", m.Name, details)
+	}
+	for _, name := range diff.Extra {
+		_, _ = fmt.Fprintf(tw, "%s\textra\tnot declared in the compose file\n", name)
+	}
+	for _, d := range diff.Drift {
+		_, _ = fmt.Fprintf(tw, "%s\tdrift\t%s: declared %s, actual %s\n", d.Name, d.Field, d.Declared, d.Actual)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,120 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/docker/cli/cli/streams"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestPruneProjectNetworks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	apiClient := mocks.NewMockAPIClient(ctrl)
+	cli := mocks.NewMockCli(ctrl)
+	out := new(bytes.Buffer)
+	cli.EXPECT().Client().Return(apiClient).AnyTimes()
+	cli.EXPECT().Out().Return(streams.NewOut(out)).AnyTimes()
+
+	apiClient.EXPECT().NetworkList(gomock.Any(), network.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", "com.docker.compose.project=shop")),
+	}).Return([]network.Inspect{{ID: "1", Name: "shop_default"}, {ID: "2", Name: "shop_backend"}, {ID: "3", Name: "shop_jobs"}}, nil)
+	apiClient.EXPECT().NetworkInspect(gomock.Any(), "1", gomock.Any()).
+		Return(network.Inspect{ID: "1", Name: "shop_default", Containers: map[string]network.EndpointResource{"c1": {}}}, nil)
+	apiClient.EXPECT().NetworkInspect(gomock.Any(), "2", gomock.Any()).
+		Return(network.Inspect{ID: "2", Name: "shop_backend"}, nil)
+	apiClient.EXPECT().ContainerList(gomock.Any(), container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("network", "2")),
+	}).Return(nil, nil)
+	// the stopped container of a network isn't listed by its inspection
+	apiClient.EXPECT().NetworkInspect(gomock.Any(), "3", gomock.Any()).
+		Return(network.Inspect{ID: "3", Name: "shop_jobs"}, nil)
+	apiClient.EXPECT().ContainerList(gomock.Any(), container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("network", "3")),
+	}).Return([]container.Summary{{ID: "c2", State: "exited"}}, nil)
+	apiClient.EXPECT().NetworkRemove(gomock.Any(), "2").Return(nil)
+
+	require.NoError(t, pruneProjectNetworks(context.Background(), cli, "shop", true))
+	assert.Equal(t, "The following networks of project shop have no attached containers:\n"+
+		"  - shop_backend\n"+
+		"Removed network shop_backend\n", out.String())
+}
+
+func TestDiffProjectNetworks(t *testing.T) {
+	project := &types.Project{
+		Name: "shop",
+		Services: types.Services{
+			"web": {Name: "web", Networks: map[string]*types.ServiceNetworkConfig{"default": nil, "frontend": nil, "proxy": nil}},
+			"api": {Name: "api", Networks: map[string]*types.ServiceNetworkConfig{"default": nil, "backend": nil, "frontend": nil}},
+		},
+		Networks: types.Networks{
+			"default":  {Name: "shop_default"},
+			"backend":  {Name: "shop_backend", Driver: "bridge", Ipam: types.IPAMConfig{Config: []*types.IPAMPool{{Subnet: "10.1.0.0/24"}}}},
+			"frontend": {Name: "shop_frontend"},
+			"proxy":    {Name: "traefik", External: true},
+		},
+	}
+	existing := []network.Inspect{
+		{ID: "1", Name: "shop_default", Driver: "bridge", Labels: map[string]string{"com.docker.compose.network": "default"}},
+		{ID: "2", Name: "shop_backend", Driver: "overlay", Labels: map[string]string{"com.docker.compose.network": "backend"},
+			IPAM: network.IPAM{Config: []network.IPAMConfig{{Subnet: "10.2.0.0/24"}}}},
+		{ID: "3", Name: "shop_legacy", Driver: "bridge", Labels: map[string]string{"com.docker.compose.network": "legacy"}},
+	}
+
+	diff := diffProjectNetworks(project, existing)
+	assert.Equal(t, []networkMissing{
+		{Network: "frontend", Name: "shop_frontend", Services: []string{"api", "web"}},
+		{Network: "proxy", Name: "traefik", External: true, Services: []string{"web"}},
+	}, diff.Missing)
+	assert.Equal(t, []string{"shop_legacy"}, diff.Extra)
+	assert.Equal(t, []networkDrift{
+		{Network: "backend", Name: "shop_backend", Field: "driver", Declared: "bridge", Actual: "overlay"},
+		{Network: "backend", Name: "shop_backend", Field: "subnet", Declared: "10.1.0.0/24", Actual: "10.2.0.0/24"},
+	}, diff.Drift)
+
+	var out bytes.Buffer
+	require.NoError(t, printNetworkDiff(&out, "shop", diff, "table"))
+	assert.Equal(t, "NETWORK         STATUS    DETAILS\n"+
+		"shop_frontend   missing   not created, used by api, web\n"+
+		"traefik         missing   external network not found, used by web\n"+
+		"shop_legacy     extra     not declared in the compose file\n"+
+		"shop_backend    drift     driver: declared bridge, actual overlay\n"+
+		"shop_backend    drift     subnet: declared 10.1.0.0/24, actual 10.2.0.0/24\n", out.String())
+
+	// an external network found and unchanged declarations match
+	existing = append(existing[:1], network.Inspect{ID: "4", Name: "traefik", Driver: "overlay"})
+	delete(project.Networks, "backend")
+	delete(project.Networks, "frontend")
+	diff = diffProjectNetworks(project, existing)
+	assert.True(t, diff.empty())
+	out.Reset()
+	require.NoError(t, printNetworkDiff(&out, "shop", diff, "json"))
+	assert.JSONEq(t, `{"missing":[],"extra":[],"drift":[]}`, out.String())
+}
@@ -0,0 +1,60 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/pflag"
+)
+
+// addOutputFlag adds the --output flag redirecting the structured output of a command to a file,
+// usage listing the outputs it applies to
+func addOutputFlag(flags *pflag.FlagSet, output *string, usage string) {
+	flags.StringVarP(output, "output", "o", "", fmt.Sprintf("Write %s to file instead of stdout", usage))
+}
+
+// writeOutput calls write with stdout, or with the file path when set. The file is written
+// atomically: write goes to a temporary file next to it, renamed over path once complete, so a
+// failed write never leaves a truncated file behind.
+func writeOutput(path string, perm os.FileMode, stdout io.Writer, write func(w io.Writer) error) error {
+	if path == "" {
+		return write(stdout)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	if err := write(tmp); err != nil {
+		return errors.Join(err, tmp.Close())
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return errors.Join(fmt.Errorf("failed to write %s: %v", path, err), tmp.Close())
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
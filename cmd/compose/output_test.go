@@ -0,0 +1,69 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteOutput(t *testing.T) {
+	var stdout bytes.Buffer
+	require.NoError(t, writeOutput("", 0o644, &stdout, func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, "to stdout")
+		return err
+	}))
+	assert.Equal(t, "to stdout\n", stdout.String())
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "out.json")
+	require.NoError(t, writeOutput(file, 0o600, &stdout, func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, "first")
+		return err
+	}))
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "first\n", string(content))
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// a failed write leaves the previous content and no temporary file
+	err = writeOutput(file, 0o600, &stdout, func(w io.Writer) error {
+		_, _ = fmt.Fprintln(w, "partial")
+		return errors.New("boom")
+	})
+	assert.EqualError(t, err, "boom")
+	content, err = os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "first\n", string(content))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "to stdout\n", stdout.String())
+
+	err = writeOutput(filepath.Join(dir, "missing", "out.json"), 0o644, &stdout, func(io.Writer) error { return nil })
+	assert.ErrorContains(t, err, "failed to create")
+}
@@ -17,10 +17,23 @@
 package compose
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/docker/cli/cli/command"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
 
 	"github.com/compose-spec/compose-go/v2/types"
@@ -38,11 +51,24 @@ type perfOptions struct {
 	disk       bool
 	duration   int
 	interval   int
+	snapshot   bool
 	report     string
 	format     string
 	thresholds bool
 	optimize   bool
 	quiet      bool
+	top        int
+	by         string
+
+	leakCheck     bool
+	leakThreshold float64
+
+	writeOverride bool
+	headroom      int
+
+	sampleTo string
+	sampler  *perfSampleWriter // writes the samples to --sample-to
+	measured time.Duration     // time samples were collected over, known once sampling stopped
 }
 
 func perfCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *BackendOptions) *cobra.Command {
@@ -60,6 +86,9 @@ func perfCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *Backe
 		thresholds:     false,
 		optimize:       false,
 		quiet:          false,
+		by:             "cpu",
+		leakThreshold:  1,
+		headroom:       30,
 	}
 
 	cmd := &cobra.Command{
@@ -74,8 +103,41 @@ This command supports:
 4. Threshold analysis: Check if resources exceed defined thresholds
 5. Reports: Generate performance reports in various formats
 6. Quiet mode: Minimal output for scripting
+
+With --top N, only the N services using the most resources over the run are listed,
+ranked by average CPU usage or by the resource selected with --by. All services are
+analyzed when none are given.
+
+With --leak-check, memory usage (excluding the page cache) is sampled over the whole
+--duration and a trend line fitted per service. Services whose memory grows at every
+sample faster than --leak-threshold MB/min are reported as suspected leaks, along with
+the projected time until their memory limit is reached.
+
+With --write-override, ` + perfOverrideFile + ` is written in the project directory with
+deploy.resources for each analyzed service: reservations at the p95 CPU and memory usage measured
+per container, limits at the p95 plus --headroom percent. Apply it with:
+
+    docker compose -f compose.yaml -f ` + perfOverrideFile + ` up
+
+A longer --duration under a representative load gives more reliable recommendations.
+
+With --duration 0, samples are collected every --interval until the analysis is interrupted
+with Ctrl+C, then the summary, reports and recommendations are produced from the samples
+collected so far, and the command succeeds. A second Ctrl+C aborts without reporting. Use
+--snapshot to analyze a single reading instead.
+
+With --sample-to FILE, every sample collected is appended to FILE as a JSON line as soon as it
+is read: timestamp, service, container, CPU usage since the previous sample, memory usage and
+limit, and the cumulative network and disk bytes of the container. The file is written along
+with the summary, and keeps the samples collected until an interrupted run stopped.
+
+With --disk, the disk I/O of each service is broken down per mount: bytes and operations read
+and written on the block device backing each volume or bind mount, the container filesystem
+showing as such. The engine accounts I/O per device, so mounts sharing a device are reported
+together, and mounts are only resolved when running on the engine host. A mount doing most of
+the I/O of a service is reported with the optimization suggestions.
 `,
-		RunE: Adapt(func(ctx context.Context, args []string) error {
+		RunE: adaptPerf(func(ctx context.Context, args []string) error {
 			opts.services = args
 			return runPerf(ctx, dockerCli, backendOptions, &opts)
 		}),
@@ -86,26 +148,97 @@ This command supports:
 	cmd.Flags().BoolVar(&opts.memory, "memory", true, "Analyze memory usage")
 	cmd.Flags().BoolVar(&opts.nets, "net", true, "Analyze network usage")
 	cmd.Flags().BoolVar(&opts.disk, "disk", true, "Analyze disk usage")
-	cmd.Flags().IntVar(&opts.duration, "duration", 30, "Analysis duration in seconds")
+	cmd.Flags().IntVar(&opts.duration, "duration", 30, "Analysis duration in seconds (0 to run until interrupted)")
 	cmd.Flags().IntVar(&opts.interval, "interval", 1, "Sampling interval in seconds")
+	cmd.Flags().BoolVar(&opts.snapshot, "snapshot", false, "Analyze a single snapshot instead of sampling over --duration")
 	cmd.Flags().StringVar(&opts.report, "report", "", "Output directory for performance reports")
 	cmd.Flags().StringVar(&opts.format, "format", "text", "Report format (text, json, html)")
 	cmd.Flags().BoolVar(&opts.thresholds, "thresholds", false, "Check resource usage against thresholds")
 	cmd.Flags().BoolVar(&opts.optimize, "optimize", false, "Generate optimization suggestions")
 	cmd.Flags().BoolVar(&opts.quiet, "quiet", false, "Quiet mode (minimal output)")
+	cmd.Flags().IntVar(&opts.top, "top", 0, "Only list the N services using the most resources")
+	cmd.Flags().StringVar(&opts.by, "by", "cpu", "Resource used to rank services with --top (cpu, mem, net, disk)")
+	cmd.Flags().BoolVar(&opts.leakCheck, "leak-check", false, "Detect services whose memory keeps growing over the analysis duration")
+	cmd.Flags().Float64Var(&opts.leakThreshold, "leak-threshold", 1, "Memory growth in MB/min above which a service is reported as leaking")
+	cmd.Flags().BoolVar(&opts.writeOverride, "write-override", false, "Write resource recommendations to "+perfOverrideFile+" (implies --optimize)")
+	cmd.Flags().StringVar(&opts.sampleTo, "sample-to", "", "Write every collected sample to FILE as newline-delimited JSON")
+	cmd.Flags().IntVar(&opts.headroom, "headroom", 30, "Percentage added to the p95 usage for the limits written with --write-override")
 	return cmd
 }
 
+// adaptPerf adapts the perf command like Adapt, except an analysis interrupted with Ctrl+C
+// which still produced its report succeeds, instead of exiting with status 130
+func adaptPerf(fn Command) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		var runErr error
+		err := Adapt(func(ctx context.Context, args []string) error {
+			runErr = fn(ctx, args)
+			return runErr
+		})(cmd, args)
+		if runErr == nil {
+			return nil
+		}
+		return err
+	}
+}
+
 func runPerf(ctx context.Context, dockerCli command.Cli, backendOptions *BackendOptions, opts *perfOptions) error {
+	if !opts.snapshot {
+		if err := validatePerfTiming(opts.duration, opts.interval); err != nil {
+			return err
+		}
+	}
+	offsets := opts.sampleOffsets()
+	if opts.top < 0 {
+		return fmt.Errorf("--top must not be negative, got %d", opts.top)
+	}
+	if !slices.Contains(perfRankings, opts.by) {
+		return fmt.Errorf("invalid --by value %q, must be one of %s", opts.by, strings.Join(perfRankings, ", "))
+	}
+	if opts.leakCheck {
+		if offsets != nil && len(offsets) < 3 {
+			return fmt.Errorf("--leak-check requires a --duration of at least 2 intervals")
+		}
+		if opts.top > 0 {
+			return fmt.Errorf("--leak-check cannot be combined with --top")
+		}
+	}
+
+	if opts.writeOverride {
+		if opts.top > 0 {
+			return fmt.Errorf("--write-override cannot be combined with --top")
+		}
+		if opts.headroom < 0 {
+			return fmt.Errorf("--headroom must not be negative, got %d", opts.headroom)
+		}
+		opts.optimize = true
+	}
+
 	backend, err := compose.NewComposeService(dockerCli, backendOptions.Options...)
 	if err != nil {
 		return err
 	}
 
-	project, _, err := opts.ToProject(ctx, dockerCli, backend, opts.services)
+	selection := opts.SelectServices(opts.services, opts.all)
+	project, _, err := opts.ToProject(ctx, dockerCli, backend, selection)
 	if err != nil {
 		return err
 	}
+	opts.services = opts.ResolveServices(project, selection)
+
+	if opts.sampleTo != "" {
+		f, err := os.Create(opts.sampleTo)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", opts.sampleTo, err)
+		}
+		defer f.Close() //nolint:errcheck
+		opts.sampler = &perfSampleWriter{w: f}
+	}
+
+	if opts.top > 0 {
+		// the ranking replaces the per-service output
+		opts.quiet = true
+	}
 
 	if !opts.quiet {
 		fmt.Println("Starting performance analysis...")
@@ -113,8 +246,16 @@ func runPerf(ctx context.Context, dockerCli command.Cli, backendOptions *Backend
 		if opts.all {
 			fmt.Println("Analyzing all services")
 		}
-		fmt.Printf("Duration: %d seconds\n", opts.duration)
-		fmt.Printf("Interval: %d seconds\n", opts.interval)
+		switch {
+		case opts.snapshot:
+			fmt.Println("Duration: single snapshot")
+		case offsets == nil:
+			fmt.Println("Duration: until interrupted (press Ctrl+C to stop and report)")
+			fmt.Printf("Interval: %d seconds\n", opts.interval)
+		default:
+			fmt.Printf("Duration: %d seconds\n", opts.duration)
+			fmt.Printf("Interval: %d seconds (%d samples)\n", opts.interval, len(offsets))
+		}
 		fmt.Printf("Metrics: ")
 		metrics := []string{}
 		if opts.cpu {
@@ -142,26 +283,73 @@ func runPerf(ctx context.Context, dockerCli command.Cli, backendOptions *Backend
 		}
 	}
 
-	// Analyze each service
+	// Sample the containers of all services together, so they are analyzed over the same window
+	var analyzed []string
+	var containers []api.ContainerSummary
+	serviceContainers := map[string][]api.ContainerSummary{}
 	for _, service := range opts.services {
-		if !opts.quiet {
-			fmt.Printf("\nAnalyzing service: %s\n", service)
+		found, err := backend.Ps(ctx, project.Name, api.PsOptions{Services: []string{service}})
+		if err == nil && len(found) == 0 {
+			err = fmt.Errorf("no running containers for service %s", service)
 		}
-		if err := analyzeServicePerf(ctx, dockerCli, backend, project, service, opts); err != nil {
+		if err != nil {
 			if !opts.quiet {
 				fmt.Printf("Warning: Analysis failed for service %s: %v\n", service, err)
 			}
 			continue
 		}
+		analyzed = append(analyzed, service)
+		serviceContainers[service] = found
+		containers = append(containers, found...)
+	}
+
+	var samples map[string][]container.StatsResponse
+	if len(containers) > 0 {
+		if !opts.quiet {
+			fmt.Println("\nCollecting performance metrics...")
+		}
+		samples, offsets, err = samplePerfStats(ctx, dockerCli, containers, offsets, time.Duration(opts.interval)*time.Second, opts.sampler)
+		if err != nil {
+			return err
+		}
+		if len(offsets) == 0 {
+			return fmt.Errorf("analysis interrupted before the first sample")
+		}
+		opts.measured = offsets[len(offsets)-1]
+		if ctx.Err() != nil {
+			// interrupted with --duration 0, report on what was collected
+			ctx = context.WithoutCancel(ctx)
+			if !opts.quiet {
+				fmt.Printf("\nSampling stopped after %s (%d samples)\n", opts.measured, len(offsets))
+			}
+		}
+	}
+
+	// Analyze each service
+	var results []*servicePerfResult
+	for _, service := range analyzed {
+		if !opts.quiet {
+			fmt.Printf("\nAnalyzing service: %s\n", service)
+		}
+		results = append(results, summarizeServicePerf(ctx, dockerCli, service, serviceContainers[service], samples, offsets, opts))
 		if !opts.quiet {
 			fmt.Printf("Analysis completed for service: %s\n", service)
 		}
 	}
 
+	if opts.top > 0 {
+		return printPerfTop(os.Stdout, rankPerfResults(results, opts.by, opts.top), opts.format)
+	}
+
+	if opts.leakCheck {
+		fmt.Println("\nMemory leak check:")
+		printMemoryTrends(os.Stdout, results)
+	}
+
 	// Generate reports
 	if opts.report != "" && !opts.quiet {
 		fmt.Println("\nGenerating performance reports...")
-		if err := generatePerfReport(ctx, project, opts); err != nil {
+		if err := generatePerfReport(ctx, project, opts, results); err != nil {
 			fmt.Printf("Warning: Failed to generate performance report: %v\n", err)
 		} else {
 			fmt.Println("Performance reports generated successfully")
@@ -169,11 +357,16 @@ func runPerf(ctx context.Context, dockerCli command.Cli, backendOptions *Backend
 	}
 
 	// Generate optimization suggestions
-	if opts.optimize && !opts.quiet {
-		fmt.Println("\nGenerating optimization suggestions...")
-		if err := generateOptimizationSuggestions(ctx, project, opts); err != nil {
+	if opts.optimize && (!opts.quiet || opts.writeOverride) {
+		if !opts.quiet {
+			fmt.Println("\nGenerating optimization suggestions...")
+		}
+		if err := generateOptimizationSuggestions(ctx, project, opts, results); err != nil {
+			if opts.writeOverride {
+				return err
+			}
 			fmt.Printf("Warning: Failed to generate optimization suggestions: %v\n", err)
-		} else {
+		} else if !opts.quiet {
 			fmt.Println("Optimization suggestions generated successfully")
 		}
 	}
@@ -184,53 +377,677 @@ func runPerf(ctx context.Context, dockerCli command.Cli, backendOptions *Backend
 	return nil
 }
 
-func analyzeServicePerf(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, service string, opts *perfOptions) error {
-	// Simplified implementation - in real code, this would perform actual analysis
-	if !opts.quiet {
-		fmt.Printf("Analyzing performance for service: %s\n", service)
-		fmt.Printf("Duration: %d seconds\n", opts.duration)
-		fmt.Printf("Interval: %d seconds\n", opts.interval)
-		fmt.Println("Collecting performance metrics...")
+// servicePerfResult holds what was observed for a service over the sampling window
+type servicePerfResult struct {
+	Service         string
+	CPUPercent      float64
+	MemoryUsage     uint64
+	PeakMemoryUsage uint64 // highest memory usage seen across samples
+	MemoryLimit     uint64
+	Samples         int
+	ThrottleRatio   float64
+	ThrottledTime   time.Duration
+	MemoryFailcnt   uint64
+	OOMKilled       bool
+	NetworkBytes    uint64        // bytes received and sent over the sampling window
+	DiskBytes       uint64        // bytes read and written over the sampling window
+	MountIO         []perfMountIO // disk I/O per device, hottest first
+	MemoryTrend     *memoryTrend  // set with --leak-check
+	CPUP95          float64       // p95 of the CPU usage between samples, highest across containers
+	MemoryP95       uint64        // p95 of the memory usage without cache, highest across containers
+	Warnings        []string
+}
+
+// throttleWarningRatio is the share of throttled CPU periods above which a CPU limit is reported as too low
+const throttleWarningRatio = 0.1
+
+// summarizeServicePerf computes the result of a service from the samples of its containers, read at offsets
+func summarizeServicePerf(ctx context.Context, dockerCli command.Cli, service string, containers []api.ContainerSummary, samples map[string][]container.StatsResponse, offsets []time.Duration, opts *perfOptions) *servicePerfResult {
+	result := &servicePerfResult{Service: service}
+	memory := make([]uint64, len(offsets))
+	var periods, throttledPeriods uint64
+	for _, c := range containers {
+		containerSamples := samples[c.ID]
+		start, last := containerSamples[0], containerSamples[len(containerSamples)-1]
+		if len(containerSamples) == 1 {
+			// a snapshot is compared with the previous CPU reading taken by the engine
+			start = container.StatsResponse{CPUStats: last.PreCPUStats}
+		}
+
+		var peak uint64
+		containerMemory := make([]float64, 0, len(containerSamples))
+		for i, sample := range containerSamples {
+			peak = max(peak, sample.MemoryStats.Usage)
+			memory[i] += statsMemoryWithoutCache(sample)
+			containerMemory = append(containerMemory, float64(statsMemoryWithoutCache(sample)))
+		}
+		containerCPU := []float64{cpuPercentBetween(start, last)}
+		if len(containerSamples) > 1 {
+			containerCPU = containerCPU[:0]
+			for i := 1; i < len(containerSamples); i++ {
+				containerCPU = append(containerCPU, cpuPercentBetween(containerSamples[i-1], containerSamples[i]))
+			}
+		}
+		result.CPUP95 = max(result.CPUP95, perfPercentile(containerCPU, 95))
+		result.MemoryP95 = max(result.MemoryP95, uint64(perfPercentile(containerMemory, 95)))
+		result.Samples = len(containerSamples)
+		result.CPUPercent += cpuPercentBetween(start, last)
+		result.MemoryUsage += last.MemoryStats.Usage
+		result.PeakMemoryUsage += peak
+		result.MemoryLimit += last.MemoryStats.Limit
+
+		periods += counterDelta(start.CPUStats.ThrottlingData.Periods, last.CPUStats.ThrottlingData.Periods)
+		throttledPeriods += counterDelta(start.CPUStats.ThrottlingData.ThrottledPeriods, last.CPUStats.ThrottlingData.ThrottledPeriods)
+		result.ThrottledTime += time.Duration(counterDelta(start.CPUStats.ThrottlingData.ThrottledTime, last.CPUStats.ThrottlingData.ThrottledTime))
+		result.MemoryFailcnt += counterDelta(start.MemoryStats.Failcnt, last.MemoryStats.Failcnt)
+		result.NetworkBytes += counterDelta(statsNetworkBytes(start), statsNetworkBytes(last))
+		result.DiskBytes += counterDelta(statsDiskBytes(start), statsDiskBytes(last))
+
+		inspect, err := dockerCli.Client().ContainerInspect(ctx, c.ID)
+		if err == nil && inspect.State != nil && inspect.State.OOMKilled {
+			result.OOMKilled = true
+		}
+		if opts.disk {
+			var mounts map[string][]string
+			if err == nil {
+				mounts = mountDevices(inspect.Mounts)
+			}
+			result.MountIO = mergeMountIO(result.MountIO, deviceIOBetween(start, last, mounts))
+		}
 	}
+	sortMountIO(result.MountIO)
+	if periods > 0 {
+		result.ThrottleRatio = float64(throttledPeriods) / float64(periods)
+	}
+	if opts.leakCheck && len(offsets) >= 3 {
+		result.MemoryTrend = fitMemoryTrend(offsets, memory, result.MemoryLimit, opts.leakThreshold)
+	}
+	result.Warnings = perfWarnings(result)
 
-	// Simulate performance analysis
 	if !opts.quiet {
-		fmt.Println("Collecting CPU metrics...")
-		fmt.Println("Collecting memory metrics...")
-		fmt.Println("Collecting network metrics...")
-		fmt.Println("Collecting disk metrics...")
-		fmt.Println("Analyzing collected data...")
+		fmt.Println("\nMetrics:")
+		fmt.Printf("CPU usage: %.1f%%\n", result.CPUPercent)
+		if result.MemoryLimit > 0 {
+			fmt.Printf("Memory usage: %dMB / %dMB (%.0f%%)\n", result.MemoryUsage>>20, result.MemoryLimit>>20,
+				float64(result.MemoryUsage)/float64(result.MemoryLimit)*100)
+		}
+		if result.Samples > 1 {
+			fmt.Printf("Peak memory usage: %dMB over %d samples\n", result.PeakMemoryUsage>>20, result.Samples)
+		}
+		fmt.Printf("CPU throttled: %.0f%% of periods (%s)\n", result.ThrottleRatio*100, result.ThrottledTime)
+		if len(result.MountIO) > 0 {
+			fmt.Println("Disk I/O by mount:")
+			printMountIO(os.Stdout, result.MountIO)
+		}
+		if result.MemoryTrend != nil {
+			fmt.Printf("Memory trend: %+.2f MB/min\n", result.MemoryTrend.SlopeMBPerMinute)
+		}
+		for _, warning := range result.Warnings {
+			fmt.Printf("Warning: %s\n", warning)
+		}
 	}
 
-	// For demo purposes, just return success
-	if !opts.quiet {
-		fmt.Println("Performance analysis completed successfully")
-		// Print sample metrics
-		fmt.Println("\nSample metrics:")
-		fmt.Println("CPU usage: 25.4%")
-		fmt.Println("Memory usage: 128MB / 512MB (25%)")
-		fmt.Println("Network: 10MB/s")
-		fmt.Println("Disk I/O: 5MB/s")
+	return result
+}
+
+// validatePerfTiming checks --duration and --interval before any sampling starts
+func validatePerfTiming(duration, interval int) error {
+	switch {
+	case duration < 0:
+		return fmt.Errorf("--duration must not be negative, got %d", duration)
+	case interval <= 0:
+		return fmt.Errorf("--interval must be greater than 0, got %d", interval)
+	case duration > 0 && interval > duration:
+		return fmt.Errorf("--interval (%ds) must not exceed --duration (%ds)", interval, duration)
+	}
+	return nil
+}
+
+// perfSampleOffsets returns when samples are taken relative to the start of the analysis:
+// every interval, plus a last one exactly at duration. A zero duration has no end, nil is returned
+// and samples are taken until the analysis is interrupted.
+func perfSampleOffsets(duration, interval int) []time.Duration {
+	if duration == 0 {
+		return nil
+	}
+	var offsets []time.Duration
+	for t := 0; t < duration; t += interval {
+		offsets = append(offsets, time.Duration(t)*time.Second)
+	}
+	return append(offsets, time.Duration(duration)*time.Second)
+}
+
+// sampleOffsets returns when samples are taken, nil to sample until the analysis is interrupted
+func (opts *perfOptions) sampleOffsets() []time.Duration {
+	if opts.snapshot {
+		return []time.Duration{0}
+	}
+	return perfSampleOffsets(opts.duration, opts.interval)
+}
+
+// samplePerfStats reads the stats of the containers at each offset and returns the samples per container,
+// along with the offsets sampled. Without offsets, samples are read every interval until ctx is done and
+// the complete rounds read so far are returned. Each sample is also written to sampler, if set.
+func samplePerfStats(ctx context.Context, dockerCli command.Cli, containers []api.ContainerSummary, offsets []time.Duration, interval time.Duration, sampler *perfSampleWriter) (map[string][]container.StatsResponse, []time.Duration, error) {
+	untilDone := offsets == nil
+	samples := map[string][]container.StatsResponse{}
+	var sampled []time.Duration
+	interrupted := func() (map[string][]container.StatsResponse, []time.Duration, error) {
+		// drop the round being read, so every container has a sample per offset
+		for id := range samples {
+			samples[id] = samples[id][:len(sampled)]
+		}
+		return samples, sampled, nil
+	}
+
+	start := time.Now()
+	for i := 0; untilDone || i < len(offsets); i++ {
+		offset := time.Duration(i) * interval
+		if !untilDone {
+			offset = offsets[i]
+		}
+		select {
+		case <-ctx.Done():
+			if untilDone {
+				return interrupted()
+			}
+			return nil, nil, ctx.Err()
+		case <-time.After(time.Until(start.Add(offset))):
+		}
+		for _, c := range containers {
+			read := readContainerStats
+			if len(offsets) == 1 {
+				// a snapshot needs the previous CPU reading to compute usage
+				read = readContainerStatsSample
+			}
+			stats, err := read(ctx, dockerCli, c.ID)
+			if err != nil {
+				if untilDone && ctx.Err() != nil {
+					return interrupted()
+				}
+				return nil, nil, err
+			}
+			if sampler != nil {
+				if err := sampler.write(c, stats, samples[c.ID]); err != nil {
+					return nil, nil, err
+				}
+			}
+			samples[c.ID] = append(samples[c.ID], stats)
+		}
+		sampled = append(sampled, offset)
 	}
+	return samples, sampled, nil
+}
 
+// perfSample is a line written to --sample-to
+type perfSample struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Service     string    `json:"service"`
+	Container   string    `json:"container"`
+	CPUPercent  *float64  `json:"cpu_percent,omitempty"` // unknown for the first sample of a series
+	MemoryBytes uint64    `json:"mem_bytes"`
+	MemoryLimit uint64    `json:"mem_limit_bytes"`
+	NetBytes    uint64    `json:"net_bytes"`  // cumulative bytes received and sent
+	DiskBytes   uint64    `json:"disk_bytes"` // cumulative bytes read and written
+}
+
+// perfSampleWriter writes samples as newline-delimited JSON, one unbuffered write per sample
+type perfSampleWriter struct {
+	w io.Writer
+}
+
+// write records the stats of a container, previous holding its samples read so far
+func (s *perfSampleWriter) write(c api.ContainerSummary, stats container.StatsResponse, previous []container.StatsResponse) error {
+	sample := perfSample{
+		Timestamp:   stats.Read,
+		Service:     c.Service,
+		Container:   cmp.Or(strings.TrimPrefix(c.Name, "/"), c.ID),
+		MemoryBytes: stats.MemoryStats.Usage,
+		MemoryLimit: stats.MemoryStats.Limit,
+		NetBytes:    statsNetworkBytes(stats),
+		DiskBytes:   statsDiskBytes(stats),
+	}
+	if sample.Timestamp.IsZero() {
+		sample.Timestamp = time.Now()
+	}
+	switch {
+	case len(previous) > 0:
+		cpu := cpuPercentBetween(previous[len(previous)-1], stats)
+		sample.CPUPercent = &cpu
+	case stats.PreCPUStats.SystemUsage > 0:
+		cpu := sampleCPUPercent(stats)
+		sample.CPUPercent = &cpu
+	}
+	line, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write sample: %v", err)
+	}
 	return nil
 }
 
-func generatePerfReport(ctx context.Context, project *types.Project, opts *perfOptions) error {
+func readContainerStats(ctx context.Context, dockerCli command.Cli, containerID string) (container.StatsResponse, error) {
+	var stats container.StatsResponse
+	response, err := dockerCli.Client().ContainerStatsOneShot(ctx, containerID)
+	if err != nil {
+		return stats, err
+	}
+	defer response.Body.Close() //nolint:errcheck
+	err = json.NewDecoder(response.Body).Decode(&stats)
+	return stats, err
+}
+
+// counterDelta returns the growth of a cumulative cgroup counter, treating a reset (container restart) as no growth
+func counterDelta(start, last uint64) uint64 {
+	if last < start {
+		return 0
+	}
+	return last - start
+}
+
+// cpuPercentBetween computes CPU usage, relative to a single core, between two stats readings
+func cpuPercentBetween(start, last container.StatsResponse) float64 {
+	cpuDelta := float64(last.CPUStats.CPUUsage.TotalUsage) - float64(start.CPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(last.CPUStats.SystemUsage) - float64(start.CPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	onlineCPUs := float64(last.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(last.CPUStats.CPUUsage.PercpuUsage))
+	}
+	return cpuDelta / systemDelta * onlineCPUs * 100
+}
+
+// sampleCPUPercent computes CPU usage from a stats sample holding the previous CPU reading
+func sampleCPUPercent(stats container.StatsResponse) float64 {
+	return cpuPercentBetween(container.StatsResponse{CPUStats: stats.PreCPUStats}, stats)
+}
+
+// statsNetworkBytes sums the bytes received and sent on all the container interfaces
+func statsNetworkBytes(stats container.StatsResponse) uint64 {
+	var total uint64
+	for _, n := range stats.Networks {
+		total += n.RxBytes + n.TxBytes
+	}
+	return total
+}
+
+// statsDiskBytes sums the bytes read and written by the container on block devices
+func statsDiskBytes(stats container.StatsResponse) uint64 {
+	var total uint64
+	for _, entry := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read", "write":
+			total += entry.Value
+		}
+	}
+	return total
+}
+
+// perfUnmappedDevice names the I/O of a device no mount of the service is on, typically the
+// container filesystem
+const perfUnmappedDevice = "(container filesystem)"
+
+// perfMountIO is the disk I/O of a service on a block device, attributed to the mounts it backs.
+// cgroups only account I/O per device, so mounts sharing a device share its I/O.
+type perfMountIO struct {
+	Device     string   `json:"device"` // major:minor
+	Mounts     []string `json:"mounts"` // container paths of the mounts on the device
+	ReadBytes  uint64   `json:"readBytes"`
+	WriteBytes uint64   `json:"writeBytes"`
+	ReadOps    uint64   `json:"readOps"`
+	WriteOps   uint64   `json:"writeOps"`
+}
+
+// mountDevices maps the devices holding the sources of the container mounts to their container
+// paths, mounts whose source can't be resolved from this host being left out
+func mountDevices(mounts []container.MountPoint) map[string][]string {
+	devices := map[string][]string{}
+	for _, m := range mounts {
+		if m.Source == "" {
+			continue
+		}
+		if device, ok := pathDevice(m.Source); ok {
+			devices[device] = append(devices[device], m.Destination)
+		}
+	}
+	return devices
+}
+
+// blockDiskDevice returns the major:minor number of the disk a partition belongs to, from the
+// sysfs mounted on sysfs, as blkio stats account the I/O of partitions to their disk. Other
+// devices, and partitions whose disk can't be resolved, are returned as-is.
+func blockDiskDevice(sysfs, device string) string {
+	// /sys/dev/block/MAJ:MIN links to the device directory, nested in the disk one for a partition
+	dir, err := filepath.EvalSymlinks(filepath.Join(sysfs, "dev", "block", device))
+	if err != nil {
+		return device
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partition")); err != nil {
+		return device
+	}
+	disk, err := os.ReadFile(filepath.Join(filepath.Dir(dir), "dev"))
+	if err != nil {
+		return device
+	}
+	return strings.TrimSpace(string(disk))
+}
+
+// statsDeviceIO returns the cumulative I/O counters of the container per device
+func statsDeviceIO(stats container.StatsResponse) map[string]*perfMountIO {
+	devices := map[string]*perfMountIO{}
+	device := func(major, minor uint64) *perfMountIO {
+		key := fmt.Sprintf("%d:%d", major, minor)
+		if devices[key] == nil {
+			devices[key] = &perfMountIO{Device: key}
+		}
+		return devices[key]
+	}
+	for _, entry := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			device(entry.Major, entry.Minor).ReadBytes += entry.Value
+		case "write":
+			device(entry.Major, entry.Minor).WriteBytes += entry.Value
+		}
+	}
+	for _, entry := range stats.BlkioStats.IoServicedRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			device(entry.Major, entry.Minor).ReadOps += entry.Value
+		case "write":
+			device(entry.Major, entry.Minor).WriteOps += entry.Value
+		}
+	}
+	return devices
+}
+
+// deviceIOBetween returns the I/O of the container per device between two readings, attributed
+// to the mounts on each device
+func deviceIOBetween(start, last container.StatsResponse, mounts map[string][]string) []perfMountIO {
+	before := statsDeviceIO(start)
+	var entries []perfMountIO
+	for key, counters := range statsDeviceIO(last) {
+		delta := perfMountIO{Device: key, Mounts: mounts[key]}
+		previous := before[key]
+		if previous == nil {
+			previous = &perfMountIO{}
+		}
+		delta.ReadBytes = counterDelta(previous.ReadBytes, counters.ReadBytes)
+		delta.WriteBytes = counterDelta(previous.WriteBytes, counters.WriteBytes)
+		delta.ReadOps = counterDelta(previous.ReadOps, counters.ReadOps)
+		delta.WriteOps = counterDelta(previous.WriteOps, counters.WriteOps)
+		if len(delta.Mounts) == 0 {
+			delta.Mounts = []string{perfUnmappedDevice}
+		}
+		entries = append(entries, delta)
+	}
+	return entries
+}
+
+// mergeMountIO adds the I/O of a container to the one of the other containers of the service
+func mergeMountIO(total, entries []perfMountIO) []perfMountIO {
+	for _, entry := range entries {
+		i := slices.IndexFunc(total, func(t perfMountIO) bool { return t.Device == entry.Device })
+		if i < 0 {
+			entry.Mounts = slices.Clone(entry.Mounts)
+			total = append(total, entry)
+			continue
+		}
+		for _, m := range entry.Mounts {
+			if !slices.Contains(total[i].Mounts, m) {
+				total[i].Mounts = append(total[i].Mounts, m)
+			}
+		}
+		total[i].ReadBytes += entry.ReadBytes
+		total[i].WriteBytes += entry.WriteBytes
+		total[i].ReadOps += entry.ReadOps
+		total[i].WriteOps += entry.WriteOps
+	}
+	return total
+}
+
+// sortMountIO sorts the devices by bytes written then read, the hottest first
+func sortMountIO(entries []perfMountIO) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].WriteBytes != entries[j].WriteBytes {
+			return entries[i].WriteBytes > entries[j].WriteBytes
+		}
+		if entries[i].ReadBytes != entries[j].ReadBytes {
+			return entries[i].ReadBytes > entries[j].ReadBytes
+		}
+		return entries[i].Device < entries[j].Device
+	})
+}
+
+func printMountIO(w io.Writer, mountIO []perfMountIO) {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "  MOUNT\tDEVICE\tREAD\tWRITTEN\tREAD OPS\tWRITE OPS")
+	for _, m := range mountIO {
+		_, _ = fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%d\t%d\n", strings.Join(m.Mounts, ", "), m.Device,
+			units.BytesSize(float64(m.ReadBytes)), units.BytesSize(float64(m.WriteBytes)), m.ReadOps, m.WriteOps)
+	}
+	_ = tw.Flush()
+}
+
+// perfMountSuggestion suggests faster storage for the mount of a service doing most of its disk
+// I/O, nothing when the I/O is on the container filesystem or spread over devices
+func perfMountSuggestion(result *servicePerfResult) string {
+	if len(result.MountIO) == 0 {
+		return ""
+	}
+	var total uint64
+	for _, m := range result.MountIO {
+		total += m.ReadBytes + m.WriteBytes
+	}
+	hottest := result.MountIO[0]
+	hot := hottest.ReadBytes + hottest.WriteBytes
+	if hot == 0 || slices.Contains(hottest.Mounts, perfUnmappedDevice) || float64(hot) < float64(total)*perfHotMountShare {
+		return ""
+	}
+	return fmt.Sprintf("%s of %s does %.0f%% of its disk I/O (%s written, %s read), move it to a faster volume driver or storage",
+		strings.Join(hottest.Mounts, ", "), result.Service, float64(hot)/float64(total)*100,
+		units.BytesSize(float64(hottest.WriteBytes)), units.BytesSize(float64(hottest.ReadBytes)))
+}
+
+// perfHotMountShare is the share of the disk I/O of a service above which a mount is reported as a hotspot
+const perfHotMountShare = 0.5
+
+// perfRankings lists the resources services can be ranked by with --top
+var perfRankings = []string{"cpu", "mem", "net", "disk"}
+
+// perfTopEntry is a row of the --top ranking
+type perfTopEntry struct {
+	Rank         int     `json:"rank"`
+	Service      string  `json:"service"`
+	CPUPercent   float64 `json:"cpuPercent"`
+	MemoryUsage  uint64  `json:"memoryUsage"`
+	NetworkBytes uint64  `json:"networkBytes"`
+	DiskBytes    uint64  `json:"diskBytes"`
+}
+
+// rankPerfResults sorts the results by decreasing usage of the resource and keeps the first top ones
+func rankPerfResults(results []*servicePerfResult, by string, top int) []perfTopEntry {
+	usage := func(r *servicePerfResult) float64 {
+		switch by {
+		case "mem":
+			return float64(r.MemoryUsage)
+		case "net":
+			return float64(r.NetworkBytes)
+		case "disk":
+			return float64(r.DiskBytes)
+		default:
+			return r.CPUPercent
+		}
+	}
+	sorted := slices.Clone(results)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if usage(sorted[i]) != usage(sorted[j]) {
+			return usage(sorted[i]) > usage(sorted[j])
+		}
+		return sorted[i].Service < sorted[j].Service
+	})
+
+	entries := make([]perfTopEntry, 0, min(top, len(sorted)))
+	for i, r := range sorted[:min(top, len(sorted))] {
+		entries = append(entries, perfTopEntry{
+			Rank:         i + 1,
+			Service:      r.Service,
+			CPUPercent:   r.CPUPercent,
+			MemoryUsage:  r.MemoryUsage,
+			NetworkBytes: r.NetworkBytes,
+			DiskBytes:    r.DiskBytes,
+		})
+	}
+	return entries
+}
+
+func printPerfTop(w io.Writer, entries []perfTopEntry, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "RANK\tSERVICE\tCPU %\tMEMORY\tNET I/O\tDISK I/O")
+	for _, e := range entries {
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%.1f\t%s\t%s\t%s\n", e.Rank, e.Service, e.CPUPercent,
+			units.BytesSize(float64(e.MemoryUsage)), units.BytesSize(float64(e.NetworkBytes)), units.BytesSize(float64(e.DiskBytes)))
+	}
+	return tw.Flush()
+}
+
+// perfWarnings reports resource limits that are too tight for the observed workload
+func perfWarnings(result *servicePerfResult) []string {
+	var warnings []string
+	if result.ThrottleRatio >= throttleWarningRatio {
+		warnings = append(warnings, fmt.Sprintf("%s throttled %.0f%% of sampling window — CPU limit too low",
+			result.Service, result.ThrottleRatio*100))
+	}
+	if result.MemoryFailcnt > 0 {
+		warnings = append(warnings, fmt.Sprintf("%s hit its memory limit %d times — memory limit too low",
+			result.Service, result.MemoryFailcnt))
+	}
+	if result.OOMKilled {
+		warnings = append(warnings, fmt.Sprintf("%s was OOM killed — memory limit too low", result.Service))
+	}
+	if trend := result.MemoryTrend; trend != nil && trend.SuspectedLeak {
+		warning := fmt.Sprintf("%s memory grows by %.2f MB/min — suspected memory leak", result.Service, trend.SlopeMBPerMinute)
+		if trend.TimeToLimit > 0 {
+			warning += fmt.Sprintf(", limit reached in ~%s", trend.TimeToLimit.Round(time.Minute))
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
+
+// memoryTrend is the linear trend of a service memory usage over the sampling window
+type memoryTrend struct {
+	SlopeMBPerMinute float64
+	// Monotonic is true when memory grew, or stayed flat, from every sample to the next
+	Monotonic     bool
+	SuspectedLeak bool
+	// TimeToLimit is the projected time until the memory limit is reached, zero when not growing
+	TimeToLimit time.Duration
+}
+
+// fitMemoryTrend fits a least squares line through the memory samples. A service is suspected of
+// leaking when its memory grows monotonically faster than threshold MB/min.
+func fitMemoryTrend(offsets []time.Duration, memory []uint64, limit uint64, threshold float64) *memoryTrend {
+	n := float64(len(memory))
+	var sumX, sumY, sumXY, sumXX float64
+	trend := &memoryTrend{Monotonic: true}
+	for i, m := range memory {
+		x, y := offsets[i].Minutes(), float64(m)/(1<<20)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+		if i > 0 && m < memory[i-1] {
+			trend.Monotonic = false
+		}
+	}
+	if denominator := n*sumXX - sumX*sumX; denominator != 0 {
+		trend.SlopeMBPerMinute = (n*sumXY - sumX*sumY) / denominator
+	}
+	trend.SuspectedLeak = trend.Monotonic && trend.SlopeMBPerMinute > threshold
+
+	last := memory[len(memory)-1]
+	if trend.SlopeMBPerMinute > 0 && limit > last {
+		minutes := float64(limit-last) / (1 << 20) / trend.SlopeMBPerMinute
+		trend.TimeToLimit = time.Duration(minutes * float64(time.Minute))
+	}
+	return trend
+}
+
+// statsMemoryWithoutCache returns the memory usage minus the inactive page cache, like docker stats does
+func statsMemoryWithoutCache(stats container.StatsResponse) uint64 {
+	usage := stats.MemoryStats.Usage
+	// cgroup v1 reports total_inactive_file, cgroup v2 inactive_file
+	for _, key := range []string{"total_inactive_file", "inactive_file"} {
+		if cache, ok := stats.MemoryStats.Stats[key]; ok {
+			if cache < usage {
+				return usage - cache
+			}
+			return usage
+		}
+	}
+	return usage
+}
+
+// printMemoryTrends prints the memory trend of every service analyzed with --leak-check
+func printMemoryTrends(w io.Writer, results []*servicePerfResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SERVICE\tTREND (MB/min)\tMONOTONIC\tTIME TO LIMIT\tSTATUS")
+	for _, r := range results {
+		if r.MemoryTrend == nil {
+			continue
+		}
+		timeToLimit, status := "-", "ok"
+		if r.MemoryTrend.TimeToLimit > 0 {
+			timeToLimit = r.MemoryTrend.TimeToLimit.Round(time.Minute).String()
+		}
+		if r.MemoryTrend.SuspectedLeak {
+			status = "suspected leak"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%+.2f\t%t\t%s\t%s\n", r.Service, r.MemoryTrend.SlopeMBPerMinute, r.MemoryTrend.Monotonic, timeToLimit, status)
+	}
+	_ = tw.Flush()
+}
+
+func generatePerfReport(ctx context.Context, project *types.Project, opts *perfOptions, results []*servicePerfResult) error {
 	// Simplified implementation - in real code, this would generate actual reports
 	if !opts.quiet {
 		fmt.Println("Generating performance report")
 		fmt.Printf("Report format: %s\n", opts.format)
+		for _, result := range results {
+			for _, warning := range result.Warnings {
+				fmt.Printf("Warning: %s\n", warning)
+			}
+		}
 	}
 
 	// For demo purposes, just return success
 	return nil
 }
 
-func generateOptimizationSuggestions(ctx context.Context, project *types.Project, opts *perfOptions) error {
+func generateOptimizationSuggestions(ctx context.Context, project *types.Project, opts *perfOptions, results []*servicePerfResult) error {
 	// Simplified implementation - in real code, this would generate actual suggestions
 	if !opts.quiet {
 		fmt.Println("Generating optimization suggestions")
+		for _, result := range results {
+			for _, warning := range result.Warnings {
+				fmt.Printf("- %s\n", warning)
+			}
+		}
+		for _, result := range results {
+			if suggestion := perfMountSuggestion(result); suggestion != "" {
+				fmt.Printf("- %s\n", suggestion)
+			}
+		}
 		fmt.Println("\nOptimization suggestions:")
 		fmt.Println("1. Reduce container memory limit to 256MB")
 		fmt.Println("2. Use a more efficient base image")
@@ -239,6 +1056,109 @@ func generateOptimizationSuggestions(ctx context.Context, project *types.Project
 		fmt.Println("5. Use caching for frequently accessed data")
 	}
 
-	// For demo purposes, just return success
+	if opts.writeOverride {
+		return writePerfOverride(project, opts, results)
+	}
 	return nil
 }
+
+// perfOverrideFile is the compose override written with --write-override
+const perfOverrideFile = "compose.perf-tuned.yaml"
+
+// perfMinMemory is the lowest memory limit accepted by the engine
+const perfMinMemory = 6 << 20
+
+// perfPercentile returns the p-th percentile of values, using the nearest rank
+func perfPercentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
+
+// perfResources is the deploy.resources recommended for a service
+type perfResources struct {
+	ReservationCPUs   float64
+	ReservationMemory uint64
+	LimitCPUs         float64
+	LimitMemory       uint64
+}
+
+// recommendPerfResources derives the resources of a service from its measured p95 usage: reserved as
+// measured, limited with headroom percent on top. CPUs are rounded up to a hundredth of a core and
+// memory up to a MB.
+func recommendPerfResources(result *servicePerfResult, headroom int) perfResources {
+	cpus := func(percent float64) float64 {
+		return max(math.Ceil(percent), 1) / 100
+	}
+	memory := func(bytes float64) uint64 {
+		return max(uint64(math.Ceil(bytes/(1<<20)))<<20, perfMinMemory)
+	}
+	factor := 1 + float64(headroom)/100
+	return perfResources{
+		ReservationCPUs:   cpus(result.CPUP95),
+		ReservationMemory: memory(float64(result.MemoryP95)),
+		LimitCPUs:         cpus(result.CPUP95 * factor),
+		LimitMemory:       memory(float64(result.MemoryP95) * factor),
+	}
+}
+
+// writePerfOverride writes the resources recommended for the analyzed services to perfOverrideFile
+func writePerfOverride(project *types.Project, opts *perfOptions, results []*servicePerfResult) error {
+	if len(results) == 0 {
+		return fmt.Errorf("no service could be analyzed, %s not written", perfOverrideFile)
+	}
+	file := filepath.Join(project.WorkingDir, perfOverrideFile)
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", file, err)
+	}
+	defer f.Close() //nolint:errcheck
+	if err := renderPerfOverride(f, opts, results); err != nil {
+		return fmt.Errorf("failed to write %s: %v", file, err)
+	}
+	if !opts.quiet {
+		fmt.Printf("Resource recommendations for %d service(s) written to %s\n", len(results), file)
+		fmt.Printf("Apply them with: docker compose -f compose.yaml -f %s up\n", perfOverrideFile)
+	}
+	return nil
+}
+
+// renderPerfOverride renders the recommended resources as a compose override file, each service
+// commented with the measurements it is derived from
+func renderPerfOverride(w io.Writer, opts *perfOptions, results []*servicePerfResult) error {
+	sorted := slices.Clone(results)
+	slices.SortFunc(sorted, func(a, b *servicePerfResult) int { return strings.Compare(a.Service, b.Service) })
+
+	var b strings.Builder
+	b.WriteString("# Resources recommended by `docker compose perf --write-override`.\n")
+	fmt.Fprintf(&b, "# Reservations are the p95 usage measured per container, limits add %d%% headroom.\n", opts.headroom)
+	switch {
+	case opts.snapshot:
+		b.WriteString("# Measured from a single snapshot, run with a --duration for reliable numbers.\n")
+	case opts.duration == 0:
+		fmt.Fprintf(&b, "# Measured over %s until interrupted, sampled every %ds.\n", opts.measured.Truncate(time.Second), opts.interval)
+	default:
+		fmt.Fprintf(&b, "# Measured over %ds, sampled every %ds.\n", opts.duration, opts.interval)
+	}
+	b.WriteString("services:\n")
+	for _, result := range sorted {
+		resources := recommendPerfResources(result, opts.headroom)
+		fmt.Fprintf(&b, "  %s:\n", result.Service)
+		b.WriteString("    deploy:\n")
+		b.WriteString("      resources:\n")
+		fmt.Fprintf(&b, "        # measured over %d sample(s): CPU p95 %.1f%%, memory p95 %dMB (peak %dMB)\n",
+			result.Samples, result.CPUP95, result.MemoryP95>>20, result.PeakMemoryUsage>>20)
+		b.WriteString("        limits:\n")
+		fmt.Fprintf(&b, "          cpus: \"%.2f\"\n", resources.LimitCPUs)
+		fmt.Fprintf(&b, "          memory: %dM\n", resources.LimitMemory>>20)
+		b.WriteString("        reservations:\n")
+		fmt.Fprintf(&b, "          cpus: \"%.2f\"\n", resources.ReservationCPUs)
+		fmt.Fprintf(&b, "          memory: %dM\n", resources.ReservationMemory>>20)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
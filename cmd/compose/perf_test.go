@@ -0,0 +1,348 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dockercli "github.com/docker/cli/cli"
+	"github.com/docker/docker/api/types/container"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestAdaptPerf(t *testing.T) {
+	interrupted, cancel := context.WithCancel(context.Background())
+	cancel()
+	cmd := &cobra.Command{}
+	cmd.SetContext(interrupted)
+
+	// the report was produced from the samples collected until interrupted
+	err := adaptPerf(func(ctx context.Context, args []string) error { return nil })(cmd, nil)
+	require.NoError(t, err)
+
+	err = adaptPerf(func(ctx context.Context, args []string) error { return ctx.Err() })(cmd, nil)
+	assert.Equal(t, dockercli.StatusError{StatusCode: 130}, err)
+}
+
+func TestPerfWarnings(t *testing.T) {
+	assert.Empty(t, perfWarnings(&servicePerfResult{Service: "web", ThrottleRatio: 0.05}))
+
+	warnings := perfWarnings(&servicePerfResult{
+		Service:       "web",
+		ThrottleRatio: 0.34,
+		MemoryFailcnt: 2,
+		OOMKilled:     true,
+	})
+	assert.Equal(t, []string{
+		"web throttled 34% of sampling window — CPU limit too low",
+		"web hit its memory limit 2 times — memory limit too low",
+		"web was OOM killed — memory limit too low",
+	}, warnings)
+}
+
+func TestCounterDelta(t *testing.T) {
+	assert.Equal(t, uint64(5), counterDelta(10, 15))
+	assert.Equal(t, uint64(0), counterDelta(15, 3))
+}
+
+func TestValidatePerfTiming(t *testing.T) {
+	assert.NoError(t, validatePerfTiming(30, 1))
+	assert.NoError(t, validatePerfTiming(0, 5))
+	assert.NoError(t, validatePerfTiming(5, 5))
+	assert.ErrorContains(t, validatePerfTiming(-1, 1), "--duration must not be negative")
+	assert.ErrorContains(t, validatePerfTiming(30, 0), "--interval must be greater than 0")
+	assert.ErrorContains(t, validatePerfTiming(0, 0), "--interval must be greater than 0")
+	assert.ErrorContains(t, validatePerfTiming(5, 10), "must not exceed --duration")
+}
+
+func TestPerfSampleOffsets(t *testing.T) {
+	assert.Nil(t, perfSampleOffsets(0, 1), "sampled until interrupted")
+	assert.Equal(t, []time.Duration{0}, (&perfOptions{snapshot: true, duration: 30, interval: 1}).sampleOffsets())
+	assert.Equal(t, []time.Duration{0, 2 * time.Second, 4 * time.Second, 5 * time.Second}, perfSampleOffsets(5, 2))
+	assert.Equal(t, []time.Duration{0, 3 * time.Second}, perfSampleOffsets(3, 3))
+}
+
+func TestStatsIOBytes(t *testing.T) {
+	stats := container.StatsResponse{
+		Networks: map[string]container.NetworkStats{"eth0": {RxBytes: 100, TxBytes: 50}, "eth1": {RxBytes: 10}},
+		BlkioStats: container.BlkioStats{IoServiceBytesRecursive: []container.BlkioStatEntry{
+			{Op: "Read", Value: 1000}, {Op: "write", Value: 200}, {Op: "Total", Value: 1200},
+		}},
+	}
+	assert.Equal(t, uint64(160), statsNetworkBytes(stats))
+	assert.Equal(t, uint64(1200), statsDiskBytes(stats))
+}
+
+func TestDeviceIO(t *testing.T) {
+	reading := func(read, written, ops uint64) container.StatsResponse {
+		return container.StatsResponse{BlkioStats: container.BlkioStats{
+			IoServiceBytesRecursive: []container.BlkioStatEntry{
+				{Major: 8, Minor: 0, Op: "read", Value: read},
+				{Major: 8, Minor: 0, Op: "write", Value: written},
+				{Major: 8, Minor: 16, Op: "Write", Value: written / 10},
+				{Major: 8, Minor: 16, Op: "Total", Value: written / 10},
+			},
+			IoServicedRecursive: []container.BlkioStatEntry{
+				{Major: 8, Minor: 0, Op: "write", Value: ops},
+			},
+		}}
+	}
+	mounts := map[string][]string{"8:0": {"/var/lib/postgresql/data"}}
+	db := deviceIOBetween(reading(10, 1000, 5), reading(30, 9000, 25), mounts)
+	replica := deviceIOBetween(reading(0, 0, 0), reading(0, 1000, 1), mounts)
+	io := mergeMountIO(mergeMountIO(nil, db), replica)
+	sortMountIO(io)
+	assert.Equal(t, []perfMountIO{
+		{Device: "8:0", Mounts: []string{"/var/lib/postgresql/data"}, ReadBytes: 20, WriteBytes: 9000, WriteOps: 21},
+		{Device: "8:16", Mounts: []string{perfUnmappedDevice}, WriteBytes: 900},
+	}, io)
+
+	result := &servicePerfResult{Service: "db", MountIO: io}
+	assert.Equal(t, "/var/lib/postgresql/data of db does 91% of its disk I/O (8.789KiB written, 20B read), move it to a faster volume driver or storage",
+		perfMountSuggestion(result))
+
+	// the container filesystem, or I/O spread over devices, is no mount hotspot
+	result.MountIO = []perfMountIO{io[1], io[0]}
+	assert.Empty(t, perfMountSuggestion(result))
+	result.MountIO = []perfMountIO{{Device: "8:0", Mounts: []string{"/data"}, WriteBytes: 40}, {Device: "8:16", Mounts: []string{"/logs"}, WriteBytes: 60}}
+	assert.Empty(t, perfMountSuggestion(result))
+	assert.Empty(t, perfMountSuggestion(&servicePerfResult{Service: "web"}))
+
+	var buf bytes.Buffer
+	printMountIO(&buf, io[:1])
+	assert.Equal(t, "  MOUNT                      DEVICE   READ   WRITTEN    READ OPS   WRITE OPS\n"+
+		"  /var/lib/postgresql/data   8:0      20B    8.789KiB   0          21\n", buf.String())
+}
+
+func TestMountDevices(t *testing.T) {
+	dir := t.TempDir()
+	device, ok := pathDevice(dir)
+	if !ok {
+		t.Skip("block devices can't be resolved on this platform")
+	}
+	devices := mountDevices([]container.MountPoint{
+		{Source: dir, Destination: "/data"},
+		{Source: "", Destination: "/tmpfs"},
+		{Source: dir + "/missing", Destination: "/missing"},
+	})
+	assert.Equal(t, map[string][]string{device: {"/data"}}, devices)
+}
+
+func TestBlockDiskDevice(t *testing.T) {
+	sysfs := t.TempDir()
+	disk := filepath.Join(sysfs, "devices", "pci0000:00", "block", "sda")
+	require.NoError(t, os.MkdirAll(filepath.Join(disk, "sda1"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(disk, "dev"), []byte("8:0\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(disk, "sda1", "dev"), []byte("8:1\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(disk, "sda1", "partition"), []byte("1\n"), 0o644))
+	mapper := filepath.Join(sysfs, "devices", "virtual", "block", "dm-0")
+	require.NoError(t, os.MkdirAll(mapper, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(mapper, "dev"), []byte("253:0\n"), 0o644))
+	links := filepath.Join(sysfs, "dev", "block")
+	require.NoError(t, os.MkdirAll(links, 0o755))
+	for device, target := range map[string]string{
+		"8:0":   "../../devices/pci0000:00/block/sda",
+		"8:1":   "../../devices/pci0000:00/block/sda/sda1",
+		"253:0": "../../devices/virtual/block/dm-0",
+	} {
+		if err := os.Symlink(target, filepath.Join(links, device)); err != nil {
+			t.Skipf("symbolic links are not supported: %v", err)
+		}
+	}
+
+	assert.Equal(t, "8:0", blockDiskDevice(sysfs, "8:1"), "a partition is accounted to its disk")
+	assert.Equal(t, "8:0", blockDiskDevice(sysfs, "8:0"))
+	assert.Equal(t, "253:0", blockDiskDevice(sysfs, "253:0"))
+	assert.Equal(t, "0:42", blockDiskDevice(sysfs, "0:42"), "devices unknown to sysfs are kept")
+}
+
+func TestRankPerfResults(t *testing.T) {
+	results := []*servicePerfResult{
+		{Service: "db", CPUPercent: 20, MemoryUsage: 512 << 20},
+		{Service: "web", CPUPercent: 80, MemoryUsage: 64 << 20},
+		{Service: "worker", CPUPercent: 20, MemoryUsage: 128 << 20},
+	}
+	top := rankPerfResults(results, "cpu", 2)
+	require.Len(t, top, 2)
+	assert.Equal(t, perfTopEntry{Rank: 1, Service: "web", CPUPercent: 80, MemoryUsage: 64 << 20}, top[0])
+	assert.Equal(t, "db", top[1].Service)
+
+	top = rankPerfResults(results, "mem", 10)
+	assert.Equal(t, []string{"db", "worker", "web"}, []string{top[0].Service, top[1].Service, top[2].Service})
+
+	var buf bytes.Buffer
+	require.NoError(t, printPerfTop(&buf, top[:1], "text"))
+	assert.Equal(t, "RANK   SERVICE   CPU %   MEMORY   NET I/O   DISK I/O\n"+
+		"1      db        20.0    512MiB   0B        0B\n", buf.String())
+}
+
+func TestFitMemoryTrend(t *testing.T) {
+	offsets := perfSampleOffsets(120, 60)
+	const mb = 1 << 20
+
+	// 100MB -> 110MB -> 120MB over two minutes, with a 520MB limit
+	trend := fitMemoryTrend(offsets, []uint64{100 * mb, 110 * mb, 120 * mb}, 520*mb, 1)
+	assert.InDelta(t, 10, trend.SlopeMBPerMinute, 0.001)
+	assert.True(t, trend.Monotonic)
+	assert.True(t, trend.SuspectedLeak)
+	assert.Equal(t, 40*time.Minute, trend.TimeToLimit)
+	assert.Equal(t, []string{"web memory grows by 10.00 MB/min — suspected memory leak, limit reached in ~40m0s"},
+		perfWarnings(&servicePerfResult{Service: "web", MemoryTrend: trend}))
+
+	// growing overall but released in between: not a leak
+	trend = fitMemoryTrend(offsets, []uint64{100 * mb, 90 * mb, 130 * mb}, 0, 1)
+	assert.False(t, trend.Monotonic)
+	assert.False(t, trend.SuspectedLeak)
+	assert.Zero(t, trend.TimeToLimit)
+
+	// steady growth below the threshold
+	trend = fitMemoryTrend(offsets, []uint64{100 * mb, 100 * mb, 101 * mb}, 0, 1)
+	assert.True(t, trend.Monotonic)
+	assert.False(t, trend.SuspectedLeak)
+
+	stats := container.StatsResponse{}
+	stats.MemoryStats.Usage = 300
+	stats.MemoryStats.Stats = map[string]uint64{"inactive_file": 100}
+	assert.Equal(t, uint64(200), statsMemoryWithoutCache(stats))
+}
+
+func TestPerfPercentile(t *testing.T) {
+	assert.Zero(t, perfPercentile(nil, 95))
+	assert.Equal(t, 7.0, perfPercentile([]float64{7}, 95))
+	values := make([]float64, 0, 20)
+	for i := 20; i >= 1; i-- {
+		values = append(values, float64(i))
+	}
+	assert.Equal(t, 19.0, perfPercentile(values, 95))
+	assert.Equal(t, 10.0, perfPercentile(values, 50))
+	assert.Equal(t, 20.0, values[0], "values are not sorted in place")
+}
+
+func TestRenderPerfOverride(t *testing.T) {
+	const mb = 1 << 20
+	results := []*servicePerfResult{
+		{Service: "web", Samples: 31, CPUP95: 42.3, MemoryP95: 200 * mb, PeakMemoryUsage: 230 * mb},
+		{Service: "db", Samples: 31, CPUP95: 0, MemoryP95: 1 * mb, PeakMemoryUsage: 2 * mb},
+	}
+	assert.Equal(t, perfResources{ReservationCPUs: 0.43, ReservationMemory: 200 * mb, LimitCPUs: 0.55, LimitMemory: 260 * mb},
+		recommendPerfResources(results[0], 30))
+	assert.Equal(t, perfResources{ReservationCPUs: 0.01, ReservationMemory: perfMinMemory, LimitCPUs: 0.01, LimitMemory: perfMinMemory},
+		recommendPerfResources(results[1], 30))
+
+	var buf bytes.Buffer
+	require.NoError(t, renderPerfOverride(&buf, &perfOptions{duration: 0, interval: 5, headroom: 30, measured: 95 * time.Second}, results[:0]))
+	assert.Contains(t, buf.String(), "# Measured over 1m35s until interrupted, sampled every 5s.\n")
+	buf.Reset()
+	require.NoError(t, renderPerfOverride(&buf, &perfOptions{duration: 30, interval: 1, headroom: 30}, results))
+	assert.Equal(t, "# Resources recommended by `docker compose perf --write-override`.\n"+
+		"# Reservations are the p95 usage measured per container, limits add 30% headroom.\n"+
+		"# Measured over 30s, sampled every 1s.\n"+
+		"services:\n"+
+		"  db:\n"+
+		"    deploy:\n"+
+		"      resources:\n"+
+		"        # measured over 31 sample(s): CPU p95 0.0%, memory p95 1MB (peak 2MB)\n"+
+		"        limits:\n"+
+		"          cpus: \"0.01\"\n"+
+		"          memory: 6M\n"+
+		"        reservations:\n"+
+		"          cpus: \"0.01\"\n"+
+		"          memory: 6M\n"+
+		"  web:\n"+
+		"    deploy:\n"+
+		"      resources:\n"+
+		"        # measured over 31 sample(s): CPU p95 42.3%, memory p95 200MB (peak 230MB)\n"+
+		"        limits:\n"+
+		"          cpus: \"0.55\"\n"+
+		"          memory: 260M\n"+
+		"        reservations:\n"+
+		"          cpus: \"0.43\"\n"+
+		"          memory: 200M\n", buf.String())
+}
+
+func TestSamplePerfStatsUntilInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctrl := gomock.NewController(t)
+	cli := mocks.NewMockCli(ctrl)
+	apiClient := mocks.NewMockAPIClient(ctrl)
+	cli.EXPECT().Client().Return(apiClient).AnyTimes()
+	reads := 0
+	apiClient.EXPECT().ContainerStatsOneShot(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, id string) (container.StatsResponseReader, error) {
+		reads++
+		if reads == 5 {
+			// interrupted while reading the third round
+			cancel()
+			return container.StatsResponseReader{}, ctx.Err()
+		}
+		body := fmt.Sprintf(`{"memory_stats":{"usage":%d}}`, reads)
+		return container.StatsResponseReader{Body: io.NopCloser(strings.NewReader(body))}, nil
+	}).Times(5)
+
+	var buf bytes.Buffer
+	containers := []api.ContainerSummary{{ID: "a", Service: "web"}, {ID: "b", Service: "db"}}
+	samples, offsets, err := samplePerfStats(ctx, cli, containers, nil, time.Millisecond, &perfSampleWriter{w: &buf})
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{0, time.Millisecond}, offsets)
+	require.Len(t, samples["a"], 2)
+	require.Len(t, samples["b"], 2)
+	assert.Equal(t, uint64(3), samples["a"][1].MemoryStats.Usage)
+	assert.Equal(t, 4, strings.Count(buf.String(), "\n"), "the samples read are written")
+
+	apiClient.EXPECT().ContainerInspect(gomock.Any(), "b").Return(container.InspectResponse{}, fmt.Errorf("no such container"))
+	result := summarizeServicePerf(context.WithoutCancel(ctx), cli, "db", containers[1:], samples, offsets, &perfOptions{quiet: true, leakCheck: true})
+	assert.Equal(t, 2, result.Samples)
+	assert.Nil(t, result.MemoryTrend, "too few samples for a trend")
+}
+
+func TestPerfSampleWriter(t *testing.T) {
+	var buf bytes.Buffer
+	sampler := &perfSampleWriter{w: &buf}
+	c := api.ContainerSummary{ID: "abc", Name: "shop-web-1", Service: "web"}
+	read := time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC)
+
+	first := container.StatsResponse{}
+	first.Read = read
+	first.CPUStats.CPUUsage.TotalUsage = 100
+	first.CPUStats.SystemUsage = 1000
+	first.CPUStats.OnlineCPUs = 2
+	first.MemoryStats.Usage = 64 << 20
+	first.Networks = map[string]container.NetworkStats{"eth0": {RxBytes: 10, TxBytes: 5}}
+	second := first
+	second.Read = read.Add(time.Second)
+	second.CPUStats.CPUUsage.TotalUsage = 200
+	second.CPUStats.SystemUsage = 2000
+
+	require.NoError(t, sampler.write(c, first, nil))
+	require.NoError(t, sampler.write(c, second, []container.StatsResponse{first}))
+	assert.Equal(t, `{"timestamp":"2026-05-04T10:00:00Z","service":"web","container":"shop-web-1","mem_bytes":67108864,"mem_limit_bytes":0,"net_bytes":15,"disk_bytes":0}`+"\n"+
+		`{"timestamp":"2026-05-04T10:00:01Z","service":"web","container":"shop-web-1","cpu_percent":20,"mem_bytes":67108864,"mem_limit_bytes":0,"net_bytes":15,"disk_bytes":0}`+"\n", buf.String())
+}
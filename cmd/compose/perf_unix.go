@@ -0,0 +1,37 @@
+//go:build !windows
+
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// pathDevice returns the major:minor number of the block device holding path, as reported in
+// blkio stats: the disk of a partition. It only matches the daemon devices when running on the
+// daemon host.
+func pathDevice(path string) (string, bool) {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return "", false
+	}
+	dev := uint64(stat.Dev) //nolint:unconvert // Dev is not an uint64 on every platform
+	return blockDiskDevice("/sys", fmt.Sprintf("%d:%d", unix.Major(dev), unix.Minor(dev))), true
+}
@@ -19,7 +19,9 @@ package compose
 import (
 	"context"
 	"fmt"
+	"slices"
 
+	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/docker/cli/cli/command"
 	"github.com/spf13/cobra"
 
@@ -32,6 +34,7 @@ type quickOptions struct {
 	build    bool
 	pull     bool
 	detach   bool
+	recreate bool
 	services []string
 }
 
@@ -53,6 +56,14 @@ This command combines multiple operations into one:
 2. Build services (if needed)
 3. Start services in detached mode
 4. Show status and endpoints
+
+When every requested service is already running with its current configuration and
+image, pull, build and start are skipped. Use --recreate to run them anyway.
+
+Services of a profile are only started when the profile is enabled, with --profile before or
+after the command name (both add up) or, when no --profile is given, with COMPOSE_PROFILES
+from the environment or the .env file. Services named as arguments are enabled whatever their
+profile.
 `,
 		RunE: Adapt(func(ctx context.Context, args []string) error {
 			opts.services = args
@@ -60,9 +71,11 @@ This command combines multiple operations into one:
 		}),
 	}
 
+	opts.addProfileFlag(cmd.Flags())
 	cmd.Flags().BoolVar(&opts.build, "no-build", false, "Skip build step")
 	cmd.Flags().BoolVar(&opts.pull, "no-pull", false, "Skip pull step")
 	cmd.Flags().BoolVar(&opts.detach, "no-detach", false, "Do not start in detached mode")
+	cmd.Flags().BoolVar(&opts.recreate, "recreate", false, "Pull, build and recreate containers even if the stack is already running")
 	return cmd
 }
 
@@ -72,11 +85,22 @@ func runQuick(ctx context.Context, dockerCli command.Cli, backendOptions *Backen
 		return err
 	}
 
-	project, _, err := opts.ToProject(ctx, dockerCli, backend, nil)
+	project, _, err := opts.ToProject(ctx, dockerCli, backend, opts.services)
 	if err != nil {
 		return err
 	}
 
+	if !opts.recreate {
+		stale, err := staleQuickServices(ctx, dockerCli, backend, project)
+		if err != nil {
+			return err
+		}
+		if len(stale) == 0 {
+			fmt.Printf("Project %s is already running, skipping pull, build and start (use --recreate to force)\n", project.Name)
+			return printQuickSummary(ctx, backend, project, true)
+		}
+	}
+
 	// Step 1: Pull images if needed
 	if opts.pull {
 		fmt.Println("Pulling latest images...")
@@ -97,11 +121,19 @@ func runQuick(ctx context.Context, dockerCli command.Cli, backendOptions *Backen
 	// Step 3: Start services
 	fmt.Println("Starting services...")
 	uOptions := api.UpOptions{}
+	if opts.recreate {
+		uOptions.Create.Recreate = api.RecreateForce
+	}
 	if err := backend.Up(ctx, project, uOptions); err != nil {
 		return err
 	}
 
 	// Step 4: Show status and endpoints
+	return printQuickSummary(ctx, backend, project, false)
+}
+
+// printQuickSummary shows the status of the containers and the published endpoints
+func printQuickSummary(ctx context.Context, backend api.Compose, project *types.Project, alreadyRunning bool) error {
 	fmt.Println("\nServices status:")
 	containers, err := backend.Ps(ctx, project.Name, api.PsOptions{})
 	if err != nil {
@@ -123,6 +155,57 @@ func runQuick(ctx context.Context, dockerCli command.Cli, backendOptions *Backen
 		}
 	}
 
+	if alreadyRunning {
+		fmt.Printf("\nProject %s is already running!\n", project.Name)
+		return nil
+	}
 	fmt.Printf("\nProject %s is ready!\n", project.Name)
 	return nil
 }
+
+// staleQuickServices returns the services of the project which need pull, build or start
+func staleQuickServices(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project) ([]string, error) {
+	containers, err := backend.Ps(ctx, project.Name, api.PsOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	imageIDs := map[string]string{}
+	for _, service := range project.Services {
+		image, err := dockerCli.Client().ImageInspect(ctx, api.GetImageNameOrDefault(service, project.Name))
+		if err == nil {
+			imageIDs[service.Name] = image.ID
+		}
+	}
+	return quickStaleServices(project, containers, imageIDs)
+}
+
+// quickStaleServices compares the containers to the project: a service is up to date when all its
+// replicas are running with the current configuration hash and the local image of the service
+func quickStaleServices(project *types.Project, containers []api.ContainerSummary, imageIDs map[string]string) ([]string, error) {
+	var stale []string
+	for _, service := range project.Services {
+		hash, err := compose.ServiceHash(service)
+		if err != nil {
+			return nil, err
+		}
+		running := 0
+		current := imageIDs[service.Name] != ""
+		for _, container := range containers {
+			if container.Service != service.Name {
+				continue
+			}
+			if container.State != "running" ||
+				container.Labels[api.ConfigHashLabel] != hash ||
+				container.Labels[api.ImageDigestLabel] != imageIDs[service.Name] {
+				current = false
+				continue
+			}
+			running++
+		}
+		if !current || running != service.GetScale() {
+			stale = append(stale, service.Name)
+		}
+	}
+	slices.Sort(stale)
+	return stale, nil
+}
@@ -0,0 +1,66 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/compose"
+)
+
+func TestQuickStaleServices(t *testing.T) {
+	two := 2
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"web": {Name: "web", Image: "nginx"},
+		"api": {Name: "api", Image: "api", Scale: &two},
+		"db":  {Name: "db", Image: "postgres"},
+	}}
+	labels := func(service string, image string) map[string]string {
+		hash, err := compose.ServiceHash(project.Services[service])
+		require.NoError(t, err)
+		return map[string]string{api.ConfigHashLabel: hash, api.ImageDigestLabel: image}
+	}
+	imageIDs := map[string]string{"web": "sha256:web", "api": "sha256:api", "db": "sha256:db"}
+	containers := []api.ContainerSummary{
+		{Service: "web", State: "running", Labels: labels("web", "sha256:web")},
+		{Service: "api", State: "running", Labels: labels("api", "sha256:api")},
+		{Service: "api", State: "running", Labels: labels("api", "sha256:api")},
+		{Service: "db", State: "running", Labels: labels("db", "sha256:db")},
+	}
+
+	stale, err := quickStaleServices(project, containers, imageIDs)
+	require.NoError(t, err)
+	assert.Empty(t, stale)
+
+	// an exited replica, an outdated image and a changed configuration
+	containers[1].State = "exited"
+	containers[3].Labels = labels("db", "sha256:old")
+	containers[0].Labels = map[string]string{api.ConfigHashLabel: "outdated", api.ImageDigestLabel: "sha256:web"}
+	stale, err = quickStaleServices(project, containers, imageIDs)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api", "db", "web"}, stale)
+
+	// images missing locally need a pull or a build
+	stale, err = quickStaleServices(project, containers[3:], map[string]string{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api", "db", "web"}, stale)
+}
@@ -17,17 +17,24 @@
 package compose
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/docker/cli/cli/command"
 	"github.com/spf13/cobra"
 
+	"github.com/docker/compose/v5/cmd/prompt"
 	"github.com/docker/compose/v5/pkg/api"
 	"github.com/docker/compose/v5/pkg/compose"
+	"github.com/docker/compose/v5/pkg/extensions"
 )
 
 type rollbackOptions struct {
@@ -38,6 +45,17 @@ type rollbackOptions struct {
 	preserveData bool
 	services     []string
 	history      bool
+	dryRun       bool
+	format       string
+	output       string
+
+	healthTimeout time.Duration
+	noAutoRestore bool
+
+	keep      int
+	keepDays  int
+	prune     bool
+	retention bool // --keep or --keep-days was set
 }
 
 func rollbackCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *BackendOptions) *cobra.Command {
@@ -45,6 +63,8 @@ func rollbackCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *B
 		ProjectOptions: p,
 		strategy:       "rolling",
 		preserveData:   true,
+		format:         "text",
+		healthTimeout:  60 * time.Second,
 	}
 
 	cmd := &cobra.Command{
@@ -58,18 +78,52 @@ This command supports:
 3. Rollback to specific time point
 4. Rollback strategies (rolling/blue-green)
 5. Data preservation options
+
+Once rolled back, every targeted service must be healthy (or running, without healthcheck)
+within --health-timeout. Otherwise, or when the rollback itself fails, the services are
+restored to the images they were running before the rollback and the command fails.
+Use --no-auto-restore to leave the services as they are instead.
+
+Every version records the ID of the image each service was running, and services are rolled
+back to that image even when its tag was rebuilt or pushed again since. The image must still be
+present locally. Versions recorded before image IDs were kept roll back to their image tag.
+
+The version history grows with every deployment. --keep N and --keep-days D set the retention
+policy of the project: the history is pruned right away, then every time a version is recorded,
+to the N newest versions and those from the last D days. --keep 0 and --keep-days 0 lift a limit.
+--prune trims the history to the current policy on demand. The currently deployed version is
+never pruned. Rollbacks reuse the volumes of the previous containers and store no snapshot, so
+pruning only removes history entries.
+
+Services of a profile are only rolled back when the profile is enabled, with --profile before or
+after the command name (both add up) or, when no --profile is given, with COMPOSE_PROFILES
+from the environment or the .env file. Services named as arguments are enabled whatever their
+profile.
 `,
+		PreRunE: AdaptCmd(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+			opts.retention = cmd.Flags().Changed("keep") || cmd.Flags().Changed("keep-days")
+			return nil
+		}),
 		RunE: Adapt(func(ctx context.Context, args []string) error {
 			opts.services = args
 			return runRollbackCommand(ctx, dockerCli, backendOptions, &opts)
 		}),
 	}
 
+	opts.addProfileFlag(cmd.Flags())
 	cmd.Flags().StringVar(&opts.version, "version", "", "Rollback to specific version")
 	cmd.Flags().StringVar(&opts.timepoint, "timepoint", "", "Rollback to specific time point (YYYY-MM-DD HH:MM:SS)")
 	cmd.Flags().StringVar(&opts.strategy, "strategy", "rolling", "Rollback strategy (rolling/blue-green)")
 	cmd.Flags().BoolVar(&opts.preserveData, "preserve-data", true, "Preserve service data during rollback")
 	cmd.Flags().BoolVar(&opts.history, "history", false, "Show version history")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Show the rollback plan without applying it")
+	cmd.Flags().StringVar(&opts.format, "format", "text", "Format of the --dry-run plan (text, json)")
+	addOutputFlag(cmd.Flags(), &opts.output, "the --history and the --dry-run plan")
+	cmd.Flags().DurationVar(&opts.healthTimeout, "health-timeout", 60*time.Second, "How long the rolled back services have to become healthy")
+	cmd.Flags().BoolVar(&opts.noAutoRestore, "no-auto-restore", false, "Don't restore the previous images when the rollback fails or leaves services unhealthy")
+	cmd.Flags().IntVar(&opts.keep, "keep", 0, "Keep only the N newest versions in the history (0 for no limit)")
+	cmd.Flags().IntVar(&opts.keepDays, "keep-days", 0, "Keep only the versions from the last D days in the history (0 for no limit)")
+	cmd.Flags().BoolVar(&opts.prune, "prune", false, "Prune the history according to the retention policy")
 	return cmd
 }
 
@@ -86,7 +140,21 @@ func runRollbackCommand(ctx context.Context, dockerCli command.Cli, backendOptio
 
 	// Show history if requested
 	if opts.history {
-		return showVersionHistory(project.Name)
+		return writeOutput(opts.output, 0o644, os.Stdout, func(w io.Writer) error {
+			return showVersionHistory(w, project.Name)
+		})
+	}
+
+	if opts.retention || opts.prune {
+		return pruneVersionHistory(extensions.DefaultHistoryStore(), project.Name, opts)
+	}
+
+	// Let the user pick the version when running interactively
+	if opts.version == "" && opts.timepoint == "" && dockerCli.In().IsTerminal() {
+		opts.version, err = selectVersion(dockerCli, project.Name)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Determine target version
@@ -95,32 +163,47 @@ func runRollbackCommand(ctx context.Context, dockerCli command.Cli, backendOptio
 		return err
 	}
 
+	history, err := extensions.DefaultHistoryStore().Load(project.Name)
+	if err != nil {
+		return err
+	}
+	target, err := findVersion(history, targetVersion)
+	if err != nil {
+		return err
+	}
+
+	containers, err := backend.Ps(ctx, project.Name, api.PsOptions{All: true})
+	if err != nil {
+		return err
+	}
+	plan, err := planServiceRollback(project, opts.services, target, containers)
+	if err != nil {
+		return err
+	}
+
+	if opts.dryRun {
+		return writeOutput(opts.output, 0o644, os.Stdout, func(w io.Writer) error {
+			return printRollbackPlan(w, newRollbackPlan(project, opts, target, plan), opts.format)
+		})
+	}
+
 	fmt.Printf("Rolling back to version: %s\n", targetVersion)
 	fmt.Printf("Strategy: %s\n", opts.strategy)
 	fmt.Printf("Preserve data: %v\n", opts.preserveData)
-	fmt.Printf("Rolling back services: %v\n", opts.services)
-
-	// Perform rollback based on strategy
-	switch opts.strategy {
-	case "rolling":
-		if err := runRollingRollback(ctx, backend, project, opts.services, targetVersion, opts.preserveData); err != nil {
-			return err
-		}
-	case "blue-green":
-		if err := runBlueGreenRollback(ctx, backend, project, project.Name, opts.services, targetVersion, opts.preserveData); err != nil {
-			return err
-		}
-	default:
-		return fmt.Errorf("unsupported rollback strategy: %s", opts.strategy)
-	}
+	fmt.Printf("Rolling back services: %v\n", plannedServices(plan))
 
-	// Show rollback status
-	fmt.Println("\nRollback status:")
-	containers, err := backend.Ps(ctx, project.Name, api.PsOptions{})
+	containers, err = rollbackToVersion(ctx, backend, extensions.DefaultHistoryStore(), project, target, plan, opts)
 	if err != nil {
 		return err
 	}
 
+	fmt.Println("\nRollback summary:")
+	for _, step := range plan {
+		fmt.Printf("%s: %s -> %s\n", step.Service, step.From, step.To)
+	}
+
+	// Show rollback status
+	fmt.Println("\nRollback status:")
 	for _, container := range containers {
 		fmt.Printf("%s: %s\n", container.Service, container.State)
 	}
@@ -129,26 +212,86 @@ func runRollbackCommand(ctx context.Context, dockerCli command.Cli, backendOptio
 	return nil
 }
 
-func showVersionHistory(projectName string) error {
-	// Get version history (simplified implementation)
-	history := getVersionHistory(projectName)
+// rollbackToVersion applies the rollback plan and records the project as switched back to the
+// target version, so that the history knows which version is deployed. It returns the containers
+// of the project once rolled back
+func rollbackToVersion(ctx context.Context, backend api.Compose, store *extensions.HistoryStore, project *types.Project, target *extensions.VersionInfo, plan []serviceRollback, opts *rollbackOptions) ([]api.ContainerSummary, error) {
+	if err := rollbackAndVerify(ctx, backend, project, plan, opts); err != nil {
+		return nil, fmt.Errorf("rollback to version %s failed: %w", target.Version, err)
+	}
+
+	containers, err := backend.Ps(ctx, project.Name, api.PsOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := store.RecordRollback(project.Name, target, fmt.Sprintf("Rolled back to %s", target.Version), containers); err != nil {
+		fmt.Printf("Warning: Failed to record the rollback in version history: %v\n", err)
+	}
+	return containers, nil
+}
+
+func showVersionHistory(w io.Writer, projectName string) error {
+	history, err := extensions.DefaultHistoryStore().Load(projectName)
+	if err != nil {
+		return err
+	}
 
 	if len(history) == 0 {
-		fmt.Println("No version history found.")
+		_, _ = fmt.Fprintln(w, "No version history found.")
 		return nil
 	}
 
-	fmt.Println("Version history:")
-	fmt.Println("┌─────────┬─────────────────────┬─────────────────────┬─────────────────────┐")
-	fmt.Println("│ Version │ Created At          │ Updated At          │ Description         │")
-	fmt.Println("├─────────┼─────────────────────┼─────────────────────┼─────────────────────┤")
+	_, _ = fmt.Fprintln(w, "Version history:")
+	_, _ = fmt.Fprintln(w, "┌─────────┬─────────────────────┬─────────────────────┬─────────────────────┐")
+	_, _ = fmt.Fprintln(w, "│ Version │ Created At          │ Updated At          │ Description         │")
+	_, _ = fmt.Fprintln(w, "├─────────┼─────────────────────┼─────────────────────┼─────────────────────┤")
 
 	for _, version := range history {
-		fmt.Printf("│ %-7s │ %-19s │ %-19s │ %-19s │\n",
-			version.Version, version.CreatedAt, version.UpdatedAt, version.Description)
+		description := version.Description
+		if version.Status == extensions.VersionFailed {
+			description = "FAILED: " + description
+		}
+		_, _ = fmt.Fprintf(w, "│ %-7s │ %-19s │ %-19s │ %-19s │\n",
+			version.Version, version.CreatedAt, version.UpdatedAt, description)
 	}
 
-	fmt.Println("└─────────┴─────────────────────┴─────────────────────┴─────────────────────┘")
+	_, _ = fmt.Fprintln(w, "└─────────┴─────────────────────┴─────────────────────┴─────────────────────┘")
+	return nil
+}
+
+// pruneVersionHistory saves the retention policy given with --keep and --keep-days, if any, and
+// prunes the history of the project accordingly
+func pruneVersionHistory(store *extensions.HistoryStore, projectName string, opts *rollbackOptions) error {
+	if opts.keep < 0 || opts.keepDays < 0 {
+		return fmt.Errorf("--keep and --keep-days must not be negative")
+	}
+	retention, err := store.LoadRetention(projectName)
+	if err != nil {
+		return err
+	}
+	if opts.retention {
+		retention = extensions.HistoryRetention{Keep: opts.keep, KeepDays: opts.keepDays}
+		if err := store.SaveRetention(projectName, retention); err != nil {
+			return err
+		}
+		fmt.Printf("Retention policy of %s: keep %s\n", projectName, retention)
+	} else if retention.IsZero() {
+		return fmt.Errorf("no retention policy set for %s, use --keep or --keep-days", projectName)
+	}
+
+	pruned, err := store.Prune(projectName, retention)
+	if err != nil {
+		return err
+	}
+	if len(pruned) == 0 {
+		fmt.Println("Nothing to prune from the history")
+		return nil
+	}
+	versions := make([]string, 0, len(pruned))
+	for _, v := range pruned {
+		versions = append(versions, v.Version)
+	}
+	fmt.Printf("Pruned %d version(s) from the history: %s\n", len(pruned), strings.Join(versions, ", "))
 	return nil
 }
 
@@ -157,24 +300,30 @@ func determineTargetVersion(version, timepoint, projectName string) (string, err
 		return version, nil
 	}
 
+	history, err := extensions.DefaultHistoryStore().Load(projectName)
+	if err != nil {
+		return "", err
+	}
+	// failed deployments are never rolled back to
+	history = extensions.DeployedVersions(history)
+
 	if timepoint != "" {
 		// Find version closest to the specified timepoint
-		targetTime, err := time.Parse("2006-01-02 15:04:05", timepoint)
+		targetTime, err := time.Parse(extensions.VersionTimeLayout, timepoint)
 		if err != nil {
 			return "", fmt.Errorf("invalid timepoint format: %v", err)
 		}
 
-		history := getVersionHistory(projectName)
 		if len(history) == 0 {
 			return "", fmt.Errorf("no version history found")
 		}
 
 		// Find closest version before or at the timepoint
-		var closestVersion *VersionInfo
+		var closestVersion *extensions.VersionInfo
 		var minDiff time.Duration
 
 		for i, v := range history {
-			vTime, err := time.Parse("2006-01-02 15:04:05", v.CreatedAt)
+			vTime, err := time.Parse(extensions.VersionTimeLayout, v.CreatedAt)
 			if err != nil {
 				continue
 			}
@@ -198,108 +347,225 @@ func determineTargetVersion(version, timepoint, projectName string) (string, err
 	}
 
 	// Default to previous version
-	history := getVersionHistory(projectName)
 	if len(history) < 2 {
 		return "", fmt.Errorf("not enough version history to rollback")
 	}
 
 	// Sort by created time (newest first)
-	sort.Slice(history, func(i, j int) bool {
-		timeI, _ := time.Parse("2006-01-02 15:04:05", history[i].CreatedAt)
-		timeJ, _ := time.Parse("2006-01-02 15:04:05", history[j].CreatedAt)
+	sort.SliceStable(history, func(i, j int) bool {
+		timeI, _ := time.Parse(extensions.VersionTimeLayout, history[i].CreatedAt)
+		timeJ, _ := time.Parse(extensions.VersionTimeLayout, history[j].CreatedAt)
 		return timeI.After(timeJ)
 	})
 
 	return history[1].Version, nil
 }
 
-func runRollingRollback(ctx context.Context, backend api.Compose, project *types.Project, services []string, version string, preserveData bool) error {
-	// Rolling rollback: stop and start services one by one
-	targetServices := project.Services
-	if len(services) > 0 {
-		// Filter services to only those specified
-		filteredServices := make(map[string]types.ServiceConfig)
-		for _, serviceName := range services {
-			if service, ok := project.Services[serviceName]; ok {
-				filteredServices[serviceName] = service
-			}
-		}
-		targetServices = filteredServices
+// selectVersion prompts for one of the successfully deployed versions, newest first
+func selectVersion(dockerCli command.Cli, projectName string) (string, error) {
+	history, err := extensions.DefaultHistoryStore().Load(projectName)
+	if err != nil {
+		return "", err
+	}
+	history = extensions.DeployedVersions(history)
+	if len(history) == 0 {
+		return "", fmt.Errorf("no version history found")
 	}
 
-	for serviceName := range targetServices {
-		fmt.Printf("Rolling back service: %s to version %s\n", serviceName, version)
+	options := make([]string, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		v := history[i]
+		options = append(options, fmt.Sprintf("%-7s %s  %s", v.Version, v.CreatedAt, v.Description))
+	}
+	selected, err := prompt.NewPrompt(dockerCli.In(), dockerCli.Out()).Select("Select the version to roll back to:", options)
+	if err != nil {
+		return "", err
+	}
+	return history[len(history)-1-selected].Version, nil
+}
+
+// serviceRollback describes the image switch applied to a single service
+type serviceRollback = extensions.ServiceRollback
+
+// rollbackPlan is the outcome of a rollback, as shown by --dry-run
+type rollbackPlan struct {
+	Project       string                `json:"project"`
+	TargetVersion string                `json:"targetVersion"`
+	ResolvedBy    string                `json:"resolvedBy"`
+	Strategy      string                `json:"strategy"`
+	PreserveData  bool                  `json:"preserveData"`
+	Services      []serviceRollbackPlan `json:"services"`
+}
+
+// serviceRollbackPlan details the image switch and the fate of the volumes of a service
+type serviceRollbackPlan struct {
+	serviceRollback
+	Changed bool `json:"changed"`
+	// Volumes lists volume mounts with what happens to their data
+	Volumes []string `json:"volumes,omitempty"`
+}
 
-		// Stop the service
-		if err := backend.Stop(ctx, project.Name, api.StopOptions{
-			Services: []string{serviceName},
-		}); err != nil {
-			fmt.Printf("Warning: Stop failed: %v\n", err)
-			// Continue even if stop fails
+func newRollbackPlan(project *types.Project, opts *rollbackOptions, target *extensions.VersionInfo, steps []serviceRollback) rollbackPlan {
+	plan := rollbackPlan{
+		Project:       project.Name,
+		TargetVersion: target.Version,
+		ResolvedBy:    "previous version",
+		Strategy:      opts.strategy,
+		PreserveData:  opts.preserveData,
+	}
+	switch {
+	case opts.version != "":
+		plan.ResolvedBy = "--version"
+	case opts.timepoint != "":
+		plan.ResolvedBy = fmt.Sprintf("--timepoint %s", opts.timepoint)
+	}
+	for _, step := range steps {
+		servicePlan := serviceRollbackPlan{serviceRollback: step, Changed: step.Changed()}
+		for _, volume := range project.Services[step.Service].Volumes {
+			switch {
+			case volume.Type != types.VolumeTypeVolume:
+				continue
+			case volume.Source != "":
+				servicePlan.Volumes = append(servicePlan.Volumes, fmt.Sprintf("%s:%s kept (named volume)", volume.Source, volume.Target))
+			case opts.preserveData:
+				servicePlan.Volumes = append(servicePlan.Volumes, fmt.Sprintf("%s inherited from the current container", volume.Target))
+			default:
+				servicePlan.Volumes = append(servicePlan.Volumes, fmt.Sprintf("%s recreated empty", volume.Target))
+			}
 		}
+		plan.Services = append(plan.Services, servicePlan)
+	}
+	return plan
+}
 
-		// Start the service (in real implementation, this would use the specified version)
-		if err := backend.Start(ctx, project.Name, api.StartOptions{
-			Services: []string{serviceName},
-		}); err != nil {
+func printRollbackPlan(w io.Writer, plan rollbackPlan, format string) error {
+	switch format {
+	case "json":
+		marshal, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
 			return err
 		}
+		_, err = fmt.Fprintln(w, string(marshal))
+		return err
+	case "text":
+		_, _ = fmt.Fprintf(w, "Rollback plan for project %s (dry run):\n", plan.Project)
+		_, _ = fmt.Fprintf(w, "  Target version: %s (resolved by %s)\n", plan.TargetVersion, plan.ResolvedBy)
+		_, _ = fmt.Fprintf(w, "  Strategy:       %s\n", plan.Strategy)
+		_, _ = fmt.Fprintf(w, "  Preserve data:  %v\n", plan.PreserveData)
+		for _, service := range plan.Services {
+			if service.Changed {
+				_, _ = fmt.Fprintf(w, "  ~ %s: %s -> %s\n", service.Service, service.From, service.To)
+			} else {
+				_, _ = fmt.Fprintf(w, "  = %s: %s (unchanged, recreated)\n", service.Service, service.To)
+			}
+			for _, volume := range service.Volumes {
+				_, _ = fmt.Fprintf(w, "      volume %s\n", volume)
+			}
+		}
+		_, _ = fmt.Fprintln(w, "No changes applied.")
+		return nil
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
 	}
+}
 
-	return nil
+func planServiceRollback(project *types.Project, services []string, target *extensions.VersionInfo, containers []api.ContainerSummary) ([]serviceRollback, error) {
+	return extensions.PlanRollback(project, services, target, containers)
 }
 
-func runBlueGreenRollback(ctx context.Context, backend api.Compose, project *types.Project, projectName string, services []string, version string, preserveData bool) error {
-	// Blue-green rollback: create new instances alongside existing ones
-	fmt.Printf("Performing blue-green rollback to version %s\n", version)
+func plannedServices(plan []serviceRollback) []string {
+	services := make([]string, 0, len(plan))
+	for _, step := range plan {
+		services = append(services, step.Service)
+	}
+	return services
+}
 
-	// Stop all services
-	if err := backend.Stop(ctx, projectName, api.StopOptions{
-		Services: services,
-	}); err != nil {
-		fmt.Printf("Warning: Stop failed: %v\n", err)
-		// Continue even if stop fails
+// rollbackAndVerify applies the rollback plan with the selected strategy and waits for the rolled back
+// services to be healthy. On failure, unless disabled with --no-auto-restore, the services are
+// restored to the images they were running before the rollback.
+func rollbackAndVerify(ctx context.Context, backend api.Compose, project *types.Project, plan []serviceRollback, opts *rollbackOptions) error {
+	apply := runRollingRollback
+	switch opts.strategy {
+	case "rolling":
+	case "blue-green":
+		apply = runBlueGreenRollback
+	default:
+		return fmt.Errorf("unsupported rollback strategy: %s", opts.strategy)
 	}
 
-	// Start all services (in real implementation, this would use the specified version)
-	if err := backend.Start(ctx, projectName, api.StartOptions{
-		Services: services,
-	}); err != nil {
+	err := apply(ctx, backend, project, plan, opts.preserveData)
+	if err == nil {
+		err = waitForRollbackHealth(ctx, backend, project.Name, plannedServices(plan), opts.healthTimeout)
+	}
+	if err == nil || opts.noAutoRestore {
 		return err
 	}
 
-	return nil
+	fmt.Printf("Rollback failed: %v\nRestoring the images running before the rollback...\n", err)
+	if restoreErr := apply(ctx, backend, project, restoreRollbackPlan(plan), opts.preserveData); restoreErr != nil {
+		return fmt.Errorf("%w, and restoring the previous images failed: %v", err, restoreErr)
+	}
+	return fmt.Errorf("%w, the previous images were restored", err)
 }
 
-// VersionInfo represents a version in the history
-type VersionInfo struct {
-	Version     string
-	CreatedAt   string
-	UpdatedAt   string
-	Description string
+// restoreRollbackPlan reverts a rollback plan, switching the services back to the images they
+// were running before
+func restoreRollbackPlan(plan []serviceRollback) []serviceRollback {
+	restore := make([]serviceRollback, 0, len(plan))
+	for _, step := range plan {
+		restore = append(restore, serviceRollback{
+			Service:     step.Service,
+			From:        step.To,
+			To:          step.From,
+			FromImageID: step.ToImageID,
+			ToImageID:   step.FromImageID,
+		})
+	}
+	return restore
+}
+
+// waitForRollbackHealth waits until all the services are healthy, or running when they have no
+// healthcheck, failing with the services still unhealthy once timeout expires
+func waitForRollbackHealth(ctx context.Context, backend api.Compose, projectName string, services []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		containers, err := backend.Ps(ctx, projectName, api.PsOptions{All: true, Services: services})
+		if err != nil {
+			return err
+		}
+		states := serviceHealthStates(containers, "")
+		var pending []string
+		for _, service := range services {
+			if states[service] != healthStateHealthy {
+				pending = append(pending, fmt.Sprintf("%s (%s)", service, cmp.Or(states[service], "no container")))
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("services not healthy after %s: %s", timeout, strings.Join(pending, ", "))
+		case <-time.After(healthWaitPollInterval):
+		}
+	}
+}
+
+func runRollingRollback(ctx context.Context, backend api.Compose, project *types.Project, plan []serviceRollback, preserveData bool) error {
+	return extensions.Rollback(ctx, backend, project, plan, extensions.RollbackOptions{PreserveData: preserveData, Out: os.Stdout})
+}
+
+func runBlueGreenRollback(ctx context.Context, backend api.Compose, project *types.Project, plan []serviceRollback, preserveData bool) error {
+	return extensions.Rollback(ctx, backend, project, plan, extensions.RollbackOptions{BlueGreen: true, PreserveData: preserveData, Out: os.Stdout})
 }
 
-func getVersionHistory(projectName string) []VersionInfo {
-	// Simplified implementation - in real code, this would read from a version store
-	// For demo purposes, return mock version history
-	return []VersionInfo{
-		{
-			Version:     "v3",
-			CreatedAt:   time.Now().Add(-24 * time.Hour).Format("2006-01-02 15:04:05"),
-			UpdatedAt:   time.Now().Add(-24 * time.Hour).Format("2006-01-02 15:04:05"),
-			Description: "Initial deployment",
-		},
-		{
-			Version:     "v2",
-			CreatedAt:   time.Now().Add(-48 * time.Hour).Format("2006-01-02 15:04:05"),
-			UpdatedAt:   time.Now().Add(-48 * time.Hour).Format("2006-01-02 15:04:05"),
-			Description: "Second version",
-		},
-		{
-			Version:     "v1",
-			CreatedAt:   time.Now().Add(-72 * time.Hour).Format("2006-01-02 15:04:05"),
-			UpdatedAt:   time.Now().Add(-72 * time.Hour).Format("2006-01-02 15:04:05"),
-			Description: "Initial version",
-		},
+func findVersion(history []extensions.VersionInfo, version string) (*extensions.VersionInfo, error) {
+	for i := range history {
+		if history[i].Version == version {
+			return &history[i], nil
+		}
 	}
+	return nil, fmt.Errorf("version %s not found in history", version)
 }
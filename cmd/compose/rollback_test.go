@@ -0,0 +1,246 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/cli/cli/streams"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/extensions"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestPlanServiceRollback(t *testing.T) {
+	project := &types.Project{
+		Name: "demo",
+		Services: types.Services{
+			"web": {Name: "web", Image: "web:3"},
+			"db":  {Name: "db", Image: "postgres:16"},
+		},
+	}
+	target := &extensions.VersionInfo{
+		Version:  "v2",
+		Services: map[string]string{"web": "web:2"},
+	}
+	containers := []api.ContainerSummary{{Service: "web", Image: "web:3-running"}}
+
+	plan, err := planServiceRollback(project, []string{"web"}, target, containers)
+	require.NoError(t, err)
+	assert.Equal(t, []serviceRollback{{Service: "web", From: "web:3-running", To: "web:2"}}, plan)
+
+	plan, err = planServiceRollback(project, nil, target, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []serviceRollback{{Service: "web", From: "web:3", To: "web:2"}}, plan)
+
+	_, err = planServiceRollback(project, []string{"db"}, target, nil)
+	assert.ErrorContains(t, err, `service "db" has no recorded history at version v2`)
+}
+
+func TestVersionHistoryRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	project := &types.Project{
+		Name:     "demo",
+		Services: types.Services{"web": {Name: "web", Image: "web:1"}},
+	}
+
+	first, err := extensions.DefaultHistoryStore().Record(project, "first", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", first.Version)
+
+	project.Services["web"] = types.ServiceConfig{Name: "web", Image: "web:2"}
+	second, err := extensions.DefaultHistoryStore().Record(project, "second", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", second.Version)
+
+	history, err := extensions.DefaultHistoryStore().Load("demo")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "web:1", history[0].Services["web"])
+	assert.Equal(t, "web:2", history[1].Services["web"])
+}
+
+func TestSelectVersion(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	project := &types.Project{Name: "demo", Services: types.Services{"web": {Name: "web", Image: "web:1"}}}
+	store := extensions.DefaultHistoryStore()
+	for _, description := range []string{"first", "second"} {
+		_, err := store.Record(project, description, "", nil)
+		require.NoError(t, err)
+	}
+	// failed deployments are not offered
+	_, err := store.RecordFailure(project, "broken", "", nil)
+	require.NoError(t, err)
+	_, err = store.Record(project, "third", "", nil)
+	require.NoError(t, err)
+
+	// the options are listed newest first: v4, v2, v1
+	for answer, version := range map[string]string{"1": "v4", "2": "v2", "3": "v1"} {
+		t.Run(answer, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			cli := mocks.NewMockCli(ctrl)
+			var out bytes.Buffer
+			cli.EXPECT().In().Return(streams.NewIn(io.NopCloser(strings.NewReader(answer + "\n")))).AnyTimes()
+			cli.EXPECT().Out().Return(streams.NewOut(&out)).AnyTimes()
+
+			selected, err := selectVersion(cli, "demo")
+			require.NoError(t, err)
+			assert.Equal(t, version, selected)
+			assert.Contains(t, out.String(), "1) v4 ")
+		})
+	}
+}
+
+func TestRollbackPlan(t *testing.T) {
+	project := &types.Project{
+		Name: "shop",
+		Services: types.Services{
+			"db": {Name: "db", Volumes: []types.ServiceVolumeConfig{
+				{Type: types.VolumeTypeVolume, Source: "db-data", Target: "/var/lib/postgresql/data"},
+				{Type: types.VolumeTypeVolume, Target: "/tmp/cache"},
+				{Type: types.VolumeTypeBind, Source: "./conf", Target: "/etc/conf"},
+			}},
+			"web": {Name: "web"},
+		},
+	}
+	opts := &rollbackOptions{strategy: "rolling", preserveData: true, version: "v1"}
+	plan := newRollbackPlan(project, opts, &extensions.VersionInfo{Version: "v1"}, []serviceRollback{
+		{Service: "db", From: "postgres:17", To: "postgres:16"},
+		{Service: "web", From: "web:1", To: "web:1"},
+	})
+
+	assert.Equal(t, "--version", plan.ResolvedBy)
+	require.Len(t, plan.Services, 2)
+	assert.True(t, plan.Services[0].Changed)
+	assert.Equal(t, []string{
+		"db-data:/var/lib/postgresql/data kept (named volume)",
+		"/tmp/cache inherited from the current container",
+	}, plan.Services[0].Volumes)
+	assert.False(t, plan.Services[1].Changed)
+
+	var buf bytes.Buffer
+	require.NoError(t, printRollbackPlan(&buf, plan, "json"))
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "v1", decoded["targetVersion"])
+	services := decoded["services"].([]any)
+	assert.Equal(t, "postgres:16", services[0].(map[string]any)["to"])
+
+	buf.Reset()
+	require.NoError(t, printRollbackPlan(&buf, plan, "text"))
+	assert.Contains(t, buf.String(), "~ db: postgres:17 -> postgres:16")
+	assert.Contains(t, buf.String(), "= web: web:1 (unchanged, recreated)")
+}
+
+func TestRollbackAndVerify(t *testing.T) {
+	newProject := func() *types.Project {
+		return &types.Project{Name: "demo", Services: types.Services{"web": {Name: "web", Image: "web:3"}}}
+	}
+	plan := []serviceRollback{{Service: "web", From: "web:3", To: "web:2"}}
+	upImage := func(image string) any {
+		return gomock.Cond(func(p *types.Project) bool { return p.Services["web"].Image == image })
+	}
+	opts := &rollbackOptions{strategy: "rolling", healthTimeout: 10 * time.Millisecond}
+
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	backend.EXPECT().Up(gomock.Any(), upImage("web:2"), gomock.Any()).Return(nil)
+	backend.EXPECT().Ps(gomock.Any(), "demo", gomock.Any()).Return([]api.ContainerSummary{
+		{Service: "web", State: "running", Health: "healthy"},
+	}, nil)
+	require.NoError(t, rollbackAndVerify(context.Background(), backend, newProject(), plan, opts))
+
+	// an unhealthy rollback is restored to the previous image
+	backend.EXPECT().Up(gomock.Any(), upImage("web:2"), gomock.Any()).Return(nil)
+	backend.EXPECT().Ps(gomock.Any(), "demo", gomock.Any()).Return([]api.ContainerSummary{
+		{Service: "web", State: "running", Health: "unhealthy"},
+	}, nil)
+	backend.EXPECT().Up(gomock.Any(), upImage("web:3"), gomock.Any()).Return(nil)
+	err := rollbackAndVerify(context.Background(), backend, newProject(), plan, opts)
+	assert.EqualError(t, err, "services not healthy after 10ms: web (unhealthy), the previous images were restored")
+
+	// unless disabled
+	backend.EXPECT().Up(gomock.Any(), upImage("web:2"), gomock.Any()).Return(nil)
+	backend.EXPECT().Ps(gomock.Any(), "demo", gomock.Any()).Return(nil, nil)
+	err = rollbackAndVerify(context.Background(), backend, newProject(), plan, &rollbackOptions{strategy: "rolling", healthTimeout: 10 * time.Millisecond, noAutoRestore: true})
+	assert.EqualError(t, err, "services not healthy after 10ms: web (no container)")
+}
+
+func TestPruneVersionHistory(t *testing.T) {
+	store := extensions.NewHistoryStore(t.TempDir())
+	project := &types.Project{Name: "demo", Services: types.Services{"web": {Name: "web", Image: "web:1"}}}
+	for range 3 {
+		_, err := store.Record(project, "deployed", "", nil)
+		require.NoError(t, err)
+	}
+
+	assert.ErrorContains(t, pruneVersionHistory(store, "demo", &rollbackOptions{prune: true}), "no retention policy set for demo")
+	assert.ErrorContains(t, pruneVersionHistory(store, "demo", &rollbackOptions{keep: -1, retention: true}), "must not be negative")
+
+	require.NoError(t, pruneVersionHistory(store, "demo", &rollbackOptions{keep: 1, retention: true}))
+	history, err := store.Load("demo")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "v3", history[0].Version)
+
+	// --prune applies the saved policy
+	require.NoError(t, pruneVersionHistory(store, "demo", &rollbackOptions{prune: true}))
+}
+
+func TestManualRollbackIsNotPruned(t *testing.T) {
+	store := extensions.NewHistoryStore(t.TempDir())
+	for _, image := range []string{"web:1", "web:2", "web:3"} {
+		project := &types.Project{Name: "demo", Services: types.Services{"web": {Name: "web", Image: image}}}
+		_, err := store.Record(project, "deployed", "", nil)
+		require.NoError(t, err)
+	}
+	history, err := store.Load("demo")
+	require.NoError(t, err)
+	target, err := findVersion(history, "v1")
+	require.NoError(t, err)
+
+	project := &types.Project{Name: "demo", Services: types.Services{"web": {Name: "web", Image: "web:3"}}}
+	plan := []serviceRollback{{Service: "web", From: "web:3", To: "web:1"}}
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	backend.EXPECT().Up(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	backend.EXPECT().Ps(gomock.Any(), "demo", gomock.Any()).Return([]api.ContainerSummary{
+		{Service: "web", State: "running", Health: "healthy"},
+	}, nil).Times(2)
+	_, err = rollbackToVersion(context.Background(), backend, store, project, target, plan,
+		&rollbackOptions{strategy: "rolling", healthTimeout: time.Second})
+	require.NoError(t, err)
+
+	require.NoError(t, pruneVersionHistory(store, "demo", &rollbackOptions{keep: 1, retention: true}))
+	history, err = store.Load("demo")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	current := extensions.LatestDeployedVersion(history)
+	require.NotNil(t, current)
+	assert.Equal(t, "web:1", current.Services["web"])
+}
@@ -18,24 +18,33 @@ package compose
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"maps"
-	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/docker/cli/cli/command"
 	"github.com/spf13/cobra"
 
+	"github.com/docker/compose/v5/cmd/display"
 	"github.com/docker/compose/v5/pkg/api"
 	"github.com/docker/compose/v5/pkg/compose"
+	"github.com/docker/compose/v5/pkg/extensions"
 )
 
 type scaleOptions struct {
 	*ProjectOptions
+	all          bool
 	noDeps       bool
 	auto         bool
 	cpuThreshold float64
@@ -44,6 +53,19 @@ type scaleOptions struct {
 	maxReplicas  int
 	interval     int
 	strategy     string
+	trendWindow  int
+	predictive   bool
+	toZeroGrace  time.Duration
+
+	metricsSource string
+	prometheusURL string
+	query         string
+	listen        string
+
+	balance int
+
+	// events receives the scaling progress events with --progress json
+	events api.EventProcessor
 }
 
 func scaleCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *BackendOptions) *cobra.Command {
@@ -55,9 +77,12 @@ func scaleCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *Back
 		maxReplicas:    10,
 		interval:       30,
 		strategy:       "balanced",
+		trendWindow:    1,
+		metricsSource:  "docker",
+		prometheusURL:  "http://localhost:9090",
 	}
 	scaleCmd := &cobra.Command{
-		Use:   "scale [SERVICE=REPLICAS...]",
+		Use:   "scale [SERVICE[=REPLICAS]...]",
 		Short: "Scale services",
 		Long: `Scale services to specified replicas or enable auto-scaling based on resource usage.
 
@@ -66,24 +91,56 @@ This command supports:
 2. Auto-scaling (based on CPU/memory usage)
 3. Scaling strategies (balanced/performance/efficiency)
 4. Scaling limits (minimum/maximum replicas)
+5. Metrics sources (Docker stats or a Prometheus query)
+
+With --metrics-source prometheus, the value returned by --query (or the x-scale.query
+extension of a service) is compared against --cpu-threshold. Occurrences of
+${SERVICE} in the query are replaced by the service name.
+
+With --progress json, each scaling is also reported as a progress event on stderr
+("Service NAME" with the running and target replicas as current and total).
+
+With --trend-window N, the scaling decisions are based on the moving average of the usage
+measured by the last N checks of a service instead of the last measure, so a single spike
+doesn't trigger a scaling. With --predictive, a linear trend is fitted through these measures
+and extrapolated to the next check: when higher than the average, the service is scaled up
+on the projected usage, before the thresholds are actually exceeded. The measures of a
+service are discarded once it is scaled, as they were taken with another replica count.
+
+With --to-zero-grace, the containers of a service scaled to 0 replicas, manually or by the
+autoscaler, are sent their stop signal and given this time to finish in-flight work before
+being killed, instead of the stop_grace_period of the service.
+
+With --listen, the autoscaler serves its state as JSON on GET /status, and
+POST /pause and POST /resume suspend and resume scaling decisions.
+
+A SERVICE given without REPLICAS is scaled to the replicas declared by its
+deploy.replicas (or scale) attribute, reconciling it with the compose file. Without
+SERVICE, or with --all, all the services declaring their replicas are scaled to them,
+the others being left untouched (all the services are auto-scaled with --auto).
+
+With --balance TOTAL, TOTAL replicas are distributed across the given services (all the
+services without SERVICE) in proportion to their x-scale.weight (1 by default), each
+service getting at least its x-scale.min and at most its x-scale.max replicas, which
+default to --min-replicas and --max-replicas.
 `,
 		Args: cobra.MinimumNArgs(0),
-		RunE: Adapt(func(ctx context.Context, args []string) error {
-			if opts.auto {
-				// Auto-scaling mode
-				if len(args) > 0 {
-					// Use specified services for auto-scaling
-					return runAutoScale(ctx, dockerCli, backendOptions, &opts, args)
+		RunE: AdaptCmd(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+			opts.events = scaleEventProcessor(dockerCli)
+			selection := opts.SelectServices(args, opts.all)
+			if cmd.Flags().Changed("balance") {
+				if opts.auto {
+					return fmt.Errorf("--balance cannot be combined with --auto")
 				}
-				// Auto-scale all services
-				return runAutoScale(ctx, dockerCli, backendOptions, &opts, nil)
+				return runBalancedScale(ctx, dockerCli, backendOptions, opts, selection)
 			}
-
-			// Manual scaling mode
-			if len(args) == 0 {
-				return fmt.Errorf("manual scaling requires at least one SERVICE=REPLICAS argument")
+			if opts.auto {
+				// Auto-scaling mode, all services when none are selected
+				return runAutoScale(ctx, dockerCli, backendOptions, &opts, selection)
 			}
-			serviceTuples, err := parseServicesReplicasArgs(args)
+
+			// Manual scaling mode, all services to their declared replicas when none are selected
+			serviceTuples, err := parseServicesReplicasArgs(selection)
 			if err != nil {
 				return err
 			}
@@ -92,19 +149,31 @@ This command supports:
 		ValidArgsFunction: completeScaleArgs(dockerCli, p),
 	}
 	flags := scaleCmd.Flags()
+	flags.BoolVar(&opts.all, "all", false, "Scale all services")
 	flags.BoolVar(&opts.noDeps, "no-deps", false, "Don't start linked services")
 	flags.BoolVar(&opts.auto, "auto", false, "Enable auto-scaling based on resource usage")
 	flags.Float64Var(&opts.cpuThreshold, "cpu-threshold", 70.0, "CPU usage threshold for auto-scaling (percentage)")
 	flags.Float64Var(&opts.memThreshold, "mem-threshold", 70.0, "Memory usage threshold for auto-scaling (percentage)")
-	flags.IntVar(&opts.minReplicas, "min-replicas", 1, "Minimum number of replicas for auto-scaling")
-	flags.IntVar(&opts.maxReplicas, "max-replicas", 10, "Maximum number of replicas for auto-scaling")
+	flags.IntVar(&opts.minReplicas, "min-replicas", 1, "Minimum number of replicas for auto-scaling and --balance")
+	flags.IntVar(&opts.maxReplicas, "max-replicas", 10, "Maximum number of replicas for auto-scaling and --balance")
+	flags.IntVar(&opts.balance, "balance", 0, "Distribute TOTAL replicas across the services according to their x-scale.weight")
 	flags.IntVar(&opts.interval, "interval", 30, "Check interval for auto-scaling (seconds)")
 	flags.StringVar(&opts.strategy, "strategy", "balanced", "Scaling strategy (balanced/performance/efficiency)")
+	flags.IntVar(&opts.trendWindow, "trend-window", 1, "Number of checks the usage is averaged over for auto-scaling decisions")
+	flags.BoolVar(&opts.predictive, "predictive", false, "Scale up on the usage trend projected to the next check (requires --trend-window of 2 or more)")
+	flags.StringVar(&opts.metricsSource, "metrics-source", "docker", "Source of the scaling signal (docker, prometheus)")
+	flags.StringVar(&opts.prometheusURL, "prometheus-url", "http://localhost:9090", "Prometheus server address")
+	flags.StringVar(&opts.query, "query", "", "Prometheus query returning the scaling signal")
+	flags.DurationVar(&opts.toZeroGrace, "to-zero-grace", 0, "Time given to the containers of a service scaled to 0 to stop gracefully before being killed")
+	flags.StringVar(&opts.listen, "listen", "", "Address to serve the auto-scaling status and control endpoint on (e.g. :8085)")
 
 	return scaleCmd
 }
 
 func runScale(ctx context.Context, dockerCli command.Cli, backendOptions *BackendOptions, opts scaleOptions, serviceReplicaTuples map[string]int) error {
+	if opts.toZeroGrace < 0 {
+		return fmt.Errorf("--to-zero-grace must not be negative, got %s", opts.toZeroGrace)
+	}
 	backend, err := compose.NewComposeService(dockerCli, backendOptions.Options...)
 	if err != nil {
 		return err
@@ -115,42 +184,212 @@ func runScale(ctx context.Context, dockerCli command.Cli, backendOptions *Backen
 	if err != nil {
 		return err
 	}
+	serviceReplicaTuples, err = scaleTargets(project, serviceReplicaTuples)
+	if err != nil {
+		return err
+	}
 
-	if opts.noDeps {
-		if project, err = project.WithSelectedServices(services, types.IgnoreDependencies); err != nil {
-			return err
+	return extensions.Scale(ctx, backend, project, serviceReplicaTuples, extensions.ScaleOptions{
+		NoDeps:      opts.noDeps,
+		Out:         os.Stdout,
+		Events:      opts.events,
+		ToZeroGrace: opts.toZeroGrace,
+	})
+}
+
+// runBalancedScale distributes the --balance budget across the services and scales them accordingly
+func runBalancedScale(ctx context.Context, dockerCli command.Cli, backendOptions *BackendOptions, opts scaleOptions, selection []string) error {
+	for _, arg := range selection {
+		if strings.Contains(arg, "=") {
+			return fmt.Errorf("--balance computes the replicas, invalid service %q", arg)
 		}
 	}
+	backend, err := compose.NewComposeService(dockerCli, backendOptions.Options...)
+	if err != nil {
+		return err
+	}
+	project, _, err := opts.ToProject(ctx, dockerCli, backend, selection)
+	if err != nil {
+		return err
+	}
 
-	for key, value := range serviceReplicaTuples {
-		service, err := project.GetService(key)
+	var shares []scaleShare
+	for _, name := range opts.ResolveServices(project, selection) {
+		service, err := project.GetService(name)
 		if err != nil {
 			return err
 		}
-		service.SetScale(value)
-		project.Services[key] = service
+		share, err := serviceScaleShare(service, opts.minReplicas, opts.maxReplicas)
+		if err != nil {
+			return err
+		}
+		shares = append(shares, share)
+	}
+	replicas, err := balanceReplicas(opts.balance, shares)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Balancing %d replicas:\n", opts.balance)
+	for _, share := range shares {
+		fmt.Printf("  %s: %d (weight %g, min %d, max %d)\n", share.Service, replicas[share.Service], share.Weight, share.Min, share.Max)
+	}
+	return runScale(ctx, dockerCli, backendOptions, opts, replicas)
+}
+
+// scaleShare is how a service takes part in a --balance distribution
+type scaleShare struct {
+	Service string
+	Weight  float64
+	Min     int
+	Max     int
+}
+
+// serviceScaleShare reads the x-scale weight, min and max of a service, min and max defaulting to the given bounds
+func serviceScaleShare(service types.ServiceConfig, minReplicas, maxReplicas int) (scaleShare, error) {
+	share := scaleShare{Service: service.Name, Weight: 1, Min: minReplicas, Max: maxReplicas}
+	xscale, _ := service.Extensions["x-scale"].(map[string]any)
+	for key, value := range xscale {
+		var number float64
+		switch v := value.(type) {
+		case int:
+			number = float64(v)
+		case int64:
+			number = float64(v)
+		case uint64:
+			number = float64(v)
+		case float64:
+			number = v
+		default:
+			if key == "weight" || key == "min" || key == "max" {
+				return share, fmt.Errorf("service %s: x-scale.%s must be a number, got %v", service.Name, key, value)
+			}
+			continue
+		}
+		switch key {
+		case "weight":
+			if number <= 0 {
+				return share, fmt.Errorf("service %s: x-scale.weight must be positive, got %g", service.Name, number)
+			}
+			share.Weight = number
+		case "min":
+			share.Min = int(number)
+		case "max":
+			share.Max = int(number)
+		}
+	}
+	if share.Min < 0 || share.Max < share.Min {
+		return share, fmt.Errorf("service %s: invalid replica bounds, min %d and max %d", service.Name, share.Min, share.Max)
+	}
+	return share, nil
+}
+
+// balanceReplicas distributes total replicas across the services in proportion to their weight,
+// within their bounds. Every service first gets its minimum, then each remaining replica goes to the
+// service below its maximum with the highest weight per replica it would have (D'Hondt method).
+func balanceReplicas(total int, shares []scaleShare) (map[string]int, error) {
+	replicas := map[string]int{}
+	minimum, maximum := 0, 0
+	for _, share := range shares {
+		replicas[share.Service] = share.Min
+		minimum += share.Min
+		maximum += share.Max
+	}
+	if total < minimum || total > maximum {
+		return nil, fmt.Errorf("cannot balance %d replicas, the services require between %d and %d replicas", total, minimum, maximum)
+	}
+	for remaining := total - minimum; remaining > 0; remaining-- {
+		best := -1
+		var bestQuotient float64
+		for i, share := range shares {
+			if replicas[share.Service] >= share.Max {
+				continue
+			}
+			quotient := share.Weight / float64(replicas[share.Service]+1)
+			if best < 0 || quotient > bestQuotient {
+				best, bestQuotient = i, quotient
+			}
+		}
+		replicas[shares[best].Service]++
 	}
+	return replicas, nil
+}
 
-	return backend.Scale(ctx, project, api.ScaleOptions{Services: services})
+// scaleEventProcessor returns the processor of the scaling events, only reported with --progress json
+// as the other progress modes render the container events of the backend
+func scaleEventProcessor(dockerCli command.Cli) api.EventProcessor {
+	if display.Mode != display.ModeJSON {
+		return nil
+	}
+	return display.JSON(dockerCli.Err())
 }
 
+// declaredReplicas marks a service given without replicas, to be scaled to its declared replicas
+const declaredReplicas = extensions.DeclaredReplicas
+
+// parseServicesReplicasArgs parses SERVICE=REPLICAS arguments. A bare SERVICE is mapped to
+// declaredReplicas, resolved once the project is loaded.
 func parseServicesReplicasArgs(args []string) (map[string]int, error) {
 	serviceReplicaTuples := map[string]int{}
 	for _, arg := range args {
 		key, val, ok := strings.Cut(arg, "=")
-		if !ok || key == "" || val == "" {
+		if !ok && key != "" {
+			serviceReplicaTuples[key] = declaredReplicas
+			continue
+		}
+		if key == "" || val == "" {
 			return nil, fmt.Errorf("invalid scale specifier: %s", arg)
 		}
 		intValue, err := strconv.Atoi(val)
 		if err != nil {
 			return nil, fmt.Errorf("invalid scale specifier: can't parse replica value as int: %v", arg)
 		}
+		if intValue < 0 {
+			return nil, fmt.Errorf("invalid scale specifier: negative replica value: %v", arg)
+		}
 		serviceReplicaTuples[key] = intValue
 	}
 	return serviceReplicaTuples, nil
 }
 
+// scaleTargets returns the replicas to scale the services to. Without any service given, the
+// services declaring their replicas are scaled to them and the others are left untouched.
+func scaleTargets(project *types.Project, serviceReplicaTuples map[string]int) (map[string]int, error) {
+	if len(serviceReplicaTuples) > 0 {
+		return serviceReplicaTuples, nil
+	}
+	targets := map[string]int{}
+	for _, name := range project.ServiceNames() {
+		if _, err := extensions.ServiceDeclaredReplicas(project.Services[name]); err == nil {
+			targets[name] = declaredReplicas
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no service declares its replicas, use SERVICE=REPLICAS")
+	}
+	return targets, nil
+}
+
 func runAutoScale(ctx context.Context, dockerCli command.Cli, backendOptions *BackendOptions, opts *scaleOptions, services []string) error {
+	switch opts.metricsSource {
+	case "docker":
+	case "prometheus":
+		if opts.query == "" {
+			return fmt.Errorf("--query is required with --metrics-source prometheus")
+		}
+	default:
+		return fmt.Errorf("unsupported metrics source: %s", opts.metricsSource)
+	}
+	if opts.toZeroGrace < 0 {
+		return fmt.Errorf("--to-zero-grace must not be negative, got %s", opts.toZeroGrace)
+	}
+	if opts.trendWindow < 1 {
+		return fmt.Errorf("--trend-window must be at least 1, got %d", opts.trendWindow)
+	}
+	if opts.predictive && opts.trendWindow < 2 {
+		return fmt.Errorf("--predictive requires a --trend-window of at least 2 checks")
+	}
+
 	backend, err := compose.NewComposeService(dockerCli, backendOptions.Options...)
 	if err != nil {
 		return err
@@ -161,54 +400,261 @@ func runAutoScale(ctx context.Context, dockerCli command.Cli, backendOptions *Ba
 		return err
 	}
 
-	targetServices := project.Services
-	if len(services) > 0 {
-		// Filter services to only those specified
-		filteredServices := make(map[string]types.ServiceConfig)
-		for _, serviceName := range services {
-			if service, ok := project.Services[serviceName]; ok {
-				filteredServices[serviceName] = service
-			}
+	targetServices := make(map[string]types.ServiceConfig)
+	for _, serviceName := range opts.ResolveServices(project, services) {
+		if service, ok := project.Services[serviceName]; ok {
+			targetServices[serviceName] = service
 		}
-		targetServices = filteredServices
 	}
 
 	fmt.Printf("Starting auto-scaling with strategy: %s\n", opts.strategy)
 	fmt.Printf("Thresholds: CPU %.1f%%, Memory %.1f%%\n", opts.cpuThreshold, opts.memThreshold)
 	fmt.Printf("Replica range: %d - %d\n", opts.minReplicas, opts.maxReplicas)
 	fmt.Printf("Check interval: %d seconds\n", opts.interval)
+	fmt.Printf("Metrics source: %s\n", opts.metricsSource)
+	if opts.trendWindow > 1 {
+		fmt.Printf("Trend window: %d checks (predictive: %t)\n", opts.trendWindow, opts.predictive)
+	}
 	fmt.Printf("Auto-scaling services: %v\n", slices.Sorted(maps.Keys(targetServices)))
 
+	status := newAutoScaleStatus()
+	if opts.listen != "" {
+		listener, err := net.Listen("tcp", opts.listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %v", opts.listen, err)
+		}
+		server := &http.Server{Handler: status.handler(), ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Printf("Warning: auto-scaling endpoint stopped: %v\n", err)
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			_ = server.Shutdown(shutdownCtx)
+		}()
+		fmt.Printf("Serving auto-scaling status on %s\n", listener.Addr())
+	}
+
+	// Scale operations run in the background so a slow backend doesn't delay the next checks,
+	// wait for them before returning
+	var scaling sync.WaitGroup
+	defer scaling.Wait()
+
 	// Main auto-scaling loop
 	for {
+		if status.isPaused() {
+			fmt.Println("Auto-scaling paused, skipping check.")
+		} else if err := checkAndScale(ctx, dockerCli, backend, project, targetServices, opts, status, &scaling); err != nil {
+			fmt.Printf("Error during auto-scaling: %v\n", err)
+		}
+
+		// Wait for next check interval
 		select {
 		case <-ctx.Done():
 			fmt.Println("Auto-scaling stopped.")
 			return nil
-		default:
-			// Check resource usage and scale
-			if err := checkAndScale(ctx, backend, project, targetServices, opts); err != nil {
-				fmt.Printf("Error during auto-scaling: %v\n", err)
-			}
+		case <-time.After(time.Duration(opts.interval) * time.Second):
+		}
+	}
+}
+
+// scaleDecision records the outcome of one auto-scaling check for a service
+type scaleDecision struct {
+	Time   time.Time `json:"time"`
+	From   int       `json:"from"`
+	To     int       `json:"to"`
+	Result string    `json:"result"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// autoScaleServiceStatus is the last known state of an auto-scaled service
+type autoScaleServiceStatus struct {
+	Replicas     int            `json:"replicas"`
+	CPU          float64        `json:"cpu"`
+	Memory       float64        `json:"memory"`
+	LastChecked  time.Time      `json:"lastChecked"`
+	LastDecision *scaleDecision `json:"lastDecision,omitempty"`
+	Scaling      bool           `json:"scaling"`
+}
+
+// autoScaleStatus is the autoscaler state shared with the --listen endpoint
+type autoScaleStatus struct {
+	mu       sync.Mutex
+	paused   bool
+	services map[string]*autoScaleServiceStatus
+	// usage holds the last measures of each service with --trend-window
+	usage map[string]*scaleUsageWindow
+}
+
+func newAutoScaleStatus() *autoScaleStatus {
+	return &autoScaleStatus{services: map[string]*autoScaleServiceStatus{}, usage: map[string]*scaleUsageWindow{}}
+}
 
-			// Wait for next check interval
-			time.Sleep(time.Duration(opts.interval) * time.Second)
+func (s *autoScaleStatus) isPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+func (s *autoScaleStatus) setPaused(paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = paused
+}
+
+// serviceStatus returns the status of a service, creating it if needed. s.mu must be held.
+func (s *autoScaleStatus) serviceStatus(service string) *autoScaleServiceStatus {
+	status, ok := s.services[service]
+	if !ok {
+		status = &autoScaleServiceStatus{}
+		s.services[service] = status
+	}
+	return status
+}
+
+// startScaling marks a scale operation in progress for the service, and returns false
+// if one is already running
+func (s *autoScaleStatus) startScaling(service string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.serviceStatus(service)
+	if status.Scaling {
+		return false
+	}
+	status.Scaling = true
+	return true
+}
+
+func (s *autoScaleStatus) isScaling(service string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.serviceStatus(service).Scaling
+}
+
+func (s *autoScaleStatus) recordMetrics(service string, replicas int, cpu, memory float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.serviceStatus(service)
+	status.Replicas = replicas
+	status.CPU = cpu
+	status.Memory = memory
+	status.LastChecked = time.Now()
+}
+
+// recordDecision stores the outcome of a check, ending the scale operation it triggered if any
+func (s *autoScaleStatus) recordDecision(service string, decision scaleDecision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.serviceStatus(service)
+	status.Scaling = false
+	if decision.Error == "" {
+		status.Replicas = decision.To
+		if decision.To != decision.From {
+			// the usage measured with the previous replica count doesn't apply anymore
+			delete(s.usage, service)
 		}
 	}
+	status.LastDecision = &decision
+}
+
+// usageSignal adds the usage of a service to its window of the last size measures, and returns the
+// CPU and memory signals the scaling decision is based on
+func (s *autoScaleStatus) usageSignal(service string, cpu, memory float64, size int, predictive bool) (float64, float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	window, ok := s.usage[service]
+	if !ok {
+		window = &scaleUsageWindow{}
+		s.usage[service] = window
+	}
+	window.add(cpu, memory, size)
+	return scaleSignal(window.cpu, predictive), scaleSignal(window.memory, predictive)
 }
 
-func checkAndScale(ctx context.Context, backend api.Compose, project *types.Project, services map[string]types.ServiceConfig, opts *scaleOptions) error {
-	for serviceName, service := range services {
-		// Get current replica count
-		var currentScale int
-		if service.Scale == nil {
-			currentScale = 1 // Default to 1 if not set
-		} else {
-			currentScale = *service.Scale
+// scaleUsageWindow is the usage measured by the last checks of a service, oldest first
+type scaleUsageWindow struct {
+	cpu    []float64
+	memory []float64
+}
+
+func (w *scaleUsageWindow) add(cpu, memory float64, size int) {
+	w.cpu = append(w.cpu, cpu)
+	w.memory = append(w.memory, memory)
+	if len(w.cpu) > size {
+		w.cpu = w.cpu[len(w.cpu)-size:]
+		w.memory = w.memory[len(w.memory)-size:]
+	}
+}
+
+// scaleSignal returns the moving average of the measures or, when predictive and higher, the value
+// at the next check of the least squares line fitted through them
+func scaleSignal(measures []float64, predictive bool) float64 {
+	n := float64(len(measures))
+	var sumX, sumY, sumXY, sumXX float64
+	for i, y := range measures {
+		x := float64(i)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	average := sumY / n
+	if !predictive || len(measures) < 2 {
+		return average
+	}
+	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	intercept := (sumY - slope*sumX) / n
+	return max(average, intercept+slope*n)
+}
+
+func (s *autoScaleStatus) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		body, err := json.Marshal(struct {
+			Paused   bool                               `json:"paused"`
+			Services map[string]*autoScaleServiceStatus `json:"services"`
+		}{s.paused, s.services})
+		s.mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		s.setPaused(true)
+		fmt.Println("Auto-scaling paused.")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		s.setPaused(false)
+		fmt.Println("Auto-scaling resumed.")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func checkAndScale(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, services map[string]types.ServiceConfig, opts *scaleOptions, status *autoScaleStatus, scaling *sync.WaitGroup) error {
+	replicas := newReplicaCounter(backend, project)
+	for serviceName := range services {
+		if status.isScaling(serviceName) {
+			fmt.Printf("Skipping %s: previous scale operation still in progress\n", serviceName)
+			continue
+		}
+		service := project.Services[serviceName]
+
+		// Get current replica count from the running containers, the configured scale may not reflect reality
+		currentScale, err := replicas.runningReplicas(ctx, serviceName)
+		if err != nil {
+			fmt.Printf("Warning: Failed to count replicas of %s: %v\n", serviceName, err)
+			continue
 		}
 
-		// Get resource usage (simplified - in real implementation, use backend.Stats or similar)
-		cpuUsage, memUsage, err := getServiceResourceUsage(ctx, backend, project.Name, serviceName)
+		cpuUsage, memUsage, err := getServiceResourceUsage(ctx, dockerCli, backend, project.Name, service, opts)
 		if err != nil {
 			fmt.Printf("Warning: Failed to get resource usage for %s: %v\n", serviceName, err)
 			continue
@@ -216,6 +662,12 @@ func checkAndScale(ctx context.Context, backend api.Compose, project *types.Proj
 
 		fmt.Printf("Service: %s, Current replicas: %d, CPU: %.1f%%, Memory: %.1f%%\n",
 			serviceName, currentScale, cpuUsage, memUsage)
+		status.recordMetrics(serviceName, currentScale, cpuUsage, memUsage)
+		if opts.trendWindow > 1 {
+			cpuUsage, memUsage = status.usageSignal(serviceName, cpuUsage, memUsage, opts.trendWindow, opts.predictive)
+			fmt.Printf("Service: %s, Scaling on CPU: %.1f%%, Memory: %.1f%% (trend over the last %d checks)\n",
+				serviceName, cpuUsage, memUsage, opts.trendWindow)
+		}
 
 		// Determine scaling action based on strategy
 		var newScale int
@@ -237,31 +689,194 @@ func checkAndScale(ctx context.Context, backend api.Compose, project *types.Proj
 		}
 
 		// Scale if needed
-		if newScale != currentScale {
-			fmt.Printf("Scaling %s from %d to %d replicas\n", serviceName, currentScale, newScale)
-
-			// Update service scale
-			service.SetScale(newScale)
-			project.Services[serviceName] = service
+		decision := scaleDecision{Time: time.Now(), From: currentScale, To: newScale, Result: "unchanged"}
+		if newScale == currentScale || !status.startScaling(serviceName) {
+			status.recordDecision(serviceName, decision)
+			continue
+		}
+		fmt.Printf("Scaling %s from %d to %d replicas\n", serviceName, currentScale, newScale)
+		if opts.events != nil {
+			opts.events.On(extensions.ScalingEvent(serviceName, currentScale, newScale))
+		}
 
-			// Apply scaling
-			if err := backend.Scale(ctx, project, api.ScaleOptions{
-				Services: []string{serviceName},
-			}); err != nil {
+		// Update service scale
+		service.SetScale(newScale)
+		project.Services[serviceName] = service
+
+		// Apply scaling on a copy, as the project keeps being updated by the next checks
+		scaled := *project
+		scaled.Services = maps.Clone(project.Services)
+		options := api.ScaleOptions{Services: []string{serviceName}}
+		if newScale == 0 && opts.toZeroGrace > 0 {
+			fmt.Printf("Stopping %s gracefully, within %s\n", serviceName, opts.toZeroGrace)
+			options.Timeout = &opts.toZeroGrace
+		}
+		scaling.Add(1)
+		go func(serviceName string) {
+			defer scaling.Done()
+			if err := backend.Scale(ctx, &scaled, options); err != nil {
 				fmt.Printf("Warning: Failed to scale %s: %v\n", serviceName, err)
+				decision.Result = "failed"
+				decision.Error = err.Error()
+				if opts.events != nil {
+					opts.events.On(extensions.ScaleErrorEvent(serviceName, err))
+				}
 			} else {
 				fmt.Printf("Successfully scaled %s to %d replicas\n", serviceName, newScale)
+				decision.Result = "scaled"
+				if opts.events != nil {
+					opts.events.On(extensions.ScaledEvent(serviceName, newScale))
+				}
 			}
-		}
+			status.recordDecision(serviceName, decision)
+		}(serviceName)
 	}
 
 	return nil
 }
 
-func getServiceResourceUsage(ctx context.Context, backend api.Compose, projectName, serviceName string) (float64, float64, error) {
-	// Simplified implementation - in real code, use backend.Stats or Docker API
-	// For demo purposes, return random values around 50%
-	return 50.0 + (rand.Float64()*20.0 - 10.0), 50.0 + (rand.Float64()*20.0 - 10.0), nil
+// replicaCounter counts the running replicas of the project services. The project containers are
+// listed on first use and cached, so a counter must not outlive a single scaling check.
+type replicaCounter struct {
+	backend    api.Compose
+	project    *types.Project
+	containers []api.ContainerSummary
+	loaded     bool
+}
+
+func newReplicaCounter(backend api.Compose, project *types.Project) *replicaCounter {
+	return &replicaCounter{backend: backend, project: project}
+}
+
+func (r *replicaCounter) runningReplicas(ctx context.Context, service string) (int, error) {
+	if !r.loaded {
+		containers, err := r.backend.Ps(ctx, r.project.Name, api.PsOptions{})
+		if err != nil {
+			return 0, err
+		}
+		r.containers, r.loaded = containers, true
+	}
+	return extensions.CountRunningReplicas(r.containers, r.project.Name, service), nil
+}
+
+// getServiceResourceUsage returns the scaling signal of a service as CPU and memory usage percentages
+func getServiceResourceUsage(ctx context.Context, dockerCli command.Cli, backend api.Compose, projectName string, service types.ServiceConfig, opts *scaleOptions) (float64, float64, error) {
+	switch opts.metricsSource {
+	case "prometheus":
+		query := opts.query
+		if xscale, ok := service.Extensions["x-scale"].(map[string]any); ok {
+			if q, ok := xscale["query"].(string); ok && q != "" {
+				query = q
+			}
+		}
+		value, err := queryPrometheus(ctx, opts.prometheusURL, strings.ReplaceAll(query, "${SERVICE}", service.Name))
+		// the query result is the only signal, memory never triggers scaling
+		return value, 0, err
+	default:
+		return getDockerStatsUsage(ctx, dockerCli, backend, projectName, service.Name)
+	}
+}
+
+// getDockerStatsUsage averages CPU and memory usage across the running replicas of a service
+func getDockerStatsUsage(ctx context.Context, dockerCli command.Cli, backend api.Compose, projectName, serviceName string) (float64, float64, error) {
+	containers, err := backend.Ps(ctx, projectName, api.PsOptions{Services: []string{serviceName}})
+	if err != nil {
+		return 0, 0, err
+	}
+	var cpuTotal, memTotal float64
+	var count int
+	for _, c := range containers {
+		if c.State != "running" {
+			continue
+		}
+		stats, err := readContainerStatsSample(ctx, dockerCli, c.ID)
+		if err != nil {
+			return 0, 0, err
+		}
+		cpuTotal += sampleCPUPercent(stats)
+		if stats.MemoryStats.Limit > 0 {
+			memTotal += float64(stats.MemoryStats.Usage) / float64(stats.MemoryStats.Limit) * 100
+		}
+		count++
+	}
+	if count == 0 {
+		return 0, 0, fmt.Errorf("no running containers for service %s", serviceName)
+	}
+	return cpuTotal / float64(count), memTotal / float64(count), nil
+}
+
+// queryPrometheus evaluates an instant query and returns its value. Vector results are summed.
+func queryPrometheus(ctx context.Context, serverURL, query string) (float64, error) {
+	endpoint := strings.TrimSuffix(serverURL, "/") + "/api/v1/query?query=" + url.QueryEscape(query)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	var body struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("invalid prometheus response: %w", err)
+	}
+	if body.Status != "success" {
+		return 0, fmt.Errorf("prometheus query failed: %s", body.Error)
+	}
+	return parsePrometheusResult(body.Data.ResultType, body.Data.Result)
+}
+
+func parsePrometheusResult(resultType string, result json.RawMessage) (float64, error) {
+	switch resultType {
+	case "scalar":
+		var sample []any
+		if err := json.Unmarshal(result, &sample); err != nil {
+			return 0, err
+		}
+		return prometheusSampleValue(sample)
+	case "vector":
+		var series []struct {
+			Value []any `json:"value"`
+		}
+		if err := json.Unmarshal(result, &series); err != nil {
+			return 0, err
+		}
+		if len(series) == 0 {
+			return 0, fmt.Errorf("prometheus query returned no data")
+		}
+		var total float64
+		for _, s := range series {
+			value, err := prometheusSampleValue(s.Value)
+			if err != nil {
+				return 0, err
+			}
+			total += value
+		}
+		return total, nil
+	default:
+		return 0, fmt.Errorf("unsupported prometheus result type: %s", resultType)
+	}
+}
+
+// prometheusSampleValue decodes a [timestamp, "value"] sample
+func prometheusSampleValue(sample []any) (float64, error) {
+	if len(sample) != 2 {
+		return 0, fmt.Errorf("invalid prometheus sample: %v", sample)
+	}
+	value, ok := sample[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid prometheus sample value: %v", sample[1])
+	}
+	return strconv.ParseFloat(value, 64)
 }
 
 func calculatePerformanceScale(currentScale int, cpuUsage, memUsage float64, opts *scaleOptions) int {
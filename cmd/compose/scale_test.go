@@ -0,0 +1,320 @@
+/*
+   Copyright 2020 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestQueryPrometheus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/query", r.URL.Path)
+		switch r.URL.Query().Get("query") {
+		case `sum(rate(http_requests_total{service="web"}[1m]))`:
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"instance":"a"},"value":[1700000000,"40.5"]},
+				{"metric":{"instance":"b"},"value":[1700000000,"10"]}]}}`))
+		case "scalar(1)":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1700000000,"1"]}}`))
+		default:
+			_, _ = w.Write([]byte(`{"status":"error","error":"parse error"}`))
+		}
+	}))
+	defer server.Close()
+
+	value, err := queryPrometheus(context.Background(), server.URL, `sum(rate(http_requests_total{service="web"}[1m]))`)
+	require.NoError(t, err)
+	assert.InDelta(t, 50.5, value, 0.001)
+
+	value, err = queryPrometheus(context.Background(), server.URL, "scalar(1)")
+	require.NoError(t, err)
+	assert.InDelta(t, 1.0, value, 0.001)
+
+	_, err = queryPrometheus(context.Background(), server.URL, "invalid(")
+	assert.ErrorContains(t, err, "prometheus query failed: parse error")
+}
+
+func TestAutoScaleStatusHandler(t *testing.T) {
+	status := newAutoScaleStatus()
+	status.recordMetrics("web", 2, 85, 40)
+	status.recordDecision("web", scaleDecision{From: 2, To: 3, Result: "scaled"})
+
+	server := httptest.NewServer(status.handler())
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/pause", "", nil)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.True(t, status.isPaused())
+
+	resp, err = http.Get(server.URL + "/status")
+	require.NoError(t, err)
+	defer resp.Body.Close() //nolint:errcheck
+	var body struct {
+		Paused   bool                              `json:"paused"`
+		Services map[string]autoScaleServiceStatus `json:"services"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.True(t, body.Paused)
+	assert.Equal(t, 3, body.Services["web"].Replicas)
+	assert.InDelta(t, 85, body.Services["web"].CPU, 0.001)
+	assert.Equal(t, "scaled", body.Services["web"].LastDecision.Result)
+
+	resp, err = http.Get(server.URL + "/pause")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = http.Post(server.URL+"/resume", "", nil)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.False(t, status.isPaused())
+}
+
+func TestCheckAndScaleSkipsServiceBeingScaled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1700000000,"95"]}}`))
+	}))
+	defer server.Close()
+
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	release := make(chan struct{})
+	labels := map[string]string{api.ProjectLabel: "shop", api.ServiceLabel: "web"}
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{}).Return([]api.ContainerSummary{
+		{ID: "1", State: "running", Labels: labels},
+	}, nil).AnyTimes()
+	backend.EXPECT().Scale(gomock.Any(), gomock.Any(), api.ScaleOptions{Services: []string{"web"}}).
+		DoAndReturn(func(context.Context, *types.Project, api.ScaleOptions) error {
+			<-release
+			return nil
+		}).Times(1)
+
+	project := &types.Project{Name: "shop", Services: types.Services{"web": {Name: "web"}}}
+	opts := &scaleOptions{
+		metricsSource: "prometheus", prometheusURL: server.URL, query: "load",
+		cpuThreshold: 70, memThreshold: 70, minReplicas: 1, maxReplicas: 5,
+	}
+	status := newAutoScaleStatus()
+	var scaling sync.WaitGroup
+
+	require.NoError(t, checkAndScale(context.Background(), nil, backend, project, project.Services, opts, status, &scaling))
+	assert.True(t, status.isScaling("web"))
+	// the second check finds the first scale operation still running and skips the service
+	require.NoError(t, checkAndScale(context.Background(), nil, backend, project, project.Services, opts, status, &scaling))
+
+	close(release)
+	scaling.Wait()
+	assert.False(t, status.isScaling("web"))
+	assert.Equal(t, 2, *project.Services["web"].Scale)
+	assert.Equal(t, "scaled", status.services["web"].LastDecision.Result)
+}
+
+func TestReplicaCounter(t *testing.T) {
+	web := map[string]string{api.ProjectLabel: "shop", api.ServiceLabel: "web"}
+	containers := []api.ContainerSummary{
+		{ID: "1", State: "running", Labels: web},
+		{ID: "2", State: "running", Labels: web},
+		{ID: "3", State: "exited", Labels: web},
+		{ID: "4", State: "running", Labels: map[string]string{api.ProjectLabel: "shop", api.ServiceLabel: "db"}},
+		{ID: "5", State: "running", Labels: map[string]string{api.ProjectLabel: "other", api.ServiceLabel: "web"}},
+	}
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	// containers are listed once per counter
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{}).Return(containers, nil).Times(1)
+	counter := newReplicaCounter(backend, &types.Project{Name: "shop"})
+	for _, service := range []string{"web", "db", "web"} {
+		_, err := counter.runningReplicas(context.Background(), service)
+		require.NoError(t, err)
+	}
+}
+
+func TestParseServicesReplicasArgs(t *testing.T) {
+	tuples, err := parseServicesReplicasArgs([]string{"web=3", "worker"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"web": 3, "worker": declaredReplicas}, tuples)
+
+	for _, arg := range []string{"=3", "web=", "web=x", "web=-1"} {
+		_, err := parseServicesReplicasArgs([]string{arg})
+		assert.ErrorContains(t, err, "invalid scale specifier", arg)
+	}
+}
+
+func TestScaleTargets(t *testing.T) {
+	replicas, scale := 3, 2
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"web":    {Name: "web", Deploy: &types.DeployConfig{Replicas: &replicas}},
+		"worker": {Name: "worker", Scale: &scale},
+		"db":     {Name: "db"},
+	}}
+
+	// without service, the services which don't declare their replicas are left untouched
+	targets, err := scaleTargets(project, map[string]int{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"web": declaredReplicas, "worker": declaredReplicas}, targets)
+
+	// named services are scaled as given, and fail when their replicas are neither given nor declared
+	targets, err = scaleTargets(project, map[string]int{"db": declaredReplicas, "web": 1})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"db": declaredReplicas, "web": 1}, targets)
+
+	_, err = scaleTargets(&types.Project{Name: "shop", Services: types.Services{"db": {Name: "db"}}}, map[string]int{})
+	assert.EqualError(t, err, "no service declares its replicas, use SERVICE=REPLICAS")
+}
+
+func TestScaleSelection(t *testing.T) {
+	replicas := 3
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"web": {Name: "web", Deploy: &types.DeployConfig{Replicas: &replicas}},
+		"db":  {Name: "db"},
+	}}
+	testCases := []struct {
+		name     string
+		args     []string
+		all      bool
+		expected map[string]int
+	}{
+		{name: "no arguments", expected: map[string]int{"web": declaredReplicas}},
+		{name: "all", all: true, expected: map[string]int{"web": declaredReplicas}},
+		{name: "all ignores arguments", args: []string{"db=2"}, all: true, expected: map[string]int{"web": declaredReplicas}},
+		{name: "named", args: []string{"db=2"}, expected: map[string]int{"db": 2}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &ProjectOptions{}
+			tuples, err := parseServicesReplicasArgs(opts.SelectServices(tc.args, tc.all))
+			require.NoError(t, err)
+			targets, err := scaleTargets(project, tuples)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, targets)
+		})
+	}
+}
+
+func TestBalanceReplicas(t *testing.T) {
+	shares := []scaleShare{
+		{Service: "api", Weight: 2, Min: 1, Max: 10},
+		{Service: "web", Weight: 1, Min: 1, Max: 10},
+		{Service: "worker", Weight: 1, Min: 1, Max: 10},
+	}
+	replicas, err := balanceReplicas(8, shares)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"api": 4, "web": 2, "worker": 2}, replicas)
+
+	// a capped service leaves its share to the others
+	shares[0].Max = 2
+	replicas, err = balanceReplicas(8, shares)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"api": 2, "web": 3, "worker": 3}, replicas)
+
+	_, err = balanceReplicas(2, shares)
+	assert.ErrorContains(t, err, "cannot balance 2 replicas, the services require between 3 and 22 replicas")
+	_, err = balanceReplicas(30, shares)
+	assert.ErrorContains(t, err, "between 3 and 22 replicas")
+}
+
+func TestServiceScaleShare(t *testing.T) {
+	share, err := serviceScaleShare(types.ServiceConfig{Name: "web"}, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, scaleShare{Service: "web", Weight: 1, Min: 1, Max: 10}, share)
+
+	share, err = serviceScaleShare(types.ServiceConfig{Name: "api", Extensions: types.Extensions{
+		"x-scale": map[string]any{"weight": 2.5, "min": 2, "max": 6, "query": "up"},
+	}}, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, scaleShare{Service: "api", Weight: 2.5, Min: 2, Max: 6}, share)
+
+	_, err = serviceScaleShare(types.ServiceConfig{Name: "api", Extensions: types.Extensions{
+		"x-scale": map[string]any{"weight": 0},
+	}}, 1, 10)
+	assert.ErrorContains(t, err, "x-scale.weight must be positive")
+	_, err = serviceScaleShare(types.ServiceConfig{Name: "api", Extensions: types.Extensions{
+		"x-scale": map[string]any{"min": 5, "max": 2},
+	}}, 1, 10)
+	assert.ErrorContains(t, err, "invalid replica bounds, min 5 and max 2")
+	_, err = serviceScaleShare(types.ServiceConfig{Name: "api", Extensions: types.Extensions{
+		"x-scale": map[string]any{"weight": "heavy"},
+	}}, 1, 10)
+	assert.ErrorContains(t, err, "x-scale.weight must be a number")
+}
+
+func TestScaleSignal(t *testing.T) {
+	assert.Equal(t, 50.0, scaleSignal([]float64{50}, true))
+	assert.Equal(t, 40.0, scaleSignal([]float64{20, 90, 10}, false), "a single spike is averaged out")
+	// a steady rise is projected to the next check
+	assert.InDelta(t, 80.0, scaleSignal([]float64{50, 60, 70}, true), 1e-9)
+	assert.Equal(t, 60.0, scaleSignal([]float64{50, 60, 70}, false))
+	// a falling trend doesn't anticipate scaling down
+	assert.Equal(t, 60.0, scaleSignal([]float64{70, 60, 50}, true))
+
+	status := newAutoScaleStatus()
+	for _, cpu := range []float64{10, 50, 60} {
+		status.usageSignal("web", cpu, 20, 2, false)
+	}
+	cpu, memory := status.usageSignal("web", 70, 30, 2, false)
+	assert.Equal(t, 65.0, cpu, "only the last 2 measures are kept")
+	assert.Equal(t, 25.0, memory)
+
+	status.recordDecision("web", scaleDecision{From: 2, To: 2, Result: "unchanged"})
+	cpu, _ = status.usageSignal("web", 80, 30, 2, false)
+	assert.Equal(t, 75.0, cpu)
+	status.recordDecision("web", scaleDecision{From: 2, To: 3, Result: "scaled"})
+	cpu, _ = status.usageSignal("web", 40, 30, 2, false)
+	assert.Equal(t, 40.0, cpu, "the measures are discarded once scaled")
+}
+
+func TestCheckAndScaleToZeroGrace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1700000000,"5"]}}`))
+	}))
+	defer server.Close()
+
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	labels := map[string]string{api.ProjectLabel: "shop", api.ServiceLabel: "web"}
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{}).Return([]api.ContainerSummary{
+		{ID: "1", State: "running", Labels: labels},
+	}, nil)
+	grace := 30 * time.Second
+	backend.EXPECT().Scale(gomock.Any(), gomock.Any(), api.ScaleOptions{Services: []string{"web"}, Timeout: &grace}).Return(nil)
+
+	project := &types.Project{Name: "shop", Services: types.Services{"web": {Name: "web"}}}
+	opts := &scaleOptions{
+		metricsSource: "prometheus", prometheusURL: server.URL, query: "load",
+		cpuThreshold: 70, memThreshold: 70, minReplicas: 0, maxReplicas: 5, toZeroGrace: grace,
+	}
+	var scaling sync.WaitGroup
+	require.NoError(t, checkAndScale(context.Background(), nil, backend, project, project.Services, opts, newAutoScaleStatus(), &scaling))
+	scaling.Wait()
+	assert.Equal(t, 0, *project.Services["web"].Scale)
+}
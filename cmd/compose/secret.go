@@ -17,33 +17,95 @@
 package compose
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/compose-spec/compose-go/v2/cli"
+	"github.com/compose-spec/compose-go/v2/dotenv"
 	"github.com/docker/cli/cli/command"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
 	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v4"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/pkg/compose"
+	"github.com/docker/compose/v5/pkg/extensions"
 )
 
 type secretOptions struct {
 	*ProjectOptions
-	name       string
-	value      string
-	file       string
-	rotate     bool
-	list       bool
-	remove     string
-	show       string
-	vault      bool
-	vaultAddr  string
-	vaultToken string
+	name        string
+	value       string
+	file        string
+	fromEnvFile string
+	key         string
+	prefix      string
+	rotate      bool
+	list        bool
+	remove      string
+	show        string
+	vault       bool
+	vaultAddr   string
+	vaultToken  string
+
+	asDockerSecret bool
+	writeCompose   bool
+
+	exportK8s    bool
+	k8sName      string
+	k8sNamespace string
+	only         []string
+	output       string
+
+	toEnvFile string
+	envPrefix string
+
+	actor     string
+	auditShow bool
+	format    string
+
+	scrub bool
+
+	diff bool
+
+	usage bool
+
+	ttl             time.Duration
+	watchRotate     bool
+	watchInterval   time.Duration
+	gracePeriod     time.Duration
+	onRotateCommand string
+
+	keepPrevious  bool
+	version       string
+	rollbackValue string
 }
 
 func secretCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *BackendOptions) *cobra.Command {
 	opts := secretOptions{
 		ProjectOptions: p,
+		watchInterval:  time.Minute,
 	}
 
 	cmd := &cobra.Command{
@@ -58,8 +120,99 @@ This command supports:
 4. Secret rotation
 5. External vault integration (HashiCorp Vault)
 6. Secret usage in services
+7. Export as a Kubernetes Secret manifest
+
+A secret created with --from-env-file stores every variable of the file as a field, use
+--show NAME --key FIELD to read a single one.
+
+Secret names can be grouped in namespaces using "/" (e.g. prod/db_password, dev/db_password),
+list a namespace with --list --prefix prod/. In compose files and Docker, "/" is replaced
+with "_" in the secret name.
+
+Every create, show, rotate and remove against the local store, and every secret written by
+--to-env-file or --export-k8s, is appended to an audit log with its result and actor (--actor, defaulting to
+$USER), never the secret value.
+Print it with --audit-show.
+
+On creation and rotation, the compose and env files of the project are scanned for the secret value and
+a warning lists where it appears in plaintext. Only values of 8 characters or more are looked for,
+and only as a whole YAML scalar or dotenv value. --scrub replaces these occurrences with a
+${VARIABLE} named after the secret (e.g. ${PROD_DB_PASSWORD} for prod/db_password), except in the
+env file entry defining that variable, which has to be removed by hand.
+
+--diff --vault compares the local store with the KV version 2 engine mounted on "secret/"
+in Vault (--vault-addr and --vault-token, or VAULT_ADDR and VAULT_TOKEN), listing the
+secrets only found locally, only found in Vault, and found in both with which side was
+updated last. Only metadata is compared, never the values. --prefix restricts the
+comparison to a namespace.
+
+--usage reports, for every stored secret, the services of the project referencing it in their
+secrets (by its compose name, e.g. prod_db_password) or interpolating its ${VARIABLE} (e.g.
+${PROD_DB_PASSWORD}, or ${API_TOKEN} for the TOKEN field of api), and lists the unused ones.
+--prefix restricts the report to a namespace.
+
+--to-env-file FILE writes the stored secrets, or the ones selected with --only or --prefix, to a
+dotenv file (mode 0600) for "docker compose --env-file FILE up". Variables are named as --scrub
+references them, e.g. PROD_DB_PASSWORD for prod/db_password and API_TOKEN for the TOKEN field of
+api, prefixed with --env-prefix when set. Secrets mapping to the same variable (e.g. db-pass and
+db_pass) are refused. The file holds the values in plaintext.
+
+--ttl on creation or rotation sets how long the values of a secret are valid. --watch-rotate
+then keeps rotating the secrets of the current project (referenced in its compose file or
+in its namespace, e.g. "myproject/...") past their TTL with a generated value, checking
+every --watch-interval. With --grace-period, the replaced value is kept as the previous
+value for that duration, and a secret is not rotated again while its previous value is
+still valid. --on-rotate-command runs on the host after each rotation, from the project
+directory, with COMPOSE_PROJECT_NAME and COMPOSE_SECRET_NAME set, e.g. to restart the
+services using it. Multi-field secrets can't be generated and are only reported.
+
+--rotate --keep-previous keeps the replaced value as the previous version of the secret,
+until the next rotation or for --grace-period when set, instead of overwriting it. Read it
+with --show NAME --version previous, and promote it back to current with --rollback-value NAME.
+Every rotation increments the version number shown by --list. With --vault, versions are
+the ones of the KV version 2 engine, which keeps them all, and --version also accepts a
+version number.
 `,
 		RunE: Adapt(func(ctx context.Context, args []string) error {
+			// Show the audit log
+			if opts.auditShow {
+				return runSecretAuditShow(dockerCli, &opts)
+			}
+
+			// Compare the local store with Vault
+			if opts.diff {
+				if !opts.vault {
+					return fmt.Errorf("--diff requires --vault")
+				}
+				return runSecretDiff(ctx, dockerCli, &opts)
+			}
+
+			// Report the services using every secret
+			if opts.usage {
+				return runSecretUsage(ctx, dockerCli, &opts)
+			}
+
+			// Rotate the secrets of the project past their TTL
+			if opts.watchRotate {
+				if opts.vault {
+					return fmt.Errorf("--watch-rotate only supports the local store")
+				}
+				return runSecretWatchRotate(ctx, dockerCli, backendOptions, &opts)
+			}
+			if opts.onRotateCommand != "" {
+				return fmt.Errorf("--on-rotate-command requires --watch-rotate")
+			}
+
+			// Export secrets as a Kubernetes manifest
+			if opts.exportK8s {
+				return runSecretExportK8s(ctx, dockerCli, &opts)
+			}
+
+			// Write secrets to a dotenv file
+			if opts.toEnvFile != "" {
+				return runSecretToEnvFile(dockerCli, &opts)
+			}
+
 			// List secrets
 			if opts.list {
 				return runSecretList(ctx, dockerCli, &opts)
@@ -67,12 +220,24 @@ This command supports:
 
 			// Remove secret
 			if opts.remove != "" {
-				return runSecretRemove(ctx, dockerCli, &opts)
+				return auditSecret(dockerCli, &opts, "remove", opts.remove, runSecretRemove(ctx, dockerCli, &opts))
+			}
+
+			if opts.version != "" && opts.show == "" {
+				return fmt.Errorf("--version requires --show")
+			}
+			if opts.keepPrevious && !opts.rotate {
+				return fmt.Errorf("--keep-previous requires --rotate")
+			}
+
+			// Promote the previous version of a secret back to current
+			if opts.rollbackValue != "" {
+				return auditSecret(dockerCli, &opts, "rollback", opts.rollbackValue, runSecretRollbackValue(ctx, dockerCli, &opts))
 			}
 
 			// Show secret
 			if opts.show != "" {
-				return runSecretShow(ctx, dockerCli, &opts)
+				return auditSecret(dockerCli, &opts, "show", opts.show, runSecretShow(ctx, dockerCli, &opts))
 			}
 
 			// Rotate secret
@@ -80,12 +245,12 @@ This command supports:
 				if opts.name == "" {
 					return fmt.Errorf("secret name is required for rotation")
 				}
-				return runSecretRotate(ctx, dockerCli, &opts)
+				return auditSecret(dockerCli, &opts, "rotate", opts.name, runSecretRotate(ctx, dockerCli, &opts))
 			}
 
 			// Create secret
 			if opts.name != "" {
-				return runSecretCreate(ctx, dockerCli, &opts)
+				return auditSecret(dockerCli, &opts, "create", opts.name, runSecretCreate(ctx, dockerCli, &opts))
 			}
 
 			// Default to help
@@ -96,48 +261,175 @@ This command supports:
 	cmd.Flags().StringVar(&opts.name, "name", "", "Secret name")
 	cmd.Flags().StringVar(&opts.value, "value", "", "Secret value")
 	cmd.Flags().StringVar(&opts.file, "file", "", "Read secret value from file")
+	cmd.Flags().StringVar(&opts.fromEnvFile, "from-env-file", "", "Store the variables of an env file as the secret fields")
+	cmd.Flags().StringVar(&opts.key, "key", "", "Only show this field of a multi-field secret")
 	cmd.Flags().BoolVar(&opts.rotate, "rotate", false, "Rotate secret")
 	cmd.Flags().BoolVar(&opts.list, "list", false, "List secrets")
+	cmd.Flags().StringVar(&opts.prefix, "prefix", "", "Only list secrets whose name starts with this prefix, e.g. a \"prod/\" namespace")
 	cmd.Flags().StringVar(&opts.remove, "remove", "", "Remove secret")
 	cmd.Flags().StringVar(&opts.show, "show", "", "Show secret value")
 	cmd.Flags().BoolVar(&opts.vault, "vault", false, "Use external vault (HashiCorp Vault)")
 	cmd.Flags().StringVar(&opts.vaultAddr, "vault-addr", "", "Vault server address")
 	cmd.Flags().StringVar(&opts.vaultToken, "vault-token", "", "Vault authentication token")
+	cmd.Flags().BoolVar(&opts.asDockerSecret, "as-docker-secret", false, "Also publish the secret as a Docker secret (Swarm) or as a local secret file")
+	cmd.Flags().BoolVar(&opts.writeCompose, "write-compose", false, "Write the secret to local files and print the compose configuration using them")
+	cmd.Flags().BoolVar(&opts.exportK8s, "export-k8s", false, "Export secrets as a Kubernetes Secret manifest")
+	cmd.Flags().StringVar(&opts.k8sName, "k8s-name", "compose-secrets", "Name of the exported Kubernetes Secret")
+	cmd.Flags().StringVar(&opts.k8sNamespace, "k8s-namespace", "default", "Namespace of the exported Kubernetes Secret")
+	cmd.Flags().StringSliceVar(&opts.only, "only", []string{}, "Only export the named secrets (comma separated or repeated)")
+	cmd.Flags().StringVar(&opts.toEnvFile, "to-env-file", "", "Write secrets to a dotenv file, for use with --env-file")
+	cmd.Flags().StringVar(&opts.envPrefix, "env-prefix", "", "With --to-env-file, prefix of the variable names (e.g. APP_)")
+	addOutputFlag(cmd.Flags(), &opts.output, "the output of --list, --audit-show, --diff and --export-k8s")
+	cmd.Flags().StringVar(&opts.actor, "actor", "", "Actor recorded in the audit log (default $USER)")
+	cmd.Flags().BoolVar(&opts.auditShow, "audit-show", false, "Show the audit log of secret operations")
+	cmd.Flags().StringVar(&opts.format, "format", "table", "Format of the --audit-show, --diff and --usage output (table, json)")
+	cmd.Flags().BoolVar(&opts.diff, "diff", false, "With --vault, list the secrets only found locally, only found in Vault, or in both")
+	cmd.Flags().BoolVar(&opts.usage, "usage", false, "Report the services of the project using every stored secret, and the unused ones")
+	cmd.Flags().DurationVar(&opts.ttl, "ttl", 0, "On creation or rotation, how long the secret value is valid before --watch-rotate rotates it")
+	cmd.Flags().BoolVar(&opts.watchRotate, "watch-rotate", false, "Keep rotating the secrets of the project past their TTL with generated values")
+	cmd.Flags().DurationVar(&opts.watchInterval, "watch-interval", time.Minute, "With --watch-rotate, how often the TTLs are checked")
+	cmd.Flags().DurationVar(&opts.gracePeriod, "grace-period", 0, "With --watch-rotate or --keep-previous, how long the replaced value is kept as the previous value")
+	cmd.Flags().StringVar(&opts.onRotateCommand, "on-rotate-command", "", "With --watch-rotate, command to run on the host after each rotation")
+	cmd.Flags().BoolVar(&opts.keepPrevious, "keep-previous", false, "With --rotate, keep the replaced value as the previous version")
+	cmd.Flags().StringVar(&opts.version, "version", "", "With --show, version to show (current, previous or a version number)")
+	cmd.Flags().StringVar(&opts.rollbackValue, "rollback-value", "", "Promote the previous version of a secret back to current")
+	cmd.Flags().BoolVar(&opts.scrub, "scrub", false, "On creation or rotation, replace the secret value found in the compose and env files with a ${VARIABLE} reference")
 	return cmd
 }
 
-func runSecretCreate(ctx context.Context, dockerCli command.Cli, opts *secretOptions) error {
-	secretName := opts.name
+// auditSecret records the outcome of an operation on the local store and returns its error.
+// Operations on an external vault are audited by the vault itself.
+func auditSecret(dockerCli command.Cli, opts *secretOptions, operation, name string, opErr error) error {
+	if opts.vault {
+		return opErr
+	}
+	actor := opts.actor
+	if actor == "" {
+		actor = os.Getenv("USER")
+	}
+	if err := secretStore().Audit(operation, name, actor, opErr); err != nil {
+		_, _ = fmt.Fprintf(dockerCli.Err(), "Warning: %v\n", err)
+	}
+	return opErr
+}
 
-	// Get secret value
-	var secretValue string
-	if opts.value != "" {
-		secretValue = opts.value
-	} else if opts.file != "" {
+// auditSecrets records the outcome of an operation on several secrets of the local store, one
+// record per secret, and returns its error
+func auditSecrets(dockerCli command.Cli, opts *secretOptions, operation string, secrets []SecretInfo, opErr error) error {
+	for _, secret := range secrets {
+		_ = auditSecret(dockerCli, opts, operation, secret.Name, opErr)
+	}
+	return opErr
+}
+
+func runSecretAuditShow(dockerCli command.Cli, opts *secretOptions) error {
+	records, err := secretStore().AuditLog()
+	if err != nil {
+		return err
+	}
+	return writeOutput(opts.output, 0o644, dockerCli.Out(), func(w io.Writer) error {
+		return printSecretAuditLog(w, records, opts.format)
+	})
+}
+
+// printSecretAuditLog renders the audit log as a table or as JSON
+func printSecretAuditLog(w io.Writer, records []extensions.SecretAuditRecord, format string) error {
+	switch format {
+	case "json":
+		if records == nil {
+			records = []extensions.SecretAuditRecord{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case "table", "":
+		if len(records) == 0 {
+			_, _ = fmt.Fprintln(w, "No secret operations recorded.")
+			return nil
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "TIME\tOPERATION\tSECRET\tRESULT\tACTOR")
+		for _, record := range records {
+			result := record.Result
+			if record.Error != "" {
+				result += ": " + record.Error
+			}
+			actor := record.Actor
+			if actor == "" {
+				actor = "-"
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", record.Time.Local().Format(time.DateTime), record.Operation, record.Secret, result, actor)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unsupported format %q, use table or json", format)
+	}
+}
+
+// readSecretInput reads the secret value, or its fields with --from-env-file, from the command flags
+func readSecretInput(opts *secretOptions) (string, map[string]string, error) {
+	switch {
+	case opts.value != "":
+		return opts.value, nil, nil
+	case opts.file != "":
 		content, err := os.ReadFile(opts.file)
 		if err != nil {
-			return fmt.Errorf("failed to read secret file: %v", err)
+			return "", nil, fmt.Errorf("failed to read secret file: %v", err)
 		}
-		secretValue = strings.TrimSpace(string(content))
-	} else {
-		return fmt.Errorf("secret value or file is required")
+		return strings.TrimSpace(string(content)), nil, nil
+	case opts.fromEnvFile != "":
+		fields, err := dotenv.Read(opts.fromEnvFile)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read env file: %v", err)
+		}
+		if len(fields) == 0 {
+			return "", nil, fmt.Errorf("no variables found in %s", opts.fromEnvFile)
+		}
+		return "", fields, nil
+	}
+	return "", nil, fmt.Errorf("secret value, file or env file is required")
+}
+
+func runSecretCreate(ctx context.Context, dockerCli command.Cli, opts *secretOptions) error {
+	secretName := opts.name
+
+	// Get secret value
+	secretValue, fields, err := readSecretInput(opts)
+	if err != nil {
+		return err
 	}
+	secret := SecretInfo{Name: secretName, Value: secretValue, Fields: fields}
 
 	// Use external vault if requested
 	if opts.vault {
-		return runSecretCreateVault(ctx, dockerCli, opts, secretName, secretValue)
+		if err := runSecretCreateVault(ctx, opts, secret); err != nil {
+			return err
+		}
+		return checkSecretLeaks(dockerCli, opts, secret)
 	}
 
-	// Create secret locally (simplified implementation)
-	err := saveSecret(secretName, secretValue)
+	// Create secret in the local store
+	err = saveSecret(secretName, secretValue, fields)
 	if err != nil {
 		return err
 	}
+	if err := setSecretTTL(secretName, opts.ttl); err != nil {
+		return err
+	}
 
 	fmt.Printf("Secret '%s' created successfully\n", secretName)
+	if err := checkSecretLeaks(dockerCli, opts, secret); err != nil {
+		return err
+	}
+	if opts.asDockerSecret {
+		return publishDockerSecret(ctx, dockerCli, secretName, secret.Content(), false)
+	}
+	if opts.writeCompose {
+		return writeComposeSecret(dockerCli.Out(), secret)
+	}
 	fmt.Println("To use this secret in services, add it to your compose file:")
-	fmt.Printf("\nsecrets:\n  %s:\n    external: true\n\n", secretName)
-	fmt.Printf("services:\n  your-service:\n    secrets:\n      - %s\n\n", secretName)
+	fmt.Printf("\nsecrets:\n  %s:\n    external: true\n\n", composeSecretName(secretName))
+	fmt.Printf("services:\n  your-service:\n    secrets:\n      - %s\n\n", composeSecretName(secretName))
 	return nil
 }
 
@@ -147,26 +439,39 @@ func runSecretList(ctx context.Context, dockerCli command.Cli, opts *secretOptio
 		return runSecretListVault(ctx, dockerCli, opts)
 	}
 
-	// List secrets locally (simplified implementation)
-	secrets := getSecrets()
+	// List secrets from the local store
+	secrets, err := getSecrets()
+	if err != nil {
+		return err
+	}
+	if opts.prefix != "" {
+		secrets = filterSecretsByPrefix(secrets, opts.prefix)
+	}
+
+	return writeOutput(opts.output, 0o644, dockerCli.Out(), func(w io.Writer) error {
+		printSecretList(w, secrets)
+		return nil
+	})
+}
 
+// printSecretList renders the secrets of the local store as a table
+func printSecretList(w io.Writer, secrets []SecretInfo) {
 	if len(secrets) == 0 {
-		fmt.Println("No secrets found.")
-		return nil
+		_, _ = fmt.Fprintln(w, "No secrets found.")
+		return
 	}
 
-	fmt.Println("Available secrets:")
-	fmt.Println("┌───────────────┬─────────────────────┬────────────────┐")
-	fmt.Println("│ Name          │ Created At          │ Status         │")
-	fmt.Println("├───────────────┼─────────────────────┼────────────────┤")
+	_, _ = fmt.Fprintln(w, "Available secrets:")
+	_, _ = fmt.Fprintln(w, "┌───────────────┬─────────┬─────────────────────┬────────────────┐")
+	_, _ = fmt.Fprintln(w, "│ Name          │ Version │ Created At          │ Status         │")
+	_, _ = fmt.Fprintln(w, "├───────────────┼─────────┼─────────────────────┼────────────────┤")
 
 	for _, secret := range secrets {
-		fmt.Printf("│ %-13s │ %-19s │ %-14s │\n",
-			secret.Name, secret.CreatedAt, secret.Status)
+		_, _ = fmt.Fprintf(w, "│ %-13s │ %-7d │ %-19s │ %-14s │\n",
+			secret.Name, secret.CurrentVersion(), secret.CreatedAt, secret.Status)
 	}
 
-	fmt.Println("└───────────────┴─────────────────────┴────────────────┘")
-	return nil
+	_, _ = fmt.Fprintln(w, "└───────────────┴─────────┴─────────────────────┴────────────────┘")
 }
 
 func runSecretRemove(ctx context.Context, dockerCli command.Cli, opts *secretOptions) error {
@@ -174,10 +479,10 @@ func runSecretRemove(ctx context.Context, dockerCli command.Cli, opts *secretOpt
 
 	// Use external vault if requested
 	if opts.vault {
-		return runSecretRemoveVault(ctx, dockerCli, opts, secretName)
+		return runSecretRemoveVault(ctx, opts, secretName)
 	}
 
-	// Remove secret locally (simplified implementation)
+	// Remove secret from the local store
 	err := removeSecret(secretName)
 	if err != nil {
 		return err
@@ -195,16 +500,110 @@ func runSecretShow(ctx context.Context, dockerCli command.Cli, opts *secretOptio
 		return runSecretShowVault(ctx, dockerCli, opts, secretName)
 	}
 
-	// Show secret locally (simplified implementation)
+	// Show secret from the local store
 	secret, err := getSecret(secretName)
 	if err != nil {
 		return err
 	}
+	secret, err = selectSecretVersion(secret, opts.version)
+	if err != nil {
+		return err
+	}
+
+	if opts.key != "" {
+		value, err := secret.Field(opts.key)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(dockerCli.Out(), value)
+		return nil
+	}
 
 	fmt.Printf("Secret: %s\n", secretName)
-	fmt.Printf("Value: %s\n", secret.Value)
+	fmt.Printf("Version: %d\n", secret.CurrentVersion())
+	if len(secret.Fields) > 0 {
+		fmt.Println("Fields:")
+		for _, key := range slices.Sorted(maps.Keys(secret.Fields)) {
+			fmt.Printf("  %s=%s\n", key, secret.Fields[key])
+		}
+	} else {
+		fmt.Printf("Value: %s\n", secret.Value)
+	}
 	fmt.Printf("Created: %s\n", secret.CreatedAt)
 	fmt.Printf("Updated: %s\n", secret.UpdatedAt)
+	if secret.TTL != "" {
+		fmt.Printf("TTL: %s\n", secret.TTL)
+	}
+	if secret.InGracePeriod(time.Now()) {
+		fmt.Printf("Previous value valid until: %s\n", secret.PreviousUntil)
+	} else if secret.HasPrevious() {
+		fmt.Println("Previous value kept until the next rotation")
+	}
+	return nil
+}
+
+// resolveSecretVersion resolves a --version selector (current, previous or a version number)
+// against the current version of a secret
+func resolveSecretVersion(selector string, current int) (int, error) {
+	switch selector {
+	case "", "current":
+		return current, nil
+	case "previous":
+		if current <= 1 {
+			return 0, fmt.Errorf("secret has no previous version")
+		}
+		return current - 1, nil
+	}
+	version, err := strconv.Atoi(selector)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid --version %q, use current, previous or a version number", selector)
+	}
+	if version > current {
+		return 0, fmt.Errorf("secret has no version %d, the current version is %d", version, current)
+	}
+	return version, nil
+}
+
+// selectSecretVersion returns the version of a local secret selected by --version, the local
+// store only keeps the current and previous ones
+func selectSecretVersion(secret *SecretInfo, selector string) (*SecretInfo, error) {
+	version, err := resolveSecretVersion(selector, secret.CurrentVersion())
+	if err != nil {
+		return nil, fmt.Errorf("secret '%s': %v", secret.Name, err)
+	}
+	switch version {
+	case secret.CurrentVersion():
+		return secret, nil
+	case secret.CurrentVersion() - 1:
+		previous, err := secret.PreviousVersion()
+		if err != nil {
+			return nil, err
+		}
+		return &previous, nil
+	}
+	return nil, fmt.Errorf("version %d of secret '%s' is not kept, the local store only keeps the current and previous versions", version, secret.Name)
+}
+
+func runSecretRollbackValue(ctx context.Context, dockerCli command.Cli, opts *secretOptions) error {
+	secretName := opts.rollbackValue
+
+	// Use external vault if requested
+	if opts.vault {
+		return runSecretRollbackValueVault(ctx, dockerCli, opts, secretName)
+	}
+
+	secret, err := secretStore().RollbackValue(secretName)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Secret '%s' rolled back to version %d, now version %d\n", secretName, secret.CurrentVersion()-2, secret.CurrentVersion())
+	if err := checkSecretLeaks(dockerCli, opts, *secret); err != nil {
+		return err
+	}
+	if opts.asDockerSecret {
+		return publishDockerSecret(ctx, dockerCli, secretName, secret.Content(), true)
+	}
+	fmt.Println("Note: You may need to restart services to use the new secret value.")
 	return nil
 }
 
@@ -212,155 +611,1279 @@ func runSecretRotate(ctx context.Context, dockerCli command.Cli, opts *secretOpt
 	secretName := opts.name
 
 	// Get new secret value
-	var newSecretValue string
-	if opts.value != "" {
-		newSecretValue = opts.value
-	} else if opts.file != "" {
-		content, err := os.ReadFile(opts.file)
-		if err != nil {
-			return fmt.Errorf("failed to read secret file: %v", err)
-		}
-		newSecretValue = strings.TrimSpace(string(content))
-	} else {
-		return fmt.Errorf("new secret value or file is required for rotation")
+	newSecretValue, fields, err := readSecretInput(opts)
+	if err != nil {
+		return err
 	}
+	secret := SecretInfo{Name: secretName, Value: newSecretValue, Fields: fields}
 
 	// Use external vault if requested
 	if opts.vault {
-		return runSecretRotateVault(ctx, dockerCli, opts, secretName, newSecretValue)
+		return runSecretRotateVault(ctx, opts, secret)
 	}
 
-	// Rotate secret locally (simplified implementation)
-	err := rotateSecret(secretName, newSecretValue)
+	// Rotate secret in the local store
+	if opts.gracePeriod < 0 {
+		return fmt.Errorf("--grace-period must not be negative, got %s", opts.gracePeriod)
+	}
+	if opts.keepPrevious {
+		err = secretStore().RotateKeepingPrevious(secretName, newSecretValue, fields, opts.gracePeriod)
+	} else {
+		err = rotateSecret(secretName, newSecretValue, fields)
+	}
 	if err != nil {
 		return err
 	}
+	if err := setSecretTTL(secretName, opts.ttl); err != nil {
+		return err
+	}
 
 	fmt.Printf("Secret '%s' rotated successfully\n", secretName)
+	if err := checkSecretLeaks(dockerCli, opts, secret); err != nil {
+		return err
+	}
+	if opts.asDockerSecret {
+		return publishDockerSecret(ctx, dockerCli, secretName, secret.Content(), true)
+	}
+	if opts.writeCompose {
+		return writeComposeSecret(dockerCli.Out(), secret)
+	}
 	fmt.Println("Note: You may need to restart services to use the new secret value.")
 	return nil
 }
 
-// Vault integration functions (simplified)
-func runSecretCreateVault(ctx context.Context, dockerCli command.Cli, opts *secretOptions, name, value string) error {
-	fmt.Printf("Creating secret '%s' in external vault\n", name)
-	// In real implementation, this would use HashiCorp Vault API
-	fmt.Println("Vault integration is not fully implemented in this demo")
-	return nil
+// setSecretTTL applies --ttl to a created or rotated secret, when set
+func setSecretTTL(name string, ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("--ttl must not be negative, got %s", ttl)
+	}
+	if ttl == 0 {
+		return nil
+	}
+	return secretStore().SetTTL(name, ttl)
 }
 
-func runSecretListVault(ctx context.Context, dockerCli command.Cli, opts *secretOptions) error {
-	fmt.Println("Listing secrets from external vault")
-	// In real implementation, this would use HashiCorp Vault API
-	fmt.Println("Vault integration is not fully implemented in this demo")
-	return nil
+func runSecretWatchRotate(ctx context.Context, dockerCli command.Cli, backendOptions *BackendOptions, opts *secretOptions) error {
+	if opts.watchInterval <= 0 {
+		return fmt.Errorf("--watch-interval must be positive, got %s", opts.watchInterval)
+	}
+	if opts.gracePeriod < 0 {
+		return fmt.Errorf("--grace-period must not be negative, got %s", opts.gracePeriod)
+	}
+	backend, err := compose.NewComposeService(dockerCli, backendOptions.Options...)
+	if err != nil {
+		return err
+	}
+	project, _, err := opts.ToProject(ctx, dockerCli, backend, nil)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Watching the TTL of the secrets of project %s every %s, press Ctrl+C to stop\n", project.Name, opts.watchInterval)
+	store := secretStore()
+	for {
+		if _, err := rotateDueSecrets(ctx, dockerCli, store, project, opts, time.Now()); err != nil {
+			fmt.Fprintf(dockerCli.Err(), "Warning: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.watchInterval):
+		}
+	}
 }
 
-func runSecretRemoveVault(ctx context.Context, dockerCli command.Cli, opts *secretOptions, name string) error {
-	fmt.Printf("Removing secret '%s' from external vault\n", name)
-	// In real implementation, this would use HashiCorp Vault API
-	fmt.Println("Vault integration is not fully implemented in this demo")
-	return nil
+// projectSecrets keeps the secrets of the project: referenced by its compose file, or in its
+// namespace
+func projectSecrets(secrets []SecretInfo, project *types.Project) []SecretInfo {
+	var selected []SecretInfo
+	for _, secret := range secrets {
+		_, referenced := project.Secrets[composeSecretName(secret.Name)]
+		if referenced || strings.HasPrefix(secret.Name, project.Name+"/") {
+			selected = append(selected, secret)
+		}
+	}
+	return selected
 }
 
-func runSecretShowVault(ctx context.Context, dockerCli command.Cli, opts *secretOptions, name string) error {
-	fmt.Printf("Showing secret '%s' from external vault\n", name)
-	// In real implementation, this would use HashiCorp Vault API
-	fmt.Println("Vault integration is not fully implemented in this demo")
-	return nil
+// rotateDueSecrets rotates the secrets of the project past their TTL with a generated value,
+// unless their previous value is still in its grace period, and runs --on-rotate-command for
+// each of them. The previous values past their grace period are dropped. It returns the names
+// of the rotated secrets.
+func rotateDueSecrets(ctx context.Context, dockerCli command.Cli, store *extensions.SecretStore, project *types.Project, opts *secretOptions, now time.Time) ([]string, error) {
+	secrets, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	var rotated []string
+	var errs []error
+	for _, secret := range projectSecrets(secrets, project) {
+		if secret.PreviousUntil != "" && !secret.InGracePeriod(now) {
+			secret.Previous, secret.PreviousFields, secret.PreviousUntil = "", nil, ""
+			if err := store.Write(secret); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			fmt.Printf("Previous value of secret '%s' expired\n", secret.Name)
+		}
+
+		due, err := secret.RotationDue(now)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !due || secret.InGracePeriod(now) {
+			continue
+		}
+		if len(secret.Fields) > 0 {
+			fmt.Fprintf(dockerCli.Err(), "Warning: secret '%s' is past its TTL, multi-field secrets must be rotated manually\n", secret.Name)
+			continue
+		}
+
+		value, err := generateSecretValue()
+		if err == nil && opts.gracePeriod > 0 {
+			err = store.RotateKeepingPrevious(secret.Name, value, nil, opts.gracePeriod)
+		} else if err == nil {
+			err = store.Rotate(secret.Name, value, nil)
+		}
+		if err := auditSecret(dockerCli, opts, "rotate", secret.Name, err); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rotated = append(rotated, secret.Name)
+		fmt.Printf("Secret '%s' rotated, its TTL of %s expired\n", secret.Name, secret.TTL)
+
+		if opts.onRotateCommand != "" {
+			cmd := exec.CommandContext(ctx, "/bin/sh", "-c", opts.onRotateCommand)
+			cmd.Dir = project.WorkingDir
+			cmd.Env = append(os.Environ(), "COMPOSE_PROJECT_NAME="+project.Name, "COMPOSE_SECRET_NAME="+secret.Name)
+			cmd.Stdout = dockerCli.Out()
+			cmd.Stderr = dockerCli.Err()
+			if err := cmd.Run(); err != nil {
+				errs = append(errs, fmt.Errorf("--on-rotate-command failed for secret '%s': %v", secret.Name, err))
+			}
+		}
+	}
+	return rotated, errors.Join(errs...)
 }
 
-func runSecretRotateVault(ctx context.Context, dockerCli command.Cli, opts *secretOptions, name, value string) error {
-	fmt.Printf("Rotating secret '%s' in external vault\n", name)
-	// In real implementation, this would use HashiCorp Vault API
-	fmt.Println("Vault integration is not fully implemented in this demo")
-	return nil
+// generateSecretValue returns a random value, URL and shell safe
+func generateSecretValue() (string, error) {
+	value := make([]byte, 32)
+	if _, err := rand.Read(value); err != nil {
+		return "", fmt.Errorf("failed to generate secret value: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(value), nil
 }
 
-// SecretInfo represents a secret in the store
-type SecretInfo struct {
-	Name      string
-	Value     string
-	CreatedAt string
-	UpdatedAt string
-	Status    string
-}
-
-func getSecrets() []SecretInfo {
-	// Simplified implementation - in real code, this would read from a secure store
-	return []SecretInfo{
-		{
-			Name:      "db_password",
-			Value:     "********",
-			CreatedAt: time.Now().Add(-72 * time.Hour).Format("2006-01-02 15:04:05"),
-			UpdatedAt: time.Now().Add(-72 * time.Hour).Format("2006-01-02 15:04:05"),
-			Status:    "active",
-		},
-		{
-			Name:      "api_key",
-			Value:     "********",
-			CreatedAt: time.Now().Add(-48 * time.Hour).Format("2006-01-02 15:04:05"),
-			UpdatedAt: time.Now().Add(-48 * time.Hour).Format("2006-01-02 15:04:05"),
-			Status:    "active",
-		},
-		{
-			Name:      "jwt_secret",
-			Value:     "********",
-			CreatedAt: time.Now().Add(-24 * time.Hour).Format("2006-01-02 15:04:05"),
-			UpdatedAt: time.Now().Add(-24 * time.Hour).Format("2006-01-02 15:04:05"),
-			Status:    "active",
-		},
+// secretLeakMinLength is the shortest value looked for in the project files, shorter ones match
+// too much unrelated configuration (ports, booleans, environment names...)
+const secretLeakMinLength = 8
+
+// secretLeak is an occurrence of a secret value in plaintext in a project file
+type secretLeak struct {
+	File     string
+	Line     int
+	Variable string
+	// Defining is set when the line is the env file entry of Variable itself, which is never scrubbed
+	Defining bool
+}
+
+// secretLeakVariable returns the variable a secret, or one of its fields, is referenced by once scrubbed
+func secretLeakVariable(name, key string) string {
+	if key != "" {
+		name += "_" + key
 	}
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(name))
 }
 
-func getSecret(name string) (*SecretInfo, error) {
-	// Simplified implementation - in real code, this would read from a secure store
-	secrets := map[string]*SecretInfo{
-		"db_password": {
-			Name:      "db_password",
-			Value:     "mysecretpassword",
-			CreatedAt: time.Now().Add(-72 * time.Hour).Format("2006-01-02 15:04:05"),
-			UpdatedAt: time.Now().Add(-72 * time.Hour).Format("2006-01-02 15:04:05"),
-			Status:    "active",
-		},
-		"api_key": {
-			Name:      "api_key",
-			Value:     "sk-1234567890abcdef",
-			CreatedAt: time.Now().Add(-48 * time.Hour).Format("2006-01-02 15:04:05"),
-			UpdatedAt: time.Now().Add(-48 * time.Hour).Format("2006-01-02 15:04:05"),
-			Status:    "active",
-		},
-		"jwt_secret": {
-			Name:      "jwt_secret",
-			Value:     "jwtsecret123",
-			CreatedAt: time.Now().Add(-24 * time.Hour).Format("2006-01-02 15:04:05"),
-			UpdatedAt: time.Now().Add(-24 * time.Hour).Format("2006-01-02 15:04:05"),
-			Status:    "active",
-		},
-	}
-
-	secret, ok := secrets[name]
-	if !ok {
-		return nil, fmt.Errorf("secret '%s' not found", name)
+// secretLeakValues maps the variables of a secret to the values to look for
+func secretLeakValues(secret SecretInfo) map[string]string {
+	values := map[string]string{}
+	if len(secret.Fields) > 0 {
+		for key, value := range secret.Fields {
+			if len(value) >= secretLeakMinLength {
+				values[secretLeakVariable(secret.Name, key)] = value
+			}
+		}
+	} else if len(secret.Value) >= secretLeakMinLength {
+		values[secretLeakVariable(secret.Name, "")] = secret.Value
 	}
+	return values
+}
 
-	return secret, nil
+// secretProjectFiles returns the compose and env files of the project, missing ones are skipped
+func secretProjectFiles(opts *ProjectOptions) []string {
+	if opts == nil {
+		return nil
+	}
+	options, err := opts.toProjectOptions()
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, file := range append(slices.Clone(options.ConfigPaths), options.EnvFiles...) {
+		if file == "-" {
+			continue
+		}
+		if _, err := os.Stat(file); err == nil && !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+	}
+	return files
 }
 
-func saveSecret(name, value string) error {
-	// Simplified implementation - in real code, this would save to a secure store
-	// For demo purposes, just return success
-	return nil
+// secretLeakKey matches the variable or key a line of a compose or env file assigns a value to
+var secretLeakKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*`)
+
+// secretLineValue locates the value assigned by a line of a compose or env file: a KEY=VALUE
+// dotenv entry or list item, a "key: value" YAML mapping, or a YAML list item. It returns the
+// offsets of the value, quotes included, the value without its quotes, and the variable the line
+// defines when it is a top level KEY=VALUE entry of an env file.
+func secretLineValue(line string) (start, end int, value, defines string) {
+	rest := strings.TrimLeft(line, " \t")
+	start = len(line) - len(rest)
+	topLevel := start == 0
+	listItem := strings.HasPrefix(rest, "- ")
+	switch {
+	case listItem:
+		rest = strings.TrimLeft(rest[1:], " \t")
+		start = len(line) - len(rest)
+	case topLevel && strings.HasPrefix(rest, "export "):
+		rest = strings.TrimLeft(rest[len("export "):], " \t")
+		start = len(line) - len(rest)
+	}
+	if key := secretLeakKey.FindString(rest); key != "" {
+		switch after := rest[len(key):]; {
+		case strings.HasPrefix(after, "="):
+			start += len(key) + 1
+			if topLevel && !listItem {
+				defines = key
+			}
+		case strings.HasPrefix(after, ":") && (len(after) == 1 || after[1] == ' ' || after[1] == '\t'):
+			after = strings.TrimLeft(after[1:], " \t")
+			start = len(line) - len(after)
+		}
+	}
+
+	end = len(strings.TrimRight(line, " \t\r"))
+	if start > end {
+		return end, end, "", defines
+	}
+	value = line[start:end]
+	if value != "" && (value[0] == '"' || value[0] == '\'') {
+		if i := strings.IndexByte(value[1:], value[0]); i >= 0 {
+			return start, start + i + 2, value[1 : i+1], defines
+		}
+	}
+	// an unquoted value ends with a comment
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimRight(value[:i], " \t")
+		end = start + len(value)
+	}
+	return start, end, value, defines
 }
 
-func removeSecret(name string) error {
-	// Simplified implementation - in real code, this would remove from a secure store
-	// For demo purposes, just return success
+// findSecretLeaks lists the lines of the files assigning one of the values, as a whole
+func findSecretLeaks(files []string, values map[string]string) ([]secretLeak, error) {
+	var leaks []secretLeak
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		for i, line := range strings.Split(string(content), "\n") {
+			_, _, value, defines := secretLineValue(line)
+			for _, variable := range slices.Sorted(maps.Keys(values)) {
+				if value == values[variable] {
+					leaks = append(leaks, secretLeak{File: file, Line: i + 1, Variable: variable, Defining: defines == variable})
+				}
+			}
+		}
+	}
+	return leaks, nil
+}
+
+// scrubSecretLeaks replaces the values assigned by the lines of the files with a ${VARIABLE}
+// reference, leaving the env file entries defining the variable itself
+func scrubSecretLeaks(files []string, values map[string]string) error {
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		lines := strings.Split(string(content), "\n")
+		for i, line := range lines {
+			start, end, value, defines := secretLineValue(line)
+			for _, variable := range slices.Sorted(maps.Keys(values)) {
+				if value == values[variable] && defines != variable {
+					lines[i] = line[:start] + "${" + variable + "}" + line[end:]
+					break
+				}
+			}
+		}
+		scrubbed := strings.Join(lines, "\n")
+		if scrubbed == string(content) {
+			continue
+		}
+		if err := os.WriteFile(file, []byte(scrubbed), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to scrub %s: %v", file, err)
+		}
+	}
 	return nil
 }
 
-func rotateSecret(name, newValue string) error {
-	// Simplified implementation - in real code, this would rotate in a secure store
-	// For demo purposes, just return success
+// checkSecretLeaks warns about the value of a created or rotated secret found in plaintext in the
+// project files, and replaces it with --scrub
+func checkSecretLeaks(dockerCli command.Cli, opts *secretOptions, secret SecretInfo) error {
+	values := secretLeakValues(secret)
+	if len(values) == 0 {
+		return nil
+	}
+	files := secretProjectFiles(opts.ProjectOptions)
+	leaks, err := findSecretLeaks(files, values)
+	if err != nil || len(leaks) == 0 {
+		return err
+	}
+
+	errOut := dockerCli.Err()
+	if opts.scrub {
+		var leaked []string
+		for _, leak := range leaks {
+			if !slices.Contains(leaked, leak.File) {
+				leaked = append(leaked, leak.File)
+			}
+		}
+		if err := scrubSecretLeaks(leaked, values); err != nil {
+			return err
+		}
+		for _, leak := range leaks {
+			if leak.Defining {
+				_, _ = fmt.Fprintf(errOut, "Left the value of secret '%s' in %s:%d, which defines %s: remove it by hand\n", secret.Name, leak.File, leak.Line, leak.Variable)
+				continue
+			}
+			_, _ = fmt.Fprintf(errOut, "Replaced the value of secret '%s' with ${%s} in %s:%d\n", secret.Name, leak.Variable, leak.File, leak.Line)
+		}
+		_, _ = fmt.Fprintln(errOut, "Set these variables from the secret store when running the project, or switch to a secret reference.")
+		return nil
+	}
+	_, _ = fmt.Fprintf(errOut, "WARNING: the value of secret '%s' is stored in plaintext in the project files:\n", secret.Name)
+	for _, leak := range leaks {
+		_, _ = fmt.Fprintf(errOut, "  %s:%d\n", leak.File, leak.Line)
+	}
+	_, _ = fmt.Fprintf(errOut, "Replace it with a secret reference (secrets: [%s]) or a ${VARIABLE}, or use --scrub (e.g. with --rotate) to replace it.\n", composeSecretName(secret.Name))
 	return nil
 }
+
+// publishDockerSecret makes a stored secret available to compose files. On a Swarm manager it
+// becomes a Docker secret, so `external: true` references resolve; otherwise it is written as
+// a file compose can mount with `file:`.
+func publishDockerSecret(ctx context.Context, dockerCli command.Cli, secretName, value string, rotate bool) error {
+	info, err := dockerCli.Client().Info(ctx)
+	if err != nil {
+		return err
+	}
+	name := composeSecretName(secretName)
+	if info.Swarm.LocalNodeState != swarm.LocalNodeStateActive || !info.Swarm.ControlAvailable {
+		file, err := writeSecretFile(secretName, value)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Docker engine is not a Swarm manager, secret '%s' written to %s\n", secretName, file)
+		fmt.Println("To use this secret in services, add it to your compose file:")
+		fmt.Printf("\nsecrets:\n  %s:\n    file: %s\n\n", name, file)
+		if rotate {
+			fmt.Println("Warning: Services using this secret must be recreated to use the new value.")
+		}
+		return nil
+	}
+
+	existing, err := dockerCli.Client().SecretList(ctx, swarm.SecretListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", name)),
+	})
+	if err != nil {
+		return err
+	}
+	for _, secret := range existing {
+		// the name filter matches on prefix
+		if secret.Spec.Name != name {
+			continue
+		}
+		if !rotate {
+			return fmt.Errorf("docker secret '%s' already exists", name)
+		}
+		// Docker secrets are immutable, rotation recreates them
+		if err := dockerCli.Client().SecretRemove(ctx, secret.ID); err != nil {
+			return fmt.Errorf("failed to remove docker secret '%s', detach it from the services using it first: %v", name, err)
+		}
+	}
+
+	if _, err := dockerCli.Client().SecretCreate(ctx, swarm.SecretSpec{
+		Annotations: swarm.Annotations{Name: name},
+		Data:        []byte(value),
+	}); err != nil {
+		return fmt.Errorf("failed to create docker secret '%s': %v", name, err)
+	}
+	fmt.Printf("Docker secret '%s' created, reference it with:\n", name)
+	fmt.Printf("\nsecrets:\n  %s:\n    external: true\n\n", name)
+	if rotate {
+		fmt.Println("Warning: Services using this secret must be updated to use the new value.")
+	}
+	return nil
+}
+
+// writeSecretFile writes the secret value as a plain file, readable by the current user only
+func writeSecretFile(name, value string) (string, error) {
+	if _, err := getSecretFile(name); err != nil {
+		return "", err
+	}
+	return writeSecretFileAt(filepath.Join(secretStore().FilesDir(), filepath.FromSlash(name)), value)
+}
+
+func writeSecretFileAt(file, value string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return "", fmt.Errorf("failed to create secret files directory: %v", err)
+	}
+	if err := os.WriteFile(file, []byte(value), 0o600); err != nil {
+		return "", fmt.Errorf("failed to write secret file: %v", err)
+	}
+	return file, nil
+}
+
+// writeComposeSecret writes the secret as files compose can mount and prints the matching
+// configuration. Each field of a multi-field secret becomes its own compose secret, and the
+// whole set is also written as an env file.
+func writeComposeSecret(w io.Writer, secret SecretInfo) error {
+	if len(secret.Fields) == 0 {
+		file, err := writeSecretFile(secret.Name, secret.Value)
+		if err != nil {
+			return err
+		}
+		name := composeSecretName(secret.Name)
+		_, _ = fmt.Fprintf(w, "\nsecrets:\n  %s:\n    file: %s\n\n", name, file)
+		_, _ = fmt.Fprintf(w, "services:\n  your-service:\n    secrets:\n      - %s\n", name)
+		return nil
+	}
+
+	if _, err := getSecretFile(secret.Name); err != nil {
+		return err
+	}
+	base := filepath.Join(secretStore().FilesDir(), filepath.FromSlash(secret.Name))
+	keys := slices.Sorted(maps.Keys(secret.Fields))
+	var names []string
+	_, _ = fmt.Fprintln(w, "\nsecrets:")
+	for _, key := range keys {
+		file, err := writeSecretFileAt(filepath.Join(base+".fields", key), secret.Fields[key])
+		if err != nil {
+			return err
+		}
+		name := composeSecretFieldName(secret.Name, key)
+		names = append(names, name)
+		_, _ = fmt.Fprintf(w, "  %s:\n    file: %s\n", name, file)
+	}
+	envFile, err := writeSecretFileAt(base+".env", secret.Content())
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprint(w, "\nservices:\n  your-service:\n    secrets:\n")
+	for _, name := range names {
+		_, _ = fmt.Fprintf(w, "      - %s\n", name)
+	}
+	_, _ = fmt.Fprintf(w, "    # or, to load all the fields as environment variables:\n    env_file: %s\n", envFile)
+	return nil
+}
+
+// composeSecretName turns a namespaced secret name into a valid compose and Docker secret name
+func composeSecretName(name string) string {
+	return strings.ReplaceAll(name, "/", "_")
+}
+
+// composeSecretFieldName names the compose secret holding a field of a multi-field secret
+func composeSecretFieldName(name, key string) string {
+	return strings.ToLower(composeSecretName(name) + "_" + key)
+}
+
+func runSecretExportK8s(ctx context.Context, dockerCli command.Cli, opts *secretOptions) error {
+	secrets, err := selectSecrets(opts.only)
+	if err != nil {
+		return err
+	}
+	if len(secrets) == 0 {
+		return fmt.Errorf("no secrets to export")
+	}
+
+	manifest, err := kubernetesSecretManifest(opts.k8sName, opts.k8sNamespace, secrets)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(dockerCli.Err(), "Warning: the exported manifest contains secret values, base64 is an encoding, not encryption.")
+	err = writeOutput(opts.output, 0o600, dockerCli.Out(), func(w io.Writer) error {
+		_, err := w.Write(manifest)
+		return err
+	})
+	return auditSecrets(dockerCli, opts, "export-k8s", secrets, err)
+}
+
+// selectSecrets returns the stored secrets with the given names, or all of them when names is empty
+func selectSecrets(names []string) ([]SecretInfo, error) {
+	if len(names) == 0 {
+		return getSecrets()
+	}
+	secrets := make([]SecretInfo, 0, len(names))
+	for _, name := range names {
+		secret, err := getSecret(name)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, *secret)
+	}
+	return secrets, nil
+}
+
+func runSecretToEnvFile(dockerCli command.Cli, opts *secretOptions) error {
+	if opts.vault {
+		return fmt.Errorf("--to-env-file only supports the local store")
+	}
+	secrets, err := selectSecrets(opts.only)
+	if err != nil {
+		return err
+	}
+	secrets = filterSecretsByPrefix(secrets, opts.prefix)
+	if len(secrets) == 0 {
+		return fmt.Errorf("no secrets to write")
+	}
+
+	fmt.Fprintf(dockerCli.Err(), "Warning: %s holds the secret values in plaintext, keep it out of version control.\n", opts.toEnvFile)
+	err = writeOutput(opts.toEnvFile, 0o600, dockerCli.Out(), func(w io.Writer) error {
+		return writeSecretEnvFile(w, secrets, opts.envPrefix)
+	})
+	if err := auditSecrets(dockerCli, opts, "to-env-file", secrets, err); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d secret(s) to %s, use it with --env-file %s\n", len(secrets), opts.toEnvFile, opts.toEnvFile)
+	return nil
+}
+
+// writeSecretEnvFile writes the secrets as dotenv variables, named as --scrub references them with
+// prefix prepended, one per field for multi-field secrets. Variables are sorted by name.
+func writeSecretEnvFile(w io.Writer, secrets []SecretInfo, prefix string) error {
+	values := map[string]string{}
+	sources := map[string]string{}
+	add := func(variable, source, value string) error {
+		if other, ok := sources[variable]; ok {
+			return fmt.Errorf("secrets %s and %s would both be written as %s", other, source, variable)
+		}
+		values[variable] = value
+		sources[variable] = source
+		return nil
+	}
+	for _, secret := range secrets {
+		if len(secret.Fields) == 0 {
+			if err := add(prefix+secretLeakVariable(secret.Name, ""), fmt.Sprintf("%q", secret.Name), secret.Value); err != nil {
+				return err
+			}
+		}
+		for _, key := range slices.Sorted(maps.Keys(secret.Fields)) {
+			source := fmt.Sprintf("%q (field %s)", secret.Name, key)
+			if err := add(prefix+secretLeakVariable(secret.Name, key), source, secret.Fields[key]); err != nil {
+				return err
+			}
+		}
+	}
+	for _, variable := range slices.Sorted(maps.Keys(values)) {
+		if !envKeyPattern.MatchString(variable) {
+			return fmt.Errorf("invalid variable name %q, check --env-prefix", variable)
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", variable, extensions.QuoteEnvValue(values[variable])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kubernetesSecretManifest renders secrets as an Opaque Kubernetes Secret, one data key per secret
+func kubernetesSecretManifest(name, namespace string, secrets []SecretInfo) ([]byte, error) {
+	type metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	}
+	manifest := struct {
+		APIVersion string            `yaml:"apiVersion"`
+		Kind       string            `yaml:"kind"`
+		Metadata   metadata          `yaml:"metadata"`
+		Type       string            `yaml:"type"`
+		Data       map[string]string `yaml:"data"`
+	}{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   metadata{Name: name, Namespace: namespace},
+		Type:       "Opaque",
+		Data:       map[string]string{},
+	}
+	for _, secret := range secrets {
+		if len(secret.Fields) == 0 {
+			manifest.Data[composeSecretName(secret.Name)] = base64.StdEncoding.EncodeToString([]byte(secret.Value))
+			continue
+		}
+		// fields are exported as-is, so the Secret can be consumed with envFrom
+		for key, value := range secret.Fields {
+			manifest.Data[key] = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// vaultSecretData returns the data of a secret as stored in Vault: its fields, or its value as
+// the "value" field
+func vaultSecretData(secret SecretInfo) map[string]string {
+	if len(secret.Fields) > 0 {
+		return secret.Fields
+	}
+	return map[string]string{"value": secret.Value}
+}
+
+func runSecretCreateVault(ctx context.Context, opts *secretOptions, secret SecretInfo) error {
+	client, err := newVaultClient(opts)
+	if err != nil {
+		return err
+	}
+	// only a secret known not to exist is created, any other failure is reported as-is
+	_, err = client.currentVersion(ctx, secret.Name)
+	if err == nil {
+		return fmt.Errorf("secret '%s' already exists in vault, use --rotate to update it", secret.Name)
+	}
+	if !errors.Is(err, errVaultSecretNotFound) {
+		return err
+	}
+	if _, err := client.write(ctx, secret.Name, vaultSecretData(secret)); err != nil {
+		return err
+	}
+	fmt.Printf("Secret '%s' created in vault\n", secret.Name)
+	return nil
+}
+
+func runSecretListVault(ctx context.Context, dockerCli command.Cli, opts *secretOptions) error {
+	client, err := newVaultClient(opts)
+	if err != nil {
+		return err
+	}
+	secrets, err := listVaultSecrets(ctx, client, opts.prefix)
+	if err != nil {
+		return err
+	}
+	return writeOutput(opts.output, 0o644, dockerCli.Out(), func(w io.Writer) error {
+		return printVaultSecretList(w, secrets)
+	})
+}
+
+// listVaultSecrets lists the Vault secrets whose name starts with prefix, sorted by name. Namespaces
+// map to KV paths, a prefix which isn't a whole namespace is listed from its parent path.
+func listVaultSecrets(ctx context.Context, client *vaultClient, prefix string) ([]vaultSecretMetadata, error) {
+	secrets, err := client.list(ctx, prefix[:strings.LastIndex(prefix, "/")+1])
+	if err != nil {
+		return nil, err
+	}
+	secrets = slices.DeleteFunc(secrets, func(secret vaultSecretMetadata) bool {
+		return !strings.HasPrefix(secret.Name, prefix)
+	})
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	return secrets, nil
+}
+
+// printVaultSecretList renders the secrets listed from Vault with their current version
+func printVaultSecretList(w io.Writer, secrets []vaultSecretMetadata) error {
+	if len(secrets) == 0 {
+		_, _ = fmt.Fprintln(w, "No secrets found in vault.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SECRET\tVERSION\tUPDATED")
+	for _, secret := range secrets {
+		updated := "-"
+		if !secret.UpdatedAt.IsZero() {
+			updated = secret.UpdatedAt.Local().Format(time.DateTime)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\n", secret.Name, secret.Version, updated)
+	}
+	return tw.Flush()
+}
+
+func runSecretRemoveVault(ctx context.Context, opts *secretOptions, name string) error {
+	client, err := newVaultClient(opts)
+	if err != nil {
+		return err
+	}
+	if _, err := client.currentVersion(ctx, name); err != nil {
+		return err
+	}
+	if err := client.remove(ctx, name); err != nil {
+		return err
+	}
+	fmt.Printf("Secret '%s' removed from vault with all its versions\n", name)
+	return nil
+}
+
+func runSecretShowVault(ctx context.Context, dockerCli command.Cli, opts *secretOptions, name string) error {
+	client, err := newVaultClient(opts)
+	if err != nil {
+		return err
+	}
+	current, err := client.currentVersion(ctx, name)
+	if err != nil {
+		return err
+	}
+	version, err := resolveSecretVersion(opts.version, current)
+	if err != nil {
+		return fmt.Errorf("secret '%s': %v", name, err)
+	}
+	data, err := client.read(ctx, name, version)
+	if err != nil {
+		return err
+	}
+
+	if opts.key != "" {
+		value, ok := data[opts.key]
+		if !ok {
+			return fmt.Errorf("secret '%s' has no field '%s'", name, opts.key)
+		}
+		_, _ = fmt.Fprintln(dockerCli.Out(), value)
+		return nil
+	}
+	fmt.Printf("Secret: %s\n", name)
+	fmt.Printf("Version: %d\n", version)
+	if value, ok := data["value"]; ok && len(data) == 1 {
+		fmt.Printf("Value: %s\n", value)
+		return nil
+	}
+	fmt.Println("Fields:")
+	for _, key := range slices.Sorted(maps.Keys(data)) {
+		fmt.Printf("  %s=%s\n", key, data[key])
+	}
+	return nil
+}
+
+// runSecretRollbackValueVault writes the data of the previous version of a Vault secret as a
+// new version, KV versions being immutable
+func runSecretRollbackValueVault(ctx context.Context, dockerCli command.Cli, opts *secretOptions, name string) error {
+	client, err := newVaultClient(opts)
+	if err != nil {
+		return err
+	}
+	current, err := client.currentVersion(ctx, name)
+	if err != nil {
+		return err
+	}
+	previous, err := resolveSecretVersion("previous", current)
+	if err != nil {
+		return fmt.Errorf("secret '%s': %v", name, err)
+	}
+	data, err := client.read(ctx, name, previous)
+	if err != nil {
+		return err
+	}
+	version, err := client.write(ctx, name, data)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Secret '%s' rolled back to version %d, now version %d\n", name, previous, version)
+	return nil
+}
+
+// runSecretRotateVault writes the new value as a new version of the secret, the replaced one
+// stays readable with --show NAME --version previous
+func runSecretRotateVault(ctx context.Context, opts *secretOptions, secret SecretInfo) error {
+	client, err := newVaultClient(opts)
+	if err != nil {
+		return err
+	}
+	if _, err := client.currentVersion(ctx, secret.Name); err != nil {
+		return err
+	}
+	version, err := client.write(ctx, secret.Name, vaultSecretData(secret))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Secret '%s' rotated in vault, now version %d\n", secret.Name, version)
+	return nil
+}
+
+// secretVaultMount is the path of the KV version 2 secrets engine holding the secrets in Vault
+const secretVaultMount = "secret"
+
+// vaultSecretMetadata is the metadata of a secret stored in Vault
+type vaultSecretMetadata struct {
+	Name      string
+	Version   int
+	UpdatedAt time.Time
+}
+
+// vaultClient reads and writes secrets in the KV version 2 engine of a Vault server
+type vaultClient struct {
+	addr  string
+	token string
+	mount string
+}
+
+func newVaultClient(opts *secretOptions) (*vaultClient, error) {
+	addr := cmp.Or(opts.vaultAddr, os.Getenv("VAULT_ADDR"))
+	if addr == "" {
+		return nil, fmt.Errorf("vault address is required, use --vault-addr or set VAULT_ADDR")
+	}
+	token := cmp.Or(opts.vaultToken, os.Getenv("VAULT_TOKEN"))
+	if token == "" {
+		return nil, fmt.Errorf("vault token is required, use --vault-token or set VAULT_TOKEN")
+	}
+	return &vaultClient{addr: strings.TrimRight(addr, "/"), token: token, mount: secretVaultMount}, nil
+}
+
+// get sends a request to the metadata endpoint of path and decodes the data of the response, it
+// returns false when the path doesn't exist
+func (c *vaultClient) get(ctx context.Context, path string, list bool, data any) (bool, error) {
+	endpoint := fmt.Sprintf("%s/v1/%s/metadata/%s", c.addr, c.mount, path)
+	if list {
+		endpoint += "?list=true"
+	}
+	return c.do(ctx, http.MethodGet, endpoint, nil, data)
+}
+
+// do sends a request to endpoint and decodes the data of the response, it returns false when
+// the path doesn't exist
+func (c *vaultClient) do(ctx context.Context, method, endpoint string, payload any, data any) (bool, error) {
+	var body io.Reader
+	if payload != nil {
+		buf, err := json.Marshal(payload)
+		if err != nil {
+			return false, err
+		}
+		body = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("X-Vault-Token", c.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to query vault: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to query vault: %s", resp.Status)
+	}
+	response := struct {
+		Data any `json:"data"`
+	}{Data: data}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return false, fmt.Errorf("failed to parse vault response: %v", err)
+	}
+	return true, nil
+}
+
+// errVaultSecretNotFound is returned for a secret which doesn't exist in Vault
+var errVaultSecretNotFound = errors.New("not found in vault")
+
+// currentVersion returns the current version of a secret
+func (c *vaultClient) currentVersion(ctx context.Context, name string) (int, error) {
+	var metadata struct {
+		CurrentVersion int `json:"current_version"`
+	}
+	ok, err := c.get(ctx, name, false, &metadata)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("secret '%s' %w", name, errVaultSecretNotFound)
+	}
+	return metadata.CurrentVersion, nil
+}
+
+// read returns the data of a version of a secret
+func (c *vaultClient) read(ctx context.Context, name string, version int) (map[string]string, error) {
+	var secret struct {
+		Data map[string]string `json:"data"`
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/data/%s?version=%d", c.addr, c.mount, name, version)
+	ok, err := c.do(ctx, http.MethodGet, endpoint, nil, &secret)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("version %d of secret '%s' not found in vault", version, name)
+	}
+	return secret.Data, nil
+}
+
+// write stores data as a new version of a secret and returns its version number
+func (c *vaultClient) write(ctx context.Context, name string, data map[string]string) (int, error) {
+	var metadata struct {
+		Version int `json:"version"`
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/data/%s", c.addr, c.mount, name)
+	if _, err := c.do(ctx, http.MethodPost, endpoint, map[string]any{"data": data}, &metadata); err != nil {
+		return 0, err
+	}
+	return metadata.Version, nil
+}
+
+// remove deletes a secret with all its versions
+func (c *vaultClient) remove(ctx context.Context, name string) error {
+	endpoint := fmt.Sprintf("%s/v1/%s/metadata/%s", c.addr, c.mount, name)
+	_, err := c.do(ctx, http.MethodDelete, endpoint, nil, nil)
+	return err
+}
+
+// list returns the metadata of the secrets under a path, recursively. Secrets are named after
+// their path, so namespaces of the local store map to Vault paths.
+func (c *vaultClient) list(ctx context.Context, path string) ([]vaultSecretMetadata, error) {
+	var keys struct {
+		Keys []string `json:"keys"`
+	}
+	if ok, err := c.get(ctx, path, true, &keys); err != nil || !ok {
+		return nil, err
+	}
+	var secrets []vaultSecretMetadata
+	for _, key := range keys.Keys {
+		if strings.HasSuffix(key, "/") {
+			nested, err := c.list(ctx, path+key)
+			if err != nil {
+				return nil, err
+			}
+			secrets = append(secrets, nested...)
+			continue
+		}
+		var metadata struct {
+			CurrentVersion int       `json:"current_version"`
+			UpdatedTime    time.Time `json:"updated_time"`
+		}
+		if _, err := c.get(ctx, path+url.PathEscape(key), false, &metadata); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, vaultSecretMetadata{Name: path + key, Version: metadata.CurrentVersion, UpdatedAt: metadata.UpdatedTime})
+	}
+	return secrets, nil
+}
+
+const (
+	secretDiffLocalOnly = "local only"
+	secretDiffVaultOnly = "vault only"
+	secretDiffBoth      = "both"
+)
+
+// secretDiffEntry is a secret of the local store or of Vault, and where it was updated last when
+// found in both
+type secretDiffEntry struct {
+	Name           string     `json:"name"`
+	State          string     `json:"state"`
+	LocalUpdatedAt *time.Time `json:"localUpdatedAt,omitempty"`
+	VaultVersion   int        `json:"vaultVersion,omitempty"`
+	VaultUpdatedAt *time.Time `json:"vaultUpdatedAt,omitempty"`
+	Newer          string     `json:"newer,omitempty"`
+}
+
+// diffSecretBackends compares the local secrets with the Vault ones by name, sorted by name
+func diffSecretBackends(local []extensions.Secret, vault []vaultSecretMetadata) []secretDiffEntry {
+	entries := map[string]*secretDiffEntry{}
+	for _, secret := range local {
+		entry := &secretDiffEntry{Name: secret.Name, State: secretDiffLocalOnly}
+		if updated, err := time.ParseInLocation(extensions.SecretTimeLayout, secret.UpdatedAt, time.Local); err == nil {
+			entry.LocalUpdatedAt = &updated
+		}
+		entries[secret.Name] = entry
+	}
+	for _, secret := range vault {
+		entry, ok := entries[secret.Name]
+		if !ok {
+			entry = &secretDiffEntry{Name: secret.Name, State: secretDiffVaultOnly}
+			entries[secret.Name] = entry
+		} else {
+			entry.State = secretDiffBoth
+		}
+		entry.VaultVersion = secret.Version
+		if !secret.UpdatedAt.IsZero() {
+			updated := secret.UpdatedAt
+			entry.VaultUpdatedAt = &updated
+		}
+		if ok && entry.LocalUpdatedAt != nil && entry.VaultUpdatedAt != nil {
+			// the local store has a second precision
+			switch local, vault := *entry.LocalUpdatedAt, entry.VaultUpdatedAt.Truncate(time.Second); {
+			case local.After(vault):
+				entry.Newer = "local"
+			case vault.After(local):
+				entry.Newer = "vault"
+			}
+		}
+	}
+	diff := make([]secretDiffEntry, 0, len(entries))
+	for _, entry := range entries {
+		diff = append(diff, *entry)
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Name < diff[j].Name })
+	return diff
+}
+
+func runSecretDiff(ctx context.Context, dockerCli command.Cli, opts *secretOptions) error {
+	client, err := newVaultClient(opts)
+	if err != nil {
+		return err
+	}
+	local, err := getSecrets()
+	if err != nil {
+		return err
+	}
+	vault, err := listVaultSecrets(ctx, client, opts.prefix)
+	if err != nil {
+		return err
+	}
+	diff := diffSecretBackends(filterSecretsByPrefix(local, opts.prefix), vault)
+	return writeOutput(opts.output, 0o644, dockerCli.Out(), func(w io.Writer) error {
+		return printSecretDiff(w, diff, opts.format)
+	})
+}
+
+// printSecretDiff renders the comparison of the local store with Vault as a table or as JSON
+func printSecretDiff(w io.Writer, diff []secretDiffEntry, format string) error {
+	switch format {
+	case "json":
+		if diff == nil {
+			diff = []secretDiffEntry{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	case "table", "":
+		if len(diff) == 0 {
+			_, _ = fmt.Fprintln(w, "No secrets found locally nor in Vault.")
+			return nil
+		}
+		formatTime := func(t *time.Time) string {
+			if t == nil {
+				return "-"
+			}
+			return t.Local().Format(time.DateTime)
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "SECRET\tSTATE\tLOCAL UPDATED\tVAULT VERSION\tVAULT UPDATED\tNEWER")
+		for _, entry := range diff {
+			version := "-"
+			if entry.VaultVersion > 0 {
+				version = strconv.Itoa(entry.VaultVersion)
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Name, entry.State,
+				formatTime(entry.LocalUpdatedAt), version, formatTime(entry.VaultUpdatedAt), cmp.Or(entry.Newer, "-"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unsupported format %q, use table or json", format)
+	}
+}
+
+// secretUsageVariable matches the ${VARIABLE} and $VARIABLE references of a value, and the $$
+// escapes to skip
+var secretUsageVariable = regexp.MustCompile(`\$(\$|\{([A-Za-z_][A-Za-z0-9_]*)|([A-Za-z_][A-Za-z0-9_]*))`)
+
+// secretReference is a service using a secret, via its secrets or via the interpolation of a variable
+type secretReference struct {
+	Service string `json:"service"`
+	Via     string `json:"via"`
+}
+
+// secretUsage lists the services of the project referencing a stored secret
+type secretUsage struct {
+	Name       string            `json:"name"`
+	References []secretReference `json:"references"`
+}
+
+func runSecretUsage(ctx context.Context, dockerCli command.Cli, opts *secretOptions) error {
+	if opts.vault {
+		return fmt.Errorf("--usage only supports the local store")
+	}
+	secrets, err := getSecrets()
+	if err != nil {
+		return err
+	}
+	// the model isn't interpolated, so the ${VARIABLE} references are still there
+	model, err := opts.ToModel(ctx, dockerCli, nil, cli.WithInterpolation(false), cli.WithoutEnvironmentResolution)
+	if err != nil {
+		return err
+	}
+	usage := secretUsageReport(model, filterSecretsByPrefix(secrets, opts.prefix))
+	return writeOutput(opts.output, 0o644, dockerCli.Out(), func(w io.Writer) error {
+		return printSecretUsage(w, usage, opts.format)
+	})
+}
+
+// secretUsageReport lists, for every secret, the services of the model referencing it in their
+// secrets, by its compose name, or interpolating one of its variables. Secrets and services are
+// sorted by name.
+func secretUsageReport(model map[string]any, secrets []SecretInfo) []secretUsage {
+	services, _ := model["services"].(map[string]any)
+	serviceSecrets := map[string][]string{}
+	serviceVariables := map[string][]string{}
+	for name, service := range services {
+		config, _ := service.(map[string]any)
+		serviceSecrets[name] = modelServiceSecrets(config)
+		serviceVariables[name] = modelVariables(config, nil)
+	}
+
+	usage := make([]secretUsage, 0, len(secrets))
+	for _, secret := range secrets {
+		variables := []string{secretLeakVariable(secret.Name, "")}
+		for _, key := range slices.Sorted(maps.Keys(secret.Fields)) {
+			variables = append(variables, secretLeakVariable(secret.Name, key))
+		}
+		entry := secretUsage{Name: secret.Name, References: []secretReference{}}
+		for _, service := range slices.Sorted(maps.Keys(services)) {
+			if slices.Contains(serviceSecrets[service], composeSecretName(secret.Name)) {
+				entry.References = append(entry.References, secretReference{Service: service, Via: "secrets"})
+			}
+			for _, variable := range variables {
+				if slices.Contains(serviceVariables[service], variable) {
+					entry.References = append(entry.References, secretReference{Service: service, Via: "${" + variable + "}"})
+				}
+			}
+		}
+		usage = append(usage, entry)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Name < usage[j].Name })
+	return usage
+}
+
+// modelServiceSecrets returns the sources of the secrets of a service, in short or long syntax
+func modelServiceSecrets(service map[string]any) []string {
+	entries, _ := service["secrets"].([]any)
+	var sources []string
+	for _, entry := range entries {
+		switch entry := entry.(type) {
+		case string:
+			sources = append(sources, entry)
+		case map[string]any:
+			if source, ok := entry["source"].(string); ok {
+				sources = append(sources, source)
+			}
+		}
+	}
+	return sources
+}
+
+// modelVariables appends the variables referenced by the strings of a model value
+func modelVariables(value any, variables []string) []string {
+	switch value := value.(type) {
+	case string:
+		for _, match := range secretUsageVariable.FindAllStringSubmatch(value, -1) {
+			if variable := cmp.Or(match[2], match[3]); variable != "" && !slices.Contains(variables, variable) {
+				variables = append(variables, variable)
+			}
+		}
+	case map[string]any:
+		for _, item := range value {
+			variables = modelVariables(item, variables)
+		}
+	case []any:
+		for _, item := range value {
+			variables = modelVariables(item, variables)
+		}
+	}
+	return variables
+}
+
+// printSecretUsage renders the services using every secret as a table, followed by the unused
+// ones, or as JSON
+func printSecretUsage(w io.Writer, usage []secretUsage, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(usage)
+	case "table", "":
+		if len(usage) == 0 {
+			_, _ = fmt.Fprintln(w, "No secrets stored.")
+			return nil
+		}
+		var unused []string
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "SECRET\tSERVICE\tVIA")
+		for _, entry := range usage {
+			if len(entry.References) == 0 {
+				unused = append(unused, entry.Name)
+				_, _ = fmt.Fprintf(tw, "%s\t-\t-\n", entry.Name)
+			}
+			for _, reference := range entry.References {
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", entry.Name, reference.Service, reference.Via)
+			}
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		if len(unused) > 0 {
+			_, _ = fmt.Fprintf(w, "\nUnused secrets: %s\n", strings.Join(unused, ", "))
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format %q, use table or json", format)
+	}
+}
+
+// SecretInfo represents a secret in the store
+type SecretInfo = extensions.Secret
+
+// secretStore returns the local secret store of the current user
+func secretStore() *extensions.SecretStore {
+	return extensions.DefaultSecretStore()
+}
+
+func getSecretsDir() string {
+	return secretStore().Dir
+}
+
+func getSecretFile(name string) (string, error) {
+	return secretStore().File(name)
+}
+
+func getSecrets() ([]SecretInfo, error) {
+	return secretStore().List()
+}
+
+func filterSecretsByPrefix(secrets []SecretInfo, prefix string) []SecretInfo {
+	return extensions.FilterSecretsByPrefix(secrets, prefix)
+}
+
+func getSecret(name string) (*SecretInfo, error) {
+	return secretStore().Get(name)
+}
+
+func saveSecret(name, value string, fields map[string]string) error {
+	return secretStore().Save(name, value, fields)
+}
+
+func removeSecret(name string) error {
+	return secretStore().Remove(name)
+}
+
+func rotateSecret(name, newValue string, fields map[string]string) error {
+	return secretStore().Rotate(name, newValue, fields)
+}
@@ -0,0 +1,641 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/cli"
+	"github.com/compose-spec/compose-go/v2/dotenv"
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/cli/cli/streams"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/docker/compose/v5/pkg/extensions"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestSecretStore(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	require.NoError(t, saveSecret("db_password", "hunter2", nil))
+	assert.ErrorContains(t, saveSecret("db_password", "other", nil), "already exists")
+	require.NoError(t, rotateSecret("db_password", "correct-horse", nil))
+
+	secret, err := getSecret("db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "correct-horse", secret.Value)
+	assert.Equal(t, "active", secret.Status)
+
+	_, err = getSecret("../escape")
+	assert.ErrorContains(t, err, "invalid secret name")
+
+	file, err := writeSecretFile("db_password", "correct-horse")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(getSecretsDir(), "files", "db_password"), file)
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "correct-horse", string(content))
+
+	secrets, err := getSecrets()
+	require.NoError(t, err)
+	assert.Len(t, secrets, 1)
+
+	require.NoError(t, removeSecret("db_password"))
+	assert.NoFileExists(t, file)
+	assert.ErrorContains(t, removeSecret("db_password"), "not found")
+}
+
+func TestSecretNamespaces(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	require.NoError(t, saveSecret("prod/db_password", "prod-pass", nil))
+	require.NoError(t, saveSecret("dev/db_password", "dev-pass", nil))
+	require.NoError(t, saveSecret("api_key", "abc", nil))
+	assert.FileExists(t, filepath.Join(getSecretsDir(), "prod", "db_password.json"))
+	require.NoError(t, rotateSecret("prod/db_password", "new-pass", nil))
+
+	secrets, err := getSecrets()
+	require.NoError(t, err)
+	assert.Len(t, secrets, 3)
+	prod := filterSecretsByPrefix(secrets, "prod/")
+	require.Len(t, prod, 1)
+	assert.Equal(t, "new-pass", prod[0].Value)
+
+	for _, name := range []string{"prod/", "/abs", "prod/../x", "files/x"} {
+		_, err := getSecretFile(name)
+		assert.ErrorContains(t, err, "invalid secret name", name)
+	}
+
+	file, err := writeSecretFile("prod/db_password", "new-pass")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(getSecretsDir(), "files", "prod", "db_password"), file)
+	assert.Equal(t, "prod_db_password", composeSecretName("prod/db_password"))
+
+	require.NoError(t, removeSecret("prod/db_password"))
+	assert.NoDirExists(t, filepath.Join(getSecretsDir(), "prod"))
+	assert.NoDirExists(t, filepath.Join(getSecretsDir(), "files", "prod"))
+	_, err = getSecret("dev/db_password")
+	require.NoError(t, err)
+}
+
+func TestMultiFieldSecret(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	envFile := filepath.Join(t.TempDir(), "db.env")
+	require.NoError(t, os.WriteFile(envFile, []byte("DB_USER=shop\nDB_PASSWORD=hunter2\n"), 0o600))
+
+	value, fields, err := readSecretInput(&secretOptions{fromEnvFile: envFile})
+	require.NoError(t, err)
+	require.NoError(t, saveSecret("db", value, fields))
+
+	secret, err := getSecret("db")
+	require.NoError(t, err)
+	password, err := secret.Field("DB_PASSWORD")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", password)
+	_, err = secret.Field("DB_HOST")
+	assert.ErrorContains(t, err, "has no field 'DB_HOST'")
+	assert.Equal(t, "DB_PASSWORD=hunter2\nDB_USER=shop\n", secret.Content())
+
+	var out bytes.Buffer
+	require.NoError(t, writeComposeSecret(&out, *secret))
+	dir := filepath.Join(getSecretsDir(), "files", "db")
+	content, err := os.ReadFile(filepath.Join(dir+".fields", "DB_PASSWORD"))
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", string(content))
+	assert.Contains(t, out.String(), "  db_db_password:\n    file: "+filepath.Join(dir+".fields", "DB_PASSWORD")+"\n")
+	assert.Contains(t, out.String(), "    env_file: "+dir+".env\n")
+
+	require.NoError(t, removeSecret("db"))
+	assert.NoDirExists(t, dir+".fields")
+	assert.NoFileExists(t, dir+".env")
+}
+
+func TestKubernetesSecretManifest(t *testing.T) {
+	manifest, err := kubernetesSecretManifest("app-secrets", "shop", []SecretInfo{
+		{Name: "db_password", Value: "hunter2"},
+		{Name: "api_key", Value: "abc"},
+		{Name: "db", Fields: map[string]string{"DB_USER": "shop"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: v1
+kind: Secret
+metadata:
+  name: app-secrets
+  namespace: shop
+type: Opaque
+data:
+  DB_USER: c2hvcA==
+  api_key: YWJj
+  db_password: aHVudGVyMg==
+`, string(manifest))
+}
+
+func TestSecretExportK8sAudit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store := secretStore()
+	require.NoError(t, store.Write(SecretInfo{Name: "db_password", Value: "s3cret"}))
+	require.NoError(t, store.Write(SecretInfo{Name: "api_key", Value: "key"}))
+
+	ctrl := gomock.NewController(t)
+	cli := mocks.NewMockCli(ctrl)
+	var out bytes.Buffer
+	cli.EXPECT().Out().Return(streams.NewOut(&out)).AnyTimes()
+	cli.EXPECT().Err().Return(streams.NewOut(io.Discard)).AnyTimes()
+	opts := &secretOptions{only: []string{"db_password"}, k8sName: "app-secrets", actor: "ci"}
+	require.NoError(t, runSecretExportK8s(context.Background(), cli, opts))
+	assert.Contains(t, out.String(), "db_password:")
+
+	records, err := store.AuditLog()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "export-k8s", records[0].Operation)
+	assert.Equal(t, "db_password", records[0].Secret)
+	assert.Equal(t, extensions.SecretAuditSuccess, records[0].Result)
+	assert.Equal(t, "ci", records[0].Actor)
+}
+
+func TestPrintSecretAuditLog(t *testing.T) {
+	records := []extensions.SecretAuditRecord{
+		{Time: time.Date(2025, 3, 1, 10, 0, 0, 0, time.Local), Operation: "create", Secret: "db_password", Result: "success", Actor: "alice"},
+		{Time: time.Date(2025, 3, 1, 11, 0, 0, 0, time.Local), Operation: "show", Secret: "missing", Result: "failure", Error: "secret 'missing' not found"},
+	}
+
+	var table bytes.Buffer
+	require.NoError(t, printSecretAuditLog(&table, records, "table"))
+	assert.Equal(t, `TIME                  OPERATION   SECRET        RESULT                                ACTOR
+2025-03-01 10:00:00   create      db_password   success                               alice
+2025-03-01 11:00:00   show        missing       failure: secret 'missing' not found   -
+`, table.String())
+
+	var empty bytes.Buffer
+	require.NoError(t, printSecretAuditLog(&empty, nil, "json"))
+	assert.Equal(t, "[]\n", empty.String())
+
+	assert.ErrorContains(t, printSecretAuditLog(&empty, records, "yaml"), "unsupported format")
+}
+
+func TestSecretLeaks(t *testing.T) {
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "compose.yaml")
+	envFile := filepath.Join(dir, ".env")
+	compose := `services:
+  db:
+    ports:
+      - "8080:8080"
+    environment:
+      POSTGRES_PASSWORD: hunter22
+      REPLICA_PASSWORD: "hunter22" # quoted
+      MOTD: welcome hunter22
+  api:
+    environment:
+      - TOKEN=tok-12345
+`
+	require.NoError(t, os.WriteFile(composeFile, []byte(compose), 0o644))
+	require.NoError(t, os.WriteFile(envFile, []byte("API_TOKEN=tok-12345\nDB_PASSWORD=hunter22\nPORT=8080\n"), 0o600))
+
+	assert.Equal(t, "PROD_DB_PASSWORD", secretLeakVariable("prod/db_password", ""))
+	assert.Equal(t, "API_ENV_TOKEN", secretLeakVariable("api-env", "token"))
+	assert.Empty(t, secretLeakValues(SecretInfo{Name: "short", Value: "abc"}))
+	assert.Empty(t, secretLeakValues(SecretInfo{Name: "port", Value: "8080"}), "short values match unrelated configuration")
+
+	values := map[string]string{}
+	maps.Copy(values, secretLeakValues(SecretInfo{Name: "prod/db_password", Value: "hunter22"}))
+	maps.Copy(values, secretLeakValues(SecretInfo{Name: "api", Fields: map[string]string{"TOKEN": "tok-12345"}}))
+	leaks, err := findSecretLeaks([]string{composeFile, envFile}, values)
+	require.NoError(t, err)
+	assert.Equal(t, []secretLeak{
+		{File: composeFile, Line: 6, Variable: "PROD_DB_PASSWORD"},
+		{File: composeFile, Line: 7, Variable: "PROD_DB_PASSWORD"},
+		{File: composeFile, Line: 11, Variable: "API_TOKEN"},
+		{File: envFile, Line: 1, Variable: "API_TOKEN", Defining: true},
+		{File: envFile, Line: 2, Variable: "PROD_DB_PASSWORD"},
+	}, leaks, "only whole values are leaks, not the motd mentioning the value")
+
+	require.NoError(t, scrubSecretLeaks([]string{composeFile, envFile}, values))
+	content, err := os.ReadFile(composeFile)
+	require.NoError(t, err)
+	assert.Equal(t, `services:
+  db:
+    ports:
+      - "8080:8080"
+    environment:
+      POSTGRES_PASSWORD: ${PROD_DB_PASSWORD}
+      REPLICA_PASSWORD: ${PROD_DB_PASSWORD} # quoted
+      MOTD: welcome hunter22
+  api:
+    environment:
+      - TOKEN=${API_TOKEN}
+`, string(content))
+	content, err = os.ReadFile(envFile)
+	require.NoError(t, err)
+	assert.Equal(t, "API_TOKEN=tok-12345\nDB_PASSWORD=${PROD_DB_PASSWORD}\nPORT=8080\n", string(content),
+		"the entry defining API_TOKEN is not turned into a reference to itself")
+	info, err := os.Stat(envFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestVaultClientList(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path + "?" + r.URL.RawQuery {
+		case "/v1/secret/metadata/?list=true":
+			_, _ = fmt.Fprint(w, `{"data":{"keys":["api_key","prod/"]}}`)
+		case "/v1/secret/metadata/prod/?list=true":
+			_, _ = fmt.Fprint(w, `{"data":{"keys":["db_password"]}}`)
+		case "/v1/secret/metadata/api_key?":
+			_, _ = fmt.Fprint(w, `{"data":{"current_version":1,"updated_time":"2024-05-01T10:00:00.5Z"}}`)
+		case "/v1/secret/metadata/prod/db_password?":
+			_, _ = fmt.Fprint(w, `{"data":{"current_version":3,"updated_time":"2024-05-02T10:00:00Z"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := newVaultClient(&secretOptions{vaultAddr: server.URL + "/", vaultToken: "root"})
+	require.NoError(t, err)
+	secrets, err := client.list(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, []vaultSecretMetadata{
+		{Name: "api_key", Version: 1, UpdatedAt: time.Date(2024, 5, 1, 10, 0, 0, 500000000, time.UTC)},
+		{Name: "prod/db_password", Version: 3, UpdatedAt: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)},
+	}, secrets)
+
+	secrets, err = client.list(context.Background(), "dev/")
+	require.NoError(t, err)
+	assert.Empty(t, secrets)
+
+	// namespaces map to KV paths
+	secrets, err = listVaultSecrets(context.Background(), client, "prod/db")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"prod/db_password"}, []string{secrets[0].Name})
+	var out bytes.Buffer
+	cli := mocks.NewMockCli(gomock.NewController(t))
+	cli.EXPECT().Out().Return(streams.NewOut(&out)).AnyTimes()
+	require.NoError(t, runSecretListVault(context.Background(), cli, &secretOptions{vaultAddr: server.URL, vaultToken: "root", prefix: "prod/"}))
+	assert.Equal(t, "SECRET             VERSION   UPDATED\n"+
+		"prod/db_password   3         "+time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC).Local().Format(time.DateTime)+"\n", out.String())
+	out.Reset()
+	require.NoError(t, runSecretListVault(context.Background(), cli, &secretOptions{vaultAddr: server.URL, vaultToken: "root", prefix: "dev/"}))
+	assert.Equal(t, "No secrets found in vault.\n", out.String())
+
+	client.token = "wrong"
+	_, err = client.list(context.Background(), "")
+	assert.ErrorContains(t, err, "403 Forbidden")
+
+	t.Setenv("VAULT_ADDR", "")
+	_, err = newVaultClient(&secretOptions{})
+	assert.ErrorContains(t, err, "vault address is required")
+}
+
+func TestSelectSecretVersion(t *testing.T) {
+	secret := &SecretInfo{Name: "db_password", Value: "third", Version: 3, Previous: "second"}
+	selected, err := selectSecretVersion(secret, "")
+	require.NoError(t, err)
+	assert.Equal(t, "third", selected.Value)
+	selected, err = selectSecretVersion(secret, "previous")
+	require.NoError(t, err)
+	assert.Equal(t, "second", selected.Value)
+	assert.Equal(t, 2, selected.CurrentVersion())
+	selected, err = selectSecretVersion(secret, "2")
+	require.NoError(t, err)
+	assert.Equal(t, "second", selected.Value)
+
+	_, err = selectSecretVersion(secret, "1")
+	assert.ErrorContains(t, err, "version 1 of secret 'db_password' is not kept")
+	_, err = selectSecretVersion(secret, "4")
+	assert.ErrorContains(t, err, "secret has no version 4, the current version is 3")
+	_, err = selectSecretVersion(secret, "latest")
+	assert.ErrorContains(t, err, `invalid --version "latest"`)
+	_, err = selectSecretVersion(&SecretInfo{Name: "api_key", Value: "key"}, "previous")
+	assert.ErrorContains(t, err, "secret 'api_key': secret has no previous version")
+	_, err = selectSecretVersion(&SecretInfo{Name: "api_key", Value: "new", Version: 2}, "previous")
+	assert.ErrorContains(t, err, "secret 'api_key' has no previous version, rotate it with --keep-previous")
+}
+
+func TestVaultClientVersions(t *testing.T) {
+	var written string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery {
+		case "GET /v1/secret/metadata/prod/db_password?":
+			_, _ = fmt.Fprint(w, `{"data":{"current_version":3}}`)
+		case "GET /v1/secret/data/prod/db_password?version=2":
+			_, _ = fmt.Fprint(w, `{"data":{"data":{"value":"second"},"metadata":{"version":2}}}`)
+		case "POST /v1/secret/data/prod/db_password?":
+			body, _ := io.ReadAll(r.Body)
+			written = string(body)
+			_, _ = fmt.Fprint(w, `{"data":{"version":4}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := newVaultClient(&secretOptions{vaultAddr: server.URL, vaultToken: "root"})
+	require.NoError(t, err)
+	ctx := context.Background()
+	current, err := client.currentVersion(ctx, "prod/db_password")
+	require.NoError(t, err)
+	assert.Equal(t, 3, current)
+	_, err = client.currentVersion(ctx, "prod/missing")
+	assert.ErrorContains(t, err, "secret 'prod/missing' not found in vault")
+
+	data, err := client.read(ctx, "prod/db_password", 2)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"value": "second"}, data)
+	_, err = client.read(ctx, "prod/db_password", 1)
+	assert.ErrorContains(t, err, "version 1 of secret 'prod/db_password' not found in vault")
+
+	version, err := client.write(ctx, "prod/db_password", data)
+	require.NoError(t, err)
+	assert.Equal(t, 4, version)
+	assert.JSONEq(t, `{"data":{"value":"second"}}`, written)
+}
+
+func TestDiffSecretBackends(t *testing.T) {
+	local := []extensions.Secret{
+		{Name: "api_key", UpdatedAt: "2024-05-01 10:00:00"},
+		{Name: "prod/db_password", UpdatedAt: "2024-05-03 10:00:00"},
+		{Name: "local_only", UpdatedAt: "2024-05-01 10:00:00"},
+	}
+	vault := []vaultSecretMetadata{
+		{Name: "api_key", Version: 1, UpdatedAt: time.Date(2024, 5, 1, 10, 0, 0, 500000000, time.Local)},
+		{Name: "prod/db_password", Version: 3, UpdatedAt: time.Date(2024, 5, 2, 10, 0, 0, 0, time.Local)},
+		{Name: "vault_only", Version: 2, UpdatedAt: time.Date(2024, 5, 4, 10, 0, 0, 0, time.Local)},
+	}
+	diff := diffSecretBackends(local, vault)
+	require.Len(t, diff, 4)
+	assert.Equal(t, "api_key", diff[0].Name)
+	assert.Equal(t, secretDiffBoth, diff[0].State)
+	assert.Empty(t, diff[0].Newer)
+	assert.Equal(t, "local_only", diff[1].Name)
+	assert.Equal(t, secretDiffLocalOnly, diff[1].State)
+	assert.Zero(t, diff[1].VaultVersion)
+	assert.Equal(t, "prod/db_password", diff[2].Name)
+	assert.Equal(t, "local", diff[2].Newer)
+	assert.Equal(t, 3, diff[2].VaultVersion)
+	assert.Equal(t, "vault_only", diff[3].Name)
+	assert.Equal(t, secretDiffVaultOnly, diff[3].State)
+	assert.Nil(t, diff[3].LocalUpdatedAt)
+
+	var buf bytes.Buffer
+	require.NoError(t, printSecretDiff(&buf, diff[1:2], "table"))
+	assert.Equal(t, "SECRET       STATE        LOCAL UPDATED         VAULT VERSION   VAULT UPDATED   NEWER\n"+
+		"local_only   local only   2024-05-01 10:00:00   -               -               -\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, printSecretDiff(&buf, nil, "json"))
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestRotateDueSecrets(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store := secretStore()
+	now := time.Now()
+	expired := now.Add(-2 * time.Hour).Format(extensions.SecretTimeLayout)
+	for _, secret := range []SecretInfo{
+		{Name: "db_password", Value: "old", TTL: "1h", UpdatedAt: expired},
+		{Name: "shop/api_key", Value: "key", TTL: "24h", UpdatedAt: expired},
+		{Name: "shop/env", Fields: map[string]string{"A": "a"}, TTL: "1h", UpdatedAt: expired},
+		{Name: "other/token", Value: "token", TTL: "1h", UpdatedAt: expired},
+	} {
+		require.NoError(t, store.Write(secret))
+	}
+	dir := t.TempDir()
+	project := &types.Project{
+		Name:       "shop",
+		WorkingDir: dir,
+		Secrets:    types.Secrets{"db_password": {External: true}},
+	}
+
+	ctrl := gomock.NewController(t)
+	cli := mocks.NewMockCli(ctrl)
+	var errOut bytes.Buffer
+	cli.EXPECT().Out().Return(streams.NewOut(io.Discard)).AnyTimes()
+	cli.EXPECT().Err().Return(streams.NewOut(&errOut)).AnyTimes()
+
+	opts := &secretOptions{gracePeriod: time.Hour, onRotateCommand: "echo $COMPOSE_SECRET_NAME >> rotated.log"}
+	rotated, err := rotateDueSecrets(context.Background(), cli, store, project, opts, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db_password"}, rotated)
+	assert.Contains(t, errOut.String(), "secret 'shop/env' is past its TTL")
+	log, err := os.ReadFile(filepath.Join(dir, "rotated.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "db_password\n", string(log))
+
+	secret, err := store.Get("db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "old", secret.Previous)
+	assert.Len(t, secret.Value, 43)
+	records, err := store.AuditLog()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "rotate", records[0].Operation)
+
+	// not rotated again while the previous value is in its grace period, which then expires
+	secret.UpdatedAt = expired
+	require.NoError(t, store.Write(*secret))
+	rotated, err = rotateDueSecrets(context.Background(), cli, store, project, opts, now)
+	require.NoError(t, err)
+	assert.Empty(t, rotated)
+	rotated, err = rotateDueSecrets(context.Background(), cli, store, project, opts, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db_password"}, rotated)
+	secret, err = store.Get("db_password")
+	require.NoError(t, err)
+	assert.NotEqual(t, "old", secret.Previous)
+
+	other, err := store.Get("other/token")
+	require.NoError(t, err)
+	assert.Equal(t, "token", other.Value)
+}
+
+func TestSecretUsageReport(t *testing.T) {
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "compose.yaml")
+	require.NoError(t, os.WriteFile(composeFile, []byte(`services:
+  db:
+    image: postgres
+    secrets:
+      - prod_db_password
+  api:
+    image: api
+    environment:
+      DB_PASSWORD: ${PROD_DB_PASSWORD:-}
+      TOKEN: $API_TOKEN
+      LITERAL: $$UNUSED
+    secrets:
+      - source: api
+        target: api_token
+secrets:
+  prod_db_password:
+    file: ./db_password
+  api:
+    environment: API_TOKEN
+`), 0o644))
+
+	opts := &ProjectOptions{ConfigPaths: []string{composeFile}, ProjectDir: dir, Offline: true}
+	model, err := opts.ToModel(t.Context(), nil, nil, cli.WithInterpolation(false), cli.WithoutEnvironmentResolution)
+	require.NoError(t, err)
+
+	usage := secretUsageReport(model, []SecretInfo{
+		{Name: "unused"},
+		{Name: "prod/db_password"},
+		{Name: "api", Fields: map[string]string{"TOKEN": "tok-123"}},
+	})
+	assert.Equal(t, []secretUsage{
+		{Name: "api", References: []secretReference{
+			{Service: "api", Via: "secrets"},
+			{Service: "api", Via: "${API_TOKEN}"},
+		}},
+		{Name: "prod/db_password", References: []secretReference{
+			{Service: "api", Via: "${PROD_DB_PASSWORD}"},
+			{Service: "db", Via: "secrets"},
+		}},
+		{Name: "unused", References: []secretReference{}},
+	}, usage)
+
+	var buf bytes.Buffer
+	require.NoError(t, printSecretUsage(&buf, usage, "table"))
+	assert.Equal(t, "SECRET             SERVICE   VIA\n"+
+		"api                api       secrets\n"+
+		"api                api       ${API_TOKEN}\n"+
+		"prod/db_password   api       ${PROD_DB_PASSWORD}\n"+
+		"prod/db_password   db        secrets\n"+
+		"unused             -         -\n"+
+		"\nUnused secrets: unused\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, printSecretUsage(&buf, usage[2:], "json"))
+	assert.Equal(t, "[\n  {\n    \"name\": \"unused\",\n    \"references\": []\n  }\n]\n", buf.String())
+}
+
+func TestWriteSecretEnvFile(t *testing.T) {
+	secrets := []SecretInfo{
+		{Name: "prod/db_password", Value: "it's $ecret"},
+		{Name: "api", Fields: map[string]string{"TOKEN": "tok-123", "url": "https://api.example.com/v1"}},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, writeSecretEnvFile(&buf, secrets, "APP_"))
+	assert.Equal(t, "APP_API_TOKEN=tok-123\n"+
+		"APP_API_URL=https://api.example.com/v1\n"+
+		`APP_PROD_DB_PASSWORD="it's \$ecret"`+"\n", buf.String())
+
+	env, err := dotenv.UnmarshalBytesWithLookup(buf.Bytes(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"APP_API_TOKEN":        "tok-123",
+		"APP_API_URL":          "https://api.example.com/v1",
+		"APP_PROD_DB_PASSWORD": "it's $ecret",
+	}, env)
+
+	assert.ErrorContains(t, writeSecretEnvFile(&buf, secrets, "1-"), `invalid variable name "1-API_TOKEN"`)
+
+	err = writeSecretEnvFile(&buf, []SecretInfo{{Name: "db-pass", Value: "a"}, {Name: "db_pass", Value: "b"}}, "")
+	assert.EqualError(t, err, `secrets "db-pass" and "db_pass" would both be written as DB_PASS`)
+	err = writeSecretEnvFile(&buf, []SecretInfo{{Name: "api_token", Value: "a"}, {Name: "api", Fields: map[string]string{"TOKEN": "b"}}}, "")
+	assert.EqualError(t, err, `secrets "api_token" and "api" (field TOKEN) would both be written as API_TOKEN`)
+}
+
+func TestSecretToEnvFileAudit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store := secretStore()
+	require.NoError(t, store.Write(SecretInfo{Name: "db_password", Value: "s3cret"}))
+	require.NoError(t, store.Write(SecretInfo{Name: "api_key", Value: "key"}))
+
+	ctrl := gomock.NewController(t)
+	cli := mocks.NewMockCli(ctrl)
+	cli.EXPECT().Out().Return(streams.NewOut(io.Discard)).AnyTimes()
+	cli.EXPECT().Err().Return(streams.NewOut(io.Discard)).AnyTimes()
+	envFile := filepath.Join(t.TempDir(), "secrets.env")
+	require.NoError(t, runSecretToEnvFile(cli, &secretOptions{toEnvFile: envFile, actor: "ci"}))
+
+	records, err := store.AuditLog()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	for _, record := range records {
+		assert.Equal(t, "to-env-file", record.Operation)
+		assert.Equal(t, extensions.SecretAuditSuccess, record.Result)
+		assert.Equal(t, "ci", record.Actor)
+	}
+	assert.ElementsMatch(t, []string{"api_key", "db_password"}, []string{records[0].Secret, records[1].Secret})
+}
+
+func TestSecretVaultWrites(t *testing.T) {
+	versions := map[string][]string{"api_key": {`{"data":{"value":"first"}}`}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/v1/secret/metadata/"), "/v1/secret/data/")
+		switch {
+		case r.Header.Get("X-Vault-Token") != "root":
+			w.WriteHeader(http.StatusForbidden)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/"):
+			if len(versions[name]) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"data":{"current_version":%d}}`, len(versions[name]))
+		case r.Method == http.MethodPost:
+			body, _ := io.ReadAll(r.Body)
+			versions[name] = append(versions[name], string(body))
+			_, _ = fmt.Fprintf(w, `{"data":{"version":%d}}`, len(versions[name]))
+		case r.Method == http.MethodDelete:
+			delete(versions, name)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	opts := &secretOptions{vaultAddr: server.URL, vaultToken: "root"}
+	require.NoError(t, runSecretCreateVault(ctx, opts, SecretInfo{Name: "prod/db", Fields: map[string]string{"user": "app"}}))
+	assert.Equal(t, []string{`{"data":{"user":"app"}}`}, versions["prod/db"])
+	assert.ErrorContains(t, runSecretCreateVault(ctx, opts, SecretInfo{Name: "api_key", Value: "x"}), "already exists in vault")
+
+	// the previous version is kept by the KV engine
+	require.NoError(t, runSecretRotateVault(ctx, opts, SecretInfo{Name: "api_key", Value: "second"}))
+	assert.Equal(t, []string{`{"data":{"value":"first"}}`, `{"data":{"value":"second"}}`}, versions["api_key"])
+	assert.ErrorContains(t, runSecretRotateVault(ctx, opts, SecretInfo{Name: "missing", Value: "x"}), "secret 'missing' not found in vault")
+
+	require.NoError(t, runSecretRemoveVault(ctx, opts, "api_key"))
+	assert.NotContains(t, versions, "api_key")
+	assert.ErrorContains(t, runSecretRemoveVault(ctx, opts, "api_key"), "secret 'api_key' not found in vault")
+
+	// a secret which can't be looked up is not created
+	opts.vaultToken = "denied"
+	assert.ErrorContains(t, runSecretCreateVault(ctx, opts, SecretInfo{Name: "new", Value: "x"}), "failed to query vault: 403 Forbidden")
+	assert.NotContains(t, versions, "new")
+}
@@ -17,14 +17,34 @@
 package compose
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/compose-spec/compose-go/v2/cli"
 	"github.com/docker/cli/cli/command"
+	"github.com/moby/patternmatcher"
 	"github.com/spf13/cobra"
 
 	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/internal/bundle"
 	"github.com/docker/compose/v5/pkg/compose"
+	"github.com/docker/compose/v5/pkg/extensions"
 )
 
 type shareOptions struct {
@@ -37,6 +57,19 @@ type shareOptions struct {
 	access  string
 	message string
 	quiet   bool
+	verbose bool
+	to      string
+
+	recipients []string
+	list       bool
+	revoke     string
+
+	importFile string
+	importDir  string
+	insecure   bool
+	verify     string
+
+	noDefaultExcludes bool
 }
 
 func shareCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *BackendOptions) *cobra.Command {
@@ -56,13 +89,32 @@ func shareCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *Back
 
 This command supports:
 1. Environment sharing: Share the entire compose environment
-2. Multiple sharing methods: Generate shareable links or export as archive
+2. Multiple sharing methods: Generate shareable links or export as archive,
+   written locally or copied over SSH with --to
 3. Include/exclude: Specify which files to include or exclude
 4. Access control: Set permissions for shared environments
 5. Expiration: Set expiration time for shared links
 6. Public/private: Control visibility of shared environments
 7. Custom messages: Add messages to shared environments
 8. Quiet mode: Minimal output for scripting
+
+Every share gets an ID and is recorded locally, along with its intended recipients, given
+as --recipients alice,bob (--to being the SSH destination of the archive), which are also
+written in the compose-bundle.json manifest of archives. --list shows
+the active shares created by the current user, and --revoke ID invalidates one,
+removing its archive when it was written locally.
+
+Archives are bundles shared with "env --export": the manifest lists every file with
+its checksum. --import ARCHIVE extracts an archive written by either command, into
+--import-dir or a directory named after the archived project or environment, and
+fails when a file does not match its checksum.
+
+Archives also carry a SHA256SUMS file, which "sha256sum -c SHA256SUMS" checks once
+extracted, and the manifest records the digest of the compose file. --verify ARCHIVE
+checks every file against both without extracting anything, and prints the compose file
+digest so it can be compared with the one given by the sender. --import runs the same
+verification before unpacking, and refuses archives without a manifest, which can't be
+verified, unless --insecure is given.
 `,
 		RunE: Adapt(func(ctx context.Context, args []string) error {
 			return runShare(ctx, dockerCli, backendOptions, &opts)
@@ -77,10 +129,72 @@ This command supports:
 	cmd.Flags().StringVar(&opts.access, "access", "read", "Access level (read, write, admin)")
 	cmd.Flags().StringVar(&opts.message, "message", "", "Custom message for shared environment")
 	cmd.Flags().BoolVar(&opts.quiet, "quiet", false, "Quiet mode (minimal output)")
+	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "Show the effective exclude patterns and collected files")
+	cmd.Flags().StringVar(&opts.to, "to", "", "Copy the archive to a remote destination over SSH (user@host:/path)")
+	cmd.Flags().StringSliceVar(&opts.recipients, "recipients", nil, "Comma-separated list of the intended recipients of the share, e.g. alice,bob (--to is the SSH destination of the archive)")
+	cmd.Flags().BoolVar(&opts.list, "list", false, "List the active shares created by the current user")
+	cmd.Flags().StringVar(&opts.revoke, "revoke", "", "Revoke the share with the given ID")
+	cmd.Flags().StringVar(&opts.importFile, "import", "", "Import a shared or exported archive")
+	cmd.Flags().StringVar(&opts.verify, "verify", "", "Verify the checksums of a shared or exported archive without extracting it")
+	cmd.Flags().StringVar(&opts.importDir, "import-dir", "", "Directory the archive is imported into, with --import")
+	cmd.Flags().BoolVar(&opts.insecure, "insecure", false, "Import archives without a manifest, whose content can't be verified, with --import")
+	cmd.Flags().BoolVar(&opts.noDefaultExcludes, "no-default-excludes", false, "Do not exclude VCS, dependency, build and secret files nor honor .gitignore")
 	return cmd
 }
 
 func runShare(ctx context.Context, dockerCli command.Cli, backendOptions *BackendOptions, opts *shareOptions) error {
+	if opts.list {
+		records, err := loadShareRecords()
+		if err != nil {
+			return err
+		}
+		return printShareRecords(dockerCli.Out(), activeShareRecords(records, time.Now()))
+	}
+	if opts.revoke != "" {
+		record, err := revokeShare(opts.revoke)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Share %s of project %s revoked\n", record.ID, record.Project)
+		if record.Method == "archive" && !isLocalShareLocation(record.Location) {
+			fmt.Fprintf(dockerCli.Err(), "Warning: the archive copied to %s must be removed manually\n", record.Location)
+		}
+		return nil
+	}
+	if opts.verify != "" {
+		result, err := verifyShareArchive(opts.verify)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: OK, %s %q, %d files verified\n", opts.verify, result.Manifest.Kind, result.Manifest.Name, len(result.Manifest.Files))
+		if result.ComposeFile != "" {
+			fmt.Printf("Compose file: %s sha256:%s\n", result.ComposeFile, result.ComposeDigest)
+		}
+		return nil
+	}
+	if opts.importDir != "" && opts.importFile == "" {
+		return fmt.Errorf("--import-dir requires --import")
+	}
+	if opts.insecure && opts.importFile == "" {
+		return fmt.Errorf("--insecure requires --import")
+	}
+	if opts.importFile != "" {
+		manifest, dir, err := importShare(opts.importFile, opts.importDir, opts.insecure)
+		if err != nil {
+			return err
+		}
+		if manifest == nil {
+			fmt.Printf("Imported %s into %s (no manifest, not verified)\n", opts.importFile, dir)
+			return nil
+		}
+		fmt.Printf("Imported %s %q into %s (%d files verified)\n", manifest.Kind, manifest.Name, dir, len(manifest.Files))
+		return nil
+	}
+	expiresIn, err := parseShareExpiry(opts.expires)
+	if err != nil {
+		return err
+	}
+
 	backend, err := compose.NewComposeService(dockerCli, backendOptions.Options...)
 	if err != nil {
 		return err
@@ -111,6 +225,9 @@ func runShare(ctx context.Context, dockerCli command.Cli, backendOptions *Backen
 		if opts.message != "" {
 			fmt.Printf("Message: %s\n", opts.message)
 		}
+		if len(opts.recipients) > 0 {
+			fmt.Printf("Recipients: %s\n", strings.Join(shareRecipients(opts.recipients), ", "))
+		}
 	}
 
 	// Validate sharing method
@@ -121,6 +238,9 @@ func runShare(ctx context.Context, dockerCli command.Cli, backendOptions *Backen
 	if !validMethods[opts.method] {
 		return fmt.Errorf("invalid sharing method: %s", opts.method)
 	}
+	if opts.to != "" && opts.method != "archive" {
+		return fmt.Errorf("--to requires --method archive")
+	}
 
 	// Validate access level
 	validAccess := map[string]bool{
@@ -137,10 +257,44 @@ func runShare(ctx context.Context, dockerCli command.Cli, backendOptions *Backen
 		fmt.Println("\nProcessing environment for sharing...")
 	}
 
-	shareResult, err := shareEnvironment(ctx, dockerCli, project, opts)
+	id, err := newShareID()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	manifest := shareManifest{
+		ID:         id,
+		Project:    project.Name,
+		Recipients: shareRecipients(opts.recipients),
+		Access:     opts.access,
+		Message:    opts.message,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(expiresIn),
+	}
+	shareResult, err := shareEnvironment(ctx, dockerCli, project, opts, manifest)
 	if err != nil {
 		return err
 	}
+	location := shareResult.Archive
+	if location == "" {
+		location = shareResult.URL
+	}
+	if err := recordShare(shareRecord{shareManifest: manifest, Method: opts.method, Location: location}); err != nil {
+		fmt.Fprintf(dockerCli.Err(), "Warning: failed to record share: %v\n", err)
+	} else if !opts.quiet {
+		fmt.Printf("Share ID: %s\n", id)
+	}
+
+	if shareResult.Archive != "" {
+		if opts.quiet {
+			fmt.Println(shareResult.Archive)
+		} else {
+			fmt.Println("\nEnvironment shared successfully!")
+			fmt.Printf("Archive: %s\n", shareResult.Archive)
+			fmt.Println("\nSharing operation completed!")
+		}
+		return nil
+	}
 
 	if !opts.quiet {
 		fmt.Println("\nEnvironment shared successfully!")
@@ -166,6 +320,8 @@ func runShare(ctx context.Context, dockerCli command.Cli, backendOptions *Backen
 }
 
 type shareResult struct {
+	// Archive is the location of the archive when sharing with the archive method
+	Archive    string
 	URL        string
 	AccessCode string
 	Expires    string
@@ -173,15 +329,46 @@ type shareResult struct {
 	Message    string
 }
 
-func shareEnvironment(ctx context.Context, dockerCli command.Cli, project *types.Project, opts *shareOptions) (*shareResult, error) {
-	// Simplified implementation - in real code, this would perform actual sharing
+func shareEnvironment(ctx context.Context, dockerCli command.Cli, project *types.Project, opts *shareOptions, manifest shareManifest) (*shareResult, error) {
 	if !opts.quiet {
 		fmt.Println("Preparing environment for sharing...")
 		fmt.Println("Collecting files...")
-		fmt.Println("Processing include/exclude patterns...")
+	}
+
+	excludes, err := shareExcludes(project.WorkingDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.verbose {
+		fmt.Println("Effective exclude patterns:")
+		for _, pattern := range excludes {
+			fmt.Printf("  %s\n", pattern)
+		}
+	}
+
+	files, err := collectShareFiles(project.WorkingDir, opts.include, excludes)
+	if err != nil {
+		return nil, err
+	}
+	if opts.verbose {
+		fmt.Println("Collected files:")
+		for _, file := range files {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+	if !opts.quiet {
+		fmt.Printf("Collected %d files\n", len(files))
 		fmt.Println("Generating shareable content...")
 	}
 
+	if opts.method == "archive" {
+		location, err := shareArchive(ctx, dockerCli, project, files, opts, manifest)
+		if err != nil {
+			return nil, err
+		}
+		return &shareResult{Archive: location, Message: opts.message}, nil
+	}
+
 	// Simulate sharing process
 	if !opts.quiet {
 		fmt.Println("Creating shareable link...")
@@ -198,3 +385,479 @@ func shareEnvironment(ctx context.Context, dockerCli command.Cli, project *types
 		Message:    opts.message,
 	}, nil
 }
+
+// shareArchive writes the files to <project>.tar.gz in the current directory, or copies it to
+// the --to destination with scp, so the user's SSH configuration applies. Unless the project has
+// its own, a lockfile pinning the image digests of the services is added for deploy --from-archive.
+// It returns where the archive ended up.
+func shareArchive(ctx context.Context, dockerCli command.Cli, project *types.Project, files []string, opts *shareOptions, manifest shareManifest) (string, error) {
+	name := project.Name + ".tar.gz"
+	archivePath := name
+	if opts.to != "" {
+		tmpDir, err := os.MkdirTemp("", "compose-share-")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(tmpDir) //nolint:errcheck
+		archivePath = filepath.Join(tmpDir, name)
+	}
+
+	// never include a previously written archive nor manifest
+	files = slices.DeleteFunc(slices.Clone(files), func(file string) bool {
+		return file == name || file == bundle.ManifestName || file == bundle.ChecksumsName
+	})
+	manifest.ComposeFile, manifest.ComposeDigest = shareComposeDigest(project, files)
+	var lock []byte
+	if !slices.Contains(files, deployLockFile) {
+		var err error
+		if lock, err = deployLock(ctx, dockerCli.Client(), project); err != nil {
+			return "", err
+		}
+	}
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive: %v", err)
+	}
+	err = writeShareArchive(f, project.WorkingDir, files, lock, manifest)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write archive: %v", err)
+	}
+
+	if opts.to == "" {
+		return filepath.Abs(archivePath)
+	}
+
+	destination := shareDestination(opts.to, name)
+	if !opts.quiet {
+		fmt.Printf("Copying archive to %s...\n", destination)
+	}
+	// a destination starting with a dash must not be taken for an option
+	cmd := exec.CommandContext(ctx, "scp", "-q", "--", archivePath, destination)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to copy archive to %s: %v", destination, err)
+	}
+	return destination, nil
+}
+
+// shareDestination appends the archive name when the scp destination designates a directory
+func shareDestination(to, name string) string {
+	if strings.HasSuffix(to, "/") || strings.HasSuffix(to, ":") {
+		return to + name
+	}
+	return to
+}
+
+// writeShareArchive writes the files, relative to projectDir, as a bundle carrying the share
+// manifest, along with the lockfile when set
+func writeShareArchive(w io.Writer, projectDir string, files []string, lock []byte, manifest shareManifest) error {
+	metadata, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	var generated map[string][]byte
+	if lock != nil {
+		generated = map[string][]byte{deployLockFile: lock}
+	}
+	return bundle.WriteGenerated(w, projectDir, files, generated, bundle.Manifest{
+		Kind:      bundle.KindShare,
+		Name:      manifest.Project,
+		CreatedAt: manifest.CreatedAt,
+		Metadata:  metadata,
+	})
+}
+
+// checkBundleManifest turns the error reading an imported archive into the import error.
+// Archives without a manifest can't be verified, they are only imported with --insecure.
+func checkBundleManifest(archive string, err error, insecure bool) error {
+	if !errors.Is(err, bundle.ErrNoManifest) {
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %v", archive, err)
+		}
+		return nil
+	}
+	if !insecure {
+		return fmt.Errorf("%s has no manifest, its content can't be verified, use --insecure to import it anyway", archive)
+	}
+	return nil
+}
+
+// importShare extracts an archive written by share or env export into dir, defaulting to a
+// directory named after the archived project or environment, and verifies its checksums
+func importShare(archive, dir string, insecure bool) (*bundle.Manifest, string, error) {
+	// extract next to the destination first, so a failed import leaves nothing behind
+	parent := "."
+	if dir != "" {
+		parent = filepath.Dir(dir)
+	}
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return nil, "", err
+	}
+	tmpDir, err := os.MkdirTemp(parent, ".compose-import-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(tmpDir) //nolint:errcheck
+
+	if _, err := verifyShareArchive(archive); err != nil {
+		if err := checkBundleManifest(archive, err, insecure); err != nil {
+			return nil, "", err
+		}
+	}
+	manifest, err := bundle.ReadFile(archive, tmpDir)
+	if err := checkBundleManifest(archive, err, insecure); err != nil {
+		return nil, "", err
+	}
+	if dir == "" {
+		if manifest == nil || manifest.Name == "" {
+			return nil, "", fmt.Errorf("%s has no manifest, set the destination with --import-dir", archive)
+		}
+		if !isPlainName(manifest.Name) {
+			return nil, "", fmt.Errorf("%s is named %q which is not a plain directory name, set the destination with --import-dir", archive, manifest.Name)
+		}
+		dir = manifest.Name
+	}
+	if _, err := os.Lstat(dir); err == nil {
+		return nil, "", fmt.Errorf("%s already exists", dir)
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		return nil, "", fmt.Errorf("failed to import %s: %v", archive, err)
+	}
+	return manifest, dir, nil
+}
+
+// isPlainName tells whether name is a single path element, which can't designate a directory
+// outside the current one
+func isPlainName(name string) bool {
+	return name != "" && name != "." && name != ".." &&
+		!filepath.IsAbs(name) && !strings.ContainsAny(name, `/\`) && filepath.Base(name) == name
+}
+
+// shareComposeDigest returns the main compose file of the project, relative to its directory, and
+// its sha256 digest when it is shared
+func shareComposeDigest(project *types.Project, files []string) (string, string) {
+	if len(project.ComposeFiles) == 0 {
+		return "", ""
+	}
+	rel, err := filepath.Rel(project.WorkingDir, project.ComposeFiles[0])
+	if err != nil || !slices.Contains(files, filepath.ToSlash(rel)) {
+		return "", ""
+	}
+	content, err := os.ReadFile(project.ComposeFiles[0])
+	if err != nil {
+		return "", ""
+	}
+	sum := sha256.Sum256(content)
+	return filepath.ToSlash(rel), hex.EncodeToString(sum[:])
+}
+
+// shareVerification is the result of the verification of an archive
+type shareVerification struct {
+	Manifest      *bundle.Manifest
+	ComposeFile   string
+	ComposeDigest string
+}
+
+// verifyShareArchive checks the files of an archive written by share or env export against its
+// manifest and SHA256SUMS without extracting it, and checks the compose file matches the digest
+// recorded by share
+func verifyShareArchive(archive string) (*shareVerification, error) {
+	manifest, err := bundle.CheckFile(archive)
+	if err != nil {
+		return nil, err
+	}
+	result := &shareVerification{Manifest: manifest}
+	var recorded string
+	if manifest.Kind == bundle.KindShare && len(manifest.Metadata) > 0 {
+		var metadata shareManifest
+		if err := json.Unmarshal(manifest.Metadata, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to read the share manifest: %v", err)
+		}
+		result.ComposeFile, recorded = metadata.ComposeFile, metadata.ComposeDigest
+	}
+	if result.ComposeFile == "" {
+		// environments hold a single compose.yaml
+		for _, name := range cli.DefaultFileNames {
+			if slices.ContainsFunc(manifest.Files, func(f bundle.File) bool { return f.Path == name }) {
+				result.ComposeFile = name
+				break
+			}
+		}
+	}
+	for _, file := range manifest.Files {
+		if file.Path == result.ComposeFile {
+			result.ComposeDigest = file.SHA256
+		}
+	}
+	if recorded != "" && recorded != result.ComposeDigest {
+		return nil, fmt.Errorf("bundle verification failed: %s does not match the compose file digest of the share", result.ComposeFile)
+	}
+	return result, nil
+}
+
+// defaultShareExcludes are never worth sharing: VCS metadata, dependencies, build output, logs and env files
+var defaultShareExcludes = []string{
+	"**/.git",
+	"**/node_modules",
+	"**/dist",
+	"**/*.log",
+	"**/.env*",
+}
+
+// shareExcludes computes the exclude patterns: the defaults and the project .gitignore unless
+// disabled, followed by the user provided --exclude patterns
+func shareExcludes(projectDir string, opts *shareOptions) ([]string, error) {
+	var excludes []string
+	if !opts.noDefaultExcludes {
+		excludes = append(excludes, defaultShareExcludes...)
+		gitignore, err := readGitignorePatterns(filepath.Join(projectDir, ".gitignore"))
+		if err != nil {
+			return nil, err
+		}
+		excludes = append(excludes, gitignore...)
+	}
+	return append(excludes, opts.exclude...), nil
+}
+
+// readGitignorePatterns converts .gitignore entries into patternmatcher patterns
+func readGitignorePatterns(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		negate := strings.HasPrefix(line, "!")
+		line = strings.TrimPrefix(line, "!")
+		line = strings.TrimSuffix(line, "/")
+		if strings.HasPrefix(line, "/") {
+			// anchored to the project directory
+			line = strings.TrimPrefix(line, "/")
+		} else if !strings.Contains(line, "/") {
+			// unanchored entries match at any depth
+			line = "**/" + line
+		}
+		if negate {
+			line = "!" + line
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+// collectShareFiles lists the files of the project directory to share, relative to it
+func collectShareFiles(projectDir string, include, exclude []string) ([]string, error) {
+	excludeMatcher, err := patternmatcher.New(exclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude pattern: %w", err)
+	}
+	var includeMatcher *patternmatcher.PatternMatcher
+	if len(include) > 0 {
+		if includeMatcher, err = patternmatcher.New(include); err != nil {
+			return nil, fmt.Errorf("invalid include pattern: %w", err)
+		}
+	}
+
+	var files []string
+	err = filepath.WalkDir(projectDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(projectDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		excluded, err := excludeMatcher.MatchesOrParentMatches(rel)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// negated patterns may re-include files below an excluded directory
+			if excluded && !excludeMatcher.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if excluded {
+			return nil
+		}
+		if includeMatcher != nil {
+			included, err := includeMatcher.MatchesOrParentMatches(rel)
+			if err != nil || !included {
+				return err
+			}
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+// shareManifest describes a share and its intended recipients
+type shareManifest struct {
+	ID         string    `json:"id"`
+	Project    string    `json:"project"`
+	Recipients []string  `json:"recipients,omitempty"`
+	Access     string    `json:"access"`
+	Message    string    `json:"message,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	// ComposeFile is the main compose file of the shared project, and ComposeDigest its sha256
+	ComposeFile   string `json:"composeFile,omitempty"`
+	ComposeDigest string `json:"composeDigest,omitempty"`
+}
+
+// shareRecord is the local record of a share created by the user
+type shareRecord struct {
+	shareManifest
+	Method string `json:"method"`
+	// Location is the share URL, or where the archive was written
+	Location string `json:"location"`
+	Revoked  bool   `json:"revoked,omitempty"`
+}
+
+// parseShareExpiry parses --expires, a Go duration or a number of days like 7d
+func parseShareExpiry(expires string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(expires, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(expires); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid expiration time %q, use a duration like 1h or a number of days like 7d", expires)
+}
+
+// shareRecipients trims and deduplicates the --recipients values, keeping their order
+func shareRecipients(recipients []string) []string {
+	var result []string
+	for _, recipient := range recipients {
+		recipient = strings.TrimSpace(recipient)
+		if recipient != "" && !slices.Contains(result, recipient) {
+			result = append(result, recipient)
+		}
+	}
+	return result
+}
+
+func newShareID() (string, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate share ID: %v", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func getSharesFile() string {
+	return filepath.Join(extensions.StateDir("shares"), "shares.json")
+}
+
+// loadShareRecords reads the shares created by the user, oldest first
+func loadShareRecords() ([]shareRecord, error) {
+	content, err := os.ReadFile(getSharesFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shares: %v", err)
+	}
+	var records []shareRecord
+	if err := json.Unmarshal(content, &records); err != nil {
+		return nil, fmt.Errorf("malformed shares file %s: %v", getSharesFile(), err)
+	}
+	return records, nil
+}
+
+func saveShareRecords(records []shareRecord) error {
+	if err := os.MkdirAll(filepath.Dir(getSharesFile()), 0o755); err != nil {
+		return fmt.Errorf("failed to create shares directory: %v", err)
+	}
+	content, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(getSharesFile(), content, 0o644); err != nil {
+		return fmt.Errorf("failed to write shares: %v", err)
+	}
+	return nil
+}
+
+func recordShare(record shareRecord) error {
+	records, err := loadShareRecords()
+	if err != nil {
+		return err
+	}
+	return saveShareRecords(append(records, record))
+}
+
+// activeShareRecords returns the shares neither revoked nor expired
+func activeShareRecords(records []shareRecord, now time.Time) []shareRecord {
+	var active []shareRecord
+	for _, record := range records {
+		if !record.Revoked && record.ExpiresAt.After(now) {
+			active = append(active, record)
+		}
+	}
+	return active
+}
+
+// revokeShare marks a share as revoked and removes its archive when it was written locally
+func revokeShare(id string) (*shareRecord, error) {
+	records, err := loadShareRecords()
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(records, func(r shareRecord) bool { return r.ID == id })
+	if i < 0 {
+		return nil, fmt.Errorf("share %q not found", id)
+	}
+	record := &records[i]
+	if record.Revoked {
+		return nil, fmt.Errorf("share %q is already revoked", id)
+	}
+	if record.Method == "archive" && isLocalShareLocation(record.Location) {
+		if err := os.Remove(record.Location); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove archive: %v", err)
+		}
+	}
+	record.Revoked = true
+	if err := saveShareRecords(records); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// isLocalShareLocation reports whether an archive was written locally rather than copied over SSH
+func isLocalShareLocation(location string) bool {
+	return filepath.IsAbs(location)
+}
+
+func printShareRecords(w io.Writer, records []shareRecord) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tPROJECT\tMETHOD\tRECIPIENTS\tEXPIRES\tLOCATION")
+	for _, record := range records {
+		recipients := strings.Join(record.Recipients, ",")
+		if recipients == "" {
+			recipients = "-"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", record.ID, record.Project, record.Method, recipients,
+			record.ExpiresAt.Local().Format(time.DateTime), record.Location)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,347 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/internal/bundle"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestCollectShareFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{
+		"compose.yaml",
+		".env",
+		".env.local",
+		".git/config",
+		"app/main.go",
+		"app/debug.log",
+		"app/node_modules/lib/index.js",
+		"dist/bundle.js",
+		"tmp/cache.bin",
+		"build/out.bin",
+	} {
+		path := filepath.Join(dir, file)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("# build output\n/build/\ncache.bin\n"), 0o644))
+
+	excludes, err := shareExcludes(dir, &shareOptions{})
+	require.NoError(t, err)
+	files, err := collectShareFiles(dir, nil, excludes)
+	require.NoError(t, err)
+	assert.Equal(t, []string{".gitignore", "app/main.go", "compose.yaml"}, files)
+
+	excludes, err = shareExcludes(dir, &shareOptions{noDefaultExcludes: true})
+	require.NoError(t, err)
+	files, err = collectShareFiles(dir, []string{"app"}, excludes)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app/debug.log", "app/main.go", "app/node_modules/lib/index.js"}, files)
+}
+
+func TestWriteShareArchive(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "app"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte("services: {}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app", "main.go"), []byte("package main\n"), 0o644))
+
+	var buf bytes.Buffer
+	manifest := shareManifest{ID: "abc", Project: "shop", Recipients: []string{"alice"}, Access: "read"}
+	require.NoError(t, writeShareArchive(&buf, dir, []string{"app/main.go", "compose.yaml"}, nil, manifest))
+
+	dest := t.TempDir()
+	written, err := bundle.Read(&buf, dest)
+	require.NoError(t, err)
+	assert.Equal(t, bundle.KindShare, written.Kind)
+	assert.Equal(t, "shop", written.Name)
+	var metadata shareManifest
+	require.NoError(t, json.Unmarshal(written.Metadata, &metadata))
+	assert.Equal(t, manifest, metadata)
+	assert.Equal(t, map[string]string{
+		"app/main.go":  "package main\n",
+		"compose.yaml": "services: {}\n",
+	}, readTree(t, dest))
+}
+
+// readTree returns the content of the regular files below dir, by slash separated relative path
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	contents := map[string]string{}
+	require.NoError(t, filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		contents[filepath.ToSlash(rel)] = string(content)
+		return err
+	}))
+	return contents
+}
+
+func TestEnvExportShareImportRoundTrip(t *testing.T) {
+	envsDir := t.TempDir()
+	require.NoError(t, createEnvironment(envsDir, "staging", "Staging", "services:\n  web:\n    image: nginx\n"))
+	exported := filepath.Join(t.TempDir(), "staging.tar.gz")
+	ctrl := gomock.NewController(t)
+	cli := mocks.NewMockCli(ctrl)
+	apiClient := mocks.NewMockAPIClient(ctrl)
+	cli.EXPECT().Client().Return(apiClient).AnyTimes()
+	apiClient.EXPECT().ImageInspect(gomock.Any(), "nginx").Return(image.InspectResponse{
+		ID:          "sha256:abc",
+		RepoDigests: []string{"nginx@sha256:def"},
+	}, nil)
+	require.NoError(t, exportEnvironment(context.Background(), cli, envsDir, "staging", exported))
+
+	t.Chdir(t.TempDir())
+	manifest, dir, err := importShare(exported, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, "staging", dir)
+	assert.Equal(t, bundle.KindEnvironment, manifest.Kind)
+	imported := readTree(t, dir)
+	assert.JSONEq(t, `{"services": {"web": {"image": "nginx", "digest": "nginx@sha256:def"}}}`, imported[deployLockFile])
+	delete(imported, deployLockFile)
+	assert.Equal(t, readTree(t, filepath.Join(envsDir, "staging")), imported)
+
+	_, _, err = importShare(exported, "", false)
+	assert.EqualError(t, err, "staging already exists")
+}
+
+func TestImportShareRejectsUnsafeName(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte("services: {}\n"), 0o644))
+	for _, name := range []string{"../escape", "../../x", "/abs/path", "a/b", ".", ".."} {
+		archive := filepath.Join(t.TempDir(), "crafted.tar.gz")
+		f, err := os.Create(archive)
+		require.NoError(t, err)
+		require.NoError(t, bundle.Write(f, dir, []string{"compose.yaml"}, bundle.Manifest{Kind: bundle.KindShare, Name: name}))
+		require.NoError(t, f.Close())
+
+		work := filepath.Join(t.TempDir(), "work")
+		require.NoError(t, os.Mkdir(work, 0o755))
+		t.Chdir(work)
+		_, _, err = importShare(archive, "", false)
+		assert.ErrorContains(t, err, "not a plain directory name, set the destination with --import-dir", name)
+		entries, err := os.ReadDir(filepath.Dir(work))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1, "nothing is written next to the working directory for %q", name)
+		entries, err = os.ReadDir(work)
+		require.NoError(t, err)
+		assert.Empty(t, entries, name)
+	}
+}
+
+func TestShareExportEnvImport(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "compose.yml"), []byte("services: {}\n"), 0o644))
+	archive := filepath.Join(t.TempDir(), "shop.tar.gz")
+	f, err := os.Create(archive)
+	require.NoError(t, err)
+	require.NoError(t, writeShareArchive(f, dir, []string{"compose.yml"}, nil, shareManifest{ID: "abc", Project: "shop"}))
+	require.NoError(t, f.Close())
+
+	envsDir := t.TempDir()
+	require.NoError(t, importEnvironment(envsDir, "review", archive, false))
+	assert.Equal(t, map[string]string{
+		"compose.yaml":    "services: {}\n",
+		"description.txt": "Imported from the share of project shop",
+	}, readTree(t, filepath.Join(envsDir, "review")))
+}
+
+func TestVerifyShareArchive(t *testing.T) {
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "compose.yaml")
+	require.NoError(t, os.WriteFile(composeFile, []byte("services: {}\n"), 0o644))
+	project := &types.Project{Name: "shop", WorkingDir: dir, ComposeFiles: []string{composeFile}}
+	name, digest := shareComposeDigest(project, []string{"compose.yaml"})
+	assert.Equal(t, "compose.yaml", name)
+	assert.Len(t, digest, 64)
+	name, _ = shareComposeDigest(project, []string{"app/main.go"})
+	assert.Empty(t, name, "the compose file is not shared")
+
+	write := func(manifest shareManifest) string {
+		archive := filepath.Join(t.TempDir(), "shop.tar.gz")
+		f, err := os.Create(archive)
+		require.NoError(t, err)
+		require.NoError(t, writeShareArchive(f, dir, []string{"compose.yaml"}, nil, manifest))
+		require.NoError(t, f.Close())
+		return archive
+	}
+	result, err := verifyShareArchive(write(shareManifest{ID: "abc", Project: "shop", ComposeFile: "compose.yaml", ComposeDigest: digest}))
+	require.NoError(t, err)
+	assert.Equal(t, "shop", result.Manifest.Name)
+	assert.Equal(t, "compose.yaml", result.ComposeFile)
+	assert.Equal(t, digest, result.ComposeDigest)
+
+	// the compose file digest is also found in archives which don't record it
+	result, err = verifyShareArchive(write(shareManifest{ID: "abc", Project: "shop"}))
+	require.NoError(t, err)
+	assert.Equal(t, digest, result.ComposeDigest)
+
+	// an archive whose compose file doesn't match the digest of the share is neither verified nor imported
+	archive := write(shareManifest{ID: "abc", Project: "shop", ComposeFile: "compose.yaml", ComposeDigest: "0000"})
+	_, err = verifyShareArchive(archive)
+	assert.EqualError(t, err, "bundle verification failed: compose.yaml does not match the compose file digest of the share")
+	t.Chdir(t.TempDir())
+	_, _, err = importShare(archive, "", false)
+	assert.ErrorContains(t, err, "does not match the compose file digest")
+	entries, err := os.ReadDir(".")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// an archive stripped of its manifest is only imported with --insecure
+	stripped := filepath.Join(t.TempDir(), "stripped.tar.gz")
+	f, err := os.Create(stripped)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	content := []byte("services: {}\n")
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "compose.yaml", Mode: 0o644, Size: int64(len(content))}))
+	_, err = tw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, f.Close())
+	_, err = verifyShareArchive(stripped)
+	assert.ErrorIs(t, err, bundle.ErrNoManifest)
+	_, _, err = importShare(stripped, "shop", false)
+	assert.EqualError(t, err, stripped+" has no manifest, its content can't be verified, use --insecure to import it anyway")
+	entries, err = os.ReadDir(".")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	manifest, dir, err := importShare(stripped, "shop", true)
+	require.NoError(t, err)
+	assert.Nil(t, manifest)
+	assert.Equal(t, map[string]string{"compose.yaml": "services: {}\n"}, readTree(t, dir))
+
+	envsDir := t.TempDir()
+	err = importEnvironment(envsDir, "review", stripped, false)
+	assert.EqualError(t, err, stripped+" has no manifest, its content can't be verified, use --insecure to import it anyway")
+	assert.NoDirExists(t, filepath.Join(envsDir, "review"))
+	require.NoError(t, importEnvironment(envsDir, "review", stripped, true))
+	assert.Equal(t, map[string]string{
+		"compose.yaml":    "services: {}\n",
+		"description.txt": "Imported environment",
+	}, readTree(t, filepath.Join(envsDir, "review")))
+
+	plain := filepath.Join(t.TempDir(), "compose.yaml")
+	require.NoError(t, os.WriteFile(plain, []byte("services: {}\n"), 0o644))
+	_, err = verifyShareArchive(plain)
+	assert.ErrorContains(t, err, "not a bundle")
+}
+
+func TestShareArchiveCopy(t *testing.T) {
+	bin := t.TempDir()
+	args := filepath.Join(t.TempDir(), "args")
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "scp"), []byte("#!/bin/sh\nprintf '%s\\n' \"$@\" > "+args+"\n"), 0o755))
+	t.Setenv("PATH", bin)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte("services: {}\n"), 0o644))
+	ctrl := gomock.NewController(t)
+	cli := mocks.NewMockCli(ctrl)
+	cli.EXPECT().Client().Return(mocks.NewMockAPIClient(ctrl)).AnyTimes()
+	project := &types.Project{Name: "shop", WorkingDir: dir}
+	location, err := shareArchive(context.Background(), cli, project, []string{"compose.yaml"}, &shareOptions{to: "-oProxyCommand=evil:", quiet: true}, shareManifest{ID: "abc", Project: "shop"})
+	require.NoError(t, err)
+	assert.Equal(t, "-oProxyCommand=evil:shop.tar.gz", location)
+	content, err := os.ReadFile(args)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, []string{"-q", "--"}, lines[:2])
+	assert.Equal(t, "-oProxyCommand=evil:shop.tar.gz", lines[3])
+}
+
+func TestShareDestination(t *testing.T) {
+	assert.Equal(t, "me@host:shop.tar.gz", shareDestination("me@host:", "shop.tar.gz"))
+	assert.Equal(t, "me@host:/srv/drop/shop.tar.gz", shareDestination("me@host:/srv/drop/", "shop.tar.gz"))
+	assert.Equal(t, "me@host:/srv/drop/latest.tgz", shareDestination("me@host:/srv/drop/latest.tgz", "shop.tar.gz"))
+}
+
+func TestShareRecords(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	now := time.Now()
+	archive := filepath.Join(t.TempDir(), "shop.tar.gz")
+	require.NoError(t, os.WriteFile(archive, nil, 0o644))
+
+	require.NoError(t, recordShare(shareRecord{
+		shareManifest: shareManifest{ID: "a1", Project: "shop", Recipients: []string{"alice", "bob"}, ExpiresAt: now.Add(time.Hour)},
+		Method:        "archive",
+		Location:      archive,
+	}))
+	require.NoError(t, recordShare(shareRecord{
+		shareManifest: shareManifest{ID: "b2", Project: "shop", ExpiresAt: now.Add(-time.Hour)},
+		Method:        "link",
+	}))
+	records, err := loadShareRecords()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	active := activeShareRecords(records, now)
+	require.Len(t, active, 1)
+	assert.Equal(t, "a1", active[0].ID)
+
+	record, err := revokeShare("a1")
+	require.NoError(t, err)
+	assert.True(t, record.Revoked)
+	assert.NoFileExists(t, archive)
+	records, err = loadShareRecords()
+	require.NoError(t, err)
+	assert.Empty(t, activeShareRecords(records, now))
+
+	_, err = revokeShare("a1")
+	assert.ErrorContains(t, err, `share "a1" is already revoked`)
+	_, err = revokeShare("zz")
+	assert.ErrorContains(t, err, `share "zz" not found`)
+}
+
+func TestParseShareExpiry(t *testing.T) {
+	d, err := parseShareExpiry("7d")
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, d)
+	d, err = parseShareExpiry("90m")
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Minute, d)
+	for _, invalid := range []string{"", "d", "-1d", "0h", "soon"} {
+		_, err = parseShareExpiry(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	assert.Equal(t, []string{"alice", "bob"}, shareRecipients([]string{" alice", "bob", "", "alice"}))
+}
@@ -0,0 +1,205 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/cli/cli/command"
+	"github.com/spf13/cobra"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/compose"
+	"github.com/docker/compose/v5/pkg/extensions"
+)
+
+type statusOptions struct {
+	*ProjectOptions
+	format string
+}
+
+func statusCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *BackendOptions) *cobra.Command {
+	opts := statusOptions{
+		ProjectOptions: p,
+		format:         "text",
+	}
+
+	cmd := &cobra.Command{
+		Use:   "status [OPTIONS]",
+		Short: "Summarize the state of a project",
+		Long: `EXPERIMENTAL - Summarize the state of a project across the extension commands.
+
+The dashboard combines:
+- The health and running replicas of each service, against the declared replicas
+- The active environment (env)
+- The latest recorded deployment (deploy, rollback)
+- The active shares of the project (share)
+`,
+		RunE: Adapt(func(ctx context.Context, args []string) error {
+			return runStatus(ctx, dockerCli, backendOptions, &opts)
+		}),
+	}
+
+	cmd.Flags().StringVar(&opts.format, "format", "text", "Output format (text, json)")
+	return cmd
+}
+
+// projectStatus is the dashboard of a project
+type projectStatus struct {
+	Project     string                  `json:"project"`
+	Services    []serviceStatus         `json:"services"`
+	Health      map[string]int          `json:"health"`
+	Environment *currentEnvironmentInfo `json:"environment,omitempty"`
+	Deployment  *extensions.VersionInfo `json:"deployment,omitempty"`
+	Shares      []shareRecord           `json:"shares"`
+}
+
+// serviceStatus is the state of a service in the dashboard
+type serviceStatus struct {
+	Name string `json:"name"`
+	// Health is the health state of the service, healthStateStopped without running container
+	Health  string `json:"health"`
+	Running int    `json:"running"`
+	// Declared is the number of replicas declared in the compose file, if any
+	Declared *int `json:"declared,omitempty"`
+}
+
+// healthStateStopped is the state of a service without any container
+const healthStateStopped = "stopped"
+
+func runStatus(ctx context.Context, dockerCli command.Cli, backendOptions *BackendOptions, opts *statusOptions) error {
+	if opts.format != "text" && opts.format != "json" {
+		return fmt.Errorf("unsupported format %q, must be one of text, json", opts.format)
+	}
+	backend, err := compose.NewComposeService(dockerCli, backendOptions.Options...)
+	if err != nil {
+		return err
+	}
+	project, _, err := opts.ToProject(ctx, dockerCli, backend, nil)
+	if err != nil {
+		return err
+	}
+
+	status, err := collectProjectStatus(ctx, backend, project, time.Now())
+	if err != nil {
+		return err
+	}
+	return printProjectStatus(dockerCli.Out(), status, opts.format)
+}
+
+// collectProjectStatus gathers the state of the project services and the extension state related to it
+func collectProjectStatus(ctx context.Context, backend api.Compose, project *types.Project, now time.Time) (projectStatus, error) {
+	status := projectStatus{Project: project.Name, Shares: []shareRecord{}}
+
+	containers, err := backend.Ps(ctx, project.Name, api.PsOptions{All: true})
+	if err != nil {
+		return status, err
+	}
+	states := serviceHealthStates(containers, "")
+	status.Health = tallyHealthStates(states)
+	for _, name := range project.ServiceNames() {
+		service := serviceStatus{
+			Name:    name,
+			Health:  states[name],
+			Running: extensions.CountRunningReplicas(containers, project.Name, name),
+		}
+		if service.Health == "" {
+			service.Health = healthStateStopped
+		}
+		if declared, err := extensions.ServiceDeclaredReplicas(project.Services[name]); err == nil {
+			service.Declared = &declared
+		}
+		status.Services = append(status.Services, service)
+	}
+
+	if env := getCurrentEnvironmentInfo(getEnvironmentsDir()); env.Active {
+		status.Environment = &env
+	}
+
+	history, err := extensions.DefaultHistoryStore().Load(project.Name)
+	if err != nil {
+		return status, err
+	}
+	if len(history) > 0 {
+		status.Deployment = &history[len(history)-1]
+	}
+
+	records, err := loadShareRecords()
+	if err != nil {
+		return status, err
+	}
+	for _, record := range activeShareRecords(records, now) {
+		if record.Project == project.Name {
+			status.Shares = append(status.Shares, record)
+		}
+	}
+	return status, nil
+}
+
+// printProjectStatus renders the dashboard
+func printProjectStatus(w io.Writer, status projectStatus, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	}
+
+	_, _ = fmt.Fprintf(w, "Project:     %s\n", status.Project)
+	environment := "none"
+	if status.Environment != nil {
+		environment = status.Environment.Name
+		if status.Environment.Description != "" {
+			environment += " (" + status.Environment.Description + ")"
+		}
+	}
+	_, _ = fmt.Fprintf(w, "Environment: %s\n", environment)
+	deployment := "none recorded"
+	if d := status.Deployment; d != nil {
+		deployment = fmt.Sprintf("%s at %s, %s", d.Version, d.CreatedAt, d.Description)
+		if d.Status != "" {
+			deployment += " [" + d.Status + "]"
+		}
+	}
+	_, _ = fmt.Fprintf(w, "Deployment:  %s\n", deployment)
+	_, _ = fmt.Fprintf(w, "Health:      %s\n\n", formatHealthTally(status.Health))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SERVICE\tHEALTH\tREPLICAS")
+	for _, service := range status.Services {
+		replicas := fmt.Sprint(service.Running)
+		if service.Declared != nil {
+			replicas = fmt.Sprintf("%d/%d", service.Running, *service.Declared)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", service.Name, service.Health, replicas)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(status.Shares) == 0 {
+		_, _ = fmt.Fprintln(w, "\nNo active shares")
+		return nil
+	}
+	_, _ = fmt.Fprintf(w, "\nActive shares (%d):\n", len(status.Shares))
+	return printShareRecords(w, status.Shares)
+}
@@ -0,0 +1,87 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/extensions"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestCollectProjectStatus(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	replicas := 2
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"web": {Name: "web", Image: "web:1", Deploy: &types.DeployConfig{Replicas: &replicas}},
+		"db":  {Name: "db", Image: "postgres:16"},
+	}}
+	_, err := extensions.DefaultHistoryStore().Record(project, "Deployed to prod", "", nil)
+	require.NoError(t, err)
+
+	now := time.Now()
+	for _, record := range []shareRecord{
+		{shareManifest: shareManifest{ID: "a1", Project: "shop", ExpiresAt: now.Add(time.Hour)}, Method: "archive", Location: "/tmp/a1.tar.gz"},
+		{shareManifest: shareManifest{ID: "b2", Project: "shop", ExpiresAt: now.Add(-time.Hour)}, Method: "archive", Location: "/tmp/b2.tar.gz"},
+		{shareManifest: shareManifest{ID: "c3", Project: "other", ExpiresAt: now.Add(time.Hour)}, Method: "archive", Location: "/tmp/c3.tar.gz"},
+	} {
+		require.NoError(t, recordShare(record))
+	}
+
+	labels := map[string]string{api.ProjectLabel: "shop", api.ServiceLabel: "web"}
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{All: true}).Return([]api.ContainerSummary{
+		{Service: "web", State: "running", Health: "healthy", Labels: labels},
+		{Service: "web", State: "running", Health: "unhealthy", Labels: labels},
+	}, nil)
+
+	status, err := collectProjectStatus(context.Background(), backend, project, now)
+	require.NoError(t, err)
+	assert.Equal(t, []serviceStatus{
+		{Name: "db", Health: healthStateStopped},
+		{Name: "web", Health: healthStateUnhealthy, Running: 2, Declared: &replicas},
+	}, status.Services)
+	assert.Nil(t, status.Environment)
+	require.NotNil(t, status.Deployment)
+	assert.Equal(t, "v1", status.Deployment.Version)
+	require.Len(t, status.Shares, 1)
+	assert.Equal(t, "a1", status.Shares[0].ID)
+
+	var buf strings.Builder
+	require.NoError(t, printProjectStatus(&buf, status, "text"))
+	out := buf.String()
+	assert.Contains(t, out, "Environment: none\n")
+	assert.Contains(t, out, "Deployment:  v1 at ")
+	assert.Contains(t, out, "Health:      healthy: 0, starting: 0, unhealthy: 1\n")
+	assert.Contains(t, out, "db        stopped     0\n")
+	assert.Contains(t, out, "web       unhealthy   2/2\n")
+	assert.Contains(t, out, "Active shares (1):\n")
+
+	buf.Reset()
+	require.NoError(t, printProjectStatus(&buf, status, "json"))
+	assert.Contains(t, buf.String(), `"declared": 2`)
+}
@@ -18,14 +18,19 @@ package compose
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/docker/cli/cli/command"
 	"github.com/spf13/cobra"
 
 	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/cmd/prompt"
 	"github.com/docker/compose/v5/pkg/api"
 	"github.com/docker/compose/v5/pkg/compose"
+	"github.com/docker/compose/v5/pkg/extensions"
 )
 
 type syncOptions struct {
@@ -33,20 +38,20 @@ type syncOptions struct {
 	services  []string
 	all       bool
 	direction string
-	watch     bool
 	ignore    []string
 	timeout   int
 	conflict  string
 	preview   bool
 	dryRun    bool
+	checksum  bool
+	replica   int
 }
 
 func syncCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *BackendOptions) *cobra.Command {
 	opts := syncOptions{
 		ProjectOptions: p,
 		all:            false,
-		direction:      "bidirectional",
-		watch:          false,
+		direction:      "local-to-container",
 		timeout:        60,
 		conflict:       "ask",
 		preview:        false,
@@ -56,16 +61,26 @@ func syncCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *Backe
 	cmd := &cobra.Command{
 		Use:   "sync [OPTIONS] [SERVICE...]",
 		Short: "Sync code between local and containers",
-		Long: `Synchronize code between local filesystem and containers with support for bidirectional sync and conflict resolution.
+		Long: `Synchronize code from the local filesystem to the containers, with conflict resolution.
 
 This command supports:
-1. Bidirectional sync: Sync changes in both directions
-2. One-way sync: Sync from local to container or container to local
-3. Watch mode: Continuously sync changes as they occur
-4. Ignore patterns: Exclude specific files and directories from sync
-5. Conflict resolution: Handle file conflicts with various strategies
-6. Preview: Show what would be synced without making changes
-7. Dry run: Simulate sync operation
+1. One-way sync: Sync the develop.watch sync paths from local to the containers
+2. Ignore patterns: Exclude specific files and directories from sync
+3. Conflict resolution: Handle file conflicts with various strategies
+4. Preview: Show what would be synced without making changes
+5. Dry run: Simulate sync operation
+
+To keep syncing changes as they occur, use "docker compose watch".
+
+Files are renamed into place only once fully transferred, and an interrupted sync resumes
+from where it stopped.
+
+With --checksum, files are compared by content with the copies in the containers and only
+those which differ are transferred. A file changed in the container since the last sync is
+a conflict, resolved with --conflict. Local hashes are cached by size and modification time.
+
+Files are synced to every running replica of a service at once, each replica keeping its own
+progress, and the result is reported per replica. --replica N only syncs replica N.
 `,
 		RunE: Adapt(func(ctx context.Context, args []string) error {
 			opts.services = args
@@ -74,13 +89,14 @@ This command supports:
 	}
 
 	cmd.Flags().BoolVar(&opts.all, "all", false, "Sync all services")
-	cmd.Flags().StringVar(&opts.direction, "direction", "bidirectional", "Sync direction (bidirectional, local-to-container, container-to-local)")
-	cmd.Flags().BoolVar(&opts.watch, "watch", false, "Watch for changes and sync continuously")
+	cmd.Flags().StringVar(&opts.direction, "direction", "local-to-container", "Sync direction (local-to-container)")
 	cmd.Flags().StringArrayVar(&opts.ignore, "ignore", []string{}, "Paths to ignore (supports patterns)")
 	cmd.Flags().IntVar(&opts.timeout, "timeout", 60, "Sync timeout in seconds")
 	cmd.Flags().StringVar(&opts.conflict, "conflict", "ask", "Conflict resolution strategy (ask, local-wins, container-wins, newer-wins)")
 	cmd.Flags().BoolVar(&opts.preview, "preview", false, "Preview sync operations without making changes")
 	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Execute command in dry run mode")
+	cmd.Flags().IntVar(&opts.replica, "replica", 0, "Only sync the given replica of the services (default all running replicas)")
+	cmd.Flags().BoolVar(&opts.checksum, "checksum", false, "Compare file contents instead of transferring every file, slower but reliable across filesystems")
 	return cmd
 }
 
@@ -90,10 +106,12 @@ func runSync(ctx context.Context, dockerCli command.Cli, backendOptions *Backend
 		return err
 	}
 
-	project, _, err := opts.ToProject(ctx, dockerCli, backend, opts.services)
+	selection := opts.SelectServices(opts.services, opts.all)
+	project, _, err := opts.ToProject(ctx, dockerCli, backend, selection)
 	if err != nil {
 		return err
 	}
+	opts.services = opts.ResolveServices(project, selection)
 
 	fmt.Println("Starting code synchronization...")
 	fmt.Printf("Syncing services: %v\n", opts.services)
@@ -101,9 +119,6 @@ func runSync(ctx context.Context, dockerCli command.Cli, backendOptions *Backend
 		fmt.Println("Syncing all services")
 	}
 	fmt.Printf("Sync direction: %s\n", opts.direction)
-	if opts.watch {
-		fmt.Println("Watch mode enabled - syncing continuously")
-	}
 	if opts.preview {
 		fmt.Println("Preview mode enabled - showing changes only")
 	}
@@ -117,9 +132,7 @@ func runSync(ctx context.Context, dockerCli command.Cli, backendOptions *Backend
 
 	// Validate sync direction
 	validDirections := map[string]bool{
-		"bidirectional":      true,
 		"local-to-container": true,
-		"container-to-local": true,
 	}
 	if !validDirections[opts.direction] {
 		return fmt.Errorf("invalid sync direction: %s", opts.direction)
@@ -136,48 +149,56 @@ func runSync(ctx context.Context, dockerCli command.Cli, backendOptions *Backend
 		return fmt.Errorf("invalid conflict resolution strategy: %s", opts.conflict)
 	}
 
-	// Sync each service
+	if err := syncServices(ctx, dockerCli, backend, project, opts); err != nil {
+		return err
+	}
+
+	fmt.Println("\nSync operation completed!")
+	return nil
+}
+
+// syncServices syncs each service, going on with the others when one fails, and returns the
+// failures of all of them
+func syncServices(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, opts *syncOptions) error {
+	var errs []error
 	for _, service := range opts.services {
 		fmt.Printf("\nSyncing service: %s\n", service)
 		if err := syncService(ctx, dockerCli, backend, project, service, opts); err != nil {
-			fmt.Printf("Warning: Sync failed for service %s: %v\n", service, err)
+			fmt.Printf("Sync failed for service %s: %v\n", service, err)
+			errs = append(errs, fmt.Errorf("failed to sync service %s: %w", service, err))
 			continue
 		}
 		fmt.Printf("Sync completed for service: %s\n", service)
 	}
-
-	// If watch mode is enabled, start watching for changes
-	if opts.watch {
-		fmt.Println("\nStarting watch mode...")
-		fmt.Println("Press Ctrl+C to stop...")
-		// For demo purposes, just wait for interrupt
-		<-ctx.Done()
-		fmt.Println("\nStopping watch mode...")
-	}
-
-	fmt.Println("\nSync operation completed!")
-	return nil
+	return errors.Join(errs...)
 }
 
 func syncService(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, service string, opts *syncOptions) error {
-	// Simplified implementation - in real code, this would perform actual sync
 	fmt.Printf("Synchronizing service: %s\n", service)
 	fmt.Printf("Direction: %s\n", opts.direction)
 	fmt.Printf("Conflict strategy: %s\n", opts.conflict)
 	fmt.Printf("Timeout: %d seconds\n", opts.timeout)
 
-	// For demo purposes, just return success
-	if opts.preview || opts.dryRun {
-		fmt.Println("Preview mode: Would sync files between local and container")
-	} else {
-		fmt.Println("Performing actual sync operation")
-	}
-
-	// Simulate sync operation
-	fmt.Println("Syncing files...")
-	fmt.Println("Checking for conflicts...")
-	fmt.Println("Resolving conflicts...")
-	fmt.Println("Sync completed successfully")
+	return extensions.Sync(ctx, backend, dockerCli.Client(), project, service, extensions.SyncOptions{
+		Ignore:   opts.ignore,
+		Replica:  opts.replica,
+		Checksum: opts.checksum,
+		Conflict: opts.conflict,
+		Ask:      askSyncConflict(dockerCli),
+		DryRun:   opts.preview || opts.dryRun,
+		Timeout:  time.Duration(opts.timeout) * time.Second,
+		Out:      os.Stdout,
+	})
+}
 
-	return nil
+// askSyncConflict prompts whether a conflicting file overwrites the container copy, conflicts
+// are kept when not attached to a terminal
+func askSyncConflict(dockerCli command.Cli) func(extensions.SyncConflict) (bool, error) {
+	if !dockerCli.In().IsTerminal() {
+		return nil
+	}
+	return func(conflict extensions.SyncConflict) (bool, error) {
+		msg := fmt.Sprintf("%s was changed in the container since the last sync, overwrite it with %s? [y/N]: ", conflict.File.ContainerPath, conflict.File.HostPath)
+		return prompt.NewPrompt(dockerCli.In(), dockerCli.Out()).Confirm(msg, false)
+	}
 }
@@ -0,0 +1,69 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/cli/cli/streams"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestSyncServiceReplica(t *testing.T) {
+	containers := []api.ContainerSummary{
+		{ID: "c2", Name: "shop-web-2", State: "running", Labels: map[string]string{api.ContainerNumberLabel: "2"}},
+		{ID: "c1", Name: "shop-web-1", State: "running", Labels: map[string]string{api.ContainerNumberLabel: "1"}},
+	}
+	ctrl := gomock.NewController(t)
+	cli := newSyncTestCli(ctrl)
+	backend := mocks.NewMockCompose(ctrl)
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{Services: []string{"web"}}).Return(containers, nil)
+	project := &types.Project{Name: "shop", Services: types.Services{"web": {Name: "web"}}}
+	err := syncService(context.Background(), cli, backend, project, "web", &syncOptions{direction: "local-to-container", replica: 3})
+	assert.EqualError(t, err, "replica 3 of service web is not running")
+}
+
+func TestSyncServicesReportsFailures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	cli := newSyncTestCli(ctrl)
+	backend := mocks.NewMockCompose(ctrl)
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{Services: []string{"db"}}).Return(nil, errors.New("connection refused"))
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{Services: []string{"web"}}).Return(nil, nil)
+	project := &types.Project{Name: "shop", Services: types.Services{"web": {Name: "web"}, "db": {Name: "db"}}}
+
+	// every service is synced, and all the failures are returned
+	err := syncServices(context.Background(), cli, backend, project, &syncOptions{services: []string{"db", "web"}, direction: "local-to-container"})
+	assert.EqualError(t, err, "failed to sync service db: connection refused\n"+
+		"failed to sync service web: no running container for service web")
+}
+
+// newSyncTestCli returns a docker CLI not attached to a terminal
+func newSyncTestCli(ctrl *gomock.Controller) *mocks.MockCli {
+	cli := mocks.NewMockCli(ctrl)
+	cli.EXPECT().Client().Return(mocks.NewMockAPIClient(ctrl)).AnyTimes()
+	cli.EXPECT().In().Return(streams.NewIn(io.NopCloser(strings.NewReader("")))).AnyTimes()
+	return cli
+}
@@ -17,12 +17,36 @@
 package compose
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
 
+	"github.com/containerd/errdefs"
+	"github.com/distribution/reference"
 	"github.com/docker/cli/cli/command"
+	containerType "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/spf13/cobra"
 
 	"github.com/compose-spec/compose-go/v2/types"
@@ -43,6 +67,46 @@ type testOptions struct {
 	clean       bool
 	coverage    bool
 	coverageDir string
+	setup       string
+	teardown    string
+	// setupCommand and teardownCommand run once on the host around the whole test run
+	setupCommand    string
+	teardownCommand string
+	keepGoing       bool
+	retries         int
+	retryDelay      time.Duration
+	noFail          bool
+	// serviceIsolation is how the tests of each service are isolated from the others: none, network
+	serviceIsolation string
+	verbose          bool
+	// waitFor are the readiness conditions polled before running the tests of a service
+	waitFor     []string
+	waitTimeout time.Duration
+	// matrix are the --matrix IMAGE=TAG[,TAG...] axes, tested as a cartesian product
+	matrix      []string
+	maxParallel int
+	// environment is the validated form of env, resolved against the host environment
+	environment []string
+	// stdout and stderr receive the progress and the output of the tests, os.Stdout and
+	// os.Stderr when unset. The combinations of a parallel matrix prefix them with their project.
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// out returns where the progress and the output of the tests are written
+func (opts *testOptions) out() io.Writer {
+	if opts.stdout != nil {
+		return opts.stdout
+	}
+	return os.Stdout
+}
+
+// errOut returns where the error output of the tests is written
+func (opts *testOptions) errOut() io.Writer {
+	if opts.stderr != nil {
+		return opts.stderr
+	}
+	return os.Stderr
 }
 
 func testCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *BackendOptions) *cobra.Command {
@@ -57,6 +121,11 @@ func testCommand(p *ProjectOptions, dockerCli command.Cli, backendOptions *Backe
 		clean:          true,
 		coverage:       false,
 		coverageDir:    "./coverage",
+		retryDelay:     2 * time.Second,
+
+		serviceIsolation: testIsolationNone,
+		waitTimeout:      60 * time.Second,
+		maxParallel:      1,
 	}
 
 	cmd := &cobra.Command{
@@ -72,6 +141,56 @@ This command supports:
 5. Parallel execution: Run multiple tests in parallel
 6. Environment variables: Set custom environment variables for tests
 7. Cleanup: Automatically clean up test resources
+
+When no service is given, or with --all, tests run for the services declaring a
+test definition: an x-test command or membership in the "test" profile.
+
+No service is tested after a failure, unless --keep-going tests the remaining ones. A
+summary of the results is printed, and the command fails when the tests of a service
+failed, unless --keep-going --no-fail.
+
+The setup and teardown of a service, declared as x-test.setup and x-test.teardown of the
+service or passed with --setup and --teardown, run in the container its tests run in: a
+one-off container of the service is then kept running for the setup, the tests and the
+teardown, and removed afterwards.
+
+A global setup and teardown, declared as x-test.setup and x-test.teardown at the
+top level of the compose file or passed with --setup-command and --teardown-command,
+run once on the host from the project directory, before the first and after the last
+service tests. A failing global setup aborts the run, while the global teardown always
+runs, even when the tests are interrupted, for up to 2 minutes, and its failure is
+reported without changing the test results.
+
+With --retries N, failing tests of a service are run up to N more times, --retry-delay
+apart. Tests passing on a retry are reported as flaky: they count as passed, and are
+tallied separately in the summary and reports.
+
+The JSON report follows a versioned schema (schema_version): the project, the timestamp and
+duration of the run, a summary of the results, and every service with its status, duration,
+attempts and captured setup and teardown output.
+
+With --parallel N, the tests of up to N services run at once. As they would share the
+project networks and the published ports, use --service-isolation network: the tests of
+each service then run in their own network (<project>_test-<service>), joined by the
+running dependencies of the service under their service name, with ephemeral published
+ports. The networks are removed when cleaning up test resources.
+
+--wait-for delays the tests of each service until a condition holds, polled from the host
+for up to --wait-timeout. It is repeatable and accepts:
+  healthy           the running containers of the tested service report healthy
+  healthy:SERVICE   the running containers of SERVICE report healthy
+  tcp://HOST:PORT   a TCP connection to HOST:PORT is accepted
+  http(s)://URL     a GET of URL answers with a status below 400
+A condition still unmet after --wait-timeout fails the tests of the service.
+
+--matrix IMAGE=TAG[,TAG...] runs the tests once per tag of an image, e.g. --matrix postgres=14,15.
+It is repeatable, the tests then run for every combination of the tags. Each combination is
+tested in its own project, <project>-matrix-<n>, where the services running the image are
+recreated with the tag before the tests, and which is removed with its volumes afterwards
+unless --clean=false. --max-parallel combinations are tested at once, the output of each
+prefixed with its project, and no other combination is started once interrupted. A report of
+the status of every service for every combination is printed, and written as matrix.json with
+--report.
 `,
 		RunE: Adapt(func(ctx context.Context, args []string) error {
 			opts.services = args
@@ -79,7 +198,7 @@ This command supports:
 		}),
 	}
 
-	cmd.Flags().BoolVar(&opts.all, "all", false, "Run tests for all services")
+	cmd.Flags().BoolVar(&opts.all, "all", false, "Run tests for all services with a test definition")
 	cmd.Flags().BoolVar(&opts.watch, "watch", false, "Watch for changes and re-run tests")
 	cmd.Flags().StringVar(&opts.report, "report", "", "Output directory for test reports")
 	cmd.Flags().StringVar(&opts.format, "format", "junit", "Test report format (junit, json, html)")
@@ -89,25 +208,79 @@ This command supports:
 	cmd.Flags().BoolVar(&opts.clean, "clean", true, "Clean up test resources after execution")
 	cmd.Flags().BoolVar(&opts.coverage, "coverage", false, "Generate coverage report")
 	cmd.Flags().StringVar(&opts.coverageDir, "coverage-dir", "./coverage", "Directory for coverage reports")
+	cmd.Flags().StringVar(&opts.setup, "setup", "", "Command to run in the test container before its tests")
+	cmd.Flags().StringVar(&opts.teardown, "teardown", "", "Command to run in the test container after its tests")
+	cmd.Flags().StringVar(&opts.setupCommand, "setup-command", "", "Command to run on the host once before all tests")
+	cmd.Flags().StringVar(&opts.teardownCommand, "teardown-command", "", "Command to run on the host once after all tests")
+	cmd.Flags().IntVar(&opts.retries, "retries", 0, "Number of times failing tests of a service are re-run before being marked failed")
+	cmd.Flags().DurationVar(&opts.retryDelay, "retry-delay", 2*time.Second, "Delay between test retries")
+	cmd.Flags().BoolVar(&opts.keepGoing, "keep-going", false, "Keep testing the remaining services after a failure")
+	cmd.Flags().BoolVar(&opts.noFail, "no-fail", false, "Exit successfully even if tests failed (requires --keep-going)")
+	cmd.Flags().StringVar(&opts.serviceIsolation, "service-isolation", testIsolationNone, "Isolation of the tests of each service (none, network)")
+	cmd.Flags().StringArrayVar(&opts.waitFor, "wait-for", nil, "Condition to wait for before running tests (healthy, healthy:SERVICE, tcp://HOST:PORT, http(s)://URL)")
+	cmd.Flags().DurationVar(&opts.waitTimeout, "wait-timeout", 60*time.Second, "How long --wait-for conditions are polled")
+	cmd.Flags().StringArrayVar(&opts.matrix, "matrix", nil, "Run the tests once per tag of an image (format: IMAGE=TAG[,TAG...])")
+	cmd.Flags().IntVar(&opts.maxParallel, "max-parallel", 1, "With --matrix, number of combinations tested at once")
+	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "Show details such as the network of each test suite")
 	return cmd
 }
 
 func runTest(ctx context.Context, dockerCli command.Cli, backendOptions *BackendOptions, opts *testOptions) error {
+	if opts.noFail && !opts.keepGoing {
+		return fmt.Errorf("--no-fail requires --keep-going")
+	}
+	if opts.retries < 0 {
+		return fmt.Errorf("--retries must not be negative, got %d", opts.retries)
+	}
+	if opts.parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1, got %d", opts.parallel)
+	}
+	for _, condition := range opts.waitFor {
+		if _, err := parseTestWaitCondition(condition, ""); err != nil {
+			return err
+		}
+	}
+	if opts.serviceIsolation != testIsolationNone && opts.serviceIsolation != testIsolationNetwork {
+		return fmt.Errorf("unsupported service isolation %q, must be one of %s, %s", opts.serviceIsolation, testIsolationNone, testIsolationNetwork)
+	}
+	axes, err := parseTestMatrix(opts.matrix)
+	if err != nil {
+		return err
+	}
+	if opts.maxParallel < 1 {
+		return fmt.Errorf("--max-parallel must be at least 1, got %d", opts.maxParallel)
+	}
+	environment, err := parseTestEnvironment(opts.env, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	opts.environment = environment
+	opts.stdout, opts.stderr = dockerCli.Out(), dockerCli.Err()
+
 	backend, err := compose.NewComposeService(dockerCli, backendOptions.Options...)
 	if err != nil {
 		return err
 	}
 
+	opts.services = opts.SelectServices(opts.services, opts.all)
 	project, _, err := opts.ToProject(ctx, dockerCli, backend, opts.services)
 	if err != nil {
 		return err
 	}
 
 	fmt.Println("Starting test execution...")
-	fmt.Printf("Running tests for services: %v\n", opts.services)
-	if opts.all {
-		fmt.Println("Running tests for all services")
+	if len(opts.services) == 0 {
+		opts.services = discoverTestServices(project)
+		if len(opts.services) == 0 {
+			return fmt.Errorf("no services with a test definition found, declare x-test.command or use the \"test\" profile")
+		}
+		// services of the test profile are disabled unless the profile is active
+		if project, err = project.WithServicesEnabled(opts.services...); err != nil {
+			return err
+		}
+		fmt.Printf("Discovered tests for services: %v\n", opts.services)
 	}
+	fmt.Printf("Running tests for services: %v\n", opts.services)
 	if opts.watch {
 		fmt.Println("Watching for changes and re-running tests")
 	}
@@ -133,20 +306,22 @@ func runTest(ctx context.Context, dockerCli command.Cli, backendOptions *Backend
 		}
 	}
 
-	// Run tests for each service
-	for _, service := range opts.services {
-		fmt.Printf("\nRunning tests for service: %s\n", service)
-		if err := runServiceTests(ctx, dockerCli, backend, project, service, opts); err != nil {
-			fmt.Printf("Warning: Tests failed for service %s: %v\n", service, err)
-			continue
-		}
-		fmt.Printf("Tests passed for service: %s\n", service)
+	if len(axes) > 0 {
+		return runTestMatrixCommand(ctx, dockerCli, backendOptions, backend, project.Name, axes, opts)
 	}
 
+	run := testRun{Project: project.Name, Started: time.Now()}
+	results, err := runTestSuite(ctx, dockerCli, backend, project, opts)
+	if err != nil {
+		return err
+	}
+	run.Duration = time.Since(run.Started)
+	run.Results = results
+
 	// Generate test report
 	if opts.report != "" {
 		fmt.Println("\nGenerating test reports...")
-		if err := generateTestReport(ctx, project, opts); err != nil {
+		if err := generateTestReport(ctx, opts, run); err != nil {
 			fmt.Printf("Warning: Failed to generate test report: %v\n", err)
 		} else {
 			fmt.Println("Test reports generated successfully")
@@ -166,72 +341,1112 @@ func runTest(ctx context.Context, dockerCli command.Cli, backendOptions *Backend
 	// Clean up resources
 	if opts.clean {
 		fmt.Println("\nCleaning up test resources...")
-		if err := cleanTestResources(ctx, backend, project, opts); err != nil {
+		if err := cleanTestResources(ctx, dockerCli, project, opts); err != nil {
 			fmt.Printf("Warning: Failed to clean up test resources: %v\n", err)
 		} else {
 			fmt.Println("Test resources cleaned up successfully")
 		}
 	}
 
+	fmt.Println("\nTest summary:")
+	printTestSummary(os.Stdout, opts.services, results)
+
+	_, failed, errored := countTestResults(results)
+	if failed+errored > 0 && !opts.noFail {
+		return fmt.Errorf("tests failed for %d of %d service(s)", failed+errored, len(opts.services))
+	}
+	fmt.Println("\nTest execution completed!")
+	return nil
+}
+
+// runTestMatrixCommand runs the tests for every combination of the matrix and reports them
+func runTestMatrixCommand(ctx context.Context, dockerCli command.Cli, backendOptions *BackendOptions, backend api.Compose, projectName string, axes []testMatrixAxis, opts *testOptions) error {
+	newBackend := func(stdout, stderr io.Writer) (api.Compose, error) {
+		options := append(slices.Clone(backendOptions.Options), compose.WithStreams(stdout, stderr, dockerCli.In()))
+		return compose.NewComposeService(dockerCli, options...)
+	}
+	results := runTestMatrix(ctx, dockerCli, newBackend, projectName, axes, opts, func(name string) (*types.Project, error) {
+		projectOptions := *opts.ProjectOptions
+		projectOptions.ProjectName = name
+		project, _, err := projectOptions.ToProject(ctx, dockerCli, backend, opts.services)
+		return project, err
+	})
+
+	if opts.report != "" {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err == nil {
+			err = os.WriteFile(filepath.Join(opts.report, "matrix.json"), data, 0o644)
+		}
+		if err != nil {
+			fmt.Printf("Warning: Failed to generate matrix report: %v\n", err)
+		}
+	}
+
+	fmt.Println("\nTest matrix:")
+	printTestMatrix(os.Stdout, opts.services, results)
+
+	if failures := countTestMatrixFailures(results); failures > 0 && !opts.noFail {
+		return fmt.Errorf("tests failed for %d of %d matrix combination(s)", failures, len(results))
+	}
 	fmt.Println("\nTest execution completed!")
 	return nil
 }
 
-func runServiceTests(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, service string, opts *testOptions) error {
-	// Simplified implementation - in real code, this would run actual tests
-	fmt.Printf("Executing tests for service: %s\n", service)
-	fmt.Printf("Test timeout: %d seconds\n", opts.timeout)
-	fmt.Printf("Parallel runners: %d\n", opts.parallel)
+// testTeardownTimeout bounds the global teardown, which also runs once the tests are interrupted
+const testTeardownTimeout = 2 * time.Minute
+
+// runTestSuite runs the tests of every selected service between the global setup and teardown
+func runTestSuite(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, opts *testOptions) ([]serviceTestResult, error) {
+	if teardown := projectTestHook(project, "teardown", opts.teardownCommand); len(teardown) > 0 {
+		defer func() {
+			fmt.Fprintln(opts.out(), "\nRunning global teardown")
+			// run even when the tests were interrupted, but not forever
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), testTeardownTimeout)
+			defer cancel()
+			if err := runHostTestHook(ctx, project, teardown, opts); err != nil {
+				fmt.Fprintf(opts.out(), "Warning: Global teardown failed: %v\n", err)
+			}
+		}()
+	}
+
+	if setup := projectTestHook(project, "setup", opts.setupCommand); len(setup) > 0 {
+		fmt.Fprintln(opts.out(), "\nRunning global setup")
+		if err := runHostTestHook(ctx, project, setup, opts); err != nil {
+			return nil, fmt.Errorf("global setup failed: %v", err)
+		}
+	}
+
+	// up to --parallel services are tested at once, no service is started after a failure
+	// unless --keep-going
+	results := make([]*serviceTestResult, len(opts.services))
+	var (
+		failed  atomic.Bool
+		wg      sync.WaitGroup
+		runners = make(chan struct{}, max(opts.parallel, 1))
+	)
+	for i, service := range opts.services {
+		runners <- struct{}{}
+		if failed.Load() && !opts.keepGoing {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-runners }()
+			fmt.Fprintf(opts.out(), "\nRunning tests for service: %s\n", service)
+			result := runServiceTestLifecycle(ctx, dockerCli, backend, project, service, opts)
+			printServiceTestResult(opts.out(), result)
+			if result.Status != testStatusPassed {
+				failed.Store(true)
+			}
+			results[i] = &result
+		}()
+	}
+	wg.Wait()
+
+	var done []serviceTestResult
+	for _, result := range results {
+		if result != nil {
+			done = append(done, *result)
+		}
+	}
+	return done, nil
+}
 
-	// For demo purposes, just return success
+func printServiceTestResult(w io.Writer, result serviceTestResult) {
+	switch result.Status {
+	case testStatusPassed:
+		if result.Flaky {
+			fmt.Fprintf(w, "Tests passed for service %s after %d attempts (flaky)\n", result.Service, result.Attempts)
+		} else {
+			fmt.Fprintf(w, "Tests passed for service: %s\n", result.Service)
+		}
+	case testStatusErrored:
+		fmt.Fprintf(w, "Warning: Tests errored for service %s: %s\n", result.Service, result.Error)
+	default:
+		fmt.Fprintf(w, "Warning: Tests failed for service %s: %s\n", result.Service, result.Error)
+	}
+}
+
+// projectTestHook returns the global setup or teardown command: the command line flag when set,
+// otherwise the top level x-test extension of the project
+func projectTestHook(project *types.Project, hook string, flag string) []string {
+	if flag != "" {
+		return []string{"/bin/sh", "-c", flag}
+	}
+	xtest, _ := project.Extensions["x-test"].(map[string]any)
+	return parseTestCommand(xtest[hook])
+}
+
+// runHostTestHook executes a global hook on the host, from the project directory, streaming its output
+func runHostTestHook(ctx context.Context, project *types.Project, command []string, opts *testOptions) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = project.WorkingDir
+	cmd.Env = append(append(os.Environ(), "COMPOSE_PROJECT_NAME="+project.Name), opts.environment...)
+	cmd.Stdout = opts.out()
+	cmd.Stderr = opts.errOut()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %v", strings.Join(command, " "), err)
+	}
 	return nil
 }
 
-func generateTestReport(ctx context.Context, project *types.Project, opts *testOptions) error {
-	// Simplified implementation - in real code, this would generate actual reports
-	reportPath := filepath.Join(opts.report, fmt.Sprintf("test-results.%s", opts.format))
-	fmt.Printf("Generating test report to: %s\n", reportPath)
+// printTestSummary prints the status of every selected service, services with no result were skipped
+// after an earlier failure
+func printTestSummary(w io.Writer, services []string, results []serviceTestResult) {
+	byService := map[string]serviceTestResult{}
+	for _, result := range results {
+		byService[result.Service] = result
+	}
+	_, _ = fmt.Fprintf(w, "%-20s %-10s %s\n", "SERVICE", "STATUS", "ERROR")
+	for _, service := range services {
+		result, ok := byService[service]
+		if !ok {
+			result = serviceTestResult{Status: "skipped"}
+		}
+		status := result.Status
+		if result.Flaky {
+			status = "flaky"
+		}
+		_, _ = fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf("%-20s %-10s %s", service, status, result.Error), " "))
+	}
+	if flaky := countFlakyTests(results); flaky > 0 {
+		_, _ = fmt.Fprintf(w, "\n%d service(s) passed after a retry\n", flaky)
+	}
+}
 
-	// For demo purposes, just create an empty file
-	reportFile, err := os.Create(reportPath)
+const (
+	testStatusPassed  = "passed"
+	testStatusFailed  = "failed"
+	testStatusErrored = "errored"
+)
+
+// serviceTestResult is the outcome of the tests of a service, including its setup and teardown
+type serviceTestResult struct {
+	Service        string `json:"service"`
+	Status         string `json:"status"`
+	Error          string `json:"error,omitempty"`
+	SetupOutput    string `json:"setupOutput,omitempty"`
+	TeardownOutput string `json:"teardownOutput,omitempty"`
+	// Attempts is the number of test runs, more than one when failing tests were retried
+	Attempts int `json:"attempts,omitempty"`
+	// Flaky is set when the tests passed on a retry
+	Flaky bool `json:"flaky,omitempty"`
+	// Duration covers the setup, every test attempt and the teardown
+	Duration time.Duration `json:"-"`
+}
+
+// testRun holds the results of a test execution, all the report formats are rendered from it
+type testRun struct {
+	Project  string
+	Started  time.Time
+	Duration time.Duration
+	Results  []serviceTestResult
+}
+
+// discoverTestServices returns the services with a test definition, including disabled services
+// of the "test" profile
+func discoverTestServices(project *types.Project) []string {
+	var services []string
+	for _, candidates := range []types.Services{project.Services, project.DisabledServices} {
+		for name, service := range candidates {
+			if len(xTestCommand(service, "command")) > 0 || slices.Contains(service.Profiles, "test") {
+				services = append(services, name)
+			}
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+// runServiceTestLifecycle runs setup, tests and teardown of a service. A failing setup skips
+// the tests and marks the service errored, while teardown always runs. With a setup or a
+// teardown, the tests run in a one-off container kept for the whole lifecycle, so the hooks see
+// and leave the state of the tests.
+func runServiceTestLifecycle(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, service string, opts *testOptions) (result serviceTestResult) {
+	result = serviceTestResult{Service: service, Status: testStatusPassed}
+	started := time.Now()
+	defer func() {
+		result.Duration = time.Since(started)
+	}()
+	serviceConfig, err := project.GetService(service)
+	if err != nil {
+		result.Status = testStatusErrored
+		result.Error = err.Error()
+		return result
+	}
+
+	if opts.serviceIsolation == testIsolationNetwork {
+		if project, err = isolateTestSuite(ctx, dockerCli, backend, project, serviceConfig, opts); err != nil {
+			result.Status = testStatusErrored
+			result.Error = fmt.Sprintf("isolation failed: %v", err)
+			return result
+		}
+	}
+
+	setup := serviceTestHook(serviceConfig, "setup", opts.setup)
+	teardown := serviceTestHook(serviceConfig, "teardown", opts.teardown)
+	var testContainer string
+	if len(setup) > 0 || len(teardown) > 0 {
+		if testContainer, err = startTestContainer(ctx, dockerCli, backend, project, service, opts.environment); err != nil {
+			result.Status = testStatusErrored
+			result.Error = fmt.Sprintf("failed to start the test container: %v", err)
+			return result
+		}
+		defer removeTestContainer(ctx, dockerCli, testContainer, opts.out())
+	}
+
+	runServiceSetupAndTests(ctx, dockerCli, backend, project, service, testContainer, setup, opts, &result)
+
+	// teardown runs once the setup and the tests are over, whatever their outcome
+	if len(teardown) > 0 {
+		fmt.Fprintf(opts.out(), "Running teardown for service: %s\n", service)
+		output, err := runTestHook(ctx, dockerCli, testContainer, teardown, opts.environment)
+		result.TeardownOutput = output
+		if err != nil {
+			fmt.Fprintf(opts.out(), "Warning: Teardown failed for service %s: %v\n", service, err)
+		}
+	}
+	return result
+}
+
+// runServiceSetupAndTests runs the setup of a service then, unless it failed, its tests, recording
+// their outcome in result
+func runServiceSetupAndTests(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, service string, testContainer string, setup []string, opts *testOptions, result *serviceTestResult) {
+	if len(setup) > 0 {
+		fmt.Fprintf(opts.out(), "Running setup for service: %s\n", service)
+		output, err := runTestHook(ctx, dockerCli, testContainer, setup, opts.environment)
+		result.SetupOutput = output
+		if err != nil {
+			result.Status = testStatusErrored
+			result.Error = fmt.Sprintf("setup failed: %v", err)
+			return
+		}
+	}
+
+	if err := runServiceTestsWithRetries(ctx, dockerCli, backend, project, service, testContainer, opts, result); err != nil {
+		result.Status = testStatusFailed
+		result.Error = err.Error()
+	}
+}
+
+// runServiceTestsWithRetries runs the tests of a service up to --retries more times while they
+// fail, recording the attempts and whether they passed on a retry
+func runServiceTestsWithRetries(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, service string, testContainer string, opts *testOptions, result *serviceTestResult) error {
+	for {
+		result.Attempts++
+		err := runServiceTests(ctx, dockerCli, backend, project, service, testContainer, opts)
+		if err == nil {
+			result.Flaky = result.Attempts > 1
+			return nil
+		}
+		if result.Attempts > opts.retries {
+			return err
+		}
+		fmt.Fprintf(opts.out(), "Tests failed for service %s (attempt %d/%d): %v, retrying in %s\n", service, result.Attempts, opts.retries+1, err, opts.retryDelay)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(opts.retryDelay):
+		}
+	}
+}
+
+// serviceTestHook returns the setup or teardown command of a service: the command line flag when
+// set, otherwise the x-test extension of the service
+func serviceTestHook(service types.ServiceConfig, hook string, flag string) []string {
+	if flag != "" {
+		return []string{"/bin/sh", "-c", flag}
+	}
+	return xTestCommand(service, hook)
+}
+
+// testContainerCommand keeps the test container of a service running until it is removed, the
+// hooks and the tests are executed in it
+var testContainerCommand = []string{"/bin/sh", "-c", "trap 'exit 0' TERM INT; while :; do sleep 1; done"}
+
+// startTestContainer starts a one-off container of the service for its hooks and tests to run in
+func startTestContainer(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, service string, environment []string) (string, error) {
+	name := fmt.Sprintf("%s%s%s%stest%s%d", project.Name, api.Separator, service, api.Separator, api.Separator, time.Now().UnixNano())
+	_, err := backend.RunOneOffContainer(ctx, project, api.RunOptions{
+		Project:     project,
+		Service:     service,
+		Name:        name,
+		Entrypoint:  testContainerCommand,
+		Environment: environment,
+		Detach:      true,
+	})
+	return name, err
+}
+
+// removeTestContainer removes the test container of a service, even once the tests were interrupted
+func removeTestContainer(ctx context.Context, dockerCli command.Cli, name string, w io.Writer) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	if err := dockerCli.Client().ContainerRemove(ctx, name, containerType.RemoveOptions{Force: true}); err != nil && !errdefs.IsNotFound(err) {
+		fmt.Fprintf(w, "Warning: Failed to remove test container %s: %v\n", name, err)
+	}
+}
+
+// runTestHook executes a command in the test container and captures its output
+func runTestHook(ctx context.Context, dockerCli command.Cli, containerID string, command []string, environment []string) (string, error) {
+	var output bytes.Buffer
+	exitCode, err := execTestCommand(ctx, dockerCli, containerID, command, environment, &output, &output)
+	if err != nil {
+		return output.String(), err
+	}
+	if exitCode != 0 {
+		return output.String(), fmt.Errorf("%s exited with code %d", strings.Join(command, " "), exitCode)
+	}
+	return output.String(), nil
+}
+
+// execTestCommand executes a command in the test container, copying its output to stdout and
+// stderr, and returns its exit code
+func execTestCommand(ctx context.Context, dockerCli command.Cli, containerID string, command []string, environment []string, stdout, stderr io.Writer) (int, error) {
+	exec, err := dockerCli.Client().ContainerExecCreate(ctx, containerID, containerType.ExecOptions{
+		Cmd:          command,
+		Env:          environment,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	attach, err := dockerCli.Client().ContainerExecAttach(ctx, exec.ID, containerType.ExecAttachOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer attach.Close()
+
+	if _, err := stdcopy.StdCopy(stdout, stderr, attach.Reader); err != nil {
+		return 0, err
+	}
+	inspect, err := dockerCli.Client().ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return 0, err
+	}
+	return inspect.ExitCode, nil
+}
+
+// runServiceTests runs the tests of a service in a new one-off container, or in testContainer
+// when the service has hooks
+func runServiceTests(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, service string, testContainer string, opts *testOptions) error {
+	serviceConfig, err := project.GetService(service)
+	if err != nil {
+		return err
+	}
+	command := serviceTestCommand(serviceConfig)
+
+	fmt.Fprintf(opts.out(), "Executing tests for service: %s\n", service)
+	if len(command) > 0 {
+		fmt.Fprintf(opts.out(), "Test command: %s\n", strings.Join(command, " "))
+	}
+	fmt.Fprintf(opts.out(), "Test timeout: %d seconds\n", opts.timeout)
+	fmt.Fprintf(opts.out(), "Parallel runners: %d\n", opts.parallel)
+
+	for _, condition := range opts.waitFor {
+		target, err := parseTestWaitCondition(condition, service)
+		if err != nil {
+			return err
+		}
+		if err := waitForTestCondition(ctx, backend, project.Name, target, opts.waitTimeout); err != nil {
+			return err
+		}
+	}
+
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(opts.timeout)*time.Second)
+		defer cancel()
+	}
+
+	var exitCode int
+	if testContainer != "" {
+		// the test container runs a keep-alive command, the entrypoint of the service is applied here
+		command = append(slices.Clone(serviceConfig.Entrypoint), command...)
+		if len(command) == 0 {
+			return fmt.Errorf("no test command for service %s, declare x-test.command or a command to run it with setup or teardown hooks", service)
+		}
+		exitCode, err = execTestCommand(ctx, dockerCli, testContainer, command, opts.environment, opts.out(), opts.errOut())
+	} else {
+		exitCode, err = backend.RunOneOffContainer(ctx, project, api.RunOptions{
+			Project:     project,
+			Service:     service,
+			Command:     command,
+			Environment: opts.environment,
+			AutoRemove:  true,
+		})
+	}
 	if err != nil {
 		return err
 	}
-	defer reportFile.Close()
+	if exitCode != 0 {
+		return fmt.Errorf("tests exited with code %d", exitCode)
+	}
+	return nil
+}
+
+// testMatrixAxis is a --matrix entry: the tags to test an image with
+type testMatrixAxis struct {
+	Image string
+	Tags  []string
+}
+
+// testMatrixImage is the image, and its tag, a combination of the matrix runs
+type testMatrixImage struct {
+	Image string `json:"image"`
+	Tag   string `json:"tag"`
+}
+
+// testMatrixResult is the outcome of the tests of a combination of the matrix
+type testMatrixResult struct {
+	Combination string              `json:"combination"`
+	Images      []testMatrixImage   `json:"images"`
+	Project     string              `json:"project"`
+	Error       string              `json:"error,omitempty"`
+	Results     []serviceTestResult `json:"results"`
+}
+
+// parseTestMatrix parses the --matrix IMAGE=TAG[,TAG...] entries
+func parseTestMatrix(entries []string) ([]testMatrixAxis, error) {
+	var axes []testMatrixAxis
+	for _, entry := range entries {
+		image, tags, ok := strings.Cut(entry, "=")
+		if !ok || image == "" {
+			return nil, fmt.Errorf("invalid --matrix %q, expected IMAGE=TAG[,TAG...]", entry)
+		}
+		axis := testMatrixAxis{Image: image}
+		for tag := range strings.SplitSeq(tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(axis.Tags, tag) {
+				axis.Tags = append(axis.Tags, tag)
+			}
+		}
+		if len(axis.Tags) == 0 {
+			return nil, fmt.Errorf("invalid --matrix %q, no tag given", entry)
+		}
+		if slices.ContainsFunc(axes, func(a testMatrixAxis) bool { return a.Image == image }) {
+			return nil, fmt.Errorf("image %q is given more than once to --matrix", image)
+		}
+		axes = append(axes, axis)
+	}
+	return axes, nil
+}
+
+// testMatrixCombinations returns the cartesian product of the axes, the first axis varying slowest
+func testMatrixCombinations(axes []testMatrixAxis) [][]testMatrixImage {
+	combinations := [][]testMatrixImage{nil}
+	for _, axis := range axes {
+		var next [][]testMatrixImage
+		for _, combination := range combinations {
+			for _, tag := range axis.Tags {
+				next = append(next, append(slices.Clone(combination), testMatrixImage{Image: axis.Image, Tag: tag}))
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// testMatrixLabel names a combination, e.g. "postgres:15, redis:7"
+func testMatrixLabel(combination []testMatrixImage) string {
+	images := make([]string, 0, len(combination))
+	for _, image := range combination {
+		images = append(images, image.Image+":"+image.Tag)
+	}
+	return strings.Join(images, ", ")
+}
+
+// testImageRepository returns the repository of an image, without registry when it is Docker Hub
+func testImageRepository(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return reference.FamiliarName(named)
+}
+
+// applyTestMatrix switches the services running the images of a combination to its tags, and
+// returns their names, sorted
+func applyTestMatrix(project *types.Project, combination []testMatrixImage) ([]string, error) {
+	var affected []string
+	for _, image := range combination {
+		repository := testImageRepository(image.Image)
+		matched := false
+		for name, service := range project.Services {
+			if service.Image == "" || testImageRepository(service.Image) != repository {
+				continue
+			}
+			service.Image = image.Image + ":" + image.Tag
+			project.Services[name] = service
+			affected = append(affected, name)
+			matched = true
+		}
+		if !matched {
+			return nil, fmt.Errorf("no service runs image %q given to --matrix", image.Image)
+		}
+	}
+	sort.Strings(affected)
+	return slices.Compact(affected), nil
+}
+
+// runTestMatrix runs the test suite once per combination of the matrix, up to --max-parallel at
+// once. Every combination is tested in its own project, <project>-matrix-<n>, loaded with load, so
+// they don't share containers, networks nor volumes. The services running an image of the matrix
+// are recreated with the tag of the combination before the tests, unless they are tested services,
+// which get it through their one-off test container.
+func runTestMatrix(ctx context.Context, dockerCli command.Cli, newBackend func(stdout, stderr io.Writer) (api.Compose, error), projectName string, axes []testMatrixAxis, opts *testOptions, load func(name string) (*types.Project, error)) []testMatrixResult {
+	combinations := testMatrixCombinations(axes)
+	results := make([]testMatrixResult, len(combinations))
+	// the output of combinations running in parallel is prefixed with their project
+	prefixed := opts.maxParallel > 1 && len(combinations) > 1
+	var (
+		wg        sync.WaitGroup
+		runners   = make(chan struct{}, max(opts.maxParallel, 1))
+		scheduled int
+	)
+	for i, combination := range combinations {
+		runners <- struct{}{}
+		// no combination is started once interrupted
+		if ctx.Err() != nil {
+			break
+		}
+		scheduled++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-runners }()
+			result := testMatrixResult{
+				Combination: testMatrixLabel(combination),
+				Images:      combination,
+				Project:     fmt.Sprintf("%s-matrix-%d", projectName, i+1),
+			}
+			combinationOpts := *opts
+			if prefixed {
+				stdout, stderr := newTestOutputPrefixer(opts.out(), result.Project), newTestOutputPrefixer(opts.errOut(), result.Project)
+				defer stdout.Flush()
+				defer stderr.Flush()
+				combinationOpts.stdout, combinationOpts.stderr = stdout, stderr
+			}
+			out := combinationOpts.out()
+			fmt.Fprintf(out, "\nTesting matrix combination %s in project %s\n", result.Combination, result.Project)
+			backend, err := newBackend(combinationOpts.out(), combinationOpts.errOut())
+			if err != nil {
+				result.Error = err.Error()
+				results[i] = result
+			} else {
+				results[i] = runTestMatrixCombination(ctx, dockerCli, backend, combination, &combinationOpts, load, result)
+			}
+			if results[i].Error != "" {
+				fmt.Fprintf(out, "Warning: Matrix combination %s errored: %s\n", results[i].Combination, results[i].Error)
+			}
+		}()
+	}
+	wg.Wait()
+	return results[:scheduled]
+}
+
+// testOutputPrefixer prefixes every line written with the project of a matrix combination, so the
+// output of combinations running in parallel can be told apart. It is safe for concurrent use.
+type testOutputPrefixer struct {
+	mu      sync.Mutex
+	out     io.Writer
+	project string
+	pending []byte
+}
+
+func newTestOutputPrefixer(out io.Writer, project string) *testOutputPrefixer {
+	return &testOutputPrefixer{out: out, project: project}
+}
+
+// Write writes the complete lines, the last incomplete one is kept until completed or flushed
+func (p *testOutputPrefixer) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, b...)
+	for {
+		i := bytes.IndexByte(p.pending, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if _, err := fmt.Fprintf(p.out, "%s | %s", p.project, p.pending[:i+1]); err != nil {
+			return 0, err
+		}
+		p.pending = p.pending[i+1:]
+	}
+}
+
+// Flush writes the last incomplete line
+func (p *testOutputPrefixer) Flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.pending) > 0 {
+		_, _ = fmt.Fprintf(p.out, "%s | %s\n", p.project, p.pending)
+		p.pending = nil
+	}
+}
+
+func runTestMatrixCombination(ctx context.Context, dockerCli command.Cli, backend api.Compose, combination []testMatrixImage, opts *testOptions, load func(name string) (*types.Project, error), result testMatrixResult) testMatrixResult {
+	project, err := load(result.Project)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	affected, err := applyTestMatrix(project, combination)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if opts.clean {
+		defer func() {
+			// cleaned up even when interrupted
+			ctx := context.WithoutCancel(ctx)
+			if err := cleanTestResources(ctx, dockerCli, project, opts); err != nil {
+				fmt.Fprintf(opts.out(), "Warning: Failed to clean up test resources of %s: %v\n", project.Name, err)
+			}
+			if err := backend.Down(ctx, project.Name, api.DownOptions{Project: project, RemoveOrphans: true, Volumes: true}); err != nil {
+				fmt.Fprintf(opts.out(), "Warning: Failed to remove project %s: %v\n", project.Name, err)
+			}
+		}()
+	}
+
+	dependencies := slices.DeleteFunc(slices.Clone(affected), func(service string) bool {
+		return slices.Contains(opts.services, service)
+	})
+	if len(dependencies) > 0 {
+		err := backend.Up(ctx, project, api.UpOptions{
+			Create: api.CreateOptions{Services: dependencies, Recreate: api.RecreateForce},
+			Start:  api.StartOptions{Project: project, Services: dependencies, Wait: true, WaitTimeout: opts.waitTimeout},
+		})
+		if err != nil {
+			result.Error = fmt.Sprintf("failed to start %s: %v", strings.Join(dependencies, ", "), err)
+			return result
+		}
+	}
+
+	results, err := runTestSuite(ctx, dockerCli, backend, project, opts)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Results = results
+	return result
+}
+
+// printTestMatrix prints the status of every selected service for every combination of the matrix
+func printTestMatrix(w io.Writer, services []string, results []testMatrixResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	header := []string{"SERVICE"}
+	for _, result := range results {
+		header = append(header, result.Combination)
+	}
+	_, _ = fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, service := range services {
+		row := []string{service}
+		for _, result := range results {
+			status := "skipped"
+			if result.Error != "" && len(result.Results) == 0 {
+				status = testStatusErrored
+			}
+			for _, r := range result.Results {
+				if r.Service == service {
+					status = r.Status
+					if r.Flaky {
+						status = "flaky"
+					}
+				}
+			}
+			row = append(row, status)
+		}
+		_, _ = fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	_ = tw.Flush()
+}
+
+// countTestMatrixFailures counts the combinations with failed or errored tests
+func countTestMatrixFailures(results []testMatrixResult) int {
+	failures := 0
+	for _, result := range results {
+		_, failed, errored := countTestResults(result.Results)
+		if result.Error != "" || failed+errored > 0 {
+			failures++
+		}
+	}
+	return failures
+}
+
+// testWaitPollInterval is how often --wait-for conditions are checked
+var testWaitPollInterval = time.Second
+
+// testWaitCondition is a parsed --wait-for condition
+type testWaitCondition struct {
+	// Kind is one of healthy, tcp, http
+	Kind string
+	// Target is the service for healthy, the address for tcp and the URL for http
+	Target string
+}
+
+func (c testWaitCondition) String() string {
+	if c.Kind == "http" {
+		return c.Target
+	}
+	return c.Kind + " " + c.Target
+}
+
+// parseTestWaitCondition parses a --wait-for condition, a bare healthy applying to service
+func parseTestWaitCondition(condition, service string) (testWaitCondition, error) {
+	switch {
+	case condition == "healthy":
+		return testWaitCondition{Kind: "healthy", Target: service}, nil
+	case strings.HasPrefix(condition, "healthy:"):
+		return testWaitCondition{Kind: "healthy", Target: strings.TrimPrefix(condition, "healthy:")}, nil
+	case strings.HasPrefix(condition, "tcp://"):
+		address := strings.TrimPrefix(condition, "tcp://")
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return testWaitCondition{}, fmt.Errorf("invalid --wait-for %q: %v", condition, err)
+		}
+		return testWaitCondition{Kind: "tcp", Target: address}, nil
+	case strings.HasPrefix(condition, "http://") || strings.HasPrefix(condition, "https://"):
+		if _, err := url.Parse(condition); err != nil {
+			return testWaitCondition{}, fmt.Errorf("invalid --wait-for %q: %v", condition, err)
+		}
+		return testWaitCondition{Kind: "http", Target: condition}, nil
+	}
+	return testWaitCondition{}, fmt.Errorf("invalid --wait-for %q, must be healthy, healthy:SERVICE, tcp://HOST:PORT or an http(s) URL", condition)
+}
+
+// waitForTestCondition polls the condition until it holds, or fails once timeout elapsed
+func waitForTestCondition(ctx context.Context, backend api.Compose, projectName string, condition testWaitCondition, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := checkTestWaitCondition(ctx, backend, projectName, condition)
+		if err == nil {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("dependency never became ready: %s not ready after %s: %v", condition, timeout, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(testWaitPollInterval):
+		}
+	}
+}
+
+// checkTestWaitCondition checks the condition once, telling why it doesn't hold
+func checkTestWaitCondition(ctx context.Context, backend api.Compose, projectName string, condition testWaitCondition) error {
+	switch condition.Kind {
+	case "healthy":
+		containers, err := backend.Ps(ctx, projectName, api.PsOptions{Services: []string{condition.Target}})
+		if err != nil {
+			return err
+		}
+		states := serviceHealthStates(containers, "")
+		switch state := states[condition.Target]; state {
+		case healthStateHealthy:
+			return nil
+		case "":
+			return fmt.Errorf("no running container")
+		default:
+			return fmt.Errorf("%s", state)
+		}
+	case "tcp":
+		dialer := net.Dialer{Timeout: testWaitPollInterval}
+		conn, err := dialer.DialContext(ctx, "tcp", condition.Target)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	default:
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, condition.Target, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
 
-	// Write simple report content
+// serviceTestCommand returns the command running the tests of a service: the x-test.command
+// extension when set, otherwise the service's own command
+func serviceTestCommand(service types.ServiceConfig) []string {
+	if command := xTestCommand(service, "command"); len(command) > 0 {
+		return command
+	}
+	return service.Command
+}
+
+// xTestCommand reads a command from the x-test extension of a service, either as a shell
+// string or as a list of arguments
+func xTestCommand(service types.ServiceConfig, key string) []string {
+	xtest, ok := service.Extensions["x-test"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	return parseTestCommand(xtest[key])
+}
+
+// parseTestCommand converts an x-test command, a shell string or a list of arguments
+func parseTestCommand(value any) []string {
+	switch command := value.(type) {
+	case string:
+		return []string{"/bin/sh", "-c", command}
+	case []any:
+		args := make([]string, 0, len(command))
+		for _, arg := range command {
+			args = append(args, fmt.Sprint(arg))
+		}
+		return args
+	default:
+		return nil
+	}
+}
+
+// parseTestEnvironment validates --env entries. KEY=VALUE entries are used as-is while a bare KEY
+// passes the host value through, and is skipped when unset on the host like `docker run -e` does.
+func parseTestEnvironment(entries []string, lookupEnv func(string) (string, bool)) ([]string, error) {
+	environment := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		key, value, hasValue := strings.Cut(entry, "=")
+		if key == "" || strings.ContainsAny(key, " \t\n") {
+			return nil, fmt.Errorf("invalid environment variable %q: expected KEY=VALUE or KEY", entry)
+		}
+		if !hasValue {
+			hostValue, ok := lookupEnv(key)
+			if !ok {
+				continue
+			}
+			value = hostValue
+		}
+		environment = append(environment, key+"="+value)
+	}
+	return environment, nil
+}
+
+func generateTestReport(ctx context.Context, opts *testOptions, run testRun) error {
+	reportPath := filepath.Join(opts.report, fmt.Sprintf("test-results.%s", opts.format))
+	fmt.Printf("Generating test report to: %s\n", reportPath)
+
+	var content []byte
+	var err error
 	switch opts.format {
 	case "junit":
-		_, err = reportFile.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
-<testsuites>
-	<testsuite name="docker-compose" tests="1" failures="0" errors="0" time="1.0">
-		<testcase name="test-service" classname="service" time="1.0"></testcase>
-	</testsuite>
-</testsuites>`)
+		content, err = junitTestReport(run)
 	case "json":
-		_, err = reportFile.WriteString(`{
-	"results": {
-		"passed": 1,
-		"failed": 0,
-		"errors": 0,
-		"time": 1.0
-	}
-}`)
+		content, err = jsonTestReport(run)
 	case "html":
-		_, err = reportFile.WriteString(`<html>
-<body>
-<h1>Test Results</h1>
-<p>Passed: 1</p>
-<p>Failed: 0</p>
-<p>Errors: 0</p>
-<p>Time: 1.0s</p>
-</body>
-</html>`)
+		content = htmlTestReport(run)
 	default:
 		return fmt.Errorf("unsupported report format: %s", opts.format)
 	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(reportPath, content, 0o644)
+}
 
-	return err
+func countTestResults(results []serviceTestResult) (passed, failed, errored int) {
+	for _, result := range results {
+		switch result.Status {
+		case testStatusPassed:
+			passed++
+		case testStatusFailed:
+			failed++
+		default:
+			errored++
+		}
+	}
+	return passed, failed, errored
+}
+
+// countFlakyTests counts the services whose tests passed on a retry
+func countFlakyTests(results []serviceTestResult) int {
+	flaky := 0
+	for _, result := range results {
+		if result.Status == testStatusPassed && result.Flaky {
+			flaky++
+		}
+	}
+	return flaky
+}
+
+// testReportSchemaVersion is the version of the JSON report schema, increased on incompatible changes
+const testReportSchemaVersion = 1
+
+// jsonReport is the JSON test report, its shape is versioned by SchemaVersion
+type jsonReport struct {
+	SchemaVersion int                 `json:"schema_version"`
+	Project       string              `json:"project"`
+	Timestamp     time.Time           `json:"timestamp"`
+	DurationMs    int64               `json:"duration_ms"`
+	Summary       jsonReportSummary   `json:"summary"`
+	Services      []jsonReportService `json:"services"`
+}
+
+type jsonReportSummary struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Errored int `json:"errored"`
+	Flaky   int `json:"flaky"`
+}
+
+type jsonReportService struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Attempts   int    `json:"attempts"`
+	Flaky      bool   `json:"flaky"`
+	Error      string `json:"error,omitempty"`
+	// Output is the captured setup and teardown output, tests output is streamed to the console
+	Output string `json:"output,omitempty"`
+}
+
+func jsonTestReport(run testRun) ([]byte, error) {
+	passed, failed, errored := countTestResults(run.Results)
+	report := jsonReport{
+		SchemaVersion: testReportSchemaVersion,
+		Project:       run.Project,
+		Timestamp:     run.Started.UTC(),
+		DurationMs:    run.Duration.Milliseconds(),
+		Summary: jsonReportSummary{
+			Total:   len(run.Results),
+			Passed:  passed,
+			Failed:  failed,
+			Errored: errored,
+			Flaky:   countFlakyTests(run.Results),
+		},
+		Services: []jsonReportService{},
+	}
+	for _, result := range run.Results {
+		report.Services = append(report.Services, jsonReportService{
+			Name:       result.Service,
+			Status:     result.Status,
+			DurationMs: result.Duration.Milliseconds(),
+			Attempts:   result.Attempts,
+			Flaky:      result.Flaky,
+			Error:      result.Error,
+			Output:     testHooksOutput(result),
+		})
+	}
+	return json.MarshalIndent(report, "", "\t")
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitOutput struct {
+	Content string `xml:",cdata"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+func junitTestReport(run testRun) ([]byte, error) {
+	_, failed, errored := countTestResults(run.Results)
+	suite := junitTestSuite{
+		Name:      run.Project,
+		Tests:     len(run.Results),
+		Failures:  failed,
+		Errors:    errored,
+		Time:      junitTime(run.Duration),
+		Timestamp: run.Started.UTC().Format("2006-01-02T15:04:05"),
+	}
+	for _, result := range run.Results {
+		testCase := junitTestCase{
+			Name:      result.Service,
+			ClassName: "service",
+			Time:      junitTime(result.Duration),
+		}
+		output := testHooksOutput(result)
+		if result.Flaky {
+			output = fmt.Sprintf("flaky: passed after %d attempts\n", result.Attempts) + output
+		}
+		if output != "" {
+			testCase.SystemOut = &junitOutput{Content: output}
+		}
+		switch result.Status {
+		case testStatusFailed:
+			testCase.Failure = &junitMessage{Message: result.Error}
+		case testStatusErrored:
+			testCase.Error = &junitMessage{Message: result.Error}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	content, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), content...), nil
+}
+
+// junitTime renders a duration in seconds, as expected by the time attributes of JUnit reports
+func junitTime(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+func htmlTestReport(run testRun) []byte {
+	passed, failed, errored := countTestResults(run.Results)
+	var b strings.Builder
+	b.WriteString("<html>\n<body>\n")
+	fmt.Fprintf(&b, "<h1>Test Results: %s</h1>\n", html.EscapeString(run.Project))
+	fmt.Fprintf(&b, "<p>Started: %s</p>\n<p>Duration: %s</p>\n", run.Started.UTC().Format(time.RFC3339), run.Duration.Round(time.Millisecond))
+	fmt.Fprintf(&b, "<p>Passed: %d</p>\n<p>Failed: %d</p>\n<p>Errors: %d</p>\n<p>Flaky: %d</p>\n", passed, failed, errored, countFlakyTests(run.Results))
+	b.WriteString("<table>\n<tr><th>Service</th><th>Status</th><th>Duration</th><th>Details</th></tr>\n")
+	for _, result := range run.Results {
+		status := result.Status
+		if result.Flaky {
+			status = fmt.Sprintf("flaky (%d attempts)", result.Attempts)
+		}
+		fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td><td>%s</td><td><pre>%s</pre></td></tr>\n",
+			html.EscapeString(result.Service), status, result.Duration.Round(time.Millisecond),
+			html.EscapeString(strings.TrimSpace(result.Error+"\n"+testHooksOutput(result))))
+	}
+	b.WriteString("</table>\n</body>\n</html>\n")
+	return []byte(b.String())
+}
+
+// testHooksOutput renders the captured setup and teardown output of a service
+func testHooksOutput(result serviceTestResult) string {
+	var b strings.Builder
+	if result.SetupOutput != "" {
+		b.WriteString("--- setup ---\n" + result.SetupOutput)
+	}
+	if result.TeardownOutput != "" {
+		b.WriteString("--- teardown ---\n" + result.TeardownOutput)
+	}
+	return b.String()
 }
 
 func generateCoverageReport(ctx context.Context, project *types.Project, opts *testOptions) error {
@@ -265,10 +1480,143 @@ func generateCoverageReport(ctx context.Context, project *types.Project, opts *t
 	return err
 }
 
-func cleanTestResources(ctx context.Context, backend api.Compose, project *types.Project, opts *testOptions) error {
-	// Simplified implementation - in real code, this would clean up actual resources
-	fmt.Println("Cleaning up test containers and volumes")
+const (
+	testIsolationNone    = "none"
+	testIsolationNetwork = "network"
+)
+
+// testSuiteLabel marks the networks created by --service-isolation network with the tested service
+const testSuiteLabel = "com.docker.compose.test.suite"
+
+// testIsolationMu serializes bringing up the dependencies of the suites run in parallel
+var testIsolationMu sync.Mutex
+
+// testNetworkName is the name of the network isolating the tests of a service
+func testNetworkName(projectName, service string) string {
+	return fmt.Sprintf("%s_test-%s", projectName, service)
+}
+
+// isolateTestSuite creates the network of the tests of a service, connects the running
+// dependencies of the service to it, and returns the project running the tests in it
+func isolateTestSuite(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, service types.ServiceConfig, opts *testOptions) (*types.Project, error) {
+	name := testNetworkName(project.Name, service.Name)
+	_, err := dockerCli.Client().NetworkCreate(ctx, name, network.CreateOptions{
+		Labels: map[string]string{
+			api.ProjectLabel: project.Name,
+			testSuiteLabel:   service.Name,
+		},
+	})
+	// left over by a run with --clean=false
+	if err != nil && !errdefs.IsConflict(err) {
+		return nil, fmt.Errorf("failed to create network %s: %v", name, err)
+	}
+	if opts.verbose {
+		fmt.Fprintf(opts.out(), "Tests of service %s run in network %s\n", service.Name, name)
+	}
+
+	if dependencies := service.GetDependencies(); len(dependencies) > 0 {
+		if err := connectTestDependencies(ctx, dockerCli, backend, project, dependencies, name); err != nil {
+			return nil, err
+		}
+	}
+	return isolatedTestProject(project, service.Name, name)
+}
 
-	// For demo purposes, just return success
+// connectTestDependencies brings the dependencies up, without recreating them, and connects
+// their containers to the network of the suite under their service name
+func connectTestDependencies(ctx context.Context, dockerCli command.Cli, backend api.Compose, project *types.Project, dependencies []string, networkName string) error {
+	testIsolationMu.Lock()
+	defer testIsolationMu.Unlock()
+	err := backend.Up(ctx, project, api.UpOptions{
+		Create: api.CreateOptions{
+			Services:             dependencies,
+			Recreate:             api.RecreateNever,
+			RecreateDependencies: api.RecreateNever,
+		},
+		Start: api.StartOptions{Project: project, Services: dependencies},
+	})
+	if err != nil {
+		return err
+	}
+	containers, err := backend.Ps(ctx, project.Name, api.PsOptions{Services: dependencies})
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		err := dockerCli.Client().NetworkConnect(ctx, networkName, c.ID, &network.EndpointSettings{Aliases: []string{c.Service}})
+		// already connected by a previous attempt
+		if err != nil && !errdefs.IsPermissionDenied(err) && !errdefs.IsConflict(err) {
+			return fmt.Errorf("failed to connect %s to network %s: %v", c.Name, networkName, err)
+		}
+	}
 	return nil
 }
+
+// isolatedTestProject returns a copy of the project where the service only joins the external
+// network of its suite, and publishes its ports on ephemeral host ports
+func isolatedTestProject(project *types.Project, service, networkName string) (*types.Project, error) {
+	key := "test-" + service
+	isolated, err := project.WithServicesTransform(func(name string, s types.ServiceConfig) (types.ServiceConfig, error) {
+		if name != service {
+			return s, nil
+		}
+		s.NetworkMode = ""
+		s.Networks = map[string]*types.ServiceNetworkConfig{key: nil}
+		ports := make([]types.ServicePortConfig, 0, len(s.Ports))
+		for _, port := range s.Ports {
+			port.Published = ""
+			ports = append(ports, port)
+		}
+		s.Ports = ports
+		return s, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if isolated.Networks == nil {
+		isolated.Networks = types.Networks{}
+	}
+	isolated.Networks[key] = types.NetworkConfig{Name: networkName, External: true}
+	return isolated, nil
+}
+
+// cleanTestResources removes the networks created for the test suites of the project, after
+// disconnecting the dependencies joined to them
+func cleanTestResources(ctx context.Context, dockerCli command.Cli, project *types.Project, opts *testOptions) error {
+	apiClient := dockerCli.Client()
+	networks, err := apiClient.NetworkList(ctx, network.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", fmt.Sprintf("%s=%s", api.ProjectLabel, project.Name)),
+			filters.Arg("label", testSuiteLabel),
+		),
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, n := range networks {
+		// containers are only reported when inspecting a network
+		inspect, err := apiClient.NetworkInspect(ctx, n.ID, network.InspectOptions{})
+		if errdefs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for id := range inspect.Containers {
+			if err := apiClient.NetworkDisconnect(ctx, n.ID, id, true); err != nil && !errdefs.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("failed to disconnect %s from network %s: %w", id, n.Name, err))
+			}
+		}
+		if err := apiClient.NetworkRemove(ctx, n.ID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove network %s: %w", n.Name, err))
+			continue
+		}
+		if opts.verbose {
+			fmt.Fprintf(opts.out(), "Removed network %s\n", n.Name)
+		}
+	}
+	return errors.Join(errs...)
+}
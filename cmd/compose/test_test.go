@@ -0,0 +1,544 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compose
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/cli/cli/streams"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestParseTestEnvironment(t *testing.T) {
+	lookup := func(key string) (string, bool) {
+		if key == "DATABASE_URL" {
+			return "postgres://db", true
+		}
+		return "", false
+	}
+
+	env, err := parseTestEnvironment([]string{"FEATURE=on", "DATABASE_URL", "UNSET", "EMPTY="}, lookup)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"FEATURE=on", "DATABASE_URL=postgres://db", "EMPTY="}, env)
+
+	_, err = parseTestEnvironment([]string{"=value"}, lookup)
+	assert.ErrorContains(t, err, `invalid environment variable "=value"`)
+
+	_, err = parseTestEnvironment([]string{"MY KEY=value"}, lookup)
+	assert.ErrorContains(t, err, "expected KEY=VALUE or KEY")
+}
+
+func TestServiceTestHook(t *testing.T) {
+	service := types.ServiceConfig{
+		Name: "api",
+		Extensions: types.Extensions{
+			"x-test": map[string]any{
+				"setup":    "./migrate.sh",
+				"teardown": []any{"rm", "-rf", "/tmp/fixtures"},
+			},
+		},
+	}
+
+	assert.Equal(t, []string{"/bin/sh", "-c", "./migrate.sh"}, serviceTestHook(service, "setup", ""))
+	assert.Equal(t, []string{"/bin/sh", "-c", "make seed"}, serviceTestHook(service, "setup", "make seed"))
+	assert.Equal(t, []string{"rm", "-rf", "/tmp/fixtures"}, serviceTestHook(service, "teardown", ""))
+	assert.Empty(t, serviceTestHook(types.ServiceConfig{Name: "web"}, "setup", ""))
+}
+
+func TestJunitTestReport(t *testing.T) {
+	content, err := junitTestReport(testRun{
+		Project:  "demo",
+		Started:  time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Duration: 3 * time.Second,
+		Results: []serviceTestResult{
+			{Service: "api", Status: testStatusPassed, SetupOutput: "migrated\n", Duration: 1500 * time.Millisecond},
+			{Service: "web", Status: testStatusErrored, Error: "setup failed: boom"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `<testsuite name="demo" tests="2" failures="0" errors="1" time="3.000" timestamp="2024-05-01T10:00:00">`)
+	assert.Contains(t, string(content), `<testcase name="api" classname="service" time="1.500">`)
+	assert.Contains(t, string(content), `<error message="setup failed: boom"></error>`)
+	assert.Contains(t, string(content), "--- setup ---\nmigrated")
+}
+
+func TestJSONTestReport(t *testing.T) {
+	content, err := jsonTestReport(testRun{
+		Project:  "demo",
+		Started:  time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Duration: 3 * time.Second,
+		Results: []serviceTestResult{
+			{Service: "api", Status: testStatusPassed, Attempts: 2, Flaky: true, Duration: 1500 * time.Millisecond},
+			{Service: "web", Status: testStatusFailed, Attempts: 1, Error: "tests exited with code 1", TeardownOutput: "cleaned\n"},
+		},
+	})
+	require.NoError(t, err)
+	var report map[string]any
+	require.NoError(t, json.Unmarshal(content, &report))
+	assert.Equal(t, map[string]any{
+		"schema_version": float64(1),
+		"project":        "demo",
+		"timestamp":      "2024-05-01T10:00:00Z",
+		"duration_ms":    float64(3000),
+		"summary": map[string]any{
+			"total": float64(2), "passed": float64(1), "failed": float64(1), "errored": float64(0), "flaky": float64(1),
+		},
+		"services": []any{
+			map[string]any{"name": "api", "status": "passed", "duration_ms": float64(1500), "attempts": float64(2), "flaky": true},
+			map[string]any{
+				"name": "web", "status": "failed", "duration_ms": float64(0), "attempts": float64(1), "flaky": false,
+				"error": "tests exited with code 1", "output": "--- teardown ---\ncleaned\n",
+			},
+		},
+	}, report)
+
+	content, err = jsonTestReport(testRun{Project: "demo"})
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"services": []`)
+}
+
+func TestPrintTestSummary(t *testing.T) {
+	var buf bytes.Buffer
+	printTestSummary(&buf, []string{"api", "web", "worker"}, []serviceTestResult{
+		{Service: "api", Status: testStatusPassed},
+		{Service: "web", Status: testStatusFailed, Error: "exit code 1"},
+	})
+	assert.Equal(t, `SERVICE              STATUS     ERROR
+api                  passed
+web                  failed     exit code 1
+worker               skipped
+`, buf.String())
+}
+
+func TestDiscoverTestServices(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services{
+			"api": {Name: "api", Extensions: map[string]any{"x-test": map[string]any{"command": "go test ./..."}}},
+			"web": {Name: "web"},
+		},
+		DisabledServices: types.Services{
+			"e2e":   {Name: "e2e", Profiles: []string{"test"}},
+			"debug": {Name: "debug", Profiles: []string{"debug"}},
+		},
+	}
+	assert.Equal(t, []string{"api", "e2e"}, discoverTestServices(project))
+}
+
+func TestGlobalTestHooks(t *testing.T) {
+	dir := t.TempDir()
+	project := &types.Project{Name: "shop", WorkingDir: dir, Extensions: types.Extensions{
+		"x-test": map[string]any{
+			"setup":    "echo $COMPOSE_PROJECT_NAME > setup.log",
+			"teardown": []any{"/bin/sh", "-c", "echo done > teardown.log"},
+		},
+	}}
+	assert.Equal(t, []string{"/bin/sh", "-c", "seed"}, projectTestHook(project, "setup", "seed"))
+	assert.Nil(t, projectTestHook(&types.Project{}, "setup", ""))
+
+	ctrl := gomock.NewController(t)
+	cli := mocks.NewMockCli(ctrl)
+	cli.EXPECT().Out().Return(streams.NewOut(io.Discard)).AnyTimes()
+	cli.EXPECT().Err().Return(streams.NewOut(io.Discard)).AnyTimes()
+
+	results, err := runTestSuite(context.Background(), cli, nil, project, &testOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	setupLog, err := os.ReadFile(filepath.Join(dir, "setup.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "shop\n", string(setupLog))
+	assert.FileExists(t, filepath.Join(dir, "teardown.log"))
+
+	// a failing setup aborts the run, the teardown still runs
+	require.NoError(t, os.Remove(filepath.Join(dir, "teardown.log")))
+	_, err = runTestSuite(context.Background(), cli, nil, project, &testOptions{setupCommand: "exit 3", services: []string{"web"}})
+	assert.ErrorContains(t, err, "global setup failed")
+	assert.FileExists(t, filepath.Join(dir, "teardown.log"))
+
+	// the teardown still runs once the tests are interrupted
+	require.NoError(t, os.Remove(filepath.Join(dir, "teardown.log")))
+	interrupted, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = runTestSuite(interrupted, cli, nil, project, &testOptions{services: []string{"web"}})
+	assert.ErrorContains(t, err, "global setup failed")
+	assert.FileExists(t, filepath.Join(dir, "teardown.log"))
+
+	// a failing teardown is only reported
+	_, err = runTestSuite(context.Background(), cli, nil, project, &testOptions{teardownCommand: "exit 1"})
+	require.NoError(t, err)
+}
+
+func TestRunServiceTestsWithRetries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	project := &types.Project{Name: "shop", Services: types.Services{"web": {Name: "web"}}}
+	gomock.InOrder(
+		backend.EXPECT().RunOneOffContainer(gomock.Any(), project, gomock.Any()).Return(1, nil),
+		backend.EXPECT().RunOneOffContainer(gomock.Any(), project, gomock.Any()).Return(0, nil),
+	)
+
+	result := serviceTestResult{Service: "web", Status: testStatusPassed}
+	require.NoError(t, runServiceTestsWithRetries(context.Background(), nil, backend, project, "web", "", &testOptions{retries: 2}, &result))
+	assert.Equal(t, 2, result.Attempts)
+	assert.True(t, result.Flaky)
+	assert.Equal(t, 1, countFlakyTests([]serviceTestResult{result, {Status: testStatusFailed, Attempts: 3}}))
+
+	backend.EXPECT().RunOneOffContainer(gomock.Any(), project, gomock.Any()).Return(1, nil).Times(2)
+	result = serviceTestResult{Service: "web", Status: testStatusPassed}
+	err := runServiceTestsWithRetries(context.Background(), nil, backend, project, "web", "", &testOptions{retries: 1}, &result)
+	assert.ErrorContains(t, err, "tests exited with code 1")
+	assert.Equal(t, 2, result.Attempts)
+	assert.False(t, result.Flaky)
+
+	var buf bytes.Buffer
+	printTestSummary(&buf, []string{"web"}, []serviceTestResult{{Service: "web", Status: testStatusPassed, Attempts: 2, Flaky: true}})
+	assert.Equal(t, "SERVICE              STATUS     ERROR\nweb                  flaky\n\n1 service(s) passed after a retry\n", buf.String())
+}
+
+func TestServiceTestHooksShareTheTestContainer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	cli := mocks.NewMockCli(ctrl)
+	apiClient := mocks.NewMockAPIClient(ctrl)
+	backend := mocks.NewMockCompose(ctrl)
+	cli.EXPECT().Client().Return(apiClient).AnyTimes()
+	cli.EXPECT().Out().Return(streams.NewOut(io.Discard)).AnyTimes()
+	cli.EXPECT().Err().Return(streams.NewOut(io.Discard)).AnyTimes()
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"web": {Name: "web", Extensions: types.Extensions{"x-test": map[string]any{
+			"command":  "test -f /tmp/seeded",
+			"setup":    "touch /tmp/seeded",
+			"teardown": "rm /tmp/seeded",
+		}}},
+	}}
+
+	var testContainer string
+	backend.EXPECT().RunOneOffContainer(gomock.Any(), project, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *types.Project, opts api.RunOptions) (int, error) {
+			assert.True(t, opts.Detach)
+			assert.Equal(t, testContainerCommand, opts.Entrypoint)
+			testContainer = opts.Name
+			return 0, nil
+		})
+	var executed []string
+	apiClient.EXPECT().ContainerExecCreate(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, containerID string, opts container.ExecOptions) (container.ExecCreateResponse, error) {
+			assert.Equal(t, testContainer, containerID, "every command runs in the test container")
+			executed = append(executed, opts.Cmd[2])
+			return container.ExecCreateResponse{ID: opts.Cmd[2]}, nil
+		}).Times(3)
+	hookOutput := map[string]string{"touch /tmp/seeded": "seeded\n", "rm /tmp/seeded": "cleaned\n"}
+	apiClient.EXPECT().ContainerExecAttach(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, execID string, _ container.ExecAttachOptions) (dockertypes.HijackedResponse, error) {
+			var output bytes.Buffer
+			_, _ = stdcopy.NewStdWriter(&output, stdcopy.Stdout).Write([]byte(hookOutput[execID]))
+			conn, _ := net.Pipe()
+			return dockertypes.HijackedResponse{Conn: conn, Reader: bufio.NewReader(&output)}, nil
+		}).Times(3)
+	apiClient.EXPECT().ContainerExecInspect(gomock.Any(), gomock.Any()).Return(container.ExecInspect{ExitCode: 0}, nil).Times(3)
+	apiClient.EXPECT().ContainerRemove(gomock.Any(), gomock.Any(), container.RemoveOptions{Force: true}).DoAndReturn(
+		func(_ context.Context, containerID string, _ container.RemoveOptions) error {
+			assert.Equal(t, testContainer, containerID)
+			return nil
+		})
+
+	result := runServiceTestLifecycle(context.Background(), cli, backend, project, "web", &testOptions{})
+	assert.Equal(t, testStatusPassed, result.Status, result.Error)
+	assert.Equal(t, []string{"touch /tmp/seeded", "test -f /tmp/seeded", "rm /tmp/seeded"}, executed)
+	assert.Equal(t, "seeded\n", result.SetupOutput)
+	assert.Equal(t, "cleaned\n", result.TeardownOutput)
+}
+
+func TestIsolatedTestProject(t *testing.T) {
+	project := &types.Project{
+		Name: "shop",
+		Networks: types.Networks{
+			"default": {Name: "shop_default"},
+		},
+		Services: types.Services{
+			"web": {
+				Name:      "web",
+				Networks:  map[string]*types.ServiceNetworkConfig{"default": nil},
+				Ports:     []types.ServicePortConfig{{Target: 80, Published: "8080"}},
+				DependsOn: types.DependsOnConfig{"db": {Condition: types.ServiceConditionStarted}},
+			},
+			"db": {Name: "db", Networks: map[string]*types.ServiceNetworkConfig{"default": nil}},
+		},
+	}
+
+	isolated, err := isolatedTestProject(project, "web", testNetworkName("shop", "web"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*types.ServiceNetworkConfig{"test-web": nil}, isolated.Services["web"].Networks)
+	assert.Equal(t, []types.ServicePortConfig{{Target: 80}}, isolated.Services["web"].Ports)
+	assert.Equal(t, types.NetworkConfig{Name: "shop_test-web", External: true}, isolated.Networks["test-web"])
+	assert.Equal(t, project.Services["db"], isolated.Services["db"])
+
+	// the project itself is left untouched
+	assert.Equal(t, "8080", project.Services["web"].Ports[0].Published)
+	assert.NotContains(t, project.Networks, "test-web")
+}
+
+func TestRunTestSuiteInParallel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"api": {Name: "api"},
+		"web": {Name: "web"},
+		"e2e": {Name: "e2e"},
+	}}
+	exitCodes := map[string]int{"api": 0, "web": 1, "e2e": 0}
+	backend.EXPECT().RunOneOffContainer(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *types.Project, opts api.RunOptions) (int, error) {
+			return exitCodes[opts.Service], nil
+		}).Times(3)
+
+	results, err := runTestSuite(context.Background(), nil, backend, project, &testOptions{
+		services:  []string{"api", "web", "e2e"},
+		parallel:  2,
+		keepGoing: true,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	// results follow the order of the services, whatever the order they completed in
+	assert.Equal(t, "api", results[0].Service)
+	assert.Equal(t, testStatusPassed, results[0].Status)
+	assert.Equal(t, "web", results[1].Service)
+	assert.Equal(t, testStatusFailed, results[1].Status)
+	assert.Equal(t, "e2e", results[2].Service)
+
+	// a single runner stops at the first failure without --keep-going
+	backend.EXPECT().RunOneOffContainer(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *types.Project, opts api.RunOptions) (int, error) {
+			return exitCodes[opts.Service], nil
+		}).Times(2)
+	results, err = runTestSuite(context.Background(), nil, backend, project, &testOptions{
+		services: []string{"api", "web", "e2e"},
+		parallel: 1,
+	})
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+}
+
+func TestTestSuiteNetworkIsolation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	cli := mocks.NewMockCli(ctrl)
+	apiClient := mocks.NewMockAPIClient(ctrl)
+	backend := mocks.NewMockCompose(ctrl)
+	cli.EXPECT().Client().Return(apiClient).AnyTimes()
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"web": {Name: "web", DependsOn: types.DependsOnConfig{"db": {Condition: types.ServiceConditionStarted}}},
+		"db":  {Name: "db"},
+	}}
+
+	apiClient.EXPECT().NetworkCreate(gomock.Any(), "shop_test-web", gomock.Cond(func(o network.CreateOptions) bool {
+		return o.Labels[api.ProjectLabel] == "shop" && o.Labels[testSuiteLabel] == "web"
+	})).Return(network.CreateResponse{ID: "n1"}, nil)
+	backend.EXPECT().Up(gomock.Any(), project, gomock.Cond(func(o api.UpOptions) bool {
+		return slices.Equal(o.Create.Services, []string{"db"}) && o.Create.Recreate == api.RecreateNever
+	})).Return(nil)
+	backend.EXPECT().Ps(gomock.Any(), "shop", gomock.Any()).Return([]api.ContainerSummary{{ID: "c1", Name: "shop-db-1", Service: "db"}}, nil)
+	apiClient.EXPECT().NetworkConnect(gomock.Any(), "shop_test-web", "c1", &network.EndpointSettings{Aliases: []string{"db"}}).Return(nil)
+	backend.EXPECT().RunOneOffContainer(gomock.Any(), gomock.Cond(func(p *types.Project) bool {
+		_, ok := p.Services["web"].Networks["test-web"]
+		return ok
+	}), gomock.Any()).Return(0, nil)
+
+	opts := &testOptions{serviceIsolation: testIsolationNetwork}
+	result := runServiceTestLifecycle(context.Background(), cli, backend, project, "web", opts)
+	assert.Equal(t, testStatusPassed, result.Status, result.Error)
+
+	apiClient.EXPECT().NetworkList(gomock.Any(), gomock.Any()).Return([]network.Summary{{ID: "n1", Name: "shop_test-web"}}, nil)
+	apiClient.EXPECT().NetworkInspect(gomock.Any(), "n1", gomock.Any()).Return(network.Inspect{
+		ID:         "n1",
+		Containers: map[string]network.EndpointResource{"c1": {}},
+	}, nil)
+	apiClient.EXPECT().NetworkDisconnect(gomock.Any(), "n1", "c1", true).Return(nil)
+	apiClient.EXPECT().NetworkRemove(gomock.Any(), "n1").Return(nil)
+	require.NoError(t, cleanTestResources(context.Background(), cli, project, opts))
+}
+
+func TestParseTestWaitCondition(t *testing.T) {
+	condition, err := parseTestWaitCondition("healthy", "web")
+	require.NoError(t, err)
+	assert.Equal(t, testWaitCondition{Kind: "healthy", Target: "web"}, condition)
+	condition, err = parseTestWaitCondition("healthy:db", "web")
+	require.NoError(t, err)
+	assert.Equal(t, testWaitCondition{Kind: "healthy", Target: "db"}, condition)
+	condition, err = parseTestWaitCondition("tcp://localhost:5432", "web")
+	require.NoError(t, err)
+	assert.Equal(t, testWaitCondition{Kind: "tcp", Target: "localhost:5432"}, condition)
+	condition, err = parseTestWaitCondition("http://localhost:8080/health", "web")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/health", condition.String())
+
+	_, err = parseTestWaitCondition("tcp://localhost", "web")
+	assert.ErrorContains(t, err, `invalid --wait-for "tcp://localhost"`)
+	_, err = parseTestWaitCondition("ready", "web")
+	assert.ErrorContains(t, err, `invalid --wait-for "ready", must be`)
+}
+
+func TestWaitForTestCondition(t *testing.T) {
+	defer func(interval time.Duration) { testWaitPollInterval = interval }(testWaitPollInterval)
+	testWaitPollInterval = 10 * time.Millisecond
+	ctx := context.Background()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close() //nolint:errcheck
+	require.NoError(t, waitForTestCondition(ctx, nil, "shop", testWaitCondition{Kind: "tcp", Target: listener.Addr().String()}, time.Second))
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	require.NoError(t, waitForTestCondition(ctx, nil, "shop", testWaitCondition{Kind: "http", Target: server.URL}, time.Second))
+	assert.Equal(t, 3, calls)
+
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	backend.EXPECT().Ps(gomock.Any(), "shop", gomock.Any()).Return([]api.ContainerSummary{
+		{Service: "db", State: "running", Health: "starting"},
+	}, nil).AnyTimes()
+	err = waitForTestCondition(ctx, backend, "shop", testWaitCondition{Kind: "healthy", Target: "db"}, 30*time.Millisecond)
+	assert.EqualError(t, err, "dependency never became ready: healthy db not ready after 30ms: starting")
+}
+
+func TestParseTestMatrix(t *testing.T) {
+	axes, err := parseTestMatrix([]string{"postgres=14, 15,14", "redis=7"})
+	require.NoError(t, err)
+	assert.Equal(t, []testMatrixAxis{{Image: "postgres", Tags: []string{"14", "15"}}, {Image: "redis", Tags: []string{"7"}}}, axes)
+
+	_, err = parseTestMatrix([]string{"postgres"})
+	assert.ErrorContains(t, err, "expected IMAGE=TAG")
+	_, err = parseTestMatrix([]string{"postgres=,"})
+	assert.ErrorContains(t, err, "no tag given")
+	_, err = parseTestMatrix([]string{"postgres=14", "postgres=15"})
+	assert.ErrorContains(t, err, "more than once")
+
+	combinations := testMatrixCombinations([]testMatrixAxis{{Image: "postgres", Tags: []string{"14", "15"}}, {Image: "redis", Tags: []string{"6", "7"}}})
+	labels := make([]string, 0, len(combinations))
+	for _, combination := range combinations {
+		labels = append(labels, testMatrixLabel(combination))
+	}
+	assert.Equal(t, []string{"postgres:14, redis:6", "postgres:14, redis:7", "postgres:15, redis:6", "postgres:15, redis:7"}, labels)
+
+	project := &types.Project{Services: types.Services{
+		"db":    {Name: "db", Image: "docker.io/library/postgres:13"},
+		"cache": {Name: "cache", Image: "redis"},
+		"api":   {Name: "api", Build: &types.BuildConfig{Context: "."}},
+	}}
+	affected, err := applyTestMatrix(project, combinations[0])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cache", "db"}, affected)
+	assert.Equal(t, "postgres:14", project.Services["db"].Image)
+	assert.Equal(t, "redis:6", project.Services["cache"].Image)
+	_, err = applyTestMatrix(project, []testMatrixImage{{Image: "mysql", Tag: "8"}})
+	assert.ErrorContains(t, err, `no service runs image "mysql"`)
+}
+
+func TestRunTestMatrix(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	load := func(name string) (*types.Project, error) {
+		return &types.Project{Name: name, Services: types.Services{
+			"db":  {Name: "db", Image: "postgres:13"},
+			"api": {Name: "api", Image: "shop/api"},
+		}}, nil
+	}
+	backend.EXPECT().Up(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, project *types.Project, opts api.UpOptions) error {
+			assert.Equal(t, []string{"db"}, opts.Create.Services)
+			assert.Equal(t, api.RecreateForce, opts.Create.Recreate)
+			return nil
+		}).Times(2)
+	// the api tests fail against postgres 15
+	backend.EXPECT().RunOneOffContainer(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, project *types.Project, opts api.RunOptions) (int, error) {
+			if project.Services["db"].Image == "postgres:15" {
+				return 1, nil
+			}
+			return 0, nil
+		}).Times(2)
+
+	axes := []testMatrixAxis{{Image: "postgres", Tags: []string{"14", "15"}}}
+	var out bytes.Buffer
+	newBackend := func(stdout, stderr io.Writer) (api.Compose, error) {
+		return backend, nil
+	}
+	opts := &testOptions{services: []string{"api"}, parallel: 1, maxParallel: 2, stdout: &out}
+	results := runTestMatrix(context.Background(), nil, newBackend, "shop", axes, opts, load)
+	require.Len(t, results, 2)
+	assert.Equal(t, "shop-matrix-1", results[0].Project)
+	assert.Equal(t, testStatusPassed, results[0].Results[0].Status)
+	assert.Equal(t, "shop-matrix-2", results[1].Project)
+	assert.Equal(t, testStatusFailed, results[1].Results[0].Status)
+	assert.Equal(t, 1, countTestMatrixFailures(results))
+
+	var buf bytes.Buffer
+	printTestMatrix(&buf, []string{"api"}, results)
+	assert.Equal(t, "SERVICE   postgres:14   postgres:15\n"+
+		"api       passed        failed\n", buf.String())
+
+	// the output of parallel combinations is prefixed with their project
+	assert.Contains(t, out.String(), "shop-matrix-1 | Testing matrix combination postgres:14 in project shop-matrix-1\n")
+	assert.Contains(t, out.String(), "shop-matrix-2 | Warning: Tests failed for service api: tests exited with code 1\n")
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		assert.Regexp(t, `^shop-matrix-\d \| `, line)
+	}
+
+	// no combination is started once interrupted
+	interrupted, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Empty(t, runTestMatrix(interrupted, nil, newBackend, "shop", axes, opts, load))
+}
+
+func TestTestOutputPrefixer(t *testing.T) {
+	var out bytes.Buffer
+	w := newTestOutputPrefixer(&out, "shop-matrix-1")
+	_, err := w.Write([]byte("first\nsec"))
+	require.NoError(t, err)
+	assert.Equal(t, "shop-matrix-1 | first\n", out.String())
+	_, err = w.Write([]byte("ond\nlast"))
+	require.NoError(t, err)
+	w.Flush()
+	assert.Equal(t, "shop-matrix-1 | first\nshop-matrix-1 | second\nshop-matrix-1 | last\n", out.String())
+}
@@ -31,6 +31,8 @@ import (
 // UI - prompt user input
 type UI interface {
 	Confirm(message string, defaultValue bool) (bool, error)
+	Select(message string, options []string) (int, error)
+	Input(message string, defaultValue string) (string, error)
 }
 
 func NewPrompt(stdin *streams.In, stdout *streams.Out) UI {
@@ -87,6 +89,36 @@ func (u User) Confirm(message string, defaultValue bool) (bool, error) {
 	return b, err
 }
 
+// Select asks to pick one of the options and returns its index
+func (u User) Select(message string, options []string) (int, error) {
+	qs := &survey.Select{
+		Message: message,
+		Options: options,
+	}
+	var i int
+	err := survey.AskOne(qs, &i, func(options *survey.AskOptions) error {
+		options.Stdio.In = u.stdin
+		options.Stdio.Out = u.stdout
+		return nil
+	})
+	return i, err
+}
+
+// Input asks for a free text answer
+func (u User) Input(message string, defaultValue string) (string, error) {
+	qs := &survey.Input{
+		Message: message,
+		Default: defaultValue,
+	}
+	var answer string
+	err := survey.AskOne(qs, &answer, func(options *survey.AskOptions) error {
+		options.Stdio.In = u.stdin
+		options.Stdio.Out = u.stdout
+		return nil
+	})
+	return answer, err
+}
+
 // Pipe - aggregates prompt methods
 type Pipe struct {
 	stdout io.Writer
@@ -100,3 +132,30 @@ func (u Pipe) Confirm(message string, defaultValue bool) (bool, error) {
 	_, _ = fmt.Fscanln(u.stdin, &answer)
 	return utils.StringToBool(answer), nil
 }
+
+// Select prints numbered options and reads the number of the selected one
+func (u Pipe) Select(message string, options []string) (int, error) {
+	for i, option := range options {
+		_, _ = fmt.Fprintf(u.stdout, "%d) %s\n", i+1, option)
+	}
+	_, _ = fmt.Fprint(u.stdout, message)
+	var answer int
+	if _, err := fmt.Fscanln(u.stdin, &answer); err != nil {
+		return 0, err
+	}
+	if answer < 1 || answer > len(options) {
+		return 0, fmt.Errorf("invalid selection: %d", answer)
+	}
+	return answer - 1, nil
+}
+
+// Input reads a line of text, falling back to defaultValue when empty
+func (u Pipe) Input(message string, defaultValue string) (string, error) {
+	_, _ = fmt.Fprint(u.stdout, message)
+	var answer string
+	_, _ = fmt.Fscanln(u.stdin, &answer)
+	if answer == "" {
+		return defaultValue, nil
+	}
+	return answer, nil
+}
@@ -0,0 +1,44 @@
+/*
+   Copyright 2020 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package prompt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeSelect(t *testing.T) {
+	options := []string{"v3", "v2", "v1"}
+
+	var out bytes.Buffer
+	selected, err := Pipe{stdin: strings.NewReader("2\n"), stdout: &out}.Select("Select a version: ", options)
+	require.NoError(t, err)
+	assert.Equal(t, 1, selected)
+	assert.Equal(t, "1) v3\n2) v2\n3) v1\nSelect a version: ", out.String())
+
+	for _, answer := range []string{"0", "4", "-1"} {
+		_, err = Pipe{stdin: strings.NewReader(answer + "\n"), stdout: &bytes.Buffer{}}.Select("Select a version: ", options)
+		assert.EqualError(t, err, "invalid selection: "+answer)
+	}
+
+	_, err = Pipe{stdin: strings.NewReader("v2\n"), stdout: &bytes.Buffer{}}.Select("Select a version: ", options)
+	assert.Error(t, err)
+}
@@ -0,0 +1,540 @@
+/*
+   Copyright 2020 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package bundle reads and writes the gzipped tarballs exchanged by the share and env commands.
+// A bundle starts with a manifest listing the files it holds along with their checksums, so
+// any bundle can be verified and imported regardless of the command which produced it. The
+// checksums are also written as a SHA256SUMS file, which "sha256sum -c" checks once extracted.
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ManifestName is the name of the manifest at the root of bundles
+const ManifestName = "compose-bundle.json"
+
+// ChecksumsName is the name of the file listing the checksums of the regular files of bundles, in
+// the format of sha256sum
+const ChecksumsName = "SHA256SUMS"
+
+// ErrNoManifest is returned when verifying a bundle without manifest
+var ErrNoManifest = errors.New("bundle has no manifest, it can't be verified")
+
+// SchemaVersion is the version of the manifest schema written by this package
+const SchemaVersion = 1
+
+const (
+	// KindShare is the kind of bundles written by the share command
+	KindShare = "share"
+	// KindEnvironment is the kind of bundles written by the env command
+	KindEnvironment = "environment"
+)
+
+// Manifest describes the content of a bundle
+type Manifest struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Kind          string    `json:"kind"`
+	Name          string    `json:"name"`
+	CreatedAt     time.Time `json:"createdAt"`
+	Files         []File    `json:"files"`
+	// Metadata holds the attributes specific to the command which wrote the bundle
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+}
+
+// File is an entry of a bundle
+type File struct {
+	Path string      `json:"path"`
+	Mode fs.FileMode `json:"mode"`
+	Size int64       `json:"size"`
+	// SHA256 is the checksum of the content of regular files
+	SHA256 string `json:"sha256,omitempty"`
+	// Link is the target of symbolic links
+	Link string `json:"link,omitempty"`
+}
+
+// IsGzip tells whether the file starts with the gzip magic number, as bundles do
+func IsGzip(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close() //nolint:errcheck
+	magic, err := bufio.NewReader(f).Peek(2)
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return magic[0] == 0x1f && magic[1] == 0x8b, nil
+}
+
+// Write writes the files, relative to dir and slash separated, as a bundle described by the
+// manifest. The files and schema version of the manifest are computed.
+func Write(w io.Writer, dir string, files []string, manifest Manifest) error {
+	return WriteGenerated(w, dir, files, nil, manifest)
+}
+
+// WriteGenerated writes a bundle like Write, along with the generated files given by their path
+// and content, which replace the files of dir with the same path
+func WriteGenerated(w io.Writer, dir string, files []string, generated map[string][]byte, manifest Manifest) error {
+	manifest.SchemaVersion = SchemaVersion
+	manifest.Files = make([]File, 0, len(files)+len(generated))
+	for _, file := range files {
+		if _, ok := generated[file]; ok || file == ManifestName || file == ChecksumsName {
+			continue
+		}
+		entry, err := describe(dir, file)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+	for _, file := range slices.Sorted(maps.Keys(generated)) {
+		content := generated[file]
+		sum := sha256.Sum256(content)
+		manifest.Files = append(manifest.Files, File{
+			Path:   file,
+			Mode:   0o644,
+			Size:   int64(len(content)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     ManifestName,
+		Mode:     0o644,
+		Size:     int64(len(content)),
+		ModTime:  manifest.CreatedAt,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(content); err != nil {
+		return err
+	}
+	sums := checksums(manifest.Files)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     ChecksumsName,
+		Mode:     0o644,
+		Size:     int64(len(sums)),
+		ModTime:  manifest.CreatedAt,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(sums); err != nil {
+		return err
+	}
+	for _, file := range manifest.Files {
+		if content, ok := generated[file.Path]; ok {
+			if err := addContent(tw, file, content, manifest.CreatedAt); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := addFile(tw, dir, file.Path); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// checksums renders the checksums of the regular files as sha256sum does
+func checksums(files []File) []byte {
+	var sums strings.Builder
+	for _, file := range files {
+		if file.Mode.IsRegular() {
+			fmt.Fprintf(&sums, "%s  %s\n", file.SHA256, file.Path)
+		}
+	}
+	return []byte(sums.String())
+}
+
+// parseChecksums parses a SHA256SUMS file, indexed by path
+func parseChecksums(r io.Reader) (map[string]string, error) {
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		// sha256sum separates the checksum from the path with a space and a mode character
+		sum, file, ok := strings.Cut(line, " ")
+		if !ok || len(sum) != sha256.Size*2 || file == "" || (file[0] != ' ' && file[0] != '*') {
+			return nil, fmt.Errorf("invalid line in %s: %q", ChecksumsName, line)
+		}
+		sums[file[1:]] = sum
+	}
+	return sums, scanner.Err()
+}
+
+func describe(dir, file string) (File, error) {
+	p := filepath.Join(dir, filepath.FromSlash(file))
+	info, err := os.Lstat(p)
+	if err != nil {
+		return File{}, err
+	}
+	entry := File{Path: file, Mode: info.Mode()}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		if entry.Link, err = os.Readlink(p); err != nil {
+			return File{}, err
+		}
+	case info.Mode().IsRegular():
+		f, err := os.Open(p)
+		if err != nil {
+			return File{}, err
+		}
+		defer f.Close() //nolint:errcheck
+		h := sha256.New()
+		if entry.Size, err = io.Copy(h, f); err != nil {
+			return File{}, err
+		}
+		entry.SHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+	return entry, nil
+}
+
+func addFile(tw *tar.Writer, dir, file string) error {
+	p := filepath.Join(dir, filepath.FromSlash(file))
+	info, err := os.Lstat(p)
+	if err != nil {
+		return err
+	}
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(p); err != nil {
+			return err
+		}
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = file
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// addContent writes a generated file
+func addContent(tw *tar.Writer, file File, content []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     file.Path,
+		Mode:     int64(file.Mode),
+		Size:     file.Size,
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+// Read extracts the bundle into dir, which is created if needed, and verifies the extracted
+// files against the manifest, which is returned. Archives without a manifest, written before it
+// existed or stripped of it, are extracted but can't be verified: ErrNoManifest is returned, for
+// callers to reject them unless unverified bundles are explicitly accepted.
+func Read(r io.Reader, dir string) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a bundle: %v", err)
+	}
+	defer gz.Close() //nolint:errcheck
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	var (
+		manifest *Manifest
+		sums     map[string]string
+	)
+	extracted := map[string]File{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %v", err)
+		}
+		if ok, err := readMetadata(tr, header, &manifest, &sums); ok || err != nil {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if link := linkedAncestor(header.Name, extracted); link != "" {
+			return nil, fmt.Errorf("invalid path in bundle: %s is below the symbolic link %s", header.Name, link)
+		}
+		entry, err := extract(tr, header, dir)
+		if err != nil {
+			return nil, err
+		}
+		extracted[entry.Path] = entry
+	}
+	if manifest == nil {
+		return nil, ErrNoManifest
+	}
+	return manifest, verify(*manifest, sums, extracted)
+}
+
+// Check verifies a bundle without extracting it, so tampered or corrupted bundles are rejected
+// before anything is written. Unlike Read, bundles without a manifest are rejected.
+func Check(r io.Reader) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a bundle: %v", err)
+	}
+	defer gz.Close() //nolint:errcheck
+
+	var (
+		manifest *Manifest
+		sums     map[string]string
+	)
+	files := map[string]File{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %v", err)
+		}
+		if ok, err := readMetadata(tr, header, &manifest, &sums); ok || err != nil {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		entry, err := inspect(tr, header)
+		if err != nil {
+			return nil, err
+		}
+		files[entry.Path] = entry
+	}
+	if manifest == nil {
+		return nil, ErrNoManifest
+	}
+	return manifest, verify(*manifest, sums, files)
+}
+
+// CheckFile verifies the bundle file without extracting it
+func CheckFile(file string) (*Manifest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+	return Check(f)
+}
+
+// readMetadata decodes the manifest or the checksums when the entry is one of them, and tells
+// whether it was
+func readMetadata(tr *tar.Reader, header *tar.Header, manifest **Manifest, sums *map[string]string) (bool, error) {
+	switch header.Name {
+	case ManifestName:
+		*manifest = &Manifest{}
+		if err := json.NewDecoder(tr).Decode(*manifest); err != nil {
+			return true, fmt.Errorf("failed to read bundle manifest: %v", err)
+		}
+		return true, nil
+	case ChecksumsName:
+		var err error
+		if *sums, err = parseChecksums(tr); err != nil {
+			return true, fmt.Errorf("failed to read bundle checksums: %v", err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// linkedAncestor returns the extracted symbolic link the entry would be written through, if any
+func linkedAncestor(name string, extracted map[string]File) string {
+	for dir := path.Dir(path.Clean(name)); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if extracted[dir].Link != "" {
+			return dir
+		}
+	}
+	return ""
+}
+
+// Verify checks the files found in a bundle match its manifest
+func Verify(manifest Manifest, files map[string]File) error {
+	return verify(manifest, nil, files)
+}
+
+// verify checks the files found in a bundle match its manifest and, when the bundle has a
+// SHA256SUMS file, its checksums
+func verify(manifest Manifest, sums map[string]string, files map[string]File) error {
+	var problems []string
+	if sums != nil {
+		for p, sum := range sums {
+			if got, ok := files[p]; !ok || got.SHA256 != sum {
+				problems = append(problems, p+" does not match "+ChecksumsName)
+			}
+		}
+		for p, file := range files {
+			if _, ok := sums[p]; !ok && file.Mode.IsRegular() {
+				problems = append(problems, p+" is not listed in "+ChecksumsName)
+			}
+		}
+	}
+	for _, want := range manifest.Files {
+		got, ok := files[want.Path]
+		switch {
+		case !ok:
+			problems = append(problems, want.Path+" is missing")
+		case got.SHA256 != want.SHA256 || got.Size != want.Size:
+			problems = append(problems, want.Path+" checksum mismatch")
+		case got.Link != want.Link:
+			problems = append(problems, want.Path+" link mismatch")
+		}
+	}
+	for p := range files {
+		if !slices.ContainsFunc(manifest.Files, func(f File) bool { return f.Path == p }) {
+			problems = append(problems, p+" is not listed in the manifest")
+		}
+	}
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return fmt.Errorf("bundle verification failed: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// entryPath returns the cleaned path of an entry of the bundle, refusing paths escaping it
+func entryPath(header *tar.Header) (string, error) {
+	name := path.Clean(header.Name)
+	if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("invalid path in bundle: %s", header.Name)
+	}
+	return name, nil
+}
+
+// inspect describes an entry of the bundle, checksumming regular files, without extracting it
+func inspect(tr *tar.Reader, header *tar.Header) (File, error) {
+	name, err := entryPath(header)
+	if err != nil {
+		return File{}, err
+	}
+	entry := File{Path: name, Mode: header.FileInfo().Mode()}
+	switch header.Typeflag {
+	case tar.TypeDir:
+	case tar.TypeSymlink:
+		entry.Link = header.Linkname
+	case tar.TypeReg:
+		h := sha256.New()
+		if entry.Size, err = io.Copy(h, tr); err != nil {
+			return File{}, fmt.Errorf("failed to read %s: %v", name, err)
+		}
+		entry.SHA256 = hex.EncodeToString(h.Sum(nil))
+	default:
+		return File{}, fmt.Errorf("unsupported entry in bundle: %s", header.Name)
+	}
+	return entry, nil
+}
+
+// extract writes an entry of the bundle under dir, refusing paths escaping it
+func extract(tr *tar.Reader, header *tar.Header, dir string) (File, error) {
+	name, err := entryPath(header)
+	if err != nil {
+		return File{}, err
+	}
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	entry := File{Path: name, Mode: header.FileInfo().Mode()}
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return entry, os.MkdirAll(target, 0o755)
+	case tar.TypeSymlink:
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return File{}, err
+		}
+		entry.Link = header.Linkname
+		return entry, os.Symlink(header.Linkname, target)
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return File{}, err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_EXCL, header.FileInfo().Mode().Perm())
+		if err != nil {
+			return File{}, err
+		}
+		h := sha256.New()
+		entry.Size, err = io.Copy(io.MultiWriter(f, h), tr)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return File{}, fmt.Errorf("failed to extract %s: %v", name, err)
+		}
+		entry.SHA256 = hex.EncodeToString(h.Sum(nil))
+		return entry, nil
+	default:
+		return File{}, fmt.Errorf("unsupported entry in bundle: %s", header.Name)
+	}
+}
+
+// ReadFile extracts the bundle file into dir
+func ReadFile(file, dir string) (*Manifest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+	return Read(f, dir)
+}
@@ -0,0 +1,214 @@
+/*
+   Copyright 2020 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "app"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte("services: {}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app", "main.go"), []byte("package main\n"), 0o600))
+	require.NoError(t, os.Symlink("main.go", filepath.Join(dir, "app", "current.go")))
+
+	var buf bytes.Buffer
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, Write(&buf, dir, []string{"app/current.go", "app/main.go", "compose.yaml"}, Manifest{
+		Kind:      KindShare,
+		Name:      "shop",
+		CreatedAt: now,
+		Metadata:  json.RawMessage(`{"id":"abc"}`),
+	}))
+
+	dest := filepath.Join(t.TempDir(), "out")
+	manifest, err := Read(&buf, dest)
+	require.NoError(t, err)
+	require.NotNil(t, manifest)
+	assert.Equal(t, SchemaVersion, manifest.SchemaVersion)
+	assert.Equal(t, KindShare, manifest.Kind)
+	assert.Equal(t, "shop", manifest.Name)
+	assert.Equal(t, now, manifest.CreatedAt)
+	assert.JSONEq(t, `{"id":"abc"}`, string(manifest.Metadata))
+	require.Len(t, manifest.Files, 3)
+	assert.Equal(t, "main.go", manifest.Files[0].Link)
+	assert.Equal(t, int64(13), manifest.Files[1].Size)
+	assert.Len(t, manifest.Files[1].SHA256, 64)
+
+	content, err := os.ReadFile(filepath.Join(dest, "app", "main.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n", string(content))
+	info, err := os.Stat(filepath.Join(dest, "app", "main.go"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	link, err := os.Readlink(filepath.Join(dest, "app", "current.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "main.go", link)
+}
+
+func TestWriteGenerated(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte("services: {}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "compose.lock.json"), []byte("stale\n"), 0o644))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteGenerated(&buf, dir, []string{"compose.lock.json", "compose.yaml"}, map[string][]byte{
+		"compose.lock.json": []byte("{}\n"),
+	}, Manifest{Kind: KindShare, Name: "shop"}))
+
+	dest := filepath.Join(t.TempDir(), "out")
+	manifest, err := Read(&buf, dest)
+	require.NoError(t, err)
+	require.Len(t, manifest.Files, 2)
+	assert.Equal(t, "compose.yaml", manifest.Files[0].Path)
+	assert.Equal(t, "compose.lock.json", manifest.Files[1].Path)
+	content, err := os.ReadFile(filepath.Join(dest, "compose.lock.json"))
+	require.NoError(t, err)
+	assert.Equal(t, "{}\n", string(content))
+}
+
+// writeTar writes a bundle by hand, with the manifest when set
+func writeTar(t *testing.T, manifest *Manifest, headers []*tar.Header, contents []string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if manifest != nil {
+		content, err := json.Marshal(manifest)
+		require.NoError(t, err)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: ManifestName, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err = tw.Write(content)
+		require.NoError(t, err)
+	}
+	for i, header := range headers {
+		require.NoError(t, tw.WriteHeader(header))
+		_, err := tw.Write([]byte(contents[i]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return &buf
+}
+
+func TestReadVerifies(t *testing.T) {
+	manifest := &Manifest{SchemaVersion: SchemaVersion, Files: []File{
+		{Path: "compose.yaml", Size: 3, SHA256: "0000"},
+		{Path: "missing.txt", Size: 1, SHA256: "1111"},
+	}}
+	buf := writeTar(t, manifest, []*tar.Header{
+		{Name: "compose.yaml", Mode: 0o644, Size: 3, Typeflag: tar.TypeReg},
+		{Name: "extra.txt", Mode: 0o644, Size: 1, Typeflag: tar.TypeReg},
+	}, []string{"abc", "x"})
+	_, err := Read(buf, t.TempDir())
+	assert.EqualError(t, err, "bundle verification failed: compose.yaml checksum mismatch, extra.txt is not listed in the manifest, missing.txt is missing")
+}
+
+func TestReadWithoutManifest(t *testing.T) {
+	buf := writeTar(t, nil, []*tar.Header{
+		{Name: "compose.yaml", Mode: 0o644, Size: 3, Typeflag: tar.TypeReg},
+	}, []string{"abc"})
+	dest := t.TempDir()
+	manifest, err := Read(buf, dest)
+	assert.ErrorIs(t, err, ErrNoManifest)
+	assert.Nil(t, manifest)
+	assert.FileExists(t, filepath.Join(dest, "compose.yaml"))
+}
+
+func TestReadRejectsEscapingPaths(t *testing.T) {
+	buf := writeTar(t, nil, []*tar.Header{
+		{Name: "../evil", Mode: 0o644, Size: 1, Typeflag: tar.TypeReg},
+	}, []string{"x"})
+	_, err := Read(buf, t.TempDir())
+	assert.EqualError(t, err, "invalid path in bundle: ../evil")
+
+	buf = writeTar(t, nil, []*tar.Header{
+		{Name: "etc", Linkname: "/etc", Typeflag: tar.TypeSymlink},
+		{Name: "etc/passwd", Mode: 0o644, Size: 1, Typeflag: tar.TypeReg},
+	}, []string{"", "x"})
+	_, err = Read(buf, t.TempDir())
+	assert.EqualError(t, err, "invalid path in bundle: etc/passwd is below the symbolic link etc")
+}
+
+func TestChecksums(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte("abc"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ChecksumsName), []byte("stale"), 0o644))
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, dir, []string{"compose.yaml", ChecksumsName}, Manifest{Kind: KindEnvironment, Name: "qa"}))
+
+	manifest, err := Check(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, "qa", manifest.Name)
+	require.Len(t, manifest.Files, 1)
+	sum := manifest.Files[0].SHA256
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", sum)
+	sums, err := parseChecksums(bytes.NewReader(checksums(manifest.Files)))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"compose.yaml": sum}, sums)
+	_, err = parseChecksums(bytes.NewReader([]byte("abc compose.yaml\n")))
+	assert.ErrorContains(t, err, `invalid line in SHA256SUMS: "abc compose.yaml"`)
+
+	dest := t.TempDir()
+	_, err = Read(&buf, dest)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dest, ChecksumsName))
+
+	// SHA256SUMS disagrees with the manifest
+	manifest = &Manifest{SchemaVersion: SchemaVersion, Files: []File{{Path: "compose.yaml", Mode: 0o644, Size: 3, SHA256: sum}}}
+	tampered := "0000000000000000000000000000000000000000000000000000000000000000  compose.yaml\n"
+	headers := []*tar.Header{
+		{Name: ChecksumsName, Mode: 0o644, Size: int64(len(tampered)), Typeflag: tar.TypeReg},
+		{Name: "compose.yaml", Mode: 0o644, Size: 3, Typeflag: tar.TypeReg},
+	}
+	_, err = Check(writeTar(t, manifest, headers, []string{tampered, "abc"}))
+	assert.EqualError(t, err, "bundle verification failed: compose.yaml does not match SHA256SUMS")
+
+	// a corrupted file matches neither
+	valid := sum + "  compose.yaml\n"
+	headers[0].Size = int64(len(valid))
+	_, err = Check(writeTar(t, manifest, headers, []string{valid, "abd"}))
+	assert.EqualError(t, err, "bundle verification failed: compose.yaml checksum mismatch, compose.yaml does not match SHA256SUMS")
+
+	_, err = Check(writeTar(t, nil, headers[1:], []string{"abc"}))
+	assert.EqualError(t, err, "bundle has no manifest, it can't be verified")
+}
+
+func TestIsGzip(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "compose.yaml")
+	require.NoError(t, os.WriteFile(plain, []byte("services: {}\n"), 0o644))
+	ok, err := IsGzip(plain)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	archive := filepath.Join(dir, "env.tar.gz")
+	require.NoError(t, os.WriteFile(archive, writeTar(t, nil, nil, nil).Bytes(), 0o644))
+	ok, err = IsGzip(archive)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -158,6 +158,8 @@ type VolumesSummary = *volume.Volume
 
 type ScaleOptions struct {
 	Services []string
+	// Timeout overrides the stop timeout of the containers removed by scaling down
+	Timeout *time.Duration
 }
 
 type WaitOptions struct {
@@ -0,0 +1,156 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package extensions
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/docker/compose/v5/pkg/api"
+)
+
+// RollingDeployOptions configures a rolling deployment
+type RollingDeployOptions struct {
+	// MaxParallel is the maximum number of services updated at the same time, 1 when unset. As
+	// the containers of a service are replaced while it is updated, it is also the maximum number
+	// of services unavailable at the same time.
+	MaxParallel int
+	// Out receives the progress messages, discarded when unset
+	Out io.Writer
+}
+
+// RollingDeploy recreates the containers of the project services, dependencies first. A service
+// is updated as soon as all its dependencies have been, each being waited for to be running or
+// healthy, and up to MaxParallel services are updated at the same time. The first failure stops
+// the rollout: the services not updated yet are left untouched.
+func RollingDeploy(ctx context.Context, backend api.Compose, project *types.Project, opts RollingDeployOptions) error {
+	out := opts.Out
+	if out == nil {
+		out = io.Discard
+	}
+	// waves detect dependency cycles, and give the order the services are scheduled in
+	waves, err := DeployWaves(project)
+	if err != nil {
+		return err
+	}
+	parallel := max(opts.MaxParallel, 1)
+	total := len(project.Services)
+	_, _ = fmt.Fprintf(out, "Deploying %d services, up to %d at a time\n", total, parallel)
+
+	deployed := map[string]chan struct{}{}
+	for name := range project.Services {
+		deployed[name] = make(chan struct{})
+	}
+	slots := make(chan struct{}, parallel)
+	var mu sync.Mutex
+	completed := 0
+
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, wave := range waves {
+		for _, service := range wave {
+			eg.Go(func() error {
+				for dependency := range project.Services[service].DependsOn {
+					if done, ok := deployed[dependency]; ok {
+						select {
+						case <-done:
+						case <-ctx.Done():
+							return ctx.Err()
+						}
+					}
+				}
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				defer func() { <-slots }()
+
+				_, _ = fmt.Fprintf(out, "Deploying service: %s\n", service)
+
+				// the containers are recreated, so they run the current image and configuration
+				if err := backend.Up(ctx, project, api.UpOptions{
+					Create: api.CreateOptions{
+						Services:             []string{service},
+						Recreate:             api.RecreateForce,
+						RecreateDependencies: api.RecreateNever,
+						Inherit:              true,
+					},
+					Start: api.StartOptions{
+						Project:  project,
+						Services: []string{service},
+						Wait:     true,
+					},
+				}); err != nil {
+					return fmt.Errorf("failed to deploy service %s: %w", service, err)
+				}
+
+				mu.Lock()
+				completed++
+				_, _ = fmt.Fprintf(out, "[%d/%d] Deployed service: %s\n", completed, total, service)
+				mu.Unlock()
+				close(deployed[service])
+				return nil
+			})
+		}
+	}
+	return eg.Wait()
+}
+
+// DeployWaves groups the project services in waves: a service belongs to the wave following
+// the one of its last dependency, so services of the same wave can be deployed in parallel
+func DeployWaves(project *types.Project) ([][]string, error) {
+	remaining := map[string][]string{}
+	for name, service := range project.Services {
+		var dependencies []string
+		for dependency := range service.DependsOn {
+			if _, ok := project.Services[dependency]; ok {
+				dependencies = append(dependencies, dependency)
+			}
+		}
+		remaining[name] = dependencies
+	}
+
+	deployed := map[string]bool{}
+	var waves [][]string
+	for len(remaining) > 0 {
+		var wave []string
+		for name, dependencies := range remaining {
+			if !slices.ContainsFunc(dependencies, func(d string) bool { return !deployed[d] }) {
+				wave = append(wave, name)
+			}
+		}
+		if len(wave) == 0 {
+			return nil, fmt.Errorf("dependency cycle between services %s", strings.Join(slices.Sorted(maps.Keys(remaining)), ", "))
+		}
+		sort.Strings(wave)
+		for _, name := range wave {
+			deployed[name] = true
+			delete(remaining, name)
+		}
+		waves = append(waves, wave)
+	}
+	return waves, nil
+}
@@ -0,0 +1,106 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package extensions
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestDeployWaves(t *testing.T) {
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"db":     {Name: "db"},
+		"cache":  {Name: "cache"},
+		"api":    {Name: "api", DependsOn: types.DependsOnConfig{"db": {}, "cache": {}}},
+		"worker": {Name: "worker", DependsOn: types.DependsOnConfig{"db": {}, "external": {}}},
+		"web":    {Name: "web", DependsOn: types.DependsOnConfig{"api": {}}},
+	}}
+	waves, err := DeployWaves(project)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"cache", "db"}, {"api", "worker"}, {"web"}}, waves)
+
+	project.Services["db"] = types.ServiceConfig{Name: "db", DependsOn: types.DependsOnConfig{"web": {}}}
+	_, err = DeployWaves(project)
+	assert.ErrorContains(t, err, "dependency cycle between services api, db, web, worker")
+}
+
+func TestRollingDeployWaitsForDependencies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"db":  {Name: "db"},
+		"web": {Name: "web", DependsOn: types.DependsOnConfig{"db": {}}},
+	}}
+	// every wave recreates the containers of its services, so they run the new image
+	recreate := func(service string) api.UpOptions {
+		return api.UpOptions{
+			Create: api.CreateOptions{
+				Services:             []string{service},
+				Recreate:             api.RecreateForce,
+				RecreateDependencies: api.RecreateNever,
+				Inherit:              true,
+			},
+			Start: api.StartOptions{Project: project, Services: []string{service}, Wait: true},
+		}
+	}
+	gomock.InOrder(
+		backend.EXPECT().Up(gomock.Any(), project, recreate("db")).Return(nil),
+		backend.EXPECT().Up(gomock.Any(), project, recreate("web")).Return(nil),
+	)
+	require.NoError(t, RollingDeploy(context.Background(), backend, project, RollingDeployOptions{MaxParallel: 4}))
+
+	// a failing wave stops the rollout before dependents are updated
+	backend.EXPECT().Up(gomock.Any(), project, gomock.Any()).Return(errors.New("unhealthy"))
+	err := RollingDeploy(context.Background(), backend, project, RollingDeployOptions{MaxParallel: 4})
+	assert.ErrorContains(t, err, "failed to deploy service db: unhealthy")
+}
+
+func TestRollingDeployDoesNotWaitForWaves(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"db":    {Name: "db"},
+		"cache": {Name: "cache"},
+		"api":   {Name: "api", DependsOn: types.DependsOnConfig{"cache": {}}},
+	}}
+	// db is only healthy once api has been updated: api must not wait for the whole first wave
+	apiStarted := make(chan struct{})
+	backend.EXPECT().Up(gomock.Any(), project, gomock.Any()).DoAndReturn(func(ctx context.Context, _ *types.Project, options api.UpOptions) error {
+		switch options.Create.Services[0] {
+		case "db":
+			select {
+			case <-apiStarted:
+			case <-time.After(5 * time.Second):
+				return errors.New("api wasn't deployed while db was starting")
+			}
+		case "api":
+			close(apiStarted)
+		}
+		return nil
+	}).Times(3)
+	require.NoError(t, RollingDeploy(context.Background(), backend, project, RollingDeployOptions{MaxParallel: 2}))
+}
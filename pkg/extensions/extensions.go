@@ -0,0 +1,62 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package extensions implements the operations behind the compose extension commands
+// (deploy, rollback, scale, secrets, sync) so they can be used by other Go programs, without
+// going through the command line.
+package extensions
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// StateDir returns the directory holding state of the given kind (environments, history, ...)
+// for the compose extension commands
+func StateDir(kind string) string {
+	switch {
+	case os.Getenv("HOME") != "":
+		// Unix-like systems
+		return filepath.Join(os.Getenv("HOME"), ".docker", "compose", kind)
+	case os.Getenv("USERPROFILE") != "":
+		// Windows
+		return filepath.Join(os.Getenv("USERPROFILE"), ".docker", "compose", kind)
+	default:
+		// Fallback
+		return ".docker-compose-" + kind
+	}
+}
+
+// envPlainValue matches the values written unquoted to an env file
+var envPlainValue = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+
+// envDoubleQuoted escapes a value in double quotes, where variables are otherwise interpolated
+var envDoubleQuoted = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`)
+
+// QuoteEnvValue quotes a value when needed to read it back unchanged from an env file: single
+// quotes keep it literal, double quotes are used when it holds a single quote or a newline
+func QuoteEnvValue(value string) string {
+	switch {
+	case envPlainValue.MatchString(value):
+		return value
+	case !strings.ContainsAny(value, "'\n"):
+		return "'" + value + "'"
+	default:
+		return `"` + envDoubleQuoted.Replace(value) + `"`
+	}
+}
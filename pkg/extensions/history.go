@@ -0,0 +1,342 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package extensions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+
+	"github.com/docker/compose/v5/pkg/api"
+)
+
+// VersionTimeLayout is the timestamp format used in the version history
+const VersionTimeLayout = "2006-01-02 15:04:05"
+
+// VersionInfo is a deployed version of a project, as recorded in its history
+type VersionInfo struct {
+	Version     string            `json:"version"`
+	CreatedAt   string            `json:"createdAt"`
+	UpdatedAt   string            `json:"updatedAt"`
+	Description string            `json:"description"`
+	Services    map[string]string `json:"services,omitempty"`
+	// ConfigHashes holds the compose configuration hash of the deployed containers, per service
+	ConfigHashes map[string]string `json:"configHashes,omitempty"`
+	// ImageIDs holds the ID of the image run by the deployed containers, per service. Unlike the
+	// image references of Services, whose tags may be moved, it designates the deployed image.
+	ImageIDs   map[string]string `json:"imageIDs,omitempty"`
+	ApprovedBy string            `json:"approvedBy,omitempty"`
+	// Status is VersionFailed for a deployment which failed, empty otherwise
+	Status string `json:"status,omitempty"`
+}
+
+// VersionFailed is the status of a recorded deployment which failed, it is never a rollback target
+const VersionFailed = "failed"
+
+// DeployedVersions returns the versions of the history which were successfully deployed
+func DeployedVersions(history []VersionInfo) []VersionInfo {
+	var deployed []VersionInfo
+	for _, v := range history {
+		if v.Status != VersionFailed {
+			deployed = append(deployed, v)
+		}
+	}
+	return deployed
+}
+
+// LatestDeployedVersion returns the latest successfully deployed version, nil if there is none
+func LatestDeployedVersion(history []VersionInfo) *VersionInfo {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Status != VersionFailed {
+			return &history[i]
+		}
+	}
+	return nil
+}
+
+// HistoryStore holds the version history of projects, one JSON file per project
+type HistoryStore struct {
+	Dir string
+}
+
+// NewHistoryStore returns the history store located in dir
+func NewHistoryStore(dir string) *HistoryStore {
+	return &HistoryStore{Dir: dir}
+}
+
+// DefaultHistoryStore returns the history store used by the deploy and rollback commands
+func DefaultHistoryStore() *HistoryStore {
+	return NewHistoryStore(StateDir("history"))
+}
+
+// File returns the history file of a project
+func (h *HistoryStore) File(projectName string) string {
+	return filepath.Join(h.Dir, projectName+".json")
+}
+
+// Load reads the recorded versions of a project, oldest first
+func (h *HistoryStore) Load(projectName string) ([]VersionInfo, error) {
+	content, err := os.ReadFile(h.File(projectName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version history: %v", err)
+	}
+	var history []VersionInfo
+	if err := json.Unmarshal(content, &history); err != nil {
+		return nil, fmt.Errorf("malformed version history %s: %v", h.File(projectName), err)
+	}
+	return history, nil
+}
+
+// Save replaces the history of a project
+func (h *HistoryStore) Save(projectName string, history []VersionInfo) error {
+	if err := os.MkdirAll(h.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create history directory: %v", err)
+	}
+	content, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(h.File(projectName), content, 0o644); err != nil {
+		return fmt.Errorf("failed to write version history: %v", err)
+	}
+	return nil
+}
+
+// Record appends the images currently configured for the project services to its history,
+// along with the configuration hash and the image ID of the given deployed containers.
+// Services not part of the project (partial deployment) keep the image from the latest version.
+func (h *HistoryStore) Record(project *types.Project, description, approvedBy string, containers []api.ContainerSummary) (*VersionInfo, error) {
+	return h.record(project, description, approvedBy, "", containers)
+}
+
+// RecordFailure appends a deployment of the project which failed to its history. It is kept
+// for the record but never used as a rollback target.
+func (h *HistoryStore) RecordFailure(project *types.Project, description, approvedBy string, containers []api.ContainerSummary) (*VersionInfo, error) {
+	return h.record(project, description, approvedBy, VersionFailed, containers)
+}
+
+func (h *HistoryStore) record(project *types.Project, description, approvedBy, status string, containers []api.ContainerSummary) (*VersionInfo, error) {
+	history, err := h.Load(project.Name)
+	if err != nil {
+		return nil, err
+	}
+	version := VersionInfo{
+		Description:  description,
+		Services:     map[string]string{},
+		ConfigHashes: map[string]string{},
+		ImageIDs:     map[string]string{},
+		ApprovedBy:   approvedBy,
+		Status:       status,
+	}
+	if latest := LatestDeployedVersion(history); latest != nil {
+		maps.Copy(version.Services, latest.Services)
+		maps.Copy(version.ConfigHashes, latest.ConfigHashes)
+		maps.Copy(version.ImageIDs, latest.ImageIDs)
+	}
+	for name, service := range project.Services {
+		version.Services[name] = api.GetImageNameOrDefault(service, project.Name)
+		delete(version.ConfigHashes, name)
+		delete(version.ImageIDs, name)
+	}
+	for _, c := range containers {
+		if _, ok := project.Services[c.Service]; ok {
+			recordContainer(&version, c)
+		}
+	}
+	return h.add(project.Name, history, version)
+}
+
+// RecordRollback appends the project switched back to the images of the target version, along with
+// the configuration hash and the image ID of the given containers running them
+func (h *HistoryStore) RecordRollback(projectName string, target *VersionInfo, description string, containers []api.ContainerSummary) (*VersionInfo, error) {
+	history, err := h.Load(projectName)
+	if err != nil {
+		return nil, err
+	}
+	version := VersionInfo{
+		Description:  description,
+		Services:     maps.Clone(target.Services),
+		ConfigHashes: map[string]string{},
+		ImageIDs:     map[string]string{},
+	}
+	maps.Copy(version.ConfigHashes, target.ConfigHashes)
+	maps.Copy(version.ImageIDs, target.ImageIDs)
+	for _, c := range containers {
+		if _, ok := target.Services[c.Service]; ok {
+			recordContainer(&version, c)
+		}
+	}
+	return h.add(projectName, history, version)
+}
+
+// recordContainer sets the configuration hash and the image ID of the service of a deployed container
+func recordContainer(version *VersionInfo, c api.ContainerSummary) {
+	if hash := c.Labels[api.ConfigHashLabel]; hash != "" {
+		version.ConfigHashes[c.Service] = hash
+	}
+	if imageID := c.Labels[api.ImageDigestLabel]; imageID != "" {
+		version.ImageIDs[c.Service] = imageID
+	}
+}
+
+// add names the version after the latest one of the history and saves it
+func (h *HistoryStore) add(projectName string, history []VersionInfo, version VersionInfo) (*VersionInfo, error) {
+	now := time.Now().Format(VersionTimeLayout)
+	version.Version = NextVersion(history)
+	version.CreatedAt = now
+	version.UpdatedAt = now
+	history = append(history, version)
+	retention, err := h.LoadRetention(projectName)
+	if err != nil {
+		return nil, err
+	}
+	history, _ = PruneHistory(history, retention, time.Now())
+	if err := h.Save(projectName, history); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// NextVersion returns the name of the version following the latest one of the history
+func NextVersion(history []VersionInfo) string {
+	latest := 0
+	for _, v := range history {
+		if n, err := strconv.Atoi(strings.TrimPrefix(v.Version, "v")); err == nil && n > latest {
+			latest = n
+		}
+	}
+	return fmt.Sprintf("v%d", latest+1)
+}
+
+// HistoryRetention bounds the versions kept in the history of a project, zero values keep everything
+type HistoryRetention struct {
+	// Keep is the number of newest versions kept
+	Keep int `json:"keep,omitempty"`
+	// KeepDays is the age in days above which versions are pruned
+	KeepDays int `json:"keepDays,omitempty"`
+}
+
+// IsZero tells if the retention keeps the whole history
+func (r HistoryRetention) IsZero() bool {
+	return r.Keep <= 0 && r.KeepDays <= 0
+}
+
+func (r HistoryRetention) String() string {
+	var rules []string
+	if r.Keep > 0 {
+		rules = append(rules, fmt.Sprintf("the %d newest versions", r.Keep))
+	}
+	if r.KeepDays > 0 {
+		rules = append(rules, fmt.Sprintf("versions from the last %d days", r.KeepDays))
+	}
+	if len(rules) == 0 {
+		return "all versions"
+	}
+	return strings.Join(rules, " and ")
+}
+
+// retentionFile returns the file holding the retention policy of a project
+func (h *HistoryStore) retentionFile(projectName string) string {
+	return filepath.Join(h.Dir, projectName+".retention.json")
+}
+
+// LoadRetention reads the retention policy of a project, keeping everything when none is set
+func (h *HistoryStore) LoadRetention(projectName string) (HistoryRetention, error) {
+	var retention HistoryRetention
+	content, err := os.ReadFile(h.retentionFile(projectName))
+	if errors.Is(err, os.ErrNotExist) {
+		return retention, nil
+	}
+	if err != nil {
+		return retention, fmt.Errorf("failed to read history retention: %v", err)
+	}
+	if err := json.Unmarshal(content, &retention); err != nil {
+		return retention, fmt.Errorf("malformed history retention %s: %v", h.retentionFile(projectName), err)
+	}
+	return retention, nil
+}
+
+// SaveRetention sets the retention policy applied to the history of a project whenever a version is recorded
+func (h *HistoryStore) SaveRetention(projectName string, retention HistoryRetention) error {
+	if retention.IsZero() {
+		if err := os.Remove(h.retentionFile(projectName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove history retention: %v", err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(h.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create history directory: %v", err)
+	}
+	content, err := json.MarshalIndent(retention, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(h.retentionFile(projectName), content, 0o644); err != nil {
+		return fmt.Errorf("failed to write history retention: %v", err)
+	}
+	return nil
+}
+
+// Prune applies the retention to the history of a project and returns the pruned versions
+func (h *HistoryStore) Prune(projectName string, retention HistoryRetention) ([]VersionInfo, error) {
+	history, err := h.Load(projectName)
+	if err != nil {
+		return nil, err
+	}
+	kept, pruned := PruneHistory(history, retention, time.Now())
+	if len(pruned) == 0 {
+		return nil, nil
+	}
+	return pruned, h.Save(projectName, kept)
+}
+
+// PruneHistory splits the history between the versions kept by the retention and the pruned ones.
+// The currently deployed version and the newest one, which the next version is numbered after, are
+// always kept. Versions with an unreadable creation time are kept too.
+func PruneHistory(history []VersionInfo, retention HistoryRetention, now time.Time) (kept, pruned []VersionInfo) {
+	if retention.IsZero() {
+		return history, nil
+	}
+	current := ""
+	if latest := LatestDeployedVersion(history); latest != nil {
+		current = latest.Version
+	}
+	for i, v := range history {
+		newer := len(history) - 1 - i
+		expired := retention.Keep > 0 && newer >= retention.Keep
+		if created, err := time.ParseInLocation(VersionTimeLayout, v.CreatedAt, time.Local); err == nil && retention.KeepDays > 0 {
+			expired = expired || now.Sub(created) > time.Duration(retention.KeepDays)*24*time.Hour
+		}
+		if expired && v.Version != current && newer > 0 {
+			pruned = append(pruned, v)
+		} else {
+			kept = append(kept, v)
+		}
+	}
+	return kept, pruned
+}
@@ -0,0 +1,198 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package extensions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestHistoryStore(t *testing.T) {
+	store := NewHistoryStore(t.TempDir())
+	project := &types.Project{Name: "shop", Services: types.Services{"web": {Name: "web", Image: "web:1"}}}
+
+	first, err := store.Record(project, "first", "", []api.ContainerSummary{
+		{Service: "web", Labels: map[string]string{api.ConfigHashLabel: "abc"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "v1", first.Version)
+	assert.Equal(t, map[string]string{"web": "abc"}, first.ConfigHashes)
+
+	project.Services["web"] = types.ServiceConfig{Name: "web", Image: "web:2"}
+	second, err := store.Record(project, "second", "alice", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", second.Version)
+
+	history, err := store.Load("shop")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	plan, err := PlanRollback(project, nil, &history[0], nil)
+	require.NoError(t, err)
+	assert.Equal(t, []ServiceRollback{{Service: "web", From: "web:2", To: "web:1"}}, plan)
+}
+
+func TestRollbackToRecordedImageID(t *testing.T) {
+	store := NewHistoryStore(t.TempDir())
+	project := &types.Project{Name: "shop", Services: types.Services{"web": {Name: "web", Image: "web:latest"}}}
+	first, err := store.Record(project, "first", "", []api.ContainerSummary{
+		{Service: "web", Image: "web:latest", Labels: map[string]string{api.ImageDigestLabel: "sha256:111"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"web": "sha256:111"}, first.ImageIDs)
+
+	// web:latest was rebuilt, the image recorded by the first version is not the tag anymore
+	running := []api.ContainerSummary{
+		{Service: "web", Image: "web:latest", Labels: map[string]string{api.ImageDigestLabel: "sha256:222"}},
+	}
+	_, err = store.Record(project, "second", "", running)
+	require.NoError(t, err)
+
+	plan, err := PlanRollback(project, nil, first, running)
+	require.NoError(t, err)
+	assert.Equal(t, []ServiceRollback{{
+		Service: "web", From: "web:latest", To: "web:latest", FromImageID: "sha256:222", ToImageID: "sha256:111",
+	}}, plan)
+	assert.True(t, plan[0].Changed(), "the tag is the same but the image is not")
+
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	backend.EXPECT().Up(gomock.Any(), gomock.Cond(func(p *types.Project) bool {
+		return p.Services["web"].Image == "sha256:111"
+	}), gomock.Any()).Return(nil)
+	require.NoError(t, Rollback(context.Background(), backend, project, plan, RollbackOptions{}))
+
+	rolledBack, err := store.RecordRollback("shop", first, "rolled back", nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"web": "sha256:111"}, rolledBack.ImageIDs)
+}
+
+func TestHistoryStoreFailedDeploy(t *testing.T) {
+	store := NewHistoryStore(t.TempDir())
+	project := &types.Project{Name: "shop", Services: types.Services{"web": {Name: "web", Image: "web:1"}}}
+	deployed, err := store.Record(project, "deployed", "", nil)
+	require.NoError(t, err)
+
+	project.Services["web"] = types.ServiceConfig{Name: "web", Image: "web:2"}
+	failed, err := store.RecordFailure(project, "failed", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, VersionFailed, failed.Status)
+
+	history, err := store.Load("shop")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", LatestDeployedVersion(history).Version)
+	assert.Len(t, DeployedVersions(history), 1)
+
+	rolledBack, err := store.RecordRollback("shop", deployed, "rolled back", []api.ContainerSummary{
+		{Service: "web", Labels: map[string]string{api.ConfigHashLabel: "def"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "v3", rolledBack.Version)
+	assert.Equal(t, map[string]string{"web": "web:1"}, rolledBack.Services)
+	assert.Equal(t, map[string]string{"web": "def"}, rolledBack.ConfigHashes)
+	assert.Empty(t, rolledBack.Status)
+
+	// a failed deployment is not the base of the next recorded version
+	project.Services["api"] = types.ServiceConfig{Name: "api", Image: "api:1"}
+	delete(project.Services, "web")
+	next, err := store.Record(project, "partial", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"web": "web:1", "api": "api:1"}, next.Services)
+}
+
+func TestPruneHistory(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	version := func(name string, age time.Duration, status string) VersionInfo {
+		return VersionInfo{Version: name, CreatedAt: now.Add(-age).Format(VersionTimeLayout), Status: status}
+	}
+	day := 24 * time.Hour
+	history := []VersionInfo{
+		version("v1", 40*day, ""),
+		version("v2", 20*day, ""),
+		version("v3", 10*day, ""),
+		version("v4", 5*day, ""),
+		version("v5", day, VersionFailed),
+	}
+	names := func(versions []VersionInfo) []string {
+		var out []string
+		for _, v := range versions {
+			out = append(out, v.Version)
+		}
+		return out
+	}
+
+	kept, pruned := PruneHistory(history, HistoryRetention{}, now)
+	assert.Len(t, kept, 5)
+	assert.Empty(t, pruned)
+
+	// v4 is the deployed version, kept even though it is not among the newest
+	kept, pruned = PruneHistory(history, HistoryRetention{Keep: 1}, now)
+	assert.Equal(t, []string{"v4", "v5"}, names(kept))
+	assert.Equal(t, []string{"v1", "v2", "v3"}, names(pruned))
+
+	kept, _ = PruneHistory(history, HistoryRetention{KeepDays: 15}, now)
+	assert.Equal(t, []string{"v3", "v4", "v5"}, names(kept))
+
+	kept, _ = PruneHistory(history, HistoryRetention{Keep: 4, KeepDays: 30}, now)
+	assert.Equal(t, []string{"v2", "v3", "v4", "v5"}, names(kept))
+
+	// the newest version is kept even when expired, the next version is numbered after it
+	kept, _ = PruneHistory(history, HistoryRetention{KeepDays: 1}, now.Add(30*day))
+	assert.Equal(t, []string{"v4", "v5"}, names(kept))
+	assert.Equal(t, "the 3 newest versions and versions from the last 7 days", HistoryRetention{Keep: 3, KeepDays: 7}.String())
+}
+
+func TestHistoryStoreRetention(t *testing.T) {
+	store := NewHistoryStore(t.TempDir())
+	project := &types.Project{Name: "shop", Services: types.Services{"web": {Name: "web", Image: "web:1"}}}
+	for range 3 {
+		_, err := store.Record(project, "deployed", "", nil)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, store.SaveRetention("shop", HistoryRetention{Keep: 2}))
+	retention, err := store.LoadRetention("shop")
+	require.NoError(t, err)
+	assert.Equal(t, HistoryRetention{Keep: 2}, retention)
+
+	pruned, err := store.Prune("shop", retention)
+	require.NoError(t, err)
+	require.Len(t, pruned, 1)
+	assert.Equal(t, "v1", pruned[0].Version)
+
+	// the policy applies when a version is recorded
+	latest, err := store.Record(project, "deployed", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "v4", latest.Version)
+	history, err := store.Load("shop")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "v3", history[0].Version)
+
+	require.NoError(t, store.SaveRetention("shop", HistoryRetention{}))
+	retention, err = store.LoadRetention("shop")
+	require.NoError(t, err)
+	assert.True(t, retention.IsZero())
+}
@@ -0,0 +1,153 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package extensions
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/compose-spec/compose-go/v2/types"
+
+	"github.com/docker/compose/v5/pkg/api"
+)
+
+// ServiceRollback describes the image switch applied to a single service
+type ServiceRollback struct {
+	Service string `json:"service"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	// FromImageID and ToImageID are the IDs of the From and To images, when known. The service
+	// is switched to the image ID, as the To tag may have been moved since it was deployed.
+	FromImageID string `json:"fromImageID,omitempty"`
+	ToImageID   string `json:"toImageID,omitempty"`
+}
+
+// Image returns the image the service is switched to: its ID when known, its reference otherwise
+func (r ServiceRollback) Image() string {
+	if r.ToImageID != "" {
+		return r.ToImageID
+	}
+	return r.To
+}
+
+// Changed tells whether the service is switched to another image than the one it runs
+func (r ServiceRollback) Changed() bool {
+	if r.FromImageID != "" && r.ToImageID != "" {
+		return r.FromImageID != r.ToImageID
+	}
+	return r.From != r.To
+}
+
+// PlanRollback resolves the image each service must be switched to, by ID when the target version
+// recorded it. Only the requested services are rolled back (all services recorded in the target
+// version when none are requested), and a requested service without a recorded image in the
+// target version is an error.
+func PlanRollback(project *types.Project, services []string, target *VersionInfo, containers []api.ContainerSummary) ([]ServiceRollback, error) {
+	if len(services) == 0 {
+		for name := range target.Services {
+			if _, ok := project.Services[name]; ok {
+				services = append(services, name)
+			}
+		}
+		sort.Strings(services)
+	}
+
+	var plan []ServiceRollback
+	for _, name := range services {
+		service, ok := project.Services[name]
+		if !ok {
+			return nil, fmt.Errorf("no such service: %s", name)
+		}
+		image, ok := target.Services[name]
+		if !ok {
+			return nil, fmt.Errorf("service %q has no recorded history at version %s", name, target.Version)
+		}
+		step := ServiceRollback{
+			Service:   name,
+			From:      api.GetImageNameOrDefault(service, project.Name),
+			To:        image,
+			ToImageID: target.ImageIDs[name],
+		}
+		for _, c := range containers {
+			if c.Service == name {
+				step.From = c.Image
+				step.FromImageID = c.Labels[api.ImageDigestLabel]
+				break
+			}
+		}
+		plan = append(plan, step)
+	}
+	return plan, nil
+}
+
+// RollbackOptions configures Rollback
+type RollbackOptions struct {
+	// BlueGreen switches all the services at once, instead of one by one
+	BlueGreen bool
+	// PreserveData makes the recreated containers inherit the volumes of the previous ones
+	PreserveData bool
+	// Out receives the progress messages, discarded when unset
+	Out io.Writer
+}
+
+// Rollback switches the services of the plan to their recorded image
+func Rollback(ctx context.Context, backend api.Compose, project *types.Project, plan []ServiceRollback, opts RollbackOptions) error {
+	out := opts.Out
+	if out == nil {
+		out = io.Discard
+	}
+	for _, step := range plan {
+		service := project.Services[step.Service]
+		service.Image = step.Image()
+		// the recorded image must be used as-is, not rebuilt from the current sources
+		service.Build = nil
+		project.Services[step.Service] = service
+	}
+
+	if opts.BlueGreen {
+		_, _ = fmt.Fprintln(out, "Performing blue-green rollback")
+		services := make([]string, 0, len(plan))
+		for _, step := range plan {
+			services = append(services, step.Service)
+		}
+		return backend.Up(ctx, project, rollbackUpOptions(project, services, opts.PreserveData))
+	}
+	for _, step := range plan {
+		_, _ = fmt.Fprintf(out, "Rolling back service: %s to %s\n", step.Service, step.To)
+		if err := backend.Up(ctx, project, rollbackUpOptions(project, []string{step.Service}, opts.PreserveData)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rollbackUpOptions(project *types.Project, services []string, preserveData bool) api.UpOptions {
+	return api.UpOptions{
+		Create: api.CreateOptions{
+			Services:             services,
+			Recreate:             api.RecreateForce,
+			RecreateDependencies: api.RecreateNever,
+			Inherit:              preserveData,
+		},
+		Start: api.StartOptions{
+			Project:  project,
+			Services: services,
+		},
+	}
+}
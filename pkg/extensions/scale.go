@@ -0,0 +1,182 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package extensions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+
+	"github.com/docker/compose/v5/pkg/api"
+)
+
+// DeclaredReplicas requests a service to be scaled to the replicas declared in the compose file
+const DeclaredReplicas = -1
+
+// ScaleOptions configures Scale
+type ScaleOptions struct {
+	// NoDeps doesn't start the services the scaled services depend on
+	NoDeps bool
+	// Out receives the progress messages, discarded when unset
+	Out io.Writer
+	// Events is notified of the scaling of each service, like the progress events of compose
+	// commands, when set
+	Events api.EventProcessor
+	// ToZeroGrace is the time the containers of services scaled to 0 are given to stop gracefully
+	// before being killed, their stop_grace_period when zero
+	ToZeroGrace time.Duration
+}
+
+// ScalingEvent reports a service being scaled, Current and Total hold the running and target replicas
+func ScalingEvent(service string, from, to int) api.Resource {
+	return api.Resource{
+		ID:      "Service " + service,
+		Status:  api.Working,
+		Text:    "Scaling",
+		Details: fmt.Sprintf("%d -> %d replicas", from, to),
+		Current: int64(from),
+		Total:   int64(to),
+	}
+}
+
+// ScaledEvent reports a service scaled to its target replicas
+func ScaledEvent(service string, replicas int) api.Resource {
+	return api.Resource{
+		ID:      "Service " + service,
+		Status:  api.Done,
+		Text:    "Scaled",
+		Details: fmt.Sprintf("%d replicas", replicas),
+		Current: int64(replicas),
+		Total:   int64(replicas),
+	}
+}
+
+// ScaleErrorEvent reports a service which failed to scale
+func ScaleErrorEvent(service string, err error) api.Resource {
+	return api.Resource{
+		ID:      "Service " + service,
+		Status:  api.Error,
+		Text:    api.StatusError,
+		Details: err.Error(),
+	}
+}
+
+// Scale sets the number of replicas of the services. A count of DeclaredReplicas scales the
+// service to its deploy.replicas (or scale) attribute.
+func Scale(ctx context.Context, backend api.Compose, project *types.Project, replicas map[string]int, opts ScaleOptions) error {
+	out := opts.Out
+	if out == nil {
+		out = io.Discard
+	}
+	services := slices.Sorted(maps.Keys(replicas))
+	if opts.NoDeps {
+		var err error
+		if project, err = project.WithSelectedServices(services, types.IgnoreDependencies); err != nil {
+			return err
+		}
+	}
+
+	// the current replicas are only reported, failing to list them doesn't prevent scaling
+	containers, listErr := backend.Ps(ctx, project.Name, api.PsOptions{})
+	targets := map[string]int{}
+	for _, name := range services {
+		service, err := project.GetService(name)
+		if err != nil {
+			return err
+		}
+		value := replicas[name]
+		if value == DeclaredReplicas {
+			if value, err = ServiceDeclaredReplicas(service); err != nil {
+				return err
+			}
+		}
+		if listErr == nil {
+			current := CountRunningReplicas(containers, project.Name, name)
+			_, _ = fmt.Fprintf(out, "Scaling %s from %d to %d replicas\n", name, current, value)
+			if opts.Events != nil {
+				opts.Events.On(ScalingEvent(name, current, value))
+			}
+		}
+		service.SetScale(value)
+		project.Services[name] = service
+		targets[name] = value
+	}
+
+	// services scaled to 0 are scaled apart, as the grace period only applies to them
+	var others, toZero []string
+	for _, name := range services {
+		if opts.ToZeroGrace > 0 && targets[name] == 0 {
+			toZero = append(toZero, name)
+		} else {
+			others = append(others, name)
+		}
+	}
+	var errs []error
+	if len(others) > 0 {
+		errs = append(errs, scaleServices(ctx, backend, project, api.ScaleOptions{Services: others}, targets, opts.Events))
+	}
+	if len(toZero) > 0 {
+		grace := opts.ToZeroGrace
+		_, _ = fmt.Fprintf(out, "Stopping %s gracefully, within %s\n", strings.Join(toZero, ", "), grace)
+		errs = append(errs, scaleServices(ctx, backend, project, api.ScaleOptions{Services: toZero, Timeout: &grace}, targets, opts.Events))
+	}
+	return errors.Join(errs...)
+}
+
+// scaleServices applies the scale of the services, reporting the outcome to events when set
+func scaleServices(ctx context.Context, backend api.Compose, project *types.Project, options api.ScaleOptions, targets map[string]int, events api.EventProcessor) error {
+	err := backend.Scale(ctx, project, options)
+	if events != nil {
+		for _, name := range options.Services {
+			if err != nil {
+				events.On(ScaleErrorEvent(name, err))
+			} else {
+				events.On(ScaledEvent(name, targets[name]))
+			}
+		}
+	}
+	return err
+}
+
+// ServiceDeclaredReplicas returns the replicas declared in the compose file for a service
+func ServiceDeclaredReplicas(service types.ServiceConfig) (int, error) {
+	if service.Deploy != nil && service.Deploy.Replicas != nil {
+		return *service.Deploy.Replicas, nil
+	}
+	if service.Scale != nil {
+		return *service.Scale, nil
+	}
+	return 0, fmt.Errorf("no replicas declared for service %s, use %s=REPLICAS", service.Name, service.Name)
+}
+
+// CountRunningReplicas counts the running containers of a project service, identified by their labels
+func CountRunningReplicas(containers []api.ContainerSummary, projectName, service string) int {
+	count := 0
+	for _, c := range containers {
+		if c.State == "running" && c.Labels[api.ProjectLabel] == projectName && c.Labels[api.ServiceLabel] == service {
+			count++
+		}
+	}
+	return count
+}
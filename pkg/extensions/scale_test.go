@@ -0,0 +1,121 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package extensions
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestScale(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	replicas := 3
+	project := &types.Project{Name: "shop", Services: types.Services{
+		"web":    {Name: "web", Deploy: &types.DeployConfig{Replicas: &replicas}},
+		"worker": {Name: "worker"},
+	}}
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{}).Return(nil, nil).Times(2)
+	backend.EXPECT().Scale(gomock.Any(), project, api.ScaleOptions{Services: []string{"web", "worker"}}).Return(nil)
+
+	require.NoError(t, Scale(context.Background(), backend, project, map[string]int{"web": DeclaredReplicas, "worker": 2}, ScaleOptions{}))
+	assert.Equal(t, 3, *project.Services["web"].Scale)
+	assert.Equal(t, 2, *project.Services["worker"].Scale)
+
+	// services scaled to 0 get the grace period, the others their stop_grace_period
+	grace := 45 * time.Second
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{}).Return(nil, nil)
+	backend.EXPECT().Scale(gomock.Any(), project, api.ScaleOptions{Services: []string{"worker"}}).Return(nil)
+	backend.EXPECT().Scale(gomock.Any(), project, api.ScaleOptions{Services: []string{"web"}, Timeout: &grace}).Return(nil)
+	require.NoError(t, Scale(context.Background(), backend, project, map[string]int{"web": 0, "worker": 1}, ScaleOptions{ToZeroGrace: grace}))
+	assert.Equal(t, 0, *project.Services["web"].Scale)
+
+	project = &types.Project{Name: "shop", Services: types.Services{"worker": {Name: "worker"}}}
+	err := Scale(context.Background(), backend, project, map[string]int{"worker": DeclaredReplicas}, ScaleOptions{})
+	assert.ErrorContains(t, err, "no replicas declared for service worker")
+}
+
+type recordedEvents struct {
+	events []api.Resource
+}
+
+func (r *recordedEvents) Start(context.Context, string) {}
+
+func (r *recordedEvents) On(events ...api.Resource) {
+	r.events = append(r.events, events...)
+}
+
+func (r *recordedEvents) Done(string, bool) {}
+
+func TestScaleEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	project := &types.Project{Name: "shop", Services: types.Services{"web": {Name: "web"}}}
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{}).Return([]api.ContainerSummary{
+		{State: "running", Labels: map[string]string{api.ProjectLabel: "shop", api.ServiceLabel: "web"}},
+	}, nil).Times(2)
+	backend.EXPECT().Scale(gomock.Any(), project, api.ScaleOptions{Services: []string{"web"}}).Return(nil)
+	backend.EXPECT().Scale(gomock.Any(), project, api.ScaleOptions{Services: []string{"web"}}).Return(errors.New("boom"))
+
+	recorder := &recordedEvents{}
+	require.NoError(t, Scale(context.Background(), backend, project, map[string]int{"web": 3}, ScaleOptions{Events: recorder}))
+	assert.Equal(t, []api.Resource{ScalingEvent("web", 1, 3), ScaledEvent("web", 3)}, recorder.events)
+	assert.Equal(t, "1 -> 3 replicas", recorder.events[0].Details)
+	assert.Equal(t, int64(3), recorder.events[1].Total)
+
+	recorder.events = nil
+	require.Error(t, Scale(context.Background(), backend, project, map[string]int{"web": 0}, ScaleOptions{Events: recorder}))
+	require.Len(t, recorder.events, 2)
+	assert.Equal(t, api.Error, recorder.events[1].Status)
+	assert.Equal(t, "boom", recorder.events[1].Details)
+}
+
+func TestCountRunningReplicas(t *testing.T) {
+	web := map[string]string{api.ProjectLabel: "shop", api.ServiceLabel: "web"}
+	containers := []api.ContainerSummary{
+		{ID: "1", State: "running", Labels: web},
+		{ID: "2", State: "running", Labels: web},
+		{ID: "3", State: "exited", Labels: web},
+		{ID: "4", State: "running", Labels: map[string]string{api.ProjectLabel: "shop", api.ServiceLabel: "db"}},
+		{ID: "5", State: "running", Labels: map[string]string{api.ProjectLabel: "other", api.ServiceLabel: "web"}},
+	}
+	assert.Equal(t, 2, CountRunningReplicas(containers, "shop", "web"))
+	assert.Equal(t, 1, CountRunningReplicas(containers, "shop", "db"))
+	assert.Equal(t, 0, CountRunningReplicas(containers, "shop", "worker"))
+}
+
+func TestServiceDeclaredReplicas(t *testing.T) {
+	replicas, scale := 4, 2
+	declared, err := ServiceDeclaredReplicas(types.ServiceConfig{Name: "web", Deploy: &types.DeployConfig{Replicas: &replicas}, Scale: &scale})
+	require.NoError(t, err)
+	assert.Equal(t, 4, declared)
+	declared, err = ServiceDeclaredReplicas(types.ServiceConfig{Name: "web", Scale: &scale})
+	require.NoError(t, err)
+	assert.Equal(t, 2, declared)
+	_, err = ServiceDeclaredReplicas(types.ServiceConfig{Name: "web"})
+	assert.ErrorContains(t, err, "no replicas declared for service web, use web=REPLICAS")
+}
@@ -0,0 +1,451 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package extensions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Secret is a secret of the store
+type Secret struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Fields holds the variables of a secret created from an env file, Value is empty then
+	Fields    map[string]string `json:"fields,omitempty"`
+	CreatedAt string            `json:"createdAt"`
+	UpdatedAt string            `json:"updatedAt"`
+	Status    string            `json:"status"`
+	// Version is incremented by every rotation, secrets stored before versioning are version 1
+	Version int `json:"version,omitempty"`
+	// TTL is how long a value is valid before it must be rotated, e.g. "720h"
+	TTL string `json:"ttl,omitempty"`
+	// Previous and PreviousFields are the version replaced by the last rotation, when kept. It
+	// is valid until PreviousUntil, or until the next rotation when unset.
+	Previous       string            `json:"previous,omitempty"`
+	PreviousFields map[string]string `json:"previousFields,omitempty"`
+	PreviousUntil  string            `json:"previousUntil,omitempty"`
+}
+
+// CurrentVersion returns the version number of the current value
+func (s Secret) CurrentVersion() int {
+	return max(s.Version, 1)
+}
+
+// HasPrevious tells whether the version replaced by the last rotation was kept
+func (s Secret) HasPrevious() bool {
+	return s.Previous != "" || len(s.PreviousFields) > 0
+}
+
+// PreviousVersion returns the version replaced by the last rotation, if kept
+func (s Secret) PreviousVersion() (Secret, error) {
+	if !s.HasPrevious() {
+		return Secret{}, fmt.Errorf("secret '%s' has no previous version, rotate it with --keep-previous", s.Name)
+	}
+	previous := s
+	previous.Value = s.Previous
+	previous.Fields = s.PreviousFields
+	previous.Version = s.CurrentVersion() - 1
+	previous.Previous, previous.PreviousFields, previous.PreviousUntil = "", nil, ""
+	return previous, nil
+}
+
+// RotationDue tells whether the secret is past its TTL
+func (s Secret) RotationDue(now time.Time) (bool, error) {
+	if s.TTL == "" {
+		return false, nil
+	}
+	ttl, err := time.ParseDuration(s.TTL)
+	if err != nil {
+		return false, fmt.Errorf("invalid TTL %q of secret '%s': %v", s.TTL, s.Name, err)
+	}
+	updated, err := time.ParseInLocation(SecretTimeLayout, s.UpdatedAt, time.Local)
+	if err != nil {
+		return false, fmt.Errorf("invalid update time of secret '%s': %v", s.Name, err)
+	}
+	return !now.Before(updated.Add(ttl)), nil
+}
+
+// InGracePeriod tells whether the previous version of the secret is kept for a grace period
+// which is not over yet
+func (s Secret) InGracePeriod(now time.Time) bool {
+	if !s.HasPrevious() || s.PreviousUntil == "" {
+		return false
+	}
+	until, err := time.ParseInLocation(SecretTimeLayout, s.PreviousUntil, time.Local)
+	return err == nil && now.Before(until)
+}
+
+// Content returns the secret value, or its fields in env file format for a multi-field secret,
+// quoted to be read back unchanged
+func (s Secret) Content() string {
+	if len(s.Fields) == 0 {
+		return s.Value
+	}
+	var b strings.Builder
+	for _, key := range slices.Sorted(maps.Keys(s.Fields)) {
+		fmt.Fprintf(&b, "%s=%s\n", key, QuoteEnvValue(s.Fields[key]))
+	}
+	return b.String()
+}
+
+// Field returns a single field of a multi-field secret
+func (s Secret) Field(key string) (string, error) {
+	if len(s.Fields) == 0 {
+		return "", fmt.Errorf("secret '%s' has no fields, it was not created from an env file", s.Name)
+	}
+	value, ok := s.Fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret '%s' has no field '%s'", s.Name, key)
+	}
+	return value, nil
+}
+
+// SecretTimeLayout is the timestamp format of the secrets CreatedAt and UpdatedAt
+const SecretTimeLayout = "2006-01-02 15:04:05"
+
+// SecretFilesNamespace is the directory of the store holding the files published for compose,
+// it can't be used as a namespace
+const SecretFilesNamespace = "files"
+
+// SecretStore is a local secret store, holding one JSON file per secret. Names can be grouped
+// in namespaces using "/", e.g. "prod/db_password", which are stored as nested directories.
+type SecretStore struct {
+	Dir string
+}
+
+// NewSecretStore returns the secret store located in dir
+func NewSecretStore(dir string) *SecretStore {
+	return &SecretStore{Dir: dir}
+}
+
+// DefaultSecretStore returns the secret store used by the secret command
+func DefaultSecretStore() *SecretStore {
+	return NewSecretStore(StateDir("secrets"))
+}
+
+// FilesDir returns the directory holding the files published for compose
+func (s *SecretStore) FilesDir() string {
+	return filepath.Join(s.Dir, SecretFilesNamespace)
+}
+
+// File returns the store file of a secret
+func (s *SecretStore) File(name string) (string, error) {
+	segments := strings.Split(name, "/")
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." || strings.Contains(segment, `\`) {
+			return "", fmt.Errorf("invalid secret name %q", name)
+		}
+	}
+	if len(segments) > 1 && segments[0] == SecretFilesNamespace {
+		return "", fmt.Errorf("invalid secret name %q, namespace %q is reserved", name, SecretFilesNamespace)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(name)+".json"), nil
+}
+
+// List returns the stored secrets across all namespaces
+func (s *SecretStore) List() ([]Secret, error) {
+	var secrets []Secret
+	err := filepath.WalkDir(s.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path == s.FilesDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".json" {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Dir, path)
+		if err != nil {
+			return err
+		}
+		secret, err := s.Get(filepath.ToSlash(strings.TrimSuffix(rel, ".json")))
+		if err != nil {
+			return err
+		}
+		secrets = append(secrets, *secret)
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret store: %v", err)
+	}
+	return secrets, nil
+}
+
+// FilterSecretsByPrefix keeps the secrets whose name starts with prefix, e.g. a "prod/" namespace
+func FilterSecretsByPrefix(secrets []Secret, prefix string) []Secret {
+	var filtered []Secret
+	for _, secret := range secrets {
+		if strings.HasPrefix(secret.Name, prefix) {
+			filtered = append(filtered, secret)
+		}
+	}
+	return filtered
+}
+
+// Get reads a secret
+func (s *SecretStore) Get(name string) (*Secret, error) {
+	file, err := s.File(name)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("secret '%s' not found", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret '%s': %v", name, err)
+	}
+	var secret Secret
+	if err := json.Unmarshal(content, &secret); err != nil {
+		return nil, fmt.Errorf("failed to parse secret '%s': %v", name, err)
+	}
+	return &secret, nil
+}
+
+// Write stores a secret as-is, replacing any previous value
+func (s *SecretStore) Write(secret Secret) error {
+	file, err := s.File(secret.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return fmt.Errorf("failed to create secret store: %v", err)
+	}
+	content, err := json.MarshalIndent(secret, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, content, 0o600); err != nil {
+		return fmt.Errorf("failed to write secret '%s': %v", secret.Name, err)
+	}
+	return nil
+}
+
+// Save creates a secret, either with a single value or with the fields of an env file
+func (s *SecretStore) Save(name, value string, fields map[string]string) error {
+	if _, err := s.Get(name); err == nil {
+		return fmt.Errorf("secret '%s' already exists, use --rotate to change its value", name)
+	}
+	now := time.Now().Format(SecretTimeLayout)
+	return s.Write(Secret{
+		Name:      name,
+		Value:     value,
+		Fields:    fields,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Status:    "active",
+		Version:   1,
+	})
+}
+
+// Rotate replaces the value, or fields, of an existing secret
+func (s *SecretStore) Rotate(name, value string, fields map[string]string) error {
+	return s.rotate(name, value, fields, false, 0)
+}
+
+// RotateKeepingPrevious replaces the value, or fields, of an existing secret, keeping the
+// replaced version as the previous one for the grace period, or until the next rotation when
+// zero, so its consumers can switch over
+func (s *SecretStore) RotateKeepingPrevious(name, value string, fields map[string]string, grace time.Duration) error {
+	return s.rotate(name, value, fields, true, grace)
+}
+
+func (s *SecretStore) rotate(name, value string, fields map[string]string, keep bool, grace time.Duration) error {
+	secret, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	secret.Previous, secret.PreviousFields, secret.PreviousUntil = "", nil, ""
+	if keep {
+		secret.Previous, secret.PreviousFields = secret.Value, secret.Fields
+		if grace > 0 {
+			secret.PreviousUntil = now.Add(grace).Format(SecretTimeLayout)
+		}
+	}
+	secret.Value = value
+	secret.Fields = fields
+	secret.Version = secret.CurrentVersion() + 1
+	secret.UpdatedAt = now.Format(SecretTimeLayout)
+	return s.Write(*secret)
+}
+
+// RollbackValue promotes the previous version of a secret back to current, as a new version.
+// The replaced version is kept as the previous one so the rollback can be undone. A previous
+// version whose grace period is over is no longer valid and can't be promoted.
+func (s *SecretStore) RollbackValue(name string) (*Secret, error) {
+	secret, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := secret.PreviousVersion()
+	if err != nil {
+		return nil, err
+	}
+	if secret.PreviousUntil != "" && !secret.InGracePeriod(time.Now()) {
+		return nil, fmt.Errorf("the previous version of secret '%s' expired at %s, at the end of its grace period", name, secret.PreviousUntil)
+	}
+	secret.Previous, secret.PreviousFields, secret.PreviousUntil = secret.Value, secret.Fields, ""
+	secret.Value, secret.Fields = previous.Value, previous.Fields
+	secret.Version = secret.CurrentVersion() + 1
+	secret.UpdatedAt = time.Now().Format(SecretTimeLayout)
+	return secret, s.Write(*secret)
+}
+
+// SetTTL sets how long the values of a secret are valid, zero meaning forever
+func (s *SecretStore) SetTTL(name string, ttl time.Duration) error {
+	secret, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	secret.TTL = ""
+	if ttl > 0 {
+		secret.TTL = ttl.String()
+	}
+	return s.Write(*secret)
+}
+
+// Remove deletes a secret along with the files published for compose
+func (s *SecretStore) Remove(name string) error {
+	file, err := s.File(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("secret '%s' not found", name)
+	} else if err != nil {
+		return fmt.Errorf("failed to remove secret '%s': %v", name, err)
+	}
+	removeEmptyDirs(filepath.Dir(file), s.Dir)
+
+	// drop the copies published by --as-docker-secret or --write-compose, if any
+	files := filepath.Join(s.FilesDir(), filepath.FromSlash(name))
+	for _, file := range []string{files, files + ".env"} {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove secret file '%s': %v", name, err)
+		}
+	}
+	if err := os.RemoveAll(files + ".fields"); err != nil {
+		return fmt.Errorf("failed to remove secret files '%s': %v", name, err)
+	}
+	removeEmptyDirs(filepath.Dir(files), s.FilesDir())
+	return nil
+}
+
+// removeEmptyDirs removes the namespace directories left empty, up to root
+func removeEmptyDirs(dir, root string) {
+	for dir != root && strings.HasPrefix(dir, root) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// SecretAuditLogName is the file of the store holding the audit log, one JSON record per line
+const SecretAuditLogName = "audit.log"
+
+// SecretAuditRecord is an operation run against the store. It never holds the secret value.
+type SecretAuditRecord struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Secret    string    `json:"secret"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+}
+
+// Audit results of SecretAuditRecord
+const (
+	SecretAuditSuccess = "success"
+	SecretAuditFailure = "failure"
+)
+
+// AuditFile returns the audit log of the store
+func (s *SecretStore) AuditFile() string {
+	return filepath.Join(s.Dir, SecretAuditLogName)
+}
+
+// Audit appends the outcome of an operation on a secret to the audit log
+func (s *SecretStore) Audit(operation, name, actor string, opErr error) error {
+	record := SecretAuditRecord{
+		Time:      time.Now().UTC(),
+		Operation: operation,
+		Secret:    name,
+		Result:    SecretAuditSuccess,
+		Actor:     actor,
+	}
+	if opErr != nil {
+		record.Result = SecretAuditFailure
+		record.Error = opErr.Error()
+	}
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create secret store: %v", err)
+	}
+	f, err := os.OpenFile(s.AuditFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open secret audit log: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Write(append(content, '\n')); err != nil {
+		return fmt.Errorf("failed to write secret audit log: %v", err)
+	}
+	return nil
+}
+
+// AuditLog reads the audit log, oldest record first
+func (s *SecretStore) AuditLog() ([]SecretAuditRecord, error) {
+	content, err := os.ReadFile(s.AuditFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret audit log: %v", err)
+	}
+	var records []SecretAuditRecord
+	for i, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var record SecretAuditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, fmt.Errorf("failed to parse secret audit log line %d: %v", i+1, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,188 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package extensions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/dotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretStore(t *testing.T) {
+	store := NewSecretStore(t.TempDir())
+
+	require.NoError(t, store.Save("prod/db_password", "s3cret", nil))
+	require.NoError(t, store.Save("api_env", "", map[string]string{"TOKEN": "t", "URL": "u"}))
+	assert.ErrorContains(t, store.Save("api_env", "", nil), "secret 'api_env' already exists")
+	assert.FileExists(t, filepath.Join(store.Dir, "prod", "db_password.json"))
+
+	secrets, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, secrets, 2)
+	assert.Equal(t, "TOKEN=t\nURL=u\n", secrets[0].Content())
+	assert.Equal(t, []string{"prod/db_password"}, secretNames(FilterSecretsByPrefix(secrets, "prod/")))
+
+	require.NoError(t, store.Rotate("prod/db_password", "rotated", nil))
+	secret, err := store.Get("prod/db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", secret.Value)
+
+	require.NoError(t, store.Remove("prod/db_password"))
+	assert.NoDirExists(t, filepath.Join(store.Dir, "prod"))
+	_, err = store.Get("prod/db_password")
+	assert.ErrorContains(t, err, "secret 'prod/db_password' not found")
+
+	_, err = store.File("files/db")
+	assert.ErrorContains(t, err, `namespace "files" is reserved`)
+}
+
+func TestSecretContentRoundTrip(t *testing.T) {
+	fields := map[string]string{
+		"PLAIN":     "postgres://db:5432/app",
+		"SPACED":    "two words # not a comment",
+		"QUOTED":    `it's "quoted"`,
+		"MULTILINE": "line one\nline two",
+		"DOLLAR":    "pa$$word ${HOME}",
+		"EMPTY":     "",
+	}
+	secret := Secret{Name: "app", Fields: fields}
+
+	env, err := dotenv.UnmarshalBytesWithLookup([]byte(secret.Content()), func(string) (string, bool) {
+		return "interpolated", true
+	})
+	require.NoError(t, err)
+	assert.Equal(t, fields, env)
+}
+
+func TestSecretRotationWithGrace(t *testing.T) {
+	store := NewSecretStore(t.TempDir())
+	require.NoError(t, store.Save("db_password", "first", nil))
+	require.NoError(t, store.SetTTL("db_password", time.Hour))
+
+	secret, err := store.Get("db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "1h0m0s", secret.TTL)
+	due, err := secret.RotationDue(time.Now())
+	require.NoError(t, err)
+	assert.False(t, due)
+	due, err = secret.RotationDue(time.Now().Add(2 * time.Hour))
+	require.NoError(t, err)
+	assert.True(t, due)
+
+	require.NoError(t, store.RotateKeepingPrevious("db_password", "second", nil, 10*time.Minute))
+	secret, err = store.Get("db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "second", secret.Value)
+	assert.Equal(t, "first", secret.Previous)
+	assert.Equal(t, "1h0m0s", secret.TTL)
+	assert.True(t, secret.InGracePeriod(time.Now()))
+	assert.False(t, secret.InGracePeriod(time.Now().Add(time.Hour)))
+
+	assert.Equal(t, 2, secret.CurrentVersion())
+
+	// a plain rotation ends the grace period
+	require.NoError(t, store.Rotate("db_password", "third", nil))
+	secret, err = store.Get("db_password")
+	require.NoError(t, err)
+	assert.Empty(t, secret.Previous)
+	assert.False(t, secret.InGracePeriod(time.Now()))
+	assert.Equal(t, 3, secret.CurrentVersion())
+
+	_, err = Secret{Name: "db", TTL: "soon"}.RotationDue(time.Now())
+	assert.ErrorContains(t, err, `invalid TTL "soon" of secret 'db'`)
+}
+
+func TestSecretPreviousVersion(t *testing.T) {
+	store := NewSecretStore(t.TempDir())
+	require.NoError(t, store.Save("api_env", "", map[string]string{"TOKEN": "old"}))
+	_, err := store.RollbackValue("api_env")
+	assert.ErrorContains(t, err, "secret 'api_env' has no previous version")
+
+	require.NoError(t, store.RotateKeepingPrevious("api_env", "", map[string]string{"TOKEN": "new"}, 0))
+	secret, err := store.Get("api_env")
+	require.NoError(t, err)
+	assert.Equal(t, 2, secret.CurrentVersion())
+	assert.False(t, secret.InGracePeriod(time.Now()))
+	previous, err := secret.PreviousVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 1, previous.Version)
+	assert.Equal(t, map[string]string{"TOKEN": "old"}, previous.Fields)
+
+	secret, err = store.RollbackValue("api_env")
+	require.NoError(t, err)
+	assert.Equal(t, 3, secret.CurrentVersion())
+	assert.Equal(t, map[string]string{"TOKEN": "old"}, secret.Fields)
+	assert.Equal(t, map[string]string{"TOKEN": "new"}, secret.PreviousFields)
+	stored, err := store.Get("api_env")
+	require.NoError(t, err)
+	assert.Equal(t, *secret, *stored)
+
+	require.NoError(t, store.RotateKeepingPrevious("api_env", "", map[string]string{"TOKEN": "newer"}, time.Hour))
+	_, err = store.RollbackValue("api_env")
+	require.NoError(t, err)
+
+	secret, err = store.Get("api_env")
+	require.NoError(t, err)
+	secret.PreviousUntil = time.Now().Add(-time.Minute).Format(SecretTimeLayout)
+	require.NoError(t, store.Write(*secret))
+	_, err = store.RollbackValue("api_env")
+	assert.ErrorContains(t, err, "the previous version of secret 'api_env' expired at")
+}
+
+func secretNames(secrets []Secret) []string {
+	var names []string
+	for _, secret := range secrets {
+		names = append(names, secret.Name)
+	}
+	return names
+}
+
+func TestSecretAuditLog(t *testing.T) {
+	store := NewSecretStore(t.TempDir())
+
+	records, err := store.AuditLog()
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	require.NoError(t, store.Save("db_password", "s3cret", nil))
+	require.NoError(t, store.Audit("create", "db_password", "alice", nil))
+	require.NoError(t, store.Audit("show", "missing", "", errors.New("secret 'missing' not found")))
+
+	records, err = store.AuditLog()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "create", records[0].Operation)
+	assert.Equal(t, SecretAuditSuccess, records[0].Result)
+	assert.Equal(t, "alice", records[0].Actor)
+	assert.Equal(t, SecretAuditFailure, records[1].Result)
+	assert.Equal(t, "secret 'missing' not found", records[1].Error)
+
+	content, err := os.ReadFile(store.AuditFile())
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "s3cret")
+
+	// the audit log is not listed as a secret
+	secrets, err := store.List()
+	require.NoError(t, err)
+	assert.Len(t, secrets, 1)
+}
@@ -0,0 +1,724 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package extensions
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	containerType "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/docker/compose/v5/pkg/api"
+)
+
+// Conflict resolution strategies of Sync, for files changed in a container since the last sync
+const (
+	// SyncConflictAsk asks SyncOptions.Ask whether to overwrite the container copy
+	SyncConflictAsk = "ask"
+	// SyncConflictLocalWins overwrites the container copy
+	SyncConflictLocalWins = "local-wins"
+	// SyncConflictContainerWins keeps the container copy
+	SyncConflictContainerWins = "container-wins"
+	// SyncConflictNewerWins keeps the most recently modified copy
+	SyncConflictNewerWins = "newer-wins"
+)
+
+// SyncOptions configures Sync
+type SyncOptions struct {
+	// Ignore lists patterns of the files not synced, in addition to the ignore of the sync rules
+	Ignore []string
+	// Replica only syncs the given replica of the service, all the running replicas when zero
+	Replica int
+	// Checksum compares the files by content with their copies in the containers, only
+	// transferring those which differ
+	Checksum bool
+	// Conflict is the strategy resolving the files changed in the containers since the last
+	// sync, detected with Checksum
+	Conflict string
+	// Ask decides with SyncConflictAsk whether a conflicting file overwrites the container
+	// copy. Conflicts are kept when unset.
+	Ask func(SyncConflict) (bool, error)
+	// DryRun reports the files which would be synced without transferring them
+	DryRun bool
+	// Timeout bounds the sync of the service when set
+	Timeout time.Duration
+	// Out receives the progress messages, discarded when unset
+	Out io.Writer
+}
+
+// SyncReplica is a running container of the synced service
+type SyncReplica struct {
+	Number int
+	ID     string
+	Name   string
+}
+
+// SyncFile is a local file to be copied into the service containers
+type SyncFile struct {
+	HostPath      string
+	ContainerPath string
+	Size          int64
+	ModTime       time.Time
+	// Checksum is the SHA-256 of the content, only computed with SyncOptions.Checksum
+	Checksum string
+}
+
+// SyncRemoteFile is the content hash and modification time of a file in a container
+type SyncRemoteFile struct {
+	Checksum string
+	ModTime  time.Time
+}
+
+// SyncConflict is a file changed both locally and in a container since the last sync
+type SyncConflict struct {
+	File   SyncFile
+	Remote SyncRemoteFile
+}
+
+// Sync copies the files covered by the develop.watch sync rules of the service to its running
+// replicas, all at once, each replica keeping its own progress. Files are renamed into place only
+// once fully transferred, and an interrupted sync resumes from where it stopped. The outcome of
+// each replica is reported to Out, and an error is returned if any failed.
+func Sync(ctx context.Context, backend api.Compose, apiClient client.APIClient, project *types.Project, service string, opts SyncOptions) error {
+	out := opts.Out
+	if out == nil {
+		out = io.Discard
+	}
+	replicas, err := SyncReplicas(ctx, backend, project.Name, service, opts.Replica)
+	if err != nil {
+		return err
+	}
+	serviceConfig, err := project.GetService(service)
+	if err != nil {
+		return err
+	}
+	files, err := collectSyncFiles(serviceConfig, opts.Ignore)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		_, _ = fmt.Fprintln(out, "No files to sync (service has no develop.watch sync rules)")
+		return nil
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	// Planning runs a replica at a time, as resolving conflicts may prompt
+	plans := make([]*syncReplicaPlan, 0, len(replicas))
+	for _, replica := range replicas {
+		plan, err := planSyncReplica(ctx, apiClient, project.Name, service, replica, files, opts, out)
+		if err != nil {
+			return fmt.Errorf("replica %d: %w", replica.Number, err)
+		}
+		if opts.DryRun {
+			for _, f := range plan.pending {
+				_, _ = fmt.Fprintf(out, "Would sync %s -> %s (replica %d)\n", f.HostPath, f.ContainerPath, replica.Number)
+			}
+			continue
+		}
+		plans = append(plans, plan)
+	}
+	if len(plans) == 0 {
+		return nil
+	}
+
+	results := make([]syncReplicaResult, len(plans))
+	var wg sync.WaitGroup
+	for i, plan := range plans {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = plan.transfer(ctx, apiClient)
+		}()
+	}
+	wg.Wait()
+	return reportSyncReplicas(out, results, len(files))
+}
+
+// SyncReplicas returns the running replicas of the service, only the given one if replica is set
+func SyncReplicas(ctx context.Context, backend api.Compose, projectName, service string, replica int) ([]SyncReplica, error) {
+	containers, err := backend.Ps(ctx, projectName, api.PsOptions{Services: []string{service}})
+	if err != nil {
+		return nil, err
+	}
+	return selectSyncReplicas(containers, service, replica)
+}
+
+func selectSyncReplicas(containers []api.ContainerSummary, service string, replica int) ([]SyncReplica, error) {
+	var replicas []SyncReplica
+	for _, c := range containers {
+		if c.State != "running" {
+			continue
+		}
+		number, _ := strconv.Atoi(c.Labels[api.ContainerNumberLabel])
+		if replica > 0 && number != replica {
+			continue
+		}
+		replicas = append(replicas, SyncReplica{Number: number, ID: c.ID, Name: strings.TrimPrefix(c.Name, "/")})
+	}
+	if len(replicas) == 0 {
+		if replica > 0 {
+			return nil, fmt.Errorf("replica %d of service %s is not running", replica, service)
+		}
+		return nil, fmt.Errorf("no running container for service %s", service)
+	}
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].Number < replicas[j].Number })
+	return replicas, nil
+}
+
+// syncReplicaPlan is the transfer of the files a replica is missing
+type syncReplicaPlan struct {
+	replica SyncReplica
+	pending []SyncFile
+	skipped int // files transferred by an interrupted previous run
+	journal *syncJournal
+	state   *syncState // set with Checksum
+}
+
+// planSyncReplica returns the files to transfer to a replica, excluding those an interrupted sync
+// already transferred and, with Checksum, those identical in the container
+func planSyncReplica(ctx context.Context, apiClient client.APIClient, projectName, service string, replica SyncReplica, files []SyncFile, opts SyncOptions, out io.Writer) (*syncReplicaPlan, error) {
+	journal, err := loadSyncJournal(syncJournalPath(projectName, service, replica.Number))
+	if err != nil {
+		return nil, err
+	}
+	plan := &syncReplicaPlan{replica: replica, journal: journal}
+	for _, f := range files {
+		if !journal.done(f) {
+			plan.pending = append(plan.pending, f)
+		}
+	}
+	if plan.skipped = len(files) - len(plan.pending); plan.skipped > 0 {
+		_, _ = fmt.Fprintf(out, "Resuming interrupted sync of replica %d: %d of %d files already transferred\n", replica.Number, plan.skipped, len(files))
+	}
+	if opts.Checksum {
+		if plan.state, err = loadSyncState(syncStatePath(projectName, service, replica.Number)); err != nil {
+			return nil, err
+		}
+		if plan.pending, err = diffSyncChecksums(ctx, apiClient, []string{replica.ID}, plan.pending, plan.state, opts, out); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// syncReplicaResult is the outcome of the transfer to a replica
+type syncReplicaResult struct {
+	replica SyncReplica
+	synced  int
+	done    int // files in sync, including those transferred by a previous run
+	err     error
+}
+
+// transfer uploads the pending files to the replica. Each file is uploaded under a temporary name
+// and only renamed into place once fully transferred, so the running application never sees a
+// truncated file. Completed files are recorded in the journal, letting an interrupted sync pick up
+// where it stopped.
+func (p *syncReplicaPlan) transfer(ctx context.Context, apiClient client.APIClient) syncReplicaResult {
+	result := syncReplicaResult{replica: p.replica, done: p.skipped}
+	err := func() error {
+		for _, f := range p.pending {
+			if err := syncFileToContainer(ctx, apiClient, p.replica.ID, f); err != nil {
+				return err
+			}
+			if err := p.journal.record(f); err != nil {
+				return err
+			}
+			if p.state != nil {
+				p.state.synced(f)
+			}
+			result.synced++
+			result.done++
+		}
+		return nil
+	}()
+	if p.state != nil {
+		if saveErr := p.state.save(); err == nil {
+			err = saveErr
+		}
+	}
+	if err == nil {
+		err = p.journal.remove()
+	}
+	result.err = err
+	return result
+}
+
+// reportSyncReplicas prints the outcome of the sync of each replica, and returns the errors of
+// the replicas which failed
+func reportSyncReplicas(w io.Writer, results []syncReplicaResult, files int) error {
+	var errs []error
+	for _, result := range results {
+		replica := fmt.Sprintf("replica %d", result.replica.Number)
+		if result.replica.Name != "" {
+			replica += fmt.Sprintf(" (%s)", result.replica.Name)
+		}
+		if result.err != nil {
+			_, _ = fmt.Fprintf(w, "%s: sync interrupted after %d of %d files, run sync again to resume: %v\n", replica, result.done, files, result.err)
+			errs = append(errs, fmt.Errorf("%s: sync interrupted after %d of %d files: %w", replica, result.done, files, result.err))
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s: synced %d files\n", replica, result.synced)
+	}
+	return errors.Join(errs...)
+}
+
+// diffSyncChecksums compares the local files with their copies in the containers and returns those
+// to transfer: missing or different ones, and conflicting ones the Conflict strategy resolves locally
+func diffSyncChecksums(ctx context.Context, apiClient client.APIClient, containerIDs []string, files []SyncFile, state *syncState, opts SyncOptions, out io.Writer) ([]SyncFile, error) {
+	if err := state.hash(files); err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.ContainerPath)
+	}
+
+	var changed []SyncFile
+	var conflicts []SyncConflict
+	seen := map[string]bool{}
+	for _, id := range containerIDs {
+		remote, err := containerSyncChecksums(ctx, apiClient, id, paths)
+		if err != nil {
+			return nil, err
+		}
+		containerChanged, containerConflicts := planSyncChecksums(files, remote, state)
+		for _, f := range containerChanged {
+			if !seen[f.ContainerPath] {
+				seen[f.ContainerPath] = true
+				changed = append(changed, f)
+			}
+		}
+		for _, conflict := range containerConflicts {
+			if !seen[conflict.File.ContainerPath] {
+				seen[conflict.File.ContainerPath] = true
+				conflicts = append(conflicts, conflict)
+			}
+		}
+	}
+	// files identical everywhere are in sync, remember it for the conflict detection of the next runs
+	for _, f := range files {
+		if !seen[f.ContainerPath] {
+			state.synced(f)
+		}
+	}
+	if unchanged := len(files) - len(changed) - len(conflicts); unchanged > 0 {
+		_, _ = fmt.Fprintf(out, "%d of %d files unchanged\n", unchanged, len(files))
+	}
+
+	for _, conflict := range conflicts {
+		overwrite, err := resolveSyncConflict(opts, conflict, out)
+		if err != nil {
+			return nil, err
+		}
+		if overwrite {
+			changed = append(changed, conflict.File)
+		} else {
+			_, _ = fmt.Fprintf(out, "Keeping %s, changed in the container since the last sync\n", conflict.File.ContainerPath)
+		}
+	}
+	return changed, nil
+}
+
+// planSyncChecksums splits the files which differ from their copy in a container between plain
+// changes and conflicts, where the container copy also changed since it was last synced
+func planSyncChecksums(files []SyncFile, remote map[string]SyncRemoteFile, state *syncState) ([]SyncFile, []SyncConflict) {
+	var changed []SyncFile
+	var conflicts []SyncConflict
+	for _, f := range files {
+		r, ok := remote[f.ContainerPath]
+		switch {
+		case !ok:
+			changed = append(changed, f)
+		case r.Checksum == f.Checksum:
+		case state.Files[f.ContainerPath].Synced != "" && state.Files[f.ContainerPath].Synced != r.Checksum:
+			conflicts = append(conflicts, SyncConflict{File: f, Remote: r})
+		default:
+			changed = append(changed, f)
+		}
+	}
+	return changed, conflicts
+}
+
+// resolveSyncConflict applies the Conflict strategy, returning whether the local file overwrites
+// the container copy
+func resolveSyncConflict(opts SyncOptions, conflict SyncConflict, out io.Writer) (bool, error) {
+	switch opts.Conflict {
+	case SyncConflictLocalWins:
+		return true, nil
+	case SyncConflictContainerWins:
+		return false, nil
+	case SyncConflictNewerWins:
+		return conflict.File.ModTime.After(conflict.Remote.ModTime), nil
+	default:
+		if opts.Ask == nil {
+			_, _ = fmt.Fprintf(out, "Warning: %s was changed in the container since the last sync, use --conflict to resolve it\n", conflict.File.ContainerPath)
+			return false, nil
+		}
+		return opts.Ask(conflict)
+	}
+}
+
+// syncChecksumBatch is the number of files hashed by a single exec in a container
+const syncChecksumBatch = 200
+
+// containerSyncChecksums hashes the given files in a container, missing files are left out
+func containerSyncChecksums(ctx context.Context, apiClient client.APIClient, containerID string, paths []string) (map[string]SyncRemoteFile, error) {
+	const script = `for f; do if [ -f "$f" ]; then echo "$(sha256sum "$f" | cut -d ' ' -f 1) $(stat -c %Y "$f") $f"; fi; done`
+	remote := map[string]SyncRemoteFile{}
+	for start := 0; start < len(paths); start += syncChecksumBatch {
+		batch := paths[start:min(start+syncChecksumBatch, len(paths))]
+		output, err := execSyncOutput(ctx, apiClient, containerID, append([]string{"sh", "-c", script, "sh"}, batch...))
+		if err != nil {
+			return nil, err
+		}
+		for file, r := range parseSyncChecksums(output) {
+			remote[file] = r
+		}
+	}
+	return remote, nil
+}
+
+// parseSyncChecksums parses the "CHECKSUM MTIME PATH" lines printed in the container
+func parseSyncChecksums(output string) map[string]SyncRemoteFile {
+	remote := map[string]SyncRemoteFile{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		seconds, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		remote[fields[2]] = SyncRemoteFile{Checksum: fields[0], ModTime: time.Unix(seconds, 0)}
+	}
+	return remote
+}
+
+// collectSyncFiles lists the regular files covered by the service develop.watch sync rules,
+// skipping paths matching the ignore patterns
+func collectSyncFiles(service types.ServiceConfig, ignore []string) ([]SyncFile, error) {
+	if service.Develop == nil {
+		return nil, nil
+	}
+	var files []SyncFile
+	for _, trigger := range service.Develop.Watch {
+		if trigger.Action != types.WatchActionSync || trigger.Target == "" {
+			continue
+		}
+		patterns := append(append([]string{}, ignore...), trigger.Ignore...)
+		err := filepath.WalkDir(trigger.Path, func(hostPath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(trigger.Path, hostPath)
+			if err != nil {
+				return err
+			}
+			if rel != "." && syncIgnored(rel, patterns) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files = append(files, SyncFile{
+				HostPath:      hostPath,
+				ContainerPath: path.Join(trigger.Target, filepath.ToSlash(rel)),
+				Size:          info.Size(),
+				ModTime:       info.ModTime(),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files in %s: %v", trigger.Path, err)
+		}
+	}
+	return files, nil
+}
+
+func syncIgnored(rel string, patterns []string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		if matched, _ := path.Match(pattern, rel); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, path.Base(rel)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// syncTempPath returns the hidden sibling a file is uploaded to before being renamed into place
+func syncTempPath(containerPath string) string {
+	return path.Join(path.Dir(containerPath), "."+path.Base(containerPath)+".compose-sync")
+}
+
+func syncFileToContainer(ctx context.Context, apiClient client.APIClient, containerID string, f SyncFile) error {
+	tmp := syncTempPath(f.ContainerPath)
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(writeSyncArchive(writer, f, strings.TrimPrefix(tmp, "/")))
+	}()
+	err := apiClient.CopyToContainer(ctx, containerID, "/", reader, containerType.CopyToContainerOptions{})
+	_ = reader.Close()
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %v", f.HostPath, err)
+	}
+	_, err = execSyncOutput(ctx, apiClient, containerID, []string{"mv", "-f", tmp, f.ContainerPath})
+	return err
+}
+
+func writeSyncArchive(w io.Writer, f SyncFile, name string) error {
+	file, err := os.Open(f.HostPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close() //nolint:errcheck
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(tw, file, header.Size); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// execSyncOutput runs a command in a container and returns its output
+func execSyncOutput(ctx context.Context, apiClient client.APIClient, containerID string, cmd []string) (string, error) {
+	exec, err := apiClient.ContainerExecCreate(ctx, containerID, containerType.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	attach, err := apiClient.ContainerExecAttach(ctx, exec.ID, containerType.ExecAttachOptions{})
+	if err != nil {
+		return "", err
+	}
+	defer attach.Close()
+
+	var output, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&output, &stderr, attach.Reader); err != nil {
+		return "", err
+	}
+	inspect, err := apiClient.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return "", err
+	}
+	if inspect.ExitCode != 0 {
+		return "", fmt.Errorf("%s failed: %s", strings.Join(cmd, " "), strings.TrimSpace(stderr.String()+output.String()))
+	}
+	return output.String(), nil
+}
+
+// syncJournal records the files already transferred by an in-progress sync
+type syncJournal struct {
+	path  string
+	Files map[string]syncJournalEntry `json:"files"`
+}
+
+type syncJournalEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+func syncJournalPath(projectName, service string, replica int) string {
+	return filepath.Join(StateDir("sync"), projectName, fmt.Sprintf("%s-%d.json", service, replica))
+}
+
+func loadSyncJournal(file string) (*syncJournal, error) {
+	journal := &syncJournal{path: file, Files: map[string]syncJournalEntry{}}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return journal, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync journal: %v", err)
+	}
+	if err := json.Unmarshal(data, journal); err != nil {
+		return nil, fmt.Errorf("failed to parse sync journal %s: %v", file, err)
+	}
+	if journal.Files == nil {
+		journal.Files = map[string]syncJournalEntry{}
+	}
+	return journal, nil
+}
+
+// done reports whether the file was transferred by a previous run and has not changed since
+func (j *syncJournal) done(f SyncFile) bool {
+	entry, ok := j.Files[f.ContainerPath]
+	return ok && entry.Size == f.Size && entry.ModTime.Equal(f.ModTime)
+}
+
+func (j *syncJournal) record(f SyncFile) error {
+	j.Files[f.ContainerPath] = syncJournalEntry{Size: f.Size, ModTime: f.ModTime}
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create sync journal directory: %v", err)
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write sync journal: %v", err)
+	}
+	return os.Rename(tmp, j.path)
+}
+
+func (j *syncJournal) remove() error {
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove sync journal: %v", err)
+	}
+	return nil
+}
+
+// syncState is kept across syncs with Checksum: the hashes of the local files, reused while
+// their size and modification time are unchanged, and the content last synced to the containers
+type syncState struct {
+	path  string
+	Files map[string]syncStateEntry `json:"files"`
+}
+
+type syncStateEntry struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Checksum string    `json:"checksum"`
+	Synced   string    `json:"synced,omitempty"`
+}
+
+func syncStatePath(projectName, service string, replica int) string {
+	return filepath.Join(StateDir("sync"), projectName, fmt.Sprintf("%s-%d.state.json", service, replica))
+}
+
+func loadSyncState(file string) (*syncState, error) {
+	state := &syncState{path: file, Files: map[string]syncStateEntry{}}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync state: %v", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse sync state %s: %v", file, err)
+	}
+	if state.Files == nil {
+		state.Files = map[string]syncStateEntry{}
+	}
+	return state, nil
+}
+
+// hash sets the checksum of the files, only reading those whose size or modification time changed
+func (s *syncState) hash(files []SyncFile) error {
+	for i, f := range files {
+		entry := s.Files[f.ContainerPath]
+		if entry.Checksum == "" || entry.Size != f.Size || !entry.ModTime.Equal(f.ModTime) {
+			checksum, err := fileChecksum(f.HostPath)
+			if err != nil {
+				return err
+			}
+			entry.Size, entry.ModTime, entry.Checksum = f.Size, f.ModTime, checksum
+			s.Files[f.ContainerPath] = entry
+		}
+		files[i].Checksum = entry.Checksum
+	}
+	return nil
+}
+
+// synced records the content of the file as the one in the containers
+func (s *syncState) synced(f SyncFile) {
+	entry := s.Files[f.ContainerPath]
+	entry.Synced = f.Checksum
+	s.Files[f.ContainerPath] = entry
+}
+
+func (s *syncState) save() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create sync state directory: %v", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write sync state: %v", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func fileChecksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() //nolint:errcheck
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %v", file, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,197 @@
+/*
+   Copyright 2023 Docker Compose CLI authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package extensions
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/docker/compose/v5/pkg/mocks"
+)
+
+func TestCollectSyncFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "src", "node_modules"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "index.js"), []byte("x"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "debug.log"), []byte("x"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "node_modules", "dep.js"), []byte("x"), 0o644))
+
+	service := types.ServiceConfig{Develop: &types.DevelopConfig{Watch: []types.Trigger{
+		{Path: filepath.Join(dir, "src"), Action: types.WatchActionSync, Target: "/app", Ignore: []string{"node_modules/"}},
+		{Path: filepath.Join(dir, "src"), Action: types.WatchActionRebuild},
+	}}}
+	files, err := collectSyncFiles(service, []string{"*.log"})
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "/app/index.js", files[0].ContainerPath)
+	assert.Equal(t, filepath.Join(dir, "src", "index.js"), files[0].HostPath)
+}
+
+func TestSyncJournal(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	file := syncJournalPath("shop", "web", 1)
+	assert.Equal(t, "/app/.bundle.js.compose-sync", syncTempPath("/app/bundle.js"))
+
+	journal, err := loadSyncJournal(file)
+	require.NoError(t, err)
+	f := SyncFile{HostPath: "bundle.js", ContainerPath: "/app/bundle.js", Size: 42}
+	assert.False(t, journal.done(f))
+	require.NoError(t, journal.record(f))
+
+	// an interrupted sync resumes from the journal, unless the file changed in between
+	journal, err = loadSyncJournal(file)
+	require.NoError(t, err)
+	assert.True(t, journal.done(f))
+	f.Size = 43
+	assert.False(t, journal.done(f))
+
+	require.NoError(t, journal.remove())
+	assert.NoFileExists(t, file)
+	require.NoError(t, journal.remove())
+}
+
+func TestSyncStateHash(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	host := filepath.Join(dir, "index.js")
+	require.NoError(t, os.WriteFile(host, []byte("hello"), 0o644))
+	info, err := os.Stat(host)
+	require.NoError(t, err)
+
+	state, err := loadSyncState(syncStatePath("shop", "web", 1))
+	require.NoError(t, err)
+	files := []SyncFile{{HostPath: host, ContainerPath: "/app/index.js", Size: info.Size(), ModTime: info.ModTime()}}
+	require.NoError(t, state.hash(files))
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", files[0].Checksum)
+	state.synced(files[0])
+	require.NoError(t, state.save())
+
+	// the cached hash is reused while size and modification time are unchanged
+	state, err = loadSyncState(syncStatePath("shop", "web", 1))
+	require.NoError(t, err)
+	entry := state.Files["/app/index.js"]
+	assert.Equal(t, files[0].Checksum, entry.Synced)
+	entry.Checksum = "cached"
+	state.Files["/app/index.js"] = entry
+	require.NoError(t, state.hash(files))
+	assert.Equal(t, "cached", files[0].Checksum)
+
+	files[0].ModTime = files[0].ModTime.Add(time.Second)
+	require.NoError(t, state.hash(files))
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", files[0].Checksum)
+}
+
+func TestPlanSyncChecksums(t *testing.T) {
+	state := &syncState{Files: map[string]syncStateEntry{
+		"/app/a.js": {Synced: "a0"},
+		"/app/b.js": {Synced: "b0"},
+	}}
+	files := []SyncFile{
+		{ContainerPath: "/app/a.js", Checksum: "a1"},
+		{ContainerPath: "/app/b.js", Checksum: "b1"},
+		{ContainerPath: "/app/c.js", Checksum: "c1"},
+		{ContainerPath: "/app/d.js", Checksum: "d1"},
+		{ContainerPath: "/app/e.js", Checksum: "e1"},
+	}
+	remote := parseSyncChecksums("a0 1700000000 /app/a.js\nb2 1700000000 /app/b.js\nd1 1700000000 /app/d.js\ne0 1700000000 /app/e.js\n")
+	assert.Equal(t, SyncRemoteFile{Checksum: "a0", ModTime: time.Unix(1700000000, 0)}, remote["/app/a.js"])
+
+	changed, conflicts := planSyncChecksums(files, remote, state)
+	// a.js changed locally, c.js is missing in the container, e.js was never synced before
+	assert.Equal(t, []string{"/app/a.js", "/app/c.js", "/app/e.js"}, syncContainerPaths(changed))
+	// b.js changed in the container since the last sync
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "/app/b.js", conflicts[0].File.ContainerPath)
+
+	conflict := SyncConflict{File: SyncFile{ModTime: time.Unix(1700000100, 0)}, Remote: SyncRemoteFile{ModTime: time.Unix(1700000000, 0)}}
+	overwrite, err := resolveSyncConflict(SyncOptions{Conflict: SyncConflictNewerWins}, conflict, io.Discard)
+	require.NoError(t, err)
+	assert.True(t, overwrite)
+	overwrite, err = resolveSyncConflict(SyncOptions{Conflict: SyncConflictContainerWins}, conflict, io.Discard)
+	require.NoError(t, err)
+	assert.False(t, overwrite)
+}
+
+func syncContainerPaths(files []SyncFile) []string {
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.ContainerPath)
+	}
+	return paths
+}
+
+func TestSelectSyncReplicas(t *testing.T) {
+	containers := []api.ContainerSummary{
+		{ID: "c2", Name: "shop-web-2", State: "running", Labels: map[string]string{api.ContainerNumberLabel: "2"}},
+		{ID: "c1", Name: "shop-web-1", State: "running", Labels: map[string]string{api.ContainerNumberLabel: "1"}},
+		{ID: "c3", Name: "shop-web-3", State: "exited", Labels: map[string]string{api.ContainerNumberLabel: "3"}},
+	}
+	replicas, err := selectSyncReplicas(containers, "web", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []SyncReplica{{Number: 1, ID: "c1", Name: "shop-web-1"}, {Number: 2, ID: "c2", Name: "shop-web-2"}}, replicas)
+
+	replicas, err = selectSyncReplicas(containers, "web", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []SyncReplica{{Number: 2, ID: "c2", Name: "shop-web-2"}}, replicas)
+
+	_, err = selectSyncReplicas(containers, "web", 3)
+	assert.ErrorContains(t, err, "replica 3 of service web is not running")
+	_, err = selectSyncReplicas(nil, "web", 0)
+	assert.ErrorContains(t, err, "no running container for service web")
+
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockCompose(ctrl)
+	backend.EXPECT().Ps(gomock.Any(), "shop", api.PsOptions{Services: []string{"web"}}).Return(containers, nil)
+	replicas, err = SyncReplicas(context.Background(), backend, "shop", "web", 0)
+	require.NoError(t, err)
+	assert.Len(t, replicas, 2)
+}
+
+func TestReportSyncReplicas(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, reportSyncReplicas(&buf, []syncReplicaResult{
+		{replica: SyncReplica{Number: 1, Name: "shop-web-1"}, synced: 3, done: 3},
+	}, 3))
+	assert.Equal(t, "replica 1 (shop-web-1): synced 3 files\n", buf.String())
+
+	buf.Reset()
+	reset := errors.New("connection reset")
+	err := reportSyncReplicas(&buf, []syncReplicaResult{
+		{replica: SyncReplica{Number: 1, Name: "shop-web-1"}, synced: 3, done: 3},
+		{replica: SyncReplica{Number: 2, Name: "shop-web-2"}, synced: 1, done: 2, err: reset},
+		{replica: SyncReplica{Number: 3}, err: context.Canceled},
+	}, 3)
+	assert.EqualError(t, err, "replica 2 (shop-web-2): sync interrupted after 2 of 3 files: connection reset\n"+
+		"replica 3: sync interrupted after 0 of 3 files: context canceled")
+	assert.ErrorIs(t, err, reset)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "replica 1 (shop-web-1): synced 3 files\n"+
+		"replica 2 (shop-web-2): sync interrupted after 2 of 3 files, run sync again to resume: connection reset\n"+
+		"replica 3: sync interrupted after 0 of 3 files, run sync again to resume: context canceled\n", buf.String())
+}